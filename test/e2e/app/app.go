@@ -10,10 +10,13 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	mrand "math/rand"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cometbft/cometbft/abci/example/kvstore"
@@ -49,6 +52,9 @@ type Application struct {
 	cfg             *Config
 	restoreSnapshot *abci.Snapshot
 	restoreChunks   [][]byte
+
+	jitterMtx sync.Mutex
+	jitter    *mrand.Rand
 }
 
 // Config allows for the setting of high level parameters for running the e2e Application
@@ -61,9 +67,18 @@ type Config struct {
 	// will take state sync snapshots. Defaults to 0 (disabled).
 	SnapshotInterval uint64 `toml:"snapshot_interval"`
 
+	// SnapshotFormat specifies the format advertised for state sync
+	// snapshots. Only snapshots of this format are accepted when restoring.
+	// Defaults to 1.
+	SnapshotFormat uint32 `toml:"snapshot_format"`
+
+	// SnapshotChunkSize specifies the size in bytes of state sync snapshot
+	// chunks. Defaults to 1MB.
+	SnapshotChunkSize uint64 `toml:"snapshot_chunk_size"`
+
 	// RetainBlocks specifies the number of recent blocks to retain. Defaults to
 	// 0, which retains all blocks. Must be greater that PersistInterval,
-	// SnapshotInterval and EvidenceAgeHeight.
+	// SnapshotInterval and the evidence max age.
 	RetainBlocks uint64 `toml:"retain_blocks"`
 
 	// KeyType sets the curve that will be used by validators.
@@ -91,6 +106,12 @@ type Config struct {
 	// height <-> pubkey <-> voting power
 	ValidatorUpdates map[string]map[string]uint8 `toml:"validator_update"`
 
+	// ValidatorKeyTypes maps the pubkeys of validators in ValidatorUpdates to
+	// their key type, for validators that do not use KeyType.
+	//
+	// pubkey <-> key type
+	ValidatorKeyTypes map[string]string `toml:"validator_key_types"`
+
 	// Add artificial delays to each of the main ABCI calls to mimic computation time
 	// of the application
 	PrepareProposalDelay time.Duration `toml:"prepare_proposal_delay"`
@@ -99,8 +120,62 @@ type Config struct {
 	FinalizeBlockDelay   time.Duration `toml:"finalize_block_delay"`
 	VoteExtensionDelay   time.Duration `toml:"vote_extension_delay"`
 
+	// PrepareProposalJitter and ProcessProposalJitter add a uniformly random
+	// delay of up to the given duration to each respective call, on top of
+	// the delays above. The random delays are drawn from JitterSeed, so that
+	// a node's delays are reproducible.
+	PrepareProposalJitter time.Duration `toml:"prepare_proposal_jitter"`
+	ProcessProposalJitter time.Duration `toml:"process_proposal_jitter"`
+	JitterSeed            int64         `toml:"jitter_seed"`
+
 	// Vote extension padding size, to simulate different vote extension sizes.
 	VoteExtensionSize uint `toml:"vote_extension_size"`
+
+	// AppConfig holds feature toggles, see AppConfigToggles. Toggles not set
+	// take their default, the first of their values.
+	AppConfig map[string]string `toml:"app_config"`
+}
+
+// The feature toggles of the application's AppConfig.
+const (
+	// AppConfigVoteExtensions chooses whether a validator "produce"s vote
+	// extensions, or "omit"s them, i.e. extends its votes with empty ones.
+	AppConfigVoteExtensions = "vote_extensions"
+	// AppConfigEmptyVoteExtensions chooses whether the application "reject"s
+	// empty vote extensions of other validators, or "accept"s them, counting
+	// them as 0 in the extension sum. Proposals carry the extensions of the
+	// last commit, so all nodes must agree on this toggle.
+	AppConfigEmptyVoteExtensions = "empty_vote_extensions"
+)
+
+// AppConfigToggles lists the values of each feature toggle of AppConfig, of
+// which the first is the default.
+var AppConfigToggles = map[string][]string{
+	AppConfigVoteExtensions:      {"produce", "omit"},
+	AppConfigEmptyVoteExtensions: {"reject", "accept"},
+}
+
+// ValidateAppConfig checks that an AppConfig only sets known toggles to known
+// values.
+func ValidateAppConfig(appConfig map[string]string) error {
+	for toggle, value := range appConfig {
+		values, ok := AppConfigToggles[toggle]
+		if !ok {
+			return fmt.Errorf("unknown app_config toggle %q", toggle)
+		}
+		if !slices.Contains(values, value) {
+			return fmt.Errorf("invalid value %q of app_config toggle %q, must be one of %v", value, toggle, values)
+		}
+	}
+	return nil
+}
+
+// toggle returns the value of a feature toggle of the configuration.
+func (cfg *Config) toggle(name string) string {
+	if value, ok := cfg.AppConfig[name]; ok {
+		return value
+	}
+	return AppConfigToggles[name][0]
 }
 
 func DefaultConfig(dir string) *Config {
@@ -113,11 +188,21 @@ func DefaultConfig(dir string) *Config {
 
 // NewApplication creates the application.
 func NewApplication(cfg *Config) (*Application, error) {
+	if err := ValidateAppConfig(cfg.AppConfig); err != nil {
+		return nil, err
+	}
 	state, err := NewState(cfg.Dir, cfg.PersistInterval)
 	if err != nil {
 		return nil, err
 	}
-	snapshots, err := NewSnapshotStore(filepath.Join(cfg.Dir, "snapshots"))
+	format, chunkSize := cfg.SnapshotFormat, cfg.SnapshotChunkSize
+	if format == 0 {
+		format = defaultSnapshotFormat
+	}
+	if chunkSize == 0 {
+		chunkSize = defaultSnapshotChunkSize
+	}
+	snapshots, err := NewSnapshotStore(filepath.Join(cfg.Dir, "snapshots"), format, chunkSize)
 	if err != nil {
 		return nil, err
 	}
@@ -126,6 +211,7 @@ func NewApplication(cfg *Config) (*Application, error) {
 		state:     state,
 		snapshots: snapshots,
 		cfg:       cfg,
+		jitter:    mrand.New(mrand.NewSource(cfg.JitterSeed)), //nolint:gosec
 	}, nil
 }
 
@@ -298,6 +384,9 @@ func (app *Application) OfferSnapshot(_ context.Context, req *abci.RequestOfferS
 	if app.restoreSnapshot != nil {
 		panic("A snapshot is already being restored")
 	}
+	if req.Snapshot.Format != app.snapshots.format {
+		return &abci.ResponseOfferSnapshot{Result: abci.ResponseOfferSnapshot_REJECT_FORMAT}, nil
+	}
 	app.restoreSnapshot = req.Snapshot
 	app.restoreChunks = [][]byte{}
 	return &abci.ResponseOfferSnapshot{Result: abci.ResponseOfferSnapshot_ACCEPT}, nil
@@ -393,9 +482,7 @@ func (app *Application) PrepareProposal(
 		txs = append(txs, tx)
 	}
 
-	if app.cfg.PrepareProposalDelay != 0 {
-		time.Sleep(app.cfg.PrepareProposalDelay)
-	}
+	app.sleep(app.cfg.PrepareProposalDelay, app.cfg.PrepareProposalJitter)
 
 	return &abci.ResponsePrepareProposal{Txs: txs}, nil
 }
@@ -426,9 +513,7 @@ func (app *Application) ProcessProposal(_ context.Context, req *abci.RequestProc
 		}
 	}
 
-	if app.cfg.ProcessProposalDelay != 0 {
-		time.Sleep(app.cfg.ProcessProposalDelay)
-	}
+	app.sleep(app.cfg.ProcessProposalDelay, app.cfg.ProcessProposalJitter)
 
 	return &abci.ResponseProcessProposal{Status: abci.ResponseProcessProposal_ACCEPT}, nil
 }
@@ -452,6 +537,10 @@ func (app *Application) ExtendVote(_ context.Context, req *abci.RequestExtendVot
 
 	var ext []byte
 	var extLen int
+	if app.cfg.toggle(AppConfigVoteExtensions) == "omit" {
+		app.logger.Info("omitting vote extension", "height", appHeight)
+		return &abci.ResponseExtendVote{}, nil
+	}
 	if app.cfg.VoteExtensionSize != 0 {
 		ext = make([]byte, app.cfg.VoteExtensionSize)
 		if _, err := rand.Read(ext); err != nil {
@@ -481,7 +570,13 @@ func (app *Application) VerifyVoteExtension(_ context.Context, req *abci.Request
 	if !areExtensionsEnabled {
 		panic(fmt.Errorf("received call to VerifyVoteExtension at height %d, when vote extensions are disabled", appHeight))
 	}
-	// We don't allow vote extensions to be optional
+	// We don't allow vote extensions to be optional, unless configured to
+	if len(req.VoteExtension) == 0 && app.cfg.toggle(AppConfigEmptyVoteExtensions) == "accept" {
+		app.logger.Info("accepted empty vote extension", "height", req.Height)
+		return &abci.ResponseVerifyVoteExtension{
+			Status: abci.ResponseVerifyVoteExtension_ACCEPT,
+		}, nil
+	}
 	if len(req.VoteExtension) == 0 {
 		app.logger.Error("received empty vote extension")
 		return &abci.ResponseVerifyVoteExtension{
@@ -585,7 +680,11 @@ func (app *Application) validatorUpdates(height uint64) (abci.ValidatorUpdates,
 		if err != nil {
 			return nil, fmt.Errorf("invalid base64 pubkey value %q: %w", keyString, err)
 		}
-		valUpdate := abci.UpdateValidator(keyBytes, int64(power), app.cfg.KeyType)
+		keyType := app.cfg.KeyType
+		if t, ok := app.cfg.ValidatorKeyTypes[keyString]; ok {
+			keyType = t
+		}
+		valUpdate := abci.UpdateValidator(keyBytes, int64(power), keyType)
 		valUpdates = append(valUpdates, valUpdate)
 		if err := app.storeValidator(&valUpdate); err != nil {
 			return nil, err
@@ -641,6 +740,10 @@ func (app *Application) verifyAndSum(
 			}
 			continue
 		}
+		if len(vote.VoteExtension) == 0 && app.cfg.toggle(AppConfigEmptyVoteExtensions) == "accept" {
+			extCount++
+			continue
+		}
 		if len(vote.VoteExtension) == 0 {
 			return 0, fmt.Errorf("received empty vote extension from %X at height %d (extensions enabled); "+
 				"e2e app's logic does not allow it", vote.Validator, currentHeight)
@@ -773,3 +876,15 @@ func parseVoteExtension(cfg *Config, ext []byte) (int64, error) {
 	}
 	return int64(len(ext)), nil
 }
+
+// sleep sleeps for the given delay, plus a random duration of up to jitter.
+func (app *Application) sleep(delay, jitter time.Duration) {
+	if jitter > 0 {
+		app.jitterMtx.Lock()
+		delay += time.Duration(app.jitter.Int63n(int64(jitter) + 1))
+		app.jitterMtx.Unlock()
+	}
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
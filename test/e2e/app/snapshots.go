@@ -13,7 +13,8 @@ import (
 )
 
 const (
-	snapshotChunkSize = 1e6
+	defaultSnapshotFormat    = 1
+	defaultSnapshotChunkSize = 1e6
 
 	// Keep only the most recent 10 snapshots. Older snapshots are pruned
 	maxSnapshotCount = 10
@@ -24,13 +25,16 @@ const (
 // into fixed-size chunks.
 type SnapshotStore struct {
 	sync.RWMutex
-	dir      string
-	metadata []abci.Snapshot
+	dir       string
+	format    uint32
+	chunkSize uint64
+	metadata  []abci.Snapshot
 }
 
-// NewSnapshotStore creates a new snapshot store.
-func NewSnapshotStore(dir string) (*SnapshotStore, error) {
-	store := &SnapshotStore{dir: dir}
+// NewSnapshotStore creates a new snapshot store, which advertises snapshots
+// with the given format and splits them into chunks of the given size.
+func NewSnapshotStore(dir string, format uint32, chunkSize uint64) (*SnapshotStore, error) {
+	store := &SnapshotStore{dir: dir, format: format, chunkSize: chunkSize}
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return nil, err
 	}
@@ -90,9 +94,9 @@ func (s *SnapshotStore) Create(state *State) (abci.Snapshot, error) {
 	}
 	snapshot := abci.Snapshot{
 		Height: height,
-		Format: 1,
+		Format: s.format,
 		Hash:   stateHash,
-		Chunks: byteChunks(bz),
+		Chunks: byteChunks(bz, s.chunkSize),
 	}
 	err = os.WriteFile(filepath.Join(s.dir, fmt.Sprintf("%v.json", height)), bz, 0o644) //nolint:gosec
 	if err != nil {
@@ -148,16 +152,16 @@ func (s *SnapshotStore) LoadChunk(height uint64, format uint32, chunk uint32) ([
 			if err != nil {
 				return nil, err
 			}
-			return byteChunk(bz, chunk), nil
+			return byteChunk(bz, chunk, s.chunkSize), nil
 		}
 	}
 	return nil, nil
 }
 
 // byteChunk returns the chunk at a given index from the full byte slice.
-func byteChunk(bz []byte, index uint32) []byte {
-	start := int(index * snapshotChunkSize)
-	end := int((index + 1) * snapshotChunkSize)
+func byteChunk(bz []byte, index uint32, chunkSize uint64) []byte {
+	start := int(uint64(index) * chunkSize)
+	end := int(uint64(index+1) * chunkSize)
 	switch {
 	case start >= len(bz):
 		return nil
@@ -169,6 +173,6 @@ func byteChunk(bz []byte, index uint32) []byte {
 }
 
 // byteChunks calculates the number of chunks in the byte slice.
-func byteChunks(bz []byte) uint32 {
-	return uint32(math.Ceil(float64(len(bz)) / snapshotChunkSize))
+func byteChunks(bz []byte, chunkSize uint64) uint32 {
+	return uint32(math.Ceil(float64(len(bz)) / float64(chunkSize)))
 }
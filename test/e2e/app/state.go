@@ -242,6 +242,12 @@ func (s *State) MarshalJSON() ([]byte, error) {
 	return json.Marshal(ss)
 }
 
+// InitChainAppHash returns the app hash the application responds with to
+// InitChain, given the initial state from the genesis app_state.
+func InitChainAppHash(initialState map[string]string) []byte {
+	return hashItems(initialState, 0)
+}
+
 // hashItems hashes a set of key/value items.
 func hashItems(items map[string]string, height uint64) []byte {
 	keys := make([]string, 0, len(items))
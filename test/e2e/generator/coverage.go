@@ -0,0 +1,624 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/cometbft/cometbft/test/e2e/app"
+	e2e "github.com/cometbft/cometbft/test/e2e/pkg"
+)
+
+// coverageChoice describes a random choice made by the generator, and how to
+// find the value that was picked for it in a generated manifest. Choices are
+// made per testnet, per node, or per light node.
+type coverageChoice struct {
+	name    string
+	values  func() []interface{}
+	testnet func(m e2e.Manifest) []string
+	node    func(node *e2e.ManifestNode) []string
+	light   func(node *e2e.ManifestNode) []string
+}
+
+// coverageChoices lists the choices tracked by the coverage report. Values are
+// looked up lazily, since some choices (e.g. versions) are set up by Generate.
+// Every package-level choice of the generator must be listed here, which
+// TestCoverageChoices enforces.
+var coverageChoices = []coverageChoice{
+	{
+		name:    "quad_topology",
+		values:  func() []interface{} { return quadTopologies.keys() },
+		testnet: func(m e2e.Manifest) []string { return quadTopology(m) },
+	},
+	{
+		name:   "large_initial_state",
+		values: func() []interface{} { return largeInitialStates.keys() },
+		testnet: func(m e2e.Manifest) []string {
+			if len(m.InitialState) == 0 {
+				return nil
+			}
+			return []string{fmt.Sprint(len(m.InitialState) == 500)}
+		},
+	},
+	{
+		name:   "ip_stack",
+		values: func() []interface{} { return ipStacks },
+		testnet: func(m e2e.Manifest) []string {
+			switch {
+			case m.DualStack():
+				return []string{"dual"}
+			case m.IPv6:
+				return []string{"ipv6"}
+			default:
+				return []string{"ipv4"}
+			}
+		},
+	},
+	{
+		name:    "abci_protocol",
+		values:  func() []interface{} { return nodeABCIProtocols },
+		testnet: func(m e2e.Manifest) []string { return []string{m.ABCIProtocol} },
+	},
+	{
+		name:    "evidence",
+		values:  func() []interface{} { return evidence },
+		testnet: func(m e2e.Manifest) []string { return []string{fmt.Sprint(m.Evidence)} },
+	},
+	{
+		name:   "abci_delays",
+		values: func() []interface{} { return abciDelays },
+		testnet: func(m e2e.Manifest) []string {
+			delays := abciDelaySet{
+				prepareProposal: m.PrepareProposalDelay,
+				processProposal: m.ProcessProposalDelay,
+				checkTx:         m.CheckTxDelay,
+				voteExtension:   m.VoteExtensionDelay,
+				finalizeBlock:   m.FinalizeBlockDelay,
+
+				prepareProposalJitter: m.PrepareProposalJitter,
+				processProposalJitter: m.ProcessProposalJitter,
+			}
+			for name, preset := range abciDelayPresets {
+				if preset == delays {
+					return []string{name}
+				}
+			}
+			return nil
+		},
+	},
+	{
+		name:   "vote_extension_enabled",
+		values: func() []interface{} { return voteExtensionEnabled },
+		testnet: func(m e2e.Manifest) []string {
+			return []string{fmt.Sprint(m.VoteExtensionsEnableHeight != 0)}
+		},
+	},
+	{
+		name:   "vote_extension_enable_height_offset",
+		values: func() []interface{} { return voteExtensionEnableHeightOffset },
+		testnet: func(m e2e.Manifest) []string {
+			if m.VoteExtensionsEnableHeight == 0 {
+				return nil
+			}
+			return []string{fmt.Sprint(m.VoteExtensionsEnableHeight - m.InitialHeight)}
+		},
+	},
+	{
+		name:   "load_profile",
+		values: func() []interface{} { return loadProfiles },
+		testnet: func(m e2e.Manifest) []string {
+			if m.LoadProfile == nil {
+				return nil
+			}
+			return []string{m.LoadProfile.Name}
+		},
+	},
+	{
+		name:   "block_max_bytes",
+		values: func() []interface{} { return blockMaxBytes.keys() },
+		testnet: func(m e2e.Manifest) []string {
+			for _, name := range nodeNamesByMode(m, e2e.ModeValidator) {
+				return []string{fmt.Sprint(m.Nodes[name].MaxBlockBytes)}
+			}
+			return nil
+		},
+	},
+	{
+		name:    "block_max_gas",
+		values:  func() []interface{} { return blockMaxGas.keys() },
+		testnet: func(m e2e.Manifest) []string { return []string{fmt.Sprint(m.MaxGas)} },
+	},
+	{
+		name:   "evidence_max_age",
+		values: func() []interface{} { return evidenceMaxAges },
+		testnet: func(m e2e.Manifest) []string {
+			return []string{fmt.Sprint(m.ConsensusParams.EvidenceMaxAgeNumBlocks)}
+		},
+	},
+	{
+		name:   "mixed_vote_extensions",
+		values: func() []interface{} { return mixedVoteExtensions.keys() },
+		testnet: func(m e2e.Manifest) []string {
+			if !appConfigApplicable(m) {
+				return nil
+			}
+			for _, node := range m.Nodes {
+				if node.AppConfig[app.AppConfigVoteExtensions] == "omit" {
+					return []string{"true"}
+				}
+			}
+			return []string{"false"}
+		},
+	},
+	{
+		name:    "validator_churn",
+		values:  func() []interface{} { return validatorChurnActions },
+		testnet: func(m e2e.Manifest) []string { return validatorPowerChanges(m) },
+	},
+	{
+		name:    "vote_extension_size",
+		values:  func() []interface{} { return voteExtensionSize },
+		testnet: func(m e2e.Manifest) []string { return []string{fmt.Sprint(m.VoteExtensionSize)} },
+	},
+	{
+		name:   "version",
+		values: func() []interface{} { return nodeVersions.keys() },
+		node:   func(n *e2e.ManifestNode) []string { return []string{n.Version} },
+	},
+	{
+		name:   "database",
+		values: func() []interface{} { return nodeDatabases.keys() },
+		node:   func(n *e2e.ManifestNode) []string { return []string{n.Database} },
+	},
+	{
+		name:   "privval_protocol",
+		values: func() []interface{} { return nodePrivvalProtocols },
+		node:   func(n *e2e.ManifestNode) []string { return []string{n.PrivvalProtocol} },
+	},
+	{
+		name:   "key_type",
+		values: func() []interface{} { return nodeKeyTypes },
+		node: func(n *e2e.ManifestNode) []string {
+			if n.KeyType == "" {
+				return nil
+			}
+			return []string{n.KeyType}
+		},
+	},
+	{
+		name:   "block_sync_version",
+		values: func() []interface{} { return nodeBlockSyncs },
+		node:   func(n *e2e.ManifestNode) []string { return []string{n.BlockSyncVersion} },
+	},
+	{
+		name:   "state_sync",
+		values: func() []interface{} { return nodeStateSyncs },
+		node:   func(n *e2e.ManifestNode) []string { return []string{fmt.Sprint(n.StateSync)} },
+	},
+	{
+		name:   "persist_interval",
+		values: func() []interface{} { return nodePersistIntervals },
+		node: func(n *e2e.ManifestNode) []string {
+			if n.PersistInterval == nil {
+				return nil
+			}
+			return []string{fmt.Sprint(*n.PersistInterval)}
+		},
+	},
+	{
+		name:   "snapshot_interval",
+		values: func() []interface{} { return nodeSnapshotIntervals },
+		node:   func(n *e2e.ManifestNode) []string { return []string{fmt.Sprint(n.SnapshotInterval)} },
+	},
+	{
+		name:   "snapshot_format",
+		values: func() []interface{} { return nodeSnapshotFormats },
+		node: func(n *e2e.ManifestNode) []string {
+			if !choosesLocalNodeSettings(n) {
+				return nil
+			}
+			if n.SnapshotFormat == 0 {
+				return []string{"1"}
+			}
+			return []string{fmt.Sprint(n.SnapshotFormat)}
+		},
+	},
+	{
+		name:   "snapshot_chunk_size",
+		values: func() []interface{} { return nodeSnapshotChunkSizes },
+		node: func(n *e2e.ManifestNode) []string {
+			if !choosesLocalNodeSettings(n) {
+				return nil
+			}
+			return []string{fmt.Sprint(n.SnapshotChunkSize)}
+		},
+	},
+	{
+		name:   "timeouts",
+		values: func() []interface{} { return nodeTimeouts },
+		node: func(n *e2e.ManifestNode) []string {
+			if !choosesLocalNodeSettings(n) {
+				return nil
+			}
+			return []string{consensusTimeouts{propose: n.TimeoutPropose, commit: n.TimeoutCommit}.String()}
+		},
+	},
+	{
+		name:   "retain_blocks",
+		values: func() []interface{} { return nodeRetainBlocks },
+		node:   func(n *e2e.ManifestNode) []string { return []string{fmt.Sprint(n.RetainBlocks)} },
+	},
+	{
+		name:   "perturb",
+		values: func() []interface{} { return nodePerturbations.keys() },
+		node:   func(n *e2e.ManifestNode) []string { return n.Perturb },
+	},
+	{
+		name:   "mempool_cache_size",
+		values: func() []interface{} { return nodeMempoolCacheSizes },
+		node: func(n *e2e.ManifestNode) []string {
+			if n.MempoolCacheSize == nil {
+				return nil
+			}
+			return []string{fmt.Sprint(*n.MempoolCacheSize)}
+		},
+	},
+	{
+		name:   "mempool_recheck",
+		values: func() []interface{} { return nodeMempoolRechecks.keys() },
+		node: func(n *e2e.ManifestNode) []string {
+			if n.MempoolRecheck == nil {
+				return nil
+			}
+			return []string{fmt.Sprint(*n.MempoolRecheck)}
+		},
+	},
+	{
+		name:   "peer_limits",
+		values: func() []interface{} { return nodePeerLimits },
+		node: func(n *e2e.ManifestNode) []string {
+			if mode := nodeMode(n); mode != e2e.ModeValidator && mode != e2e.ModeFull {
+				return nil
+			}
+			return []string{peerLimits{inbound: n.MaxInboundPeers, outbound: n.MaxOutboundPeers}.String()}
+		},
+	},
+	{
+		name:   "wal_enabled",
+		values: func() []interface{} { return nodeWALEnabled.keys() },
+		node: func(n *e2e.ManifestNode) []string {
+			if n.WALEnabled == nil {
+				return nil
+			}
+			return []string{fmt.Sprint(*n.WALEnabled)}
+		},
+	},
+	{
+		name:   "rpc_unsafe",
+		values: func() []interface{} { return nodeRPCUnsafe.keys() },
+		node: func(n *e2e.ManifestNode) []string {
+			if nodeMode(n) != e2e.ModeValidator && nodeMode(n) != e2e.ModeFull {
+				return nil
+			}
+			return []string{fmt.Sprint(n.RPCConfig.Unsafe)}
+		},
+	},
+	{
+		name:   "rpc_max_subscriptions_per_client",
+		values: func() []interface{} { return nodeRPCMaxSubscriptions.keys() },
+		node: func(n *e2e.ManifestNode) []string {
+			if n.RPCConfig.MaxSubscriptionsPerClient == nil {
+				return nil
+			}
+			return []string{fmt.Sprint(*n.RPCConfig.MaxSubscriptionsPerClient)}
+		},
+	},
+	{
+		name:   "degraded_link_delay",
+		values: func() []interface{} { return degradedLinkDelays },
+		testnet: func(m e2e.Manifest) []string {
+			values := []string{}
+			for _, link := range m.LinkLatencies {
+				values = append(values, fmt.Sprint(link.Delay))
+			}
+			return values
+		},
+	},
+	{
+		name:   "degraded_link_loss",
+		values: func() []interface{} { return degradedLinkLosses.keys() },
+		testnet: func(m e2e.Manifest) []string {
+			values := []string{}
+			for _, link := range m.LinkLatencies {
+				values = append(values, fmt.Sprint(link.Loss))
+			}
+			return values
+		},
+	},
+	{
+		name:   "throttled_gossip_rate",
+		values: func() []interface{} { return throttledGossipRates },
+		testnet: func(m e2e.Manifest) []string {
+			if !m.ThrottledGossip {
+				return nil
+			}
+			for _, name := range sortedNodeNames(m) {
+				if node := m.Nodes[name]; nodeMode(node) != e2e.ModeLight {
+					return []string{fmt.Sprint(node.SendRate)}
+				}
+			}
+			return nil
+		},
+	},
+	{
+		name:   "load_weight",
+		values: func() []interface{} { return nodeLoadWeights.keys() },
+		node: func(n *e2e.ManifestNode) []string {
+			if nodeMode(n) != e2e.ModeValidator && nodeMode(n) != e2e.ModeFull || n.SendNoLoad {
+				return nil
+			}
+			return []string{fmt.Sprint(n.LoadWeight)}
+		},
+	},
+	{
+		name:   "startup_backoff",
+		values: func() []interface{} { return nodeStartupBackoffs.keys() },
+		node: func(n *e2e.ManifestNode) []string {
+			if nodeMode(n) != e2e.ModeValidator && nodeMode(n) != e2e.ModeFull {
+				return nil
+			}
+			return []string{fmt.Sprint(n.StartupBackoff)}
+		},
+	},
+	{
+		name:   "max_dial_retries",
+		values: func() []interface{} { return nodeMaxDialRetries.keys() },
+		node: func(n *e2e.ManifestNode) []string {
+			if n.StartupBackoff == 0 {
+				return nil
+			}
+			return []string{fmt.Sprint(n.MaxDialRetries)}
+		},
+	},
+	{
+		name:   "mempool_caches_disabled",
+		values: func() []interface{} { return mempoolCachesDisabled.keys() },
+		testnet: func(m e2e.Manifest) []string {
+			if len(mempoolNodeNames(m)) < 4 {
+				return nil
+			}
+			for _, name := range mempoolNodeNames(m) {
+				if size := m.Nodes[name].MempoolCacheSize; size != nil && *size == 0 {
+					return []string{"true"}
+				}
+			}
+			return []string{"false"}
+		},
+	},
+	{
+		name:   "forced_perturbation",
+		values: func() []interface{} { return forcedPerturbations },
+		node: func(n *e2e.ManifestNode) []string {
+			return slices.DeleteFunc(slices.Clone(n.Perturb), func(p string) bool {
+				return !slices.Contains(forcedPerturbations, interface{}(p))
+			})
+		},
+	},
+	{
+		name:   "recovery_mode",
+		values: func() []interface{} { return nodeRecoveryModes },
+		node: func(n *e2e.ManifestNode) []string {
+			if n.RecoveryMode == "" {
+				return nil
+			}
+			return []string{n.RecoveryMode}
+		},
+	},
+	{
+		name:   "disk_bandwidth",
+		values: func() []interface{} { return nodeDiskBandwidths },
+		node: func(n *e2e.ManifestNode) []string {
+			if n.DiskBandwidth == 0 {
+				return nil
+			}
+			return []string{fmt.Sprint(n.DiskBandwidth)}
+		},
+	},
+	{
+		name:   "gossip_rate",
+		values: func() []interface{} { return nodeGossipRates.keys() },
+		node: func(n *e2e.ManifestNode) []string {
+			if nodeMode(n) != e2e.ModeValidator && nodeMode(n) != e2e.ModeFull {
+				return nil
+			}
+			return []string{fmt.Sprint(n.SendRate), fmt.Sprint(n.RecvRate)}
+		},
+	},
+	{
+		name:   "misbehavior",
+		values: func() []interface{} { return nodeMisbehaviors },
+		node: func(n *e2e.ManifestNode) []string {
+			misbehaviors := make([]string, 0, len(n.Misbehaviors))
+			for _, misbehavior := range n.Misbehaviors {
+				misbehaviors = append(misbehaviors, misbehavior)
+			}
+			return misbehaviors
+		},
+	},
+	{
+		name:   "debug_endpoints",
+		values: func() []interface{} { return nodeDebugEndpoints.keys() },
+		node: func(n *e2e.ManifestNode) []string {
+			var endpoints []string
+			if n.EnablePrometheus {
+				endpoints = append(endpoints, "prometheus")
+			}
+			if n.EnablePprof {
+				endpoints = append(endpoints, "pprof")
+			}
+			return endpoints
+		},
+	},
+	{
+		name:   "address_family",
+		values: func() []interface{} { return nodeAddressFamilies },
+		node: func(n *e2e.ManifestNode) []string {
+			if n.AddressFamily == "" {
+				return nil
+			}
+			return []string{n.AddressFamily}
+		},
+	},
+	{
+		name:   "zone",
+		values: func() []interface{} { return nodeZones },
+		node:   func(n *e2e.ManifestNode) []string { return []string{n.Zone} },
+	},
+	{
+		name:   "behind_nat",
+		values: func() []interface{} { return nodeNATs.keys() },
+		node: func(n *e2e.ManifestNode) []string {
+			if !choosesLocalNodeSettings(n) {
+				return nil
+			}
+			return []string{fmt.Sprint(n.BehindNAT)}
+		},
+	},
+	{
+		name:   "clock_skew",
+		values: func() []interface{} { return nodeClockSkews },
+		node: func(n *e2e.ManifestNode) []string {
+			if n.Mode == string(e2e.ModeSeed) {
+				return nil
+			}
+			return []string{fmt.Sprint(n.ClockSkew)}
+		},
+	},
+	{
+		name:   "light_perturb",
+		values: func() []interface{} { return lightNodePerturbations.keys() },
+		light:  func(n *e2e.ManifestNode) []string { return n.Perturb },
+	},
+	{
+		name:   "light_trust_period",
+		values: func() []interface{} { return lightNodeTrustPeriods },
+		light:  func(n *e2e.ManifestNode) []string { return []string{fmt.Sprint(n.TrustPeriod)} },
+	},
+}
+
+// choosesLocalNodeSettings returns whether the generator picks the settings
+// that only validators and full nodes running the local version support, such
+// as snapshot formats and consensus timeouts.
+func choosesLocalNodeSettings(n *e2e.ManifestNode) bool {
+	return n.Version == "" && (n.Mode == string(e2e.ModeValidator) || n.Mode == string(e2e.ModeFull))
+}
+
+// quadTopology returns the wiring of a "quad" testnet's validators, see
+// quadTopologies, or nil for other topologies. Ring, star and bridge testnets
+// are recognized by their peers, and other testnets by having exactly four
+// validators and no other nodes, which a "large" testnet of minimal size also
+// has.
+func quadTopology(m e2e.Manifest) []string {
+	validators := nodeNamesByMode(m, e2e.ModeValidator)
+	switch {
+	case len(m.BridgeNodes) > 0:
+		return []string{"bridge"}
+	case len(validators) < 4:
+		return nil
+	}
+	ring, star := true, true
+	for i, name := range validators {
+		peers := m.Nodes[name].PersistentPeers
+		prev := validators[(i+len(validators)-1)%len(validators)]
+		next := validators[(i+1)%len(validators)]
+		ring = ring && len(peers) == 2 && slices.Contains(peers, prev) && slices.Contains(peers, next)
+		star = star && slices.Equal(peers, []string{"full01"})
+	}
+	switch {
+	case ring:
+		return []string{"ring"}
+	case star:
+		return []string{"star"}
+	case len(validators) == 4 && len(m.Nodes) == 4:
+		return []string{"quad"}
+	default:
+		return nil
+	}
+}
+
+// CoverageReport tallies, across a set of generated manifests, how many times
+// each value of the generator's random choices was picked. Testnet-wide
+// choices are counted once per testnet, node choices once per node. Light
+// nodes are only counted for the choices specific to light clients, since most
+// other choices do not apply to them.
+type CoverageReport struct {
+	// Counts maps each choice name to the number of times each value was seen.
+	Counts map[string]map[string]int
+	// Unchosen maps each choice name to the values that were never seen.
+	Unchosen map[string][]string
+}
+
+// NewCoverageReport computes a coverage report from the given manifests.
+func NewCoverageReport(manifests []e2e.Manifest) *CoverageReport {
+	report := &CoverageReport{
+		Counts:   map[string]map[string]int{},
+		Unchosen: map[string][]string{},
+	}
+	for _, choice := range coverageChoices {
+		counts := map[string]int{}
+		for _, m := range manifests {
+			if choice.testnet != nil {
+				for _, v := range choice.testnet(m) {
+					counts[v]++
+				}
+			}
+			for _, node := range m.Nodes {
+				switch {
+				case node.Mode == string(e2e.ModeLight) && choice.light != nil:
+					for _, v := range choice.light(node) {
+						counts[v]++
+					}
+				case node.Mode != string(e2e.ModeLight) && choice.node != nil:
+					for _, v := range choice.node(node) {
+						counts[v]++
+					}
+				}
+			}
+		}
+		report.Counts[choice.name] = counts
+		for _, v := range choice.values() {
+			if counts[fmt.Sprint(v)] == 0 {
+				report.Unchosen[choice.name] = append(report.Unchosen[choice.name], fmt.Sprint(v))
+			}
+		}
+	}
+	return report
+}
+
+// String formats the report as a human-readable summary.
+func (r *CoverageReport) String() string {
+	var sb strings.Builder
+	sb.WriteString("Choice coverage:\n")
+	for _, choice := range coverageChoices {
+		counts := r.Counts[choice.name]
+		values := make([]string, 0, len(counts))
+		for v := range counts {
+			values = append(values, v)
+		}
+		sort.Strings(values)
+		fmt.Fprintf(&sb, "- %s:", choice.name)
+		for _, v := range values {
+			if v == "" {
+				fmt.Fprintf(&sb, " %q=%d", v, counts[v])
+			} else {
+				fmt.Fprintf(&sb, " %s=%d", v, counts[v])
+			}
+		}
+		if unchosen := r.Unchosen[choice.name]; len(unchosen) > 0 {
+			fmt.Fprintf(&sb, " (never chosen: %s)", strings.Join(unchosen, ", "))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
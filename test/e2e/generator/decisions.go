@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/cometbft/cometbft/libs/log"
+	e2e "github.com/cometbft/cometbft/test/e2e/pkg"
+)
+
+// logNodeChoices logs a record for every node of a generated testnet, with the
+// values chosen for all of its manifest fields, the seed and the options of
+// the testnet, so that the generator's decisions can be audited.
+func logNodeChoices(logger log.Logger, seed int64, testnet int, opt map[string]interface{}, manifest e2e.Manifest) {
+	for _, name := range sortedNodeNames(manifest) {
+		logger.Info("generated node",
+			"seed", seed,
+			"testnet", testnet,
+			"options", opt,
+			"abci_protocol", manifest.ABCIProtocol,
+			"node", name,
+			"choices", nodeChoices(manifest.Nodes[name]))
+	}
+}
+
+// nodeChoices returns the fields of a manifest node keyed by their TOML names.
+// Durations are given as strings, and unset pointers as nil.
+func nodeChoices(node *e2e.ManifestNode) map[string]interface{} {
+	choices := map[string]interface{}{}
+	v := reflect.ValueOf(node).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		key, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("toml"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		field := v.Field(i)
+		switch {
+		case field.Kind() == reflect.Ptr && field.IsNil():
+			choices[key] = nil
+		case field.Kind() == reflect.Ptr:
+			choices[key] = field.Elem().Interface()
+		case field.Type() == reflect.TypeOf(time.Duration(0)):
+			choices[key] = field.Interface().(time.Duration).String()
+		default:
+			choices[key] = field.Interface()
+		}
+	}
+	return choices
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	e2e "github.com/cometbft/cometbft/test/e2e/pkg"
+)
+
+// Diff is a difference between a committed manifest and the manifest the
+// generator produces for it today, see CheckManifestDrift. Node is empty for
+// testnet-wide settings, and Field is empty when the node itself only exists
+// on one side, in which case Old and New are "present" or "absent". Fields
+// are named by their TOML keys, e.g. "rpc_config.unsafe", and values are
+// formatted with fmt, where unset values are empty.
+type Diff struct {
+	Node  string
+	Field string
+	Old   string
+	New   string
+}
+
+// String formats the difference for humans.
+func (d Diff) String() string {
+	switch {
+	case d.Node == "":
+		return fmt.Sprintf("%s: %q -> %q", d.Field, d.Old, d.New)
+	case d.Field == "":
+		return fmt.Sprintf("node %s: %s -> %s", d.Node, d.Old, d.New)
+	default:
+		return fmt.Sprintf("node %s: %s: %q -> %q", d.Node, d.Field, d.Old, d.New)
+	}
+}
+
+// driftIgnoredFields are the manifest fields that are expected to change
+// between generator versions, and thus aren't drift.
+var driftIgnoredFields = map[string]bool{
+	"generator_version": true,
+}
+
+// CheckManifestDrift regenerates the testnets of the given seed with cfg, and
+// returns the differences between the old manifest and the regenerated one
+// closest to it, i.e. with the fewest differences, since manifests don't
+// record their position in the generated set. No differences means that the
+// generator still produces the old manifest. cfg must hold the options the
+// old manifest was generated with. Lists are compared in the canonical order
+// manifests are saved in, see e2e.Manifest.Sort.
+func CheckManifestDrift(old e2e.Manifest, seed int64, cfg *generateConfig) ([]Diff, error) {
+	manifests, _, err := GenerateFromSeed(seed, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(manifests) == 0 {
+		return nil, errors.New("the generator produced no testnets")
+	}
+	// Merging no overrides copies the old manifest, which we don't own.
+	old, err = old.Merge(e2e.Manifest{})
+	if err != nil {
+		return nil, err
+	}
+	old.Sort()
+	var closest []Diff
+	for i, manifest := range manifests {
+		manifest.Sort()
+		diffs := diffManifests(old, manifest)
+		if i == 0 || len(diffs) < len(closest) {
+			closest = diffs
+		}
+		if len(closest) == 0 {
+			break
+		}
+	}
+	return closest, nil
+}
+
+// diffManifests returns the differences between two manifests, sorted by node
+// and field.
+func diffManifests(old, manifest e2e.Manifest) []Diff {
+	oldNodes, nodes := old.Nodes, manifest.Nodes
+	old.Nodes, manifest.Nodes = nil, nil
+
+	diffs := []Diff{}
+	diffValues("", "", reflect.ValueOf(old), reflect.ValueOf(manifest), &diffs)
+	names := map[string]bool{}
+	for name := range oldNodes {
+		names[name] = true
+	}
+	for name := range nodes {
+		names[name] = true
+	}
+	for name := range names {
+		oldNode, newNode := oldNodes[name], nodes[name]
+		switch {
+		case oldNode == nil && newNode == nil:
+		case oldNode == nil:
+			diffs = append(diffs, Diff{Node: name, Old: "absent", New: "present"})
+		case newNode == nil:
+			diffs = append(diffs, Diff{Node: name, Old: "present", New: "absent"})
+		default:
+			diffValues(name, "", reflect.ValueOf(*oldNode), reflect.ValueOf(*newNode), &diffs)
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].Node != diffs[j].Node {
+			return diffs[i].Node < diffs[j].Node
+		}
+		return diffs[i].Field < diffs[j].Field
+	})
+	return diffs
+}
+
+// diffValues appends the differences between two values of the same type to
+// diffs. Structs with TOML fields, and pointers to them, are compared field by
+// field, and other values as a whole.
+func diffValues(node, field string, old, manifest reflect.Value, diffs *[]Diff) {
+	if old.Kind() == reflect.Pointer && !old.IsNil() && !manifest.IsNil() && isTOMLStruct(old.Type().Elem()) {
+		old, manifest = old.Elem(), manifest.Elem()
+	}
+	if !isTOMLStruct(old.Type()) {
+		if !reflect.DeepEqual(old.Interface(), manifest.Interface()) {
+			*diffs = append(*diffs, Diff{
+				Node: node, Field: field, Old: formatDiffValue(old), New: formatDiffValue(manifest),
+			})
+		}
+		return
+	}
+	for i := 0; i < old.NumField(); i++ {
+		key := tomlKey(old.Type().Field(i))
+		if key == "" || driftIgnoredFields[key] {
+			continue
+		}
+		if field != "" {
+			key = field + "." + key
+		}
+		diffValues(node, key, old.Field(i), manifest.Field(i), diffs)
+	}
+}
+
+// isTOMLStruct returns whether t is a struct with TOML keys, e.g. a manifest
+// section, as opposed to e.g. time.Time.
+func isTOMLStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t.NumField() > 0 && tomlKey(t.Field(0)) != ""
+}
+
+// tomlKey returns the TOML key of a struct field, or an empty string if the
+// field isn't encoded.
+func tomlKey(f reflect.StructField) string {
+	key, _, _ := strings.Cut(f.Tag.Get("toml"), ",")
+	if key == "-" {
+		return ""
+	}
+	return key
+}
+
+// formatDiffValue formats a value of a Diff, where nil pointers are empty.
+func formatDiffValue(v reflect.Value) string {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// printDrift prints the differences found by CheckManifestDrift, one per
+// line, and returns an error if there are any.
+func printDrift(w io.Writer, file string, diffs []Diff) error {
+	for _, diff := range diffs {
+		fmt.Fprintln(w, diff)
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("manifest %q drifted from the generator in %d fields", file, len(diffs))
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	e2e "github.com/cometbft/cometbft/test/e2e/pkg"
+)
+
+func TestCheckManifestDrift(t *testing.T) {
+	manifests, _, err := Generate(&generateConfig{seed: randomSeed})
+	require.NoError(t, err)
+	require.Greater(t, len(manifests), 3)
+
+	// Manifests are checked as committed, i.e. after a save/load round trip.
+	load := func() e2e.Manifest {
+		file := filepath.Join(t.TempDir(), "manifest.toml")
+		require.NoError(t, manifests[3].Save(file))
+		m, err := e2e.LoadManifest(file)
+		require.NoError(t, err)
+		return m
+	}
+
+	old := load()
+	old.GeneratorVersion = "older"
+	diffs, err := CheckManifestDrift(old, old.GeneratorSeed, &generateConfig{})
+	require.NoError(t, err)
+	assert.Empty(t, diffs)
+
+	old = load()
+	old.InitialHeight++
+	old.Nodes["validator01"].Database = "drifted"
+	old.Nodes["validator01"].RPCConfig.Unsafe = !old.Nodes["validator01"].RPCConfig.Unsafe
+	old.Nodes["extra"] = &e2e.ManifestNode{}
+	diffs, err = CheckManifestDrift(old, old.GeneratorSeed, &generateConfig{})
+	require.NoError(t, err)
+	validator01 := manifests[3].Nodes["validator01"]
+	assert.Equal(t, []Diff{
+		{Field: "initial_height", Old: fmt.Sprint(manifests[3].InitialHeight + 1), New: fmt.Sprint(manifests[3].InitialHeight)},
+		{Node: "extra", Old: "present", New: "absent"},
+		{Node: "validator01", Field: "database", Old: "drifted", New: validator01.Database},
+		{Node: "validator01", Field: "rpc_config.unsafe", Old: fmt.Sprint(!validator01.RPCConfig.Unsafe),
+			New: fmt.Sprint(validator01.RPCConfig.Unsafe)},
+	}, diffs)
+	assert.Error(t, printDrift(io.Discard, "manifest.toml", diffs))
+}
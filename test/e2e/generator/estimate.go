@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cometbft/cometbft/config"
+
+	e2e "github.com/cometbft/cometbft/test/e2e/pkg"
+)
+
+// estimatedExtraBlocks is the number of blocks a testnet is assumed to produce
+// after its last node has started, e.g. while being perturbed and tested.
+const estimatedExtraBlocks = 100
+
+// The startup SLAs of a testnet, see StartupSLAs, assume that starting a node
+// and connecting it to its peers takes startupPerNode on top of a fixed
+// startupBase, and that every node starting late takes catchUpPerNode to sync
+// on top of the blocks produced meanwhile. The results are then multiplied by
+// startupSLAMargin, so that only networks that are clearly too slow fail, and
+// the time to catch up by throttledCatchUpFactor if gossip is throttled.
+const (
+	startupBase            = 30 * time.Second
+	startupPerNode         = 1 * time.Second
+	catchUpPerNode         = 30 * time.Second
+	startupSLAMargin       = 2
+	throttledCatchUpFactor = 4
+)
+
+// The metric thresholds of a testnet, see MetricThresholds, bound the mean
+// block interval by metricThresholdMargin times the expected one, and the
+// mempool size by the transactions the load sends over that time plus
+// mempoolBacklog, e.g. while a node is perturbed.
+const (
+	metricThresholdMargin = 3
+	mempoolBacklog        = 30 * time.Second
+)
+
+// TestnetEstimate roughly estimates the resources a testnet will demand when
+// run. It is derived purely from the testnet's manifest.
+type TestnetEstimate struct {
+	// Nodes is the number of nodes, i.e. of containers running at once.
+	Nodes        int
+	Validators   int
+	LightClients int
+	// Height is the number of blocks the testnet is expected to produce.
+	Height int64
+	// RetainedBlocks is the number of blocks stored across all nodes at the
+	// end of the run, which dominates disk usage.
+	RetainedBlocks uint64
+	// Snapshots is the number of state sync snapshots taken across all nodes.
+	Snapshots uint64
+}
+
+// NewTestnetEstimate estimates the resources needed by a testnet.
+func NewTestnetEstimate(manifest e2e.Manifest) TestnetEstimate {
+	var lastStartAt int64
+	for _, node := range manifest.Nodes {
+		if node.StartAt > lastStartAt {
+			lastStartAt = node.StartAt
+		}
+	}
+	initialHeight := manifest.InitialHeight
+	if initialHeight < 1 {
+		initialHeight = 1
+	}
+	if lastStartAt < initialHeight {
+		lastStartAt = initialHeight
+	}
+
+	estimate := TestnetEstimate{
+		Nodes:  len(manifest.Nodes),
+		Height: lastStartAt - initialHeight + estimatedExtraBlocks,
+	}
+	for _, node := range manifest.Nodes {
+		switch node.Mode {
+		case string(e2e.ModeValidator), "":
+			estimate.Validators++
+		case string(e2e.ModeLight):
+			estimate.LightClients++
+			continue
+		case string(e2e.ModeSeed):
+			continue
+		}
+		// Absent validators never start, so they store nothing.
+		if node.StartAt == e2e.StartAtNever {
+			continue
+		}
+		// Nodes starting late only store blocks from their start height if
+		// they state sync, otherwise they block sync the whole chain.
+		blocks := uint64(estimate.Height)
+		if node.StateSync {
+			blocks = uint64(lastStartAt - node.StartAt + estimatedExtraBlocks)
+		}
+		if node.RetainBlocks > 0 && node.RetainBlocks < blocks {
+			blocks = node.RetainBlocks
+		}
+		estimate.RetainedBlocks += blocks
+		if node.SnapshotInterval > 0 {
+			estimate.Snapshots += uint64(estimate.Height) / node.SnapshotInterval
+		}
+	}
+	return estimate
+}
+
+// blockInterval estimates the time it takes a testnet to produce a block: the
+// default commit timeout, plus the ABCI delays and jitters on the path of
+// every block.
+func blockInterval(manifest e2e.Manifest) time.Duration {
+	return config.DefaultConsensusConfig().TimeoutCommit +
+		manifest.PrepareProposalDelay + manifest.ProcessProposalDelay + manifest.FinalizeBlockDelay +
+		manifest.PrepareProposalJitter + manifest.ProcessProposalJitter
+}
+
+// StartupSLAs returns the times within which a testnet is expected to produce
+// its first block, as measured by the runner from the start of the initial
+// nodes, and to have all of its nodes started and caught up, as measured from
+// that block, see e2e.Manifest.ExpectedFirstBlockBy and ExpectedCatchUpBy. The
+// first grows with the number of initial nodes, the block interval and a
+// genesis time offset in the future, which must be within it. The second grows
+// with the number of nodes starting late, the height the last one starts at,
+// and the duration of an archive blackout, and is scaled for testnets with
+// throttled gossip. Absent validators are left out. Blocks are assumed to be
+// produced at the rate of e2e.Manifest.ExpectedHeightAt.
+func StartupSLAs(manifest e2e.Manifest) (firstBlockBy, catchUpBy time.Duration) {
+	initialHeight := manifest.InitialHeight
+	if initialHeight < 1 {
+		initialHeight = 1
+	}
+	interval := manifest.BlockInterval()
+	var initialNodes, delayedNodes, heights int64
+	for _, node := range manifest.Nodes {
+		if node.StartAt == e2e.StartAtNever {
+			continue
+		}
+		if node.StartAt == 0 || node.StartAt == manifest.InitialHeight {
+			initialNodes++
+			continue
+		}
+		delayedNodes++
+		if node.StartAt-initialHeight > heights {
+			heights = node.StartAt - initialHeight
+		}
+	}
+	firstBlockBy = startupSLAMargin * (startupBase + time.Duration(initialNodes)*startupPerNode + interval)
+	firstBlockBy += max(manifest.GenesisTimeOffset, 0)
+	catchUp := startupSLAMargin * (time.Duration(heights)*interval + time.Duration(delayedNodes)*catchUpPerNode)
+	if manifest.ThrottledGossip {
+		catchUp *= throttledCatchUpFactor
+	}
+	catchUpBy = startupSLAMargin*startupBase + catchUp
+	// Nodes catching up stall while the archive nodes are offline.
+	if manifest.ArchiveBlackoutHeight > 0 {
+		blackout := manifest.ArchiveBlackoutDuration
+		if blackout == 0 {
+			blackout = e2e.DefaultArchiveBlackoutDuration
+		}
+		catchUpBy += startupSLAMargin * blackout
+	}
+	return firstBlockBy, catchUpBy
+}
+
+// MetricThresholds returns the default metric thresholds of a testnet, see
+// e2e.Manifest.MetricThresholds, or none if no node exposes Prometheus
+// metrics. The mean block interval is bounded from the ABCI delays, commit
+// timeouts and, since every block takes about three rounds of messages
+// between validators, the highest zone latency. The mempool size is bounded
+// from the peak load over that interval, and left unbounded for load
+// profiles expected to overload the network. Testnets with throttled gossip,
+// whose blocks are expected to be late, get no thresholds.
+func MetricThresholds(manifest e2e.Manifest) map[string]e2e.MetricThreshold {
+	prometheus := manifest.Prometheus
+	for _, node := range manifest.Nodes {
+		prometheus = prometheus || node.EnablePrometheus
+	}
+	if !prometheus || manifest.ThrottledGossip {
+		return nil
+	}
+
+	interval := manifest.BlockInterval()
+	var latency time.Duration
+	for _, latencies := range manifest.ZoneLatencies {
+		for _, l := range latencies {
+			latency = max(latency, l)
+		}
+	}
+	maxInterval := metricThresholdMargin * (interval + 3*latency)
+	maxIntervalSeconds := maxInterval.Seconds()
+	thresholds := map[string]e2e.MetricThreshold{
+		"cometbft_consensus_block_interval_seconds": {Max: &maxIntervalSeconds},
+	}
+	if manifest.LoadProfile != nil && manifest.LoadProfile.Overloaded {
+		return thresholds
+	}
+	rate := manifest.LoadTxBatchSize
+	if rate == 0 {
+		rate = e2e.DefaultLoadTxBatchSize
+	}
+	if manifest.LoadProfile != nil {
+		rate = manifest.LoadProfile.PeakRate()
+	}
+	maxMempool := min(float64(config.DefaultMempoolConfig().Size),
+		float64(rate)*(maxInterval+mempoolBacklog).Seconds())
+	thresholds["cometbft_mempool_size"] = e2e.MetricThreshold{Max: &maxMempool}
+	return thresholds
+}
+
+// EstimateTestnets estimates the resources needed by each testnet.
+func EstimateTestnets(manifests []e2e.Manifest) []TestnetEstimate {
+	estimates := make([]TestnetEstimate, 0, len(manifests))
+	for _, m := range manifests {
+		estimates = append(estimates, NewTestnetEstimate(m))
+	}
+	return estimates
+}
+
+// printEstimates prints the estimates as a table, along with their totals.
+func printEstimates(w io.Writer, estimates []TestnetEstimate) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "testnet\tnodes\tvalidators\tlight\theight\tretained blocks\tsnapshots\t")
+	var total TestnetEstimate
+	for i, e := range estimates {
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%d\t%d\t%d\t\n",
+			i, e.Nodes, e.Validators, e.LightClients, e.Height, e.RetainedBlocks, e.Snapshots)
+		total.Nodes += e.Nodes
+		total.Validators += e.Validators
+		total.LightClients += e.LightClients
+		total.Height += e.Height
+		total.RetainedBlocks += e.RetainedBlocks
+		total.Snapshots += e.Snapshots
+	}
+	fmt.Fprintf(tw, "total\t%d\t%d\t%d\t%d\t%d\t%d\t\n",
+		total.Nodes, total.Validators, total.LightClients, total.Height, total.RetainedBlocks, total.Snapshots)
+	return tw.Flush()
+}
@@ -1,19 +1,30 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"math"
 	"math/rand"
+	"regexp"
+	"runtime/debug"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/BurntSushi/toml"
 	"github.com/Masterminds/semver/v3"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing/object"
 
+	"github.com/cometbft/cometbft/libs/log"
+	"github.com/cometbft/cometbft/test/e2e/app"
 	e2e "github.com/cometbft/cometbft/test/e2e/pkg"
+	"github.com/cometbft/cometbft/types"
 	"github.com/cometbft/cometbft/version"
 )
 
@@ -29,33 +40,46 @@ var (
 		},
 		"validators": {"genesis", "initchain"},
 	}
+	// testnetCombinationWeights optionally weighs the testnet options when
+	// sampling testnets instead of generating all combinations. Options not
+	// listed here are sampled uniformly.
+	testnetCombinationWeights = map[string]weightedChoice{
+		"topology": {"single": 1, "quad": 5, "large": 4},
+	}
 	nodeVersions = weightedChoice{
 		"": 2,
 	}
 
-	// The following specify randomly chosen values for testnet nodes.
-	nodeDatabases = uniformChoice{"goleveldb", "cleveldb", "rocksdb", "boltdb", "badgerdb"}
-	ipv6          = uniformChoice{false, true}
-	// FIXME: grpc disabled due to https://github.com/tendermint/tendermint/issues/5439
-	nodeABCIProtocols     = uniformChoice{"unix", "tcp", "builtin", "builtin_connsync"} // "grpc"
+	// The following specify randomly chosen values for testnet nodes. Databases
+	// are weighted so that generateConfig.databaseWeights can override them.
+	nodeDatabases         = weightedChoice{"goleveldb": 1, "cleveldb": 1, "rocksdb": 1, "boltdb": 1, "badgerdb": 1}
+	ipStacks              = uniformChoice{"ipv4", "ipv6", "dual"}
+	nodeABCIProtocols     = uniformChoice{"unix", "tcp", "grpc", "builtin", "builtin_connsync"}
 	nodePrivvalProtocols  = uniformChoice{"file", "unix", "tcp"}
-	nodeBlockSyncs        = uniformChoice{"v0"} // "v2"
+	nodeKeyTypes          = uniformChoice{"ed25519", "secp256k1"}
+	nodeBlockSyncs        = uniformChoice{"v0"} // "v1" and "v2" were removed, see config.BlockSyncConfig
 	nodeStateSyncs        = uniformChoice{false, true}
 	nodePersistIntervals  = uniformChoice{0, 1, 5}
 	nodeSnapshotIntervals = uniformChoice{0, 3}
-	nodeRetainBlocks      = uniformChoice{
-		0,
-		2 * int(e2e.EvidenceAgeHeight),
-		4 * int(e2e.EvidenceAgeHeight),
-	}
+	nodeSnapshotFormats   = uniformChoice{uint32(1), uint32(2)}
+	// Chunk size 0 uses the application's default of 1MB.
+	nodeSnapshotChunkSizes = uniformChoice{uint64(0), uint64(1024), uint64(64 * 1024)}
+	// Nodes retain all blocks, or a multiple of the testnet's evidence age.
+	nodeRetainBlocks  = uniformChoice{0, 2, 4}
 	evidence          = uniformChoice{0, 1, 10}
-	abciDelays        = uniformChoice{"none", "small", "large"}
+	abciDelays        = uniformChoice{"none", "small", "large", "extreme"}
 	nodePerturbations = probSetChoice{
-		"disconnect": 0.1,
-		"pause":      0.1,
-		"kill":       0.1,
-		"restart":    0.1,
-		"upgrade":    0.3,
+		"disconnect":         0.1,
+		"pause":              0.1,
+		"kill":               0.1,
+		"restart":            0.1,
+		"upgrade":            0.3,
+		"skew":               0.1,
+		"throttle_disk":      0.1,
+		"corrupt_db":         0.05,
+		"privval_disconnect": 0.1,
+		"flap":               0.1,
+		"wal_truncate":       0.05,
 	}
 	lightNodePerturbations = probSetChoice{
 		"upgrade": 0.3,
@@ -63,24 +87,1056 @@ var (
 	voteExtensionEnableHeightOffset = uniformChoice{int64(0), int64(10), int64(100)}
 	voteExtensionEnabled            = uniformChoice{true, false}
 	voteExtensionSize               = uniformChoice{uint(128), uint(512), uint(2048), uint(8192)} //TODO: define the right values depending on experiment results.
+
+	nodeTimeouts = uniformChoice{
+		consensusTimeouts{}, // CometBFT defaults
+		consensusTimeouts{propose: 500 * time.Millisecond, commit: 100 * time.Millisecond},
+		consensusTimeouts{propose: 5 * time.Second, commit: 3 * time.Second},
+	}
+
+	// Validators marked as slow extenders get this vote extension delay,
+	// regardless of the delays chosen for the rest of the testnet.
+	slowVoteExtensionDelay     = 500 * time.Millisecond
+	slowVoteExtensionThreshold = 0.2
+
+	// The builtin_connsync protocol, called builtin_unsync in earlier
+	// releases, is only used with PrepareProposal delays up to this one, see
+	// generateTestnet.
+	connSyncMaxPrepareProposalDelay = 100 * time.Millisecond
+
+	// Clock skews are only applied to validators running the local version
+	// with a builtin ABCI protocol, whose node process offsets the timestamps
+	// of the votes it signs. The sum of the skews of validators starting at genesis
+	// is bounded by genesisClockSkewBudget, so that large skews are only given
+	// to delayed nodes and the genesis quorum can always make progress.
+	nodeClockSkews = uniformChoice{
+		time.Duration(0),
+		100 * time.Millisecond,
+		-100 * time.Millisecond,
+		2 * time.Second,
+		-2 * time.Second,
+	}
+	genesisClockSkewBudget = 300 * time.Millisecond
+
+	// Light clients get a primary and 1-3 witnesses from the light providers,
+	// and a trust period long enough to outlast the test. A zero trust period
+	// uses the CometBFT default.
+	lightNodeTrustPeriods = uniformChoice{time.Duration(0), time.Hour, 24 * time.Hour}
+	lightNodeMaxWitnesses = 3
+
+	// Genesis validators other than the archive nodes may misbehave in testnets
+	// with evidence, a few blocks after the initial height.
+	nodeMisbehaviors           = uniformChoice{string(e2e.MisbehaviorDoublePrevote), string(e2e.MisbehaviorDoublePrecommit)}
+	misbehaviorMinHeightOffset = int64(3)
+
+	// Nodes are spread over zones, with a one-way latency between each pair of
+	// zones roughly matching that between the corresponding regions. Only
+	// nodes running the local version emulate latency, see e2e.ManifestNode.
+	nodeZones     = uniformChoice{"us", "eu", "ap"}
+	zoneLatencies = map[string]map[string]time.Duration{
+		"us": {"us": 5 * time.Millisecond, "eu": 40 * time.Millisecond, "ap": 80 * time.Millisecond},
+		"eu": {"us": 40 * time.Millisecond, "eu": 5 * time.Millisecond, "ap": 110 * time.Millisecond},
+		"ap": {"us": 80 * time.Millisecond, "eu": 110 * time.Millisecond, "ap": 5 * time.Millisecond},
+	}
+
+	// Some nodes expose their Prometheus metrics and pprof endpoints on the
+	// host, for post-mortem debugging of failed testnets.
+	nodeDebugEndpoints = probSetChoice{
+		"prometheus": 0.2,
+		"pprof":      0.2,
+	}
+
+	// In dual-stack testnets, every node gets its own address family. Seeds
+	// and bridge nodes are always dual-homed.
+	nodeAddressFamilies = uniformChoice{"ipv4", "ipv6", "dual"}
+
+	// Nodes with a throttle_disk perturbation are limited to one of these disk
+	// bandwidths, in bytes per second, during the perturbation.
+	nodeDiskBandwidths = uniformChoice{uint64(256 * 1024), uint64(1024 * 1024), uint64(4 * 1024 * 1024)}
+
+	// Validators and full nodes limit the rates at which they send to and
+	// receive from each peer to one of these, in bytes per second, 0 meaning
+	// the CometBFT defaults. Rates too low for the testnet's load are reset,
+	// see reconcileGossipRates.
+	nodeGossipRates = weightedChoice{int64(0): 8, int64(1024 * 1024): 1, int64(4 * 1024 * 1024): 1}
+
+	// Testnets generated with generateConfig.throttleGossip limit every node
+	// to one of these send and receive rates, in bytes per second.
+	throttledGossipRates = uniformChoice{int64(32 * 1024), int64(128 * 1024)}
+
+	// The validators of "quad" testnets are wired up in one of these ways, of
+	// which the ring, star and bridge topologies add a few nodes. The wiring is
+	// chosen per testnet rather than being part of testnetCombinations, so that
+	// it doesn't multiply the number of testnets.
+	quadTopologies = weightedChoice{"quad": 3, "ring": 1, "star": 1, "bridge": 1}
+
+	// Testnets with a non-empty initial state sometimes get a large one
+	// instead, see largeInitialState. Like quadTopologies, this is chosen per
+	// testnet to avoid multiplying the number of testnets.
+	largeInitialStates = weightedChoice{false: 2, true: 1}
+
+	// Testnets get one of these transaction load profiles, see
+	// generateLoadProfile. Profiles whose peak rate exceeds what the testnet
+	// can commit, see loadCapacity, are marked as overloaded.
+	loadProfiles = uniformChoice{"light", "steady", "bursty"}
+
+	// Nodes with a corrupt_db perturbation recover in one of these ways, if
+	// the testnet has the nodes to recover from, see generateRecoveryModes.
+	nodeRecoveryModes = uniformChoice{string(e2e.RecoveryModeBlockSync), string(e2e.RecoveryModeStateSync)}
+
+	// Only nodes built with cgo support these databases, so they are removed
+	// from nodeDatabases if generateConfig.noCgo is set.
+	cgoDatabases = map[string]bool{"cleveldb": true, "rocksdb": true}
+
+	// In catch-up storms, the nodes catching up all start this many heights
+	// after the last staggered node, see generateCatchUpStorm.
+	catchUpStormDelay = int64(20)
+
+	// With generateConfig.startAtJitter, delayed nodes start up to this many
+	// heights after their scheduled height.
+	maxStartAtJitter = int64(4)
+
+	// Testnets with validator churn change the voting power of a validator
+	// in one of these ways at every step, see generateValidatorChurn.
+	validatorChurnActions = uniformChoice{"increase", "decrease", "remove"}
+
+	// Validator churn schedules this many power changes, this many heights
+	// apart, after all other validator updates and misbehaviors.
+	validatorChurnSteps    = 4
+	validatorChurnInterval = int64(5)
+
+	// Key rotations happen this many blocks after the last validator update.
+	keyRotationDelay = int64(10)
+
+	// With a filter, Generate gives up sampling testnets after this many
+	// testnets, unless generateConfig.filterAttempts says otherwise.
+	defaultFilterAttempts = 1000
+
+	// RegenerateTopology rewires a testnet up to this many more times when a
+	// wiring leaves a node behind NAT unreachable.
+	regenerateTopologyAttempts = 10
+
+	// Testnets limit their blocks to one of these sizes and amounts of gas,
+	// where 0 is the CometBFT default, see generateBlockParams. The smallest
+	// size makes PrepareProposal truncate its transactions under load.
+	blockMaxBytes = weightedChoice{int64(0): 4, int64(4 * 1024 * 1024): 1, int64(64 * 1024): 1}
+	blockMaxGas   = weightedChoice{int64(0): 4, int64(1000): 1, int64(100): 1}
+
+	// Testnets with vote extensions may have some validators omit them, see
+	// generateAppConfig.
+	mixedVoteExtensions = weightedChoice{false: 3, true: 1}
+
+	// With generateConfig.forcePerturbations, nodes that nodePerturbations
+	// left unperturbed get one of these, see generateForcedPerturbations.
+	forcedPerturbations = uniformChoice{"disconnect", "pause", "kill", "restart"}
+
+	// Validators and full nodes cache one of these numbers of transactions in
+	// their mempool, and may skip rechecking transactions after each block.
+	// Some testnets disable the cache of a minority of them, to exercise the
+	// handling of duplicate transactions, see generateMempoolCacheDisabled.
+	nodeMempoolCacheSizes = uniformChoice{10000, 1000, 100}
+	nodeMempoolRechecks   = weightedChoice{true: 3, false: 1}
+	mempoolCachesDisabled = weightedChoice{false: 3, true: 1}
+
+	// Some validators and full nodes run without a consensus WAL. Only
+	// validators with one may have it truncated, see generateNode.
+	nodeWALEnabled = weightedChoice{true: 4, false: 1}
+
+	// Some validators and full nodes limit their P2P connections, and the
+	// limits are then raised to what their peers require, see
+	// reconcilePeerLimits. With generateConfig.seedContention, seeds get
+	// seedPeerLimits, so that the other nodes contend for their slots.
+	nodePeerLimits = uniformChoice{
+		peerLimits{}, // CometBFT defaults
+		peerLimits{inbound: 10, outbound: 5},
+		peerLimits{inbound: 3, outbound: 2},
+	}
+	seedPeerLimits = peerLimits{inbound: 1, outbound: 1}
+
+	// Validators and full nodes may enable the unsafe RPC methods, and limit
+	// or disable websocket subscriptions, as long as one of them keeps
+	// accepting subscriptions, see reconcileRPCSurface.
+	nodeRPCUnsafe           = weightedChoice{false: 3, true: 1}
+	nodeRPCMaxSubscriptions = weightedChoice{5: 2, 1: 1, 0: 1}
+
+	// Some validators and full nodes bound the pauses between redials of
+	// their persistent peers, where 0 keeps CometBFT's exponential backoff,
+	// and some of those must connect within a number of such pauses, see
+	// e2e.ManifestNode.StartupBackoff and MaxDialRetries. The nodes of a
+	// catch-up storm dial with a tight backoff instead, to stress the dial
+	// path.
+	nodeStartupBackoffs = weightedChoice{time.Duration(0): 3, 2 * time.Second: 1, 10 * time.Second: 1}
+	nodeMaxDialRetries  = weightedChoice{0: 1, 10: 1}
+	stormStartupBackoff = 500 * time.Millisecond
+	stormMaxDialRetries = 40
+
+	// Testnets with a degraded link delay the packets of one direction of a
+	// random peer link by one of these latencies, and may drop some of them,
+	// see generateDegradedLink.
+	degradedLinkDelays = uniformChoice{100 * time.Millisecond, 500 * time.Millisecond}
+	degradedLinkLosses = weightedChoice{0.0: 2, 5.0: 1}
+
+	// Some validators and full nodes receive a larger share of the
+	// transaction load than others, where 0 is the default share, see
+	// e2e.ManifestNode.LoadWeight.
+	nodeLoadWeights = weightedChoice{0: 4, 2: 1, 4: 1}
+
+	// Evidence expires after one of these numbers of blocks, which nodes
+	// pruning blocks must retain, see nodeRetainBlocks.
+	evidenceMaxAges = uniformChoice{e2e.EvidenceAgeHeight, 2 * e2e.EvidenceAgeHeight}
+
+	// Some validators and full nodes running the local version are put behind
+	// NAT, if every node keeps a reachable peer, see reconcileNAT.
+	nodeNATs = weightedChoice{false: 9, true: 1}
 )
 
+// defaultScheduleSpacing is the default value of generateConfig.scheduleSpacing.
+const defaultScheduleSpacing int64 = 5
+
+// largeInitialState returns an initial state with the given number of
+// deterministic key/value pairs.
+func largeInitialState(size int) map[string]string {
+	state := make(map[string]string, size)
+	for i := 0; i < size; i++ {
+		state[fmt.Sprintf("initial%04d", i)] = fmt.Sprintf("value%04d", i)
+	}
+	return state
+}
+
+// initialStateGenerators are the generators of initial states that the
+// --initial-state flag chooses from by name, see generateConfig.initialStateGen.
+var initialStateGenerators = map[string]func(r *rand.Rand) map[string]string{
+	"large":    func(*rand.Rand) map[string]string { return largeInitialState(500) },
+	"accounts": accountsInitialState,
+}
+
+// accountsInitialState returns an initial state with a random number of
+// pre-funded accounts, mapping account/<address> keys to their balances, for
+// applications tracking accounts.
+func accountsInitialState(r *rand.Rand) map[string]string {
+	size := 10 + r.Intn(91)
+	state := make(map[string]string, size)
+	for len(state) < size {
+		address := make([]byte, 20)
+		r.Read(address)
+		state[fmt.Sprintf("account/%X", address)] = strconv.FormatInt(1+r.Int63n(1_000_000_000), 10)
+	}
+	return state
+}
+
+// generateLoadProfile randomly generates a transaction load profile for a
+// testnet whose ABCI delays have been chosen.
+func generateLoadProfile(r *rand.Rand, manifest e2e.Manifest) *e2e.LoadProfile {
+	name := loadProfiles.Choose(r).(string)
+	profile := &e2e.LoadProfile{Name: name}
+	switch name {
+	case "light":
+		profile.TxRate = 2
+		profile.TxSizes = []int{1024}
+	case "steady":
+		profile.TxRate = 20 + r.Intn(30)
+		profile.TxSizes = []int{256, 1024, 4096}
+	case "bursty":
+		// Ramp up to a peak of 5-20 times the base rate, then back down.
+		profile.TxRate = 10 + r.Intn(20)
+		profile.TxSizes = []int{1024, 16 * 1024}
+		peak := profile.TxRate * (5 + r.Intn(16))
+		profile.Bursts = []e2e.LoadBurst{
+			{Duration: 10 * time.Second, TxRate: profile.TxRate},
+			{Duration: 5 * time.Second, TxRate: (profile.TxRate + peak) / 2},
+			{Duration: 5 * time.Second, TxRate: peak},
+			{Duration: 5 * time.Second, TxRate: (profile.TxRate + peak) / 2},
+		}
+	}
+	profile.Overloaded = loadOverloaded(manifest, profile)
+	return profile
+}
+
+// loadOverloaded returns whether the peak rate of a load profile exceeds what
+// the testnet can commit, see loadCapacity.
+func loadOverloaded(manifest e2e.Manifest, profile *e2e.LoadProfile) bool {
+	maxTxSize := 0
+	for _, size := range profile.TxSizes {
+		if size > maxTxSize {
+			maxTxSize = size
+		}
+	}
+	return float64(profile.PeakRate()) > loadCapacity(manifest, maxTxSize)
+}
+
+// loadCapacity estimates how many transactions of the given size per second a
+// testnet can commit. Blocks are assumed to take the default commit timeout
+// plus the testnet's ABCI delays, including their maximum jitter, and to be
+// limited by the default maximum block size. CheckTx calls are serialized,
+// which bounds the rate further.
+func loadCapacity(manifest e2e.Manifest, txSize int) float64 {
+	maxBytes := types.DefaultBlockParams().MaxBytes
+	for _, name := range nodeNamesByMode(manifest, e2e.ModeValidator) {
+		if manifest.Nodes[name].MaxBlockBytes > 0 {
+			maxBytes = manifest.Nodes[name].MaxBlockBytes
+		}
+	}
+	capacity := float64(maxBytes/int64(txSize)) / blockInterval(manifest).Seconds()
+	if manifest.MaxGas > 0 {
+		capacity = math.Min(capacity, float64(manifest.MaxGas)/blockInterval(manifest).Seconds())
+	}
+	if manifest.CheckTxDelay > 0 {
+		capacity = math.Min(capacity, 1/manifest.CheckTxDelay.Seconds())
+	}
+	return capacity
+}
+
+// consensusTimeouts is a combination of per-node consensus timeouts.
+type consensusTimeouts struct {
+	propose time.Duration
+	commit  time.Duration
+}
+
+func (t consensusTimeouts) String() string {
+	return fmt.Sprintf("propose=%v,commit=%v", t.propose, t.commit)
+}
+
+// peerLimits is a node's limits on inbound and outbound P2P connections, where
+// 0 means the CometBFT default.
+type peerLimits struct {
+	inbound  int
+	outbound int
+}
+
+func (l peerLimits) String() string {
+	return fmt.Sprintf("inbound=%v,outbound=%v", l.inbound, l.outbound)
+}
+
+// abciDelaySet is a combination of testnet-wide ABCI method delays, one of
+// abciDelayPresets.
+type abciDelaySet struct {
+	prepareProposal time.Duration
+	processProposal time.Duration
+	checkTx         time.Duration
+	voteExtension   time.Duration
+	finalizeBlock   time.Duration
+
+	prepareProposalJitter time.Duration
+	processProposalJitter time.Duration
+}
+
+// abciDelayPresets are the delays of each value of abciDelays.
+var abciDelayPresets = map[string]abciDelaySet{
+	"none": {},
+	"small": {
+		prepareProposal: 100 * time.Millisecond,
+		processProposal: 100 * time.Millisecond,
+		voteExtension:   20 * time.Millisecond,
+		finalizeBlock:   200 * time.Millisecond,
+	},
+	"large": {
+		prepareProposal: 200 * time.Millisecond,
+		processProposal: 200 * time.Millisecond,
+		checkTx:         20 * time.Millisecond,
+		voteExtension:   100 * time.Millisecond,
+		finalizeBlock:   500 * time.Millisecond,
+
+		prepareProposalJitter: 100 * time.Millisecond,
+		processProposalJitter: 100 * time.Millisecond,
+	},
+	"extreme": {
+		prepareProposal: 500 * time.Millisecond,
+		processProposal: 500 * time.Millisecond,
+		checkTx:         50 * time.Millisecond,
+		voteExtension:   300 * time.Millisecond,
+		finalizeBlock:   1 * time.Second,
+
+		prepareProposalJitter: 300 * time.Millisecond,
+		processProposalJitter: 300 * time.Millisecond,
+	},
+}
+
 type generateConfig struct {
-	randSource   *rand.Rand
+	seed         int64
 	outputDir    string
 	multiVersion string
 	prometheus   bool
+	// deterministic sorts the seeds and persistent peers of every node, so
+	// that manifests generated from the same seed can be diffed easily.
+	deterministic bool
+	// coverage prints a report of how often each value of each random choice
+	// was picked across all generated manifests.
+	coverage bool
+	// validateSchema checks every generated manifest against the manifest
+	// schema, see e2e.ValidateManifestBytes.
+	validateSchema bool
+	// maxTotalNodes bounds the total number of nodes across all generated
+	// testnets, if non-zero. Generate first shrinks the "large" topology and
+	// then drops the largest testnets until the budget is met.
+	maxTotalNodes int
+	// numTestnets, if non-zero, randomly samples this many testnets according
+	// to testnetCombinationWeights, instead of generating a testnet for every
+	// combination of testnetCombinations.
+	numTestnets int
+	// filter, if set, discards the generated testnets it returns false for,
+	// before cfg.overrides are applied. With numTestnets, Generate keeps
+	// sampling testnets until numTestnets of them match, and fails after
+	// filterAttempts testnets, defaulting to defaultFilterAttempts if 0. The
+	// testnets it discards still advance the RNG, so a seed and a filter
+	// always reproduce the same testnets.
+	filter         func(e2e.Manifest) bool
+	filterAttempts int
+	// scheduleSpacing is the number of heights between consecutive node
+	// startups, and between a validator's startup and the validator update
+	// adding it to the validator set. Defaults to defaultScheduleSpacing if
+	// nil. Spacings of 0 or 1 make startups and updates collide on purpose,
+	// while negative spacings are rejected.
+	scheduleSpacing *int64
+	// dryRun makes the CLI print the resource estimates of the generated
+	// testnets, see TestnetEstimate, instead of writing their manifests.
+	dryRun bool
+	// minimizeLarge generates "large" testnets of the smallest possible size.
+	// It is set by Generate when shrinking testnets to fit maxTotalNodes.
+	minimizeLarge bool
+	// overrides, if non-nil, is merged onto every generated manifest with
+	// e2e.Manifest.Merge, e.g. to force all nodes onto the same database.
+	// Values set in the overrides take precedence over generated values.
+	overrides *e2e.Manifest
+	// dot makes the CLI write a Graphviz rendering of each manifest's peer
+	// graph next to it, see e2e.Manifest.ToDOT.
+	dot bool
+	// timeline makes the CLI print the events scheduled by each generated
+	// testnet, see e2e.Manifest.Timeline.
+	timeline bool
+	// upgradeAtHeight, if non-zero, generates upgrade tests: every node starts
+	// on the latest release, and the whole network is upgraded to the local
+	// version this many heights after the initial height, see
+	// e2e.Manifest.UpgradeHeight. Nodes starting later run the local version.
+	upgradeAtHeight int64
+	// throttleDisk enables the throttle_disk perturbation. It is off by
+	// default, since the Docker provider applies it by writing to the host's
+	// cgroup filesystem, which requires root.
+	throttleDisk bool
+	// noCgo removes the databases that require cgo from nodeDatabases, see
+	// cgoDatabases, for nodes built without cgo.
+	noCgo bool
+	// databaseWeights, if set, replaces the weights of nodeDatabases, e.g. to
+	// generate databases in proportion to their use in production. Databases
+	// missing from it, or with a weight of 0, aren't generated.
+	databaseWeights map[string]uint
+	// catchUpStorm, if non-zero, is the fraction of full nodes that start at
+	// the same height, to stress the nodes serving block sync. Star and bridge
+	// testnets have no such nodes, since their full nodes are hubs.
+	catchUpStorm float64
+	// logger, if non-nil, gets a record of the choices made for every node
+	// of the generated testnets, see logNodeChoices.
+	logger log.Logger
+	// abciApp, if set, is the ABCI application of every generated testnet,
+	// see e2e.Manifest.ABCIApp. Testnets running an application other than
+	// the kvstore get no kvstore-specific settings, and a socket protocol.
+	abciApp string
+	// validatorChurn schedules a series of validator power changes at the end
+	// of every testnet but bridge ones, whose validators must keep equal
+	// powers, see generateValidatorChurn.
+	validatorChurn bool
+	// bootstrapFromSnapshot has the delayed validators and full nodes of every
+	// testnet state sync from a snapshot taken before the first of them
+	// starts, rather than block sync from genesis, see
+	// generateSnapshotBootstrap. The genesis quorum of validators produces it.
+	bootstrapFromSnapshot bool
+	// noPerturbations generates no perturbations at all, e.g. to measure the
+	// baseline performance of stable networks. forcePerturbations instead
+	// perturbs every node but light clients and genesis validators at least
+	// once, see generateForcedPerturbations. They are mutually exclusive.
+	noPerturbations    bool
+	forcePerturbations bool
+	// seedOnlyDiscovery has the nodes of every testnet discover their peers
+	// through seeds only, adding a seed to testnets without one, see
+	// e2e.Manifest.SeedOnlyDiscovery. Ring, star and bridge testnets, whose
+	// topologies are made of persistent peers, are left as they are.
+	seedOnlyDiscovery bool
+	// powerDistribution, if set, assigns the voting powers of the validators
+	// of every testnet but bridge ones, whose validators must keep equal
+	// powers, instead of drawing them at random, see powerDistribution.
+	powerDistribution *powerDistribution
+	// archiveBlackoutAt, if positive, has the runner kill every archive node
+	// of every testnet at once that many blocks after the initial height,
+	// see e2e.Manifest.ArchiveBlackoutHeight. Testnets whose archive
+	// validators hold 1/3 or more of the voting power by then get none.
+	archiveBlackoutAt int64
+	// pinnedVersions maps node names to the version they run in every testnet
+	// having them, instead of one chosen from nodeVersions, e.g. to test the
+	// compatibility of a given release with the local version. Versions are
+	// "local", "latest", or release tags of the Git repository in outputDir,
+	// optionally prefixed with a Docker image, see resolvePinnedVersions.
+	pinnedVersions map[string]string
+	// restartAllAt, if positive, has the runner restart every node of every
+	// testnet at once that many blocks after the last node starts, see
+	// e2e.Manifest.GlobalRestartHeight. Every node but light clients then
+	// persists its state.
+	restartAllAt int64
+	// keySeed, if non-zero, gives nodes with the same name the same consensus
+	// keys in every testnet, see e2e.Manifest.KeySeed. sharedNodeKeys also
+	// gives them the same P2P keys, and requires keySeed.
+	keySeed        int64
+	sharedNodeKeys bool
+	// startAtJitter has delayed nodes start up to maxStartAtJitter heights
+	// after their scheduled heights, so that they don't all start on
+	// multiples of the schedule spacing. Nodes keep starting in the same
+	// order, so spacings of 0 or 1 leave no room for jitter.
+	startAtJitter bool
+	// initialStateGen, if set, generates the initial state of testnets with a
+	// non-empty one instead of the built-in states, e.g. one of
+	// initialStateGenerators. The expected initial app hash is computed from
+	// the generated state.
+	initialStateGen func(r *rand.Rand) map[string]string
+	// sentryNodes gives each genesis validator of every testnet one or two
+	// dedicated sentry full nodes, which are its only peers, see
+	// e2e.ManifestNode.SentryFor. Ring, star and bridge testnets, whose
+	// topologies are fixed, are left as they are.
+	sentryNodes bool
+	// dedicatedArchives, if positive, adds that many archive full nodes to
+	// every testnet, which serve block sync, snapshots and light clients, and
+	// no longer forces validators to be archive nodes. With none, validator01
+	// and validator02 are archive nodes. Star and bridge testnets, whose full
+	// nodes have fixed roles, are left as they are.
+	dedicatedArchives int
+	// shortRetention has a minority of the non-archive validators and full
+	// nodes of testnets with evidence retain fewer blocks than the evidence
+	// age, see e2e.ManifestNode.ShortRetention.
+	shortRetention bool
+	// skipDuplicates drops the testnets whose fingerprint matches one of an
+	// earlier testnet, see e2e.Manifest.Fingerprint, e.g. when sampling many
+	// testnets with numTestnets.
+	skipDuplicates bool
+	// validatorGrowth, if set, has quad and large testnets start with a few
+	// genesis validators and add one validator at a time until they reach a
+	// target count, see validatorGrowth.
+	validatorGrowth *validatorGrowth
+	// noLightClients drops the light clients of large testnets, and
+	// forceLightClients, if positive, pins their number instead. The number of
+	// light clients is still drawn, so that the other choices made for the
+	// testnets don't change.
+	noLightClients    bool
+	forceLightClients int
+	// keyRotation has a minority genesis validator of every testnet swap its
+	// consensus key after the other validator updates, see
+	// e2e.ManifestNode.KeyRotations.
+	keyRotation bool
+	// genesisTimeOffset, if non-zero, sets the genesis time of every testnet
+	// this far from the time the runner sets it up, see
+	// e2e.Manifest.GenesisTimeOffset. A future offset extends the testnet's
+	// expected_first_block_by, see StartupSLAs.
+	genesisTimeOffset time.Duration
+	// degradedLink has every testnet with a peer link from a node running the
+	// local version slow down that link in one direction, see
+	// generateDegradedLink.
+	degradedLink bool
+	// mempoolFlood has a single full node of every testnet with full nodes
+	// receive the whole transaction load, see generateMempoolFlood.
+	mempoolFlood bool
+	// seedContention gives the seeds of every testnet tiny P2P connection
+	// limits, so that peer discovery contends for their inbound slots, see
+	// seedPeerLimits.
+	seedContention bool
+	// paired makes the CLI pair up the generated testnets as two chains each,
+	// see GeneratePaired.
+	paired bool
+	// absentValidators, if positive, has up to that many genesis validators
+	// of every testnet never start, while remaining in the validator set, see
+	// e2e.StartAtNever and generateAbsentValidators.
+	absentValidators int
+	// chainIDPrefix starts the chain IDs of the generated testnets, see
+	// generateChainID. Defaults to defaultChainIDPrefix if empty.
+	chainIDPrefix string
+	// minimalQuorum has exactly 2f+1 of the validators of every testnet but
+	// bridge ones start at genesis, f being the number of faulty validators
+	// they tolerate, and the others never start, so that losing any live
+	// validator stalls the chain, see minimalQuorumPower.
+	minimalQuorum bool
+	// equalPower gives every validator of every testnet the same voting
+	// power, equalValidatorPower, so that proposers rotate round-robin, and
+	// has the tests check that they take turns, see
+	// e2e.Manifest.AssertProposerFairness.
+	equalPower bool
+	// observerPromotion has a full node of every testnet join the validator
+	// set some blocks after it starts, see generateObserverPromotion.
+	observerPromotion bool
+	// throttleGossip limits the send and receive rates of every node of every
+	// testnet to one of throttledGossipRates, to stress block propagation,
+	// and marks the testnets as throttled, see e2e.Manifest.ThrottledGossip.
+	throttleGossip bool
+}
+
+// Validate validates the configuration.
+func (cfg *generateConfig) Validate() error {
+	if cfg.scheduleSpacing != nil && *cfg.scheduleSpacing < 0 {
+		return fmt.Errorf("schedule spacing must not be negative, got %d", *cfg.scheduleSpacing)
+	}
+	if cfg.upgradeAtHeight < 0 {
+		return fmt.Errorf("upgrade height must not be negative, got %d", cfg.upgradeAtHeight)
+	}
+	if cfg.catchUpStorm < 0 || cfg.catchUpStorm > 1 {
+		return fmt.Errorf("catch-up storm fraction must be between 0 and 1, got %v", cfg.catchUpStorm)
+	}
+	if cfg.noPerturbations && cfg.forcePerturbations {
+		return errors.New("perturbations cannot be both disabled and forced")
+	}
+	if cfg.archiveBlackoutAt < 0 {
+		return fmt.Errorf("archive blackout height must not be negative, got %d", cfg.archiveBlackoutAt)
+	}
+	if cfg.archiveBlackoutAt > 0 && cfg.upgradeAtHeight > 0 {
+		return errors.New("archive blackouts cannot be combined with upgrade tests")
+	}
+	if cfg.restartAllAt < 0 {
+		return fmt.Errorf("global restart height must not be negative, got %d", cfg.restartAllAt)
+	}
+	if cfg.restartAllAt > 0 && (cfg.upgradeAtHeight > 0 || cfg.archiveBlackoutAt > 0) {
+		return errors.New("global restarts cannot be combined with upgrade tests or archive blackouts")
+	}
+	if cfg.dedicatedArchives < 0 {
+		return fmt.Errorf("dedicated archives must not be negative, got %d", cfg.dedicatedArchives)
+	}
+	if cfg.absentValidators < 0 {
+		return fmt.Errorf("absent validators must not be negative, got %d", cfg.absentValidators)
+	}
+	if cfg.minimalQuorum && (cfg.absentValidators > 0 || cfg.keyRotation || cfg.validatorGrowth != nil ||
+		cfg.powerDistribution != nil || cfg.validatorChurn || cfg.archiveBlackoutAt > 0) {
+		return errors.New("a minimal quorum sets the powers and start heights of the validators, and cannot be " +
+			"combined with absent validators, key rotations, validator growth, a power distribution, " +
+			"validator churn or archive blackouts")
+	}
+	if cfg.equalPower && cfg.powerDistribution != nil && cfg.powerDistribution.shape != "uniform" {
+		return fmt.Errorf("equal voting powers cannot be combined with the %v power distribution",
+			cfg.powerDistribution.shape)
+	}
+	if cfg.equalPower && (cfg.validatorGrowth != nil || cfg.validatorChurn || cfg.minimalQuorum || cfg.absentValidators > 0) {
+		return errors.New("equal voting powers cannot be combined with validator growth, validator churn, " +
+			"a minimal quorum or absent validators")
+	}
+	if cfg.observerPromotion && cfg.minimalQuorum {
+		return errors.New("observer promotions add validators, and cannot be combined with a minimal quorum")
+	}
+	if cfg.chainIDPrefix != "" && !chainIDPrefixRegexp.MatchString(cfg.chainIDPrefix) {
+		return fmt.Errorf("chain ID prefix %q must be 1 to %d letters, digits, '.', '_' or '-'",
+			cfg.chainIDPrefix, maxChainIDPrefixLen)
+	}
+	if cfg.filterAttempts < 0 {
+		return fmt.Errorf("filter attempts must not be negative, got %d", cfg.filterAttempts)
+	}
+	if cfg.forceLightClients < 0 || cfg.forceLightClients > 99 {
+		return fmt.Errorf("forced light clients must be between 0 and 99, got %d", cfg.forceLightClients)
+	}
+	if cfg.noLightClients && cfg.forceLightClients > 0 {
+		return errors.New("light clients cannot be both disabled and forced")
+	}
+	if cfg.keyRotation && (cfg.upgradeAtHeight > 0 || cfg.archiveBlackoutAt > 0 || cfg.restartAllAt > 0) {
+		return errors.New("key rotations cannot be combined with upgrade tests, archive blackouts or global restarts")
+	}
+	for database := range cfg.databaseWeights {
+		if _, ok := nodeDatabases[database]; !ok {
+			return fmt.Errorf("unknown database %q", database)
+		}
+	}
+	if cfg.sharedNodeKeys && cfg.keySeed == 0 {
+		return errors.New("shared node keys require a key seed")
+	}
+	if cfg.sentryNodes && cfg.seedOnlyDiscovery {
+		return errors.New("sentry nodes cannot be combined with seed-only discovery, since validators " +
+			"with sentries must peer with them")
+	}
+	if cfg.upgradeAtHeight > 0 && cfg.multiVersion != "" {
+		return errors.New("upgrade tests always run the latest release, and cannot be combined with multiple versions")
+	}
+	for name := range cfg.pinnedVersions {
+		if !generatedNodeName.MatchString(name) {
+			return fmt.Errorf("cannot pin the version of unknown node %q", name)
+		}
+	}
+	if cfg.validatorGrowth != nil {
+		if err := cfg.validatorGrowth.Validate(); err != nil {
+			return err
+		}
+		if cfg.powerDistribution != nil || cfg.validatorChurn {
+			return errors.New("validator growth sets the powers of the validators, and cannot be combined " +
+				"with a power distribution or validator churn")
+		}
+	}
+	if cfg.powerDistribution != nil {
+		if err := cfg.powerDistribution.Validate(); err != nil {
+			return err
+		}
+		if cfg.validatorChurn {
+			return errors.New("validator churn changes the powers of a power distribution, and cannot be combined with one")
+		}
+	}
+	return nil
+}
+
+// validatorGrowth grows the validator set of a testnet from start genesis
+// validators to target validators, adding one every interval blocks. Each
+// added validator starts interval blocks before it joins the validator set,
+// to catch up, and holds less power than half of the validators already in
+// the set, so that the others keep more than 2/3 of the voting power while it
+// catches up.
+type validatorGrowth struct {
+	start    int
+	target   int
+	interval int64
+}
+
+// parseValidatorGrowth parses a validator growth as start:target:interval,
+// e.g. "4:10:5".
+func parseValidatorGrowth(s string) (*validatorGrowth, error) {
+	fields := strings.Split(s, ":")
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("invalid validator growth %q, must be start:target:interval", s)
+	}
+	start, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid validator growth start %q: %w", fields[0], err)
+	}
+	target, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid validator growth target %q: %w", fields[1], err)
+	}
+	interval, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid validator growth interval %q: %w", fields[2], err)
+	}
+	return &validatorGrowth{start: start, target: target, interval: interval}, nil
+}
+
+// Validate validates the growth. Testnets start with at least two genesis
+// validators, which may be their archive nodes, and validator names have
+// two digits.
+func (g *validatorGrowth) Validate() error {
+	if g.start < 2 {
+		return fmt.Errorf("validator growth must start with at least 2 validators, got %d", g.start)
+	}
+	if g.target <= g.start || g.target > 99 {
+		return fmt.Errorf("validator growth target must be between %d and 99, got %d", g.start+1, g.target)
+	}
+	if g.interval < 1 {
+		return fmt.Errorf("validator growth interval must be positive, got %d", g.interval)
+	}
+	return nil
+}
+
+// powerDistribution assigns voting powers to the validators of a testnet, in
+// the order they are generated. The "uniform" distribution gives them all a
+// power of 100. The "skewed" one gives validator01 the largest power under
+// 1/3 of the power of the validators starting at genesis, and 100 to the
+// others, if at least four validators start at genesis: with fewer, no
+// validator can hold more power than the others without exceeding 1/3, and
+// the distribution is uniform. An explicit list of powers is assigned in
+// order, starting over from the first one if a testnet has more validators
+// than listed.
+type powerDistribution struct {
+	shape  string
+	powers []int64
+}
+
+// parsePowerDistribution parses a power distribution: "uniform", "skewed", or
+// a comma-separated list of powers.
+func parsePowerDistribution(s string) (*powerDistribution, error) {
+	switch s {
+	case "uniform", "skewed":
+		return &powerDistribution{shape: s}, nil
+	}
+	d := &powerDistribution{shape: "explicit"}
+	for _, field := range strings.Split(s, ",") {
+		power, err := strconv.ParseInt(strings.TrimSpace(field), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid power distribution %q, must be uniform, skewed or a list of powers", s)
+		}
+		d.powers = append(d.powers, power)
+	}
+	return d, nil
+}
+
+// Validate validates the distribution. No listed power may exceed 1/3 of the
+// total.
+func (d *powerDistribution) Validate() error {
+	switch d.shape {
+	case "uniform", "skewed":
+		return nil
+	case "explicit":
+	default:
+		return fmt.Errorf("unknown power distribution %q", d.shape)
+	}
+	if len(d.powers) == 0 {
+		return errors.New("explicit power distribution lists no powers")
+	}
+	var total int64
+	for _, power := range d.powers {
+		if power <= 0 {
+			return fmt.Errorf("validator powers must be positive, got %d", power)
+		}
+		total += power
+	}
+	for _, power := range d.powers {
+		if 3*power > total {
+			return fmt.Errorf("validator power %d exceeds 1/3 of the total power %d", power, total)
+		}
+	}
+	return nil
+}
+
+// power returns the power of the i-th validator of a testnet, counting from
+// 1, in which numGenesis validators start at genesis.
+func (d *powerDistribution) power(i, numGenesis int) int64 {
+	switch {
+	case d.shape == "explicit":
+		return d.powers[(i-1)%len(d.powers)]
+	case d.shape == "skewed" && i == 1 && numGenesis >= 4:
+		// The largest power p such that 3p < p + 100*(numGenesis-1).
+		return 50*int64(numGenesis-1) - 1
+	default:
+		return 100
+	}
+}
+
+// validatePowerShares checks that no validator holds more than 1/3 of the
+// voting power at the initial height or after any validator update, unless it
+// is the only validator, so that the testnet stays BFT-safe.
+func validatePowerShares(manifest e2e.Manifest) error {
+	heights := append([]int64{max(manifest.InitialHeight, 1)}, validatorUpdateHeights(manifest)...)
+	for _, height := range heights {
+		powers := validatorPowersAt(manifest, height)
+		if len(powers) < 2 {
+			continue
+		}
+		var total int64
+		for _, power := range powers {
+			total += power
+		}
+		for _, name := range sortedNodeNames(manifest) {
+			if 3*powers[name] > total {
+				return fmt.Errorf("validator %q holds %d of %d voting power at height %d, more than 1/3",
+					name, powers[name], total, height)
+			}
+		}
+	}
+	return nil
+}
+
+// observerPromotionDelay is how many blocks after it starts a full node is
+// promoted to a validator, see generateObserverPromotion, so that it syncs the
+// state before voting.
+const observerPromotionDelay = 10
+
+// equalValidatorPower is the voting power of every validator of the testnets
+// generated with generateConfig.equalPower.
+const equalValidatorPower = 100
+
+// minimalQuorumLivePower is the voting power of each validator starting at
+// genesis in minimal quorum testnets, see minimalQuorumPower.
+const minimalQuorumLivePower = 100
+
+// minimalQuorumSize returns the number of validators starting at genesis in a
+// minimal quorum testnet with numValidators validators: 2f+1, f being the
+// number of faulty validators they tolerate.
+func minimalQuorumSize(numValidators int) int {
+	return 2*(numValidators/3) + 1
+}
+
+// minimalQuorumPower returns the voting power of the i-th validator of a
+// minimal quorum testnet with numValidators validators, counting from 1. The
+// first minimalQuorumSize(numValidators) ones start at genesis with
+// minimalQuorumLivePower each, and the others, which never start, share f
+// times as much, as if f validators of the same power never started. The live
+// validators then hold just over 2/3 of the voting power, and any 2f of them
+// at most 2/3.
+func minimalQuorumPower(i, numValidators int) int64 {
+	live := minimalQuorumSize(numValidators)
+	if i <= live {
+		return minimalQuorumLivePower
+	}
+	absent := int64(numValidators - live)
+	share := int64(numValidators/3) * minimalQuorumLivePower
+	power := share / absent
+	if int64(i-live) <= share%absent {
+		power++
+	}
+	return max(power, 1)
+}
+
+// validateMinimalQuorum checks that the validators starting at genesis in a
+// minimal quorum testnet are exactly a quorum, at the initial height and after
+// every validator update: there are minimalQuorumSize of them, the others
+// never start, and they hold more than 2/3 of the voting power, but no longer
+// do without any one of them.
+func validateMinimalQuorum(manifest e2e.Manifest) error {
+	heights := append([]int64{max(manifest.InitialHeight, 1)}, validatorUpdateHeights(manifest)...)
+	for _, height := range heights {
+		powers := validatorPowersAt(manifest, height)
+		var total, live, minLive int64
+		numLive := 0
+		for _, name := range sortedNodeNames(manifest) {
+			power, ok := powers[name]
+			if !ok {
+				continue
+			}
+			total += power
+			node := manifest.Nodes[name]
+			switch node.StartAt {
+			case e2e.StartAtNever:
+				continue
+			case 0, manifest.InitialHeight:
+			default:
+				return fmt.Errorf("validator %q starts at height %d, but must start at genesis or never",
+					name, node.StartAt)
+			}
+			numLive++
+			live += power
+			if minLive == 0 || power < minLive {
+				minLive = power
+			}
+		}
+		if expect := minimalQuorumSize(len(powers)); numLive != expect {
+			return fmt.Errorf("%d of %d validators are live at height %d, expected exactly %d",
+				numLive, len(powers), height, expect)
+		}
+		if 3*live <= 2*total || 3*(live-minLive) > 2*total {
+			return fmt.Errorf("live validators hold %d of %d voting power at height %d, must be more than 2/3, "+
+				"and no longer be without any one of them", live, total, height)
+		}
+	}
+	return nil
+}
+
+// generatedNodeName matches the names of the nodes the generator creates.
+var generatedNodeName = regexp.MustCompile(`^(seed|validator|full|light)\d{2}$`)
+
+const (
+	// defaultChainIDPrefix starts the generated chain IDs, unless
+	// generateConfig.chainIDPrefix is set.
+	defaultChainIDPrefix = "e2e"
+
+	// maxChainIDPrefixLen bounds the length of chain ID prefixes, so that the
+	// generated chain IDs, including their topology, hash and a suffix in
+	// case of a collision, stay within types.MaxChainIDLen.
+	maxChainIDPrefixLen = 32
+)
+
+// chainIDPrefixRegexp matches valid chain ID prefixes, see
+// maxChainIDPrefixLen.
+var chainIDPrefixRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,32}$`)
+
+// Generate generates random testnets using an RNG seeded with cfg.seed. The
+// seed and the generator version are recorded in every manifest, so that the
+// same set of testnets can later be reproduced with GenerateFromSeed. It also
+// returns an estimate of the resources needed by each testnet.
+func Generate(cfg *generateConfig) ([]e2e.Manifest, []TestnetEstimate, error) {
+	manifests := []e2e.Manifest{}
+	var err error
+	GenerateSeq(cfg)(func(manifest e2e.Manifest, genErr error) bool {
+		if genErr != nil {
+			err = genErr
+			return false
+		}
+		manifests = append(manifests, manifest)
+		return true
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.coverage {
+		fmt.Print(NewCoverageReport(manifests))
+	}
+	return manifests, EstimateTestnets(manifests), nil
+}
+
+// GenerateSeq returns a sequence of the testnets generated by Generate, which
+// yields them one at a time, in the same order, as they are generated. It has
+// the shape of an iter.Seq2, and stops early when yield returns false. A
+// failure is yielded as the last element of the sequence, with an empty
+// manifest. The sequence can only be lazy without a node budget: when
+// cfg.maxTotalNodes is set, all testnets are generated before the first one is
+// yielded, to decide which ones to drop. With cfg.skipDuplicates, testnets
+// sharing the fingerprint of an earlier one are skipped. Unlike Generate, it
+// does not print a coverage report.
+func GenerateSeq(cfg *generateConfig) func(yield func(e2e.Manifest, error) bool) {
+	return func(yield func(e2e.Manifest, error) bool) {
+		upgradeVersion, restore, err := prepareGenerate(cfg)
+		if err != nil {
+			yield(e2e.Manifest{}, err)
+			return
+		}
+		defer restore()
+		genVersion := generatorVersion()
+
+		// Like the weighted versions, pinned versions are resolved once.
+		if len(cfg.pinnedVersions) > 0 {
+			pinned, err := resolvePinnedVersions(cfg.pinnedVersions, cfg.outputDir)
+			if err != nil {
+				yield(e2e.Manifest{}, err)
+				return
+			}
+			resolvedCfg := *cfg
+			resolvedCfg.pinnedVersions = pinned
+			cfg = &resolvedCfg
+		}
+
+		i := 0
+		fingerprints := map[string]bool{}
+		chainIDs := map[string]bool{}
+		emit := func(opt map[string]interface{}, manifest e2e.Manifest) bool {
+			// Chain ID hashes may collide, even if their seeds don't.
+			chainID := manifest.ChainID
+			for n := 2; chainIDs[manifest.ChainID]; n++ {
+				manifest.ChainID = fmt.Sprintf("%s-%d", chainID, n)
+			}
+			chainIDs[manifest.ChainID] = true
+			manifest, err := finishManifest(cfg, i, opt, manifest, genVersion)
+			i++
+			if err != nil {
+				yield(e2e.Manifest{}, err)
+				return false
+			}
+			if cfg.skipDuplicates {
+				fingerprint := manifest.Fingerprint()
+				if fingerprints[fingerprint] {
+					return true
+				}
+				fingerprints[fingerprint] = true
+			}
+			return yield(manifest, nil)
+		}
+
+		if cfg.maxTotalNodes > 0 {
+			manifests, opts, err := budgetTestnets(cfg, upgradeVersion)
+			if err != nil {
+				yield(e2e.Manifest{}, err)
+				return
+			}
+			for j := range manifests {
+				if !emit(opts[j], manifests[j]) {
+					return
+				}
+			}
+			return
+		}
+		if err := eachTestnet(cfg, upgradeVersion, emit); err != nil {
+			yield(e2e.Manifest{}, err)
+		}
+	}
 }
 
-// Generate generates random testnets using the given RNG.
-func Generate(cfg *generateConfig) ([]e2e.Manifest, error) {
-	upgradeVersion := ""
+// prepareGenerate validates cfg and sets up the node versions and databases
+// to choose from. It returns the version to upgrade to, if any, and a function
+// restoring the versions and databases once generation is done.
+func prepareGenerate(cfg *generateConfig) (upgradeVersion string, restore func(), err error) {
+	if err := cfg.Validate(); err != nil {
+		return "", nil, err
+	}
+	versions, databases := nodeVersions, nodeDatabases
+	defer func() {
+		if err != nil {
+			nodeVersions, nodeDatabases = versions, databases
+		}
+	}()
 
 	if cfg.multiVersion != "" {
-		var err error
-		nodeVersions, upgradeVersion, err = parseWeightedVersions(cfg.multiVersion)
+		nodeVersions, upgradeVersion, err = parseWeightedVersions(cfg.multiVersion, cfg.outputDir)
 		if err != nil {
-			return nil, err
+			return "", nil, err
 		}
 		if _, ok := nodeVersions["local"]; ok {
 			nodeVersions[""] = nodeVersions["local"]
@@ -92,7 +1148,7 @@ func Generate(cfg *generateConfig) ([]e2e.Manifest, error) {
 		if _, ok := nodeVersions["latest"]; ok {
 			latestVersion, err := gitRepoLatestReleaseVersion(cfg.outputDir)
 			if err != nil {
-				return nil, err
+				return "", nil, err
 			}
 			nodeVersions[latestVersion] = nodeVersions["latest"]
 			delete(nodeVersions, "latest")
@@ -101,6 +1157,30 @@ func Generate(cfg *generateConfig) ([]e2e.Manifest, error) {
 			}
 		}
 	}
+	if cfg.upgradeAtHeight > 0 {
+		latestVersion, err := gitRepoLatestReleaseVersion(cfg.outputDir)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to find the latest release to upgrade from: %w", err)
+		}
+		if latestVersion == "" {
+			return "", nil, fmt.Errorf("found no release of version %v to upgrade from", version.TMCoreSemVer)
+		}
+		nodeVersions = weightedChoice{latestVersion: 1}
+	}
+	if cfg.databaseWeights != nil {
+		nodeDatabases = weightedChoice{}
+		for database, weight := range cfg.databaseWeights {
+			if weight > 0 {
+				nodeDatabases[database] = weight
+			}
+		}
+	}
+	if cfg.noCgo {
+		nodeDatabases = pureGoDatabases()
+	}
+	if len(nodeDatabases) == 0 {
+		return "", nil, errors.New("no database left to generate, all of them have no weight or require cgo")
+	}
 	fmt.Println("Generating testnet with weighted versions:")
 	for ver, wt := range nodeVersions {
 		if ver == "" {
@@ -109,260 +1189,2523 @@ func Generate(cfg *generateConfig) ([]e2e.Manifest, error) {
 			fmt.Printf("- %s: %d\n", ver, wt)
 		}
 	}
-	manifests := []e2e.Manifest{}
-	for _, opt := range combinations(testnetCombinations) {
-		manifest, err := generateTestnet(cfg.randSource, opt, upgradeVersion, cfg.prometheus)
+	return upgradeVersion, func() { nodeVersions, nodeDatabases = versions, databases }, nil
+}
+
+// budgetTestnets generates all testnets, and drops the largest ones until
+// they fit within cfg.maxTotalNodes. It also returns the options used for each
+// remaining testnet.
+func budgetTestnets(cfg *generateConfig, upgradeVersion string) ([]e2e.Manifest, []map[string]interface{}, error) {
+	manifests, opts, err := generateTestnets(cfg, upgradeVersion)
+	if err != nil || countNodes(manifests) <= cfg.maxTotalNodes {
+		return manifests, opts, err
+	}
+	// Start over with minimal "large" testnets, rather than resizing
+	// individual testnets, so that the result only depends on the seed
+	// and the budget.
+	minimizedCfg := *cfg
+	minimizedCfg.minimizeLarge = true
+	manifests, opts, err = generateTestnets(&minimizedCfg, upgradeVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+	for countNodes(manifests) > cfg.maxTotalNodes {
+		largest := 0
+		for i, m := range manifests {
+			if len(m.Nodes) >= len(manifests[largest].Nodes) {
+				largest = i
+			}
+		}
+		fmt.Printf("Dropping testnet %v with %d nodes to fit the budget of %d nodes\n",
+			opts[largest], len(manifests[largest].Nodes), cfg.maxTotalNodes)
+		manifests = append(manifests[:largest], manifests[largest+1:]...)
+		opts = append(opts[:largest], opts[largest+1:]...)
+	}
+	return manifests, opts, nil
+}
+
+// finishManifest applies cfg's overrides to the i-th generated testnet,
+// validates it, and records the seed and generator version in it.
+func finishManifest(
+	cfg *generateConfig, i int, opt map[string]interface{}, manifest e2e.Manifest, genVersion string,
+) (e2e.Manifest, error) {
+	if cfg.logger != nil {
+		logNodeChoices(cfg.logger, cfg.seed, i, opt, manifest)
+	}
+	if cfg.overrides != nil {
+		var err error
+		manifest, err = manifest.Merge(*cfg.overrides)
 		if err != nil {
-			return nil, err
+			return e2e.Manifest{}, fmt.Errorf("failed to apply overrides to testnet %v: %w", opt, err)
+		}
+	}
+	if err := manifest.Validate(); err != nil {
+		return e2e.Manifest{}, fmt.Errorf("generated invalid testnet %v: %w", opt, err)
+	}
+	manifest.GeneratorSeed = cfg.seed
+	manifest.GeneratorVersion = genVersion
+	if cfg.validateSchema {
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(manifest); err != nil {
+			return e2e.Manifest{}, err
+		}
+		if err := e2e.ValidateManifestBytes(buf.Bytes()); err != nil {
+			return e2e.Manifest{}, fmt.Errorf("generated manifest does not match the schema: %w", err)
+		}
+	}
+	return manifest, nil
+}
+
+// generateTestnets generates a testnet for each combination of testnet
+// options, or for cfg.numTestnets sampled combinations, using a fresh RNG
+// seeded with cfg.seed. It also returns the options used for each testnet.
+func generateTestnets(cfg *generateConfig, upgradeVersion string) ([]e2e.Manifest, []map[string]interface{}, error) {
+	manifests := []e2e.Manifest{}
+	var opts []map[string]interface{}
+	err := eachTestnet(cfg, upgradeVersion, func(opt map[string]interface{}, manifest e2e.Manifest) bool {
+		manifests = append(manifests, manifest)
+		opts = append(opts, opt)
+		return true
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return manifests, opts, nil
+}
+
+// eachTestnet is the lazy counterpart of generateTestnets, which passes each
+// testnet matching cfg.filter, if any, to fn along with its options as soon as
+// it is generated, until fn returns false.
+func eachTestnet(cfg *generateConfig, upgradeVersion string, fn func(map[string]interface{}, e2e.Manifest) bool) error {
+	r := rand.New(rand.NewSource(cfg.seed)) //nolint:gosec
+	if cfg.numTestnets > 0 && cfg.filter != nil {
+		return eachFilteredTestnet(r, cfg, upgradeVersion, fn)
+	}
+	var opts []map[string]interface{}
+	if cfg.numTestnets > 0 {
+		opts = sampleCombinations(r, testnetCombinations, testnetCombinationWeights, cfg.numTestnets)
+	} else {
+		opts = combinations(testnetCombinations)
+	}
+	for _, opt := range opts {
+		manifest, err := generateTestnet(r, opt, upgradeVersion, cfg)
+		if err != nil {
+			return err
+		}
+		if cfg.filter != nil && !cfg.filter(manifest) {
+			continue
+		}
+		if !fn(opt, manifest) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// eachFilteredTestnet samples one combination of testnet options at a time,
+// and passes the testnets matching cfg.filter to fn, until cfg.numTestnets of
+// them matched or fn returns false. It fails once it has generated
+// cfg.filterAttempts testnets without enough matches.
+func eachFilteredTestnet(
+	r *rand.Rand, cfg *generateConfig, upgradeVersion string, fn func(map[string]interface{}, e2e.Manifest) bool,
+) error {
+	attempts := cfg.filterAttempts
+	if attempts == 0 {
+		attempts = defaultFilterAttempts
+	}
+	matches := 0
+	for attempt := 0; matches < cfg.numTestnets; attempt++ {
+		if attempt == attempts {
+			return fmt.Errorf("only %d of %d testnets matched the filter after %d attempts",
+				matches, cfg.numTestnets, attempts)
+		}
+		opt := sampleCombinations(r, testnetCombinations, testnetCombinationWeights, 1)[0]
+		manifest, err := generateTestnet(r, opt, upgradeVersion, cfg)
+		if err != nil {
+			return err
+		}
+		if !cfg.filter(manifest) {
+			continue
+		}
+		matches++
+		if !fn(opt, manifest) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// countNodes returns the total number of nodes across all manifests.
+func countNodes(manifests []e2e.Manifest) int {
+	total := 0
+	for _, m := range manifests {
+		total += len(m.Nodes)
+	}
+	return total
+}
+
+// GenerateFromSeed regenerates the testnets produced by a previous run with
+// the given seed, e.g. as recorded in a manifest's generator_seed field. All
+// other options are taken from cfg, which is left unmodified.
+func GenerateFromSeed(seed int64, cfg *generateConfig) ([]e2e.Manifest, []TestnetEstimate, error) {
+	seededCfg := *cfg
+	seededCfg.seed = seed
+	return Generate(&seededCfg)
+}
+
+// pureGoDatabases returns nodeDatabases without the databases that require
+// cgo, warning about the ones it drops.
+func pureGoDatabases() weightedChoice {
+	databases := weightedChoice{}
+	dropped := []string{}
+	for database, weight := range nodeDatabases {
+		if cgoDatabases[database.(string)] {
+			dropped = append(dropped, database.(string))
+		} else {
+			databases[database] = weight
+		}
+	}
+	sort.Strings(dropped)
+	if len(dropped) > 0 {
+		fmt.Printf("Warning: not generating the %v databases, which require cgo\n", strings.Join(dropped, ", "))
+	}
+	return databases
+}
+
+// generatorVersion returns the Git commit the generator was built from. It
+// prefers the hash injected by the Makefile, falls back to the VCS information
+// embedded by the Go toolchain and finally to the CometBFT version.
+func generatorVersion() string {
+	if version.TMGitCommitHash != "" {
+		return version.TMGitCommitHash
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" && setting.Value != "" {
+				return setting.Value
+			}
+		}
+	}
+	return version.TMCoreSemVer
+}
+
+// generateTestnet generates a single testnet with the given options.
+func generateTestnet(r *rand.Rand, opt map[string]interface{}, upgradeVersion string, cfg *generateConfig) (e2e.Manifest, error) {
+	ipStack := ipStacks.Choose(r).(string)
+	manifest := e2e.Manifest{
+		IPv6:             ipStack == "ipv6",
+		ABCIProtocol:     nodeABCIProtocols.Choose(r).(string),
+		InitialHeight:    int64(opt["initialHeight"].(int)),
+		InitialState:     opt["initialState"].(map[string]string),
+		Validators:       &map[string]int64{},
+		ValidatorUpdates: map[string]map[string]int64{},
+		Evidence:         evidence.Choose(r).(int),
+		Nodes:            map[string]*e2e.ManifestNode{},
+		UpgradeVersion:   upgradeVersion,
+		Prometheus:       cfg.prometheus,
+		KeySeed:          cfg.keySeed,
+		SharedNodeKeys:   cfg.sharedNodeKeys,
+	}
+	manifest.ABCIApp = cfg.abciApp
+	kvstore := cfg.abciApp == "" || cfg.abciApp == e2e.ABCIAppKVStore
+	if !kvstore {
+		manifest.InitialState = map[string]string{}
+		if manifest.ABCIProtocol == string(e2e.ProtocolBuiltin) || manifest.ABCIProtocol == string(e2e.ProtocolBuiltinConnSync) {
+			socketProtocols := uniformChoice{}
+			for _, protocol := range nodeABCIProtocols {
+				if protocol != string(e2e.ProtocolBuiltin) && protocol != string(e2e.ProtocolBuiltinConnSync) {
+					socketProtocols = append(socketProtocols, protocol)
+				}
+			}
+			manifest.ABCIProtocol = socketProtocols.Choose(r).(string)
+		}
+	}
+	if len(manifest.InitialState) > 0 && largeInitialStates.Choose(r).(bool) {
+		manifest.InitialState = largeInitialState(500)
+	}
+	if len(manifest.InitialState) > 0 && cfg.initialStateGen != nil {
+		manifest.InitialState = cfg.initialStateGen(r)
+	}
+
+	delays := abciDelayPresets[abciDelays.Choose(r).(string)]
+	manifest.PrepareProposalDelay = delays.prepareProposal
+	manifest.ProcessProposalDelay = delays.processProposal
+	manifest.CheckTxDelay = delays.checkTx
+	manifest.VoteExtensionDelay = delays.voteExtension
+	manifest.FinalizeBlockDelay = delays.finalizeBlock
+	manifest.PrepareProposalJitter = delays.prepareProposalJitter
+	manifest.ProcessProposalJitter = delays.processProposalJitter
+
+	// The connection-synchronized builtin client doesn't serialize calls
+	// across ABCI connections, and behaves badly when PrepareProposal takes
+	// long, so testnets with large delays fall back to the builtin protocol.
+	// Don't remove this before large delays pass with builtin_connsync.
+	if manifest.ABCIProtocol == string(e2e.ProtocolBuiltinConnSync) &&
+		delays.prepareProposal+delays.prepareProposalJitter > connSyncMaxPrepareProposalDelay {
+		manifest.ABCIProtocol = string(e2e.ProtocolBuiltin)
+	}
+
+	manifest.ConsensusParams.EvidenceMaxAgeNumBlocks = evidenceMaxAges.Choose(r).(int64)
+	evidenceAge := manifest.ConsensusParams.EvidenceMaxAgeNumBlocks
+
+	if voteExtensionEnabled.Choose(r).(bool) {
+		manifest.VoteExtensionsEnableHeight = manifest.InitialHeight + voteExtensionEnableHeightOffset.Choose(r).(int64)
+	}
+
+	manifest.VoteExtensionSize = voteExtensionSize.Choose(r).(uint)
+	manifest.LoadProfile = generateLoadProfile(r, manifest)
+
+	var numSeeds, numValidators, numFulls, numLightClients int
+	topology := opt["topology"].(string)
+	if topology == "quad" {
+		topology = quadTopologies.Choose(r).(string)
+	}
+	switch topology {
+	case "single":
+		numValidators = 1
+	case "quad":
+		numValidators = 4
+	case "large":
+		if cfg.minimizeLarge {
+			numSeeds, numLightClients, numValidators, numFulls = 1, 1, 4, 1
+			break
+		}
+		// FIXME Networks are kept small since large ones use too much CPU.
+		numSeeds = r.Intn(2)
+		numLightClients = r.Intn(3)
+		numValidators = 4 + r.Intn(4)
+		numFulls = r.Intn(4)
+	case "ring":
+		// Keep the ring small enough that only a single validator starts late,
+		// so the remaining validators always form a connected path.
+		numValidators = 4 + r.Intn(3)
+	case "star":
+		// A single full node acts as the hub, see the peer setup below.
+		numValidators = 4 + r.Intn(3)
+		numFulls = 1
+	case "bridge":
+		// Two equally sized validator clusters, connected only through one or
+		// two bridge full nodes, see the peer setup below.
+		numValidators = 6 + 2*r.Intn(2)
+		numFulls = 1 + r.Intn(2)
+	default:
+		return manifest, fmt.Errorf("unknown topology %q", opt["topology"])
+	}
+	if topology == "large" {
+		switch {
+		case cfg.noLightClients:
+			numLightClients = 0
+		case cfg.forceLightClients > 0:
+			numLightClients = cfg.forceLightClients
+		}
+	}
+	if cfg.seedOnlyDiscovery && topology != "ring" && topology != "star" && topology != "bridge" {
+		manifest.SeedOnlyDiscovery = true
+		numSeeds = max(numSeeds, 1)
+	}
+
+	// Every node makes its own choices with an RNG derived from its name, so
+	// that choices added to a node don't change those made for the others.
+	nodeSeed := r.Int63()
+	manifest.ChainID = generateChainID(cfg.chainIDPrefix, topology, nodeSeed)
+
+	// First we generate seed nodes, starting at the initial height.
+	for i := 1; i <= numSeeds; i++ {
+		name := fmt.Sprintf("seed%02d", i)
+		manifest.Nodes[name] = generateNode(
+			nodeRand(nodeSeed, name), e2e.ModeSeed, 0, evidenceAge, false)
+		pinVersion(cfg, name, manifest.Nodes[name])
+		if cfg.seedContention {
+			manifest.Nodes[name].MaxInboundPeers = seedPeerLimits.inbound
+			manifest.Nodes[name].MaxOutboundPeers = seedPeerLimits.outbound
+		}
+	}
+
+	// Delayed nodes are started spacing heights apart, beginning spacing
+	// heights after the initial height. They never start at the initial
+	// height itself, since they would then be started as initial nodes.
+	spacing := defaultScheduleSpacing
+	if cfg.scheduleSpacing != nil {
+		spacing = *cfg.scheduleSpacing
+	}
+	initialHeight := manifest.InitialHeight
+	if initialHeight < 1 {
+		initialHeight = 1
+	}
+	firstStartAt := manifest.InitialHeight + spacing
+	if firstStartAt <= initialHeight {
+		firstStartAt = initialHeight + 1
+	}
+
+	// Delayed start heights are optionally jittered, by less than the spacing
+	// so that nodes keep starting in the same order. The jitter has its own
+	// RNG, so that it doesn't change any other choice.
+	jitterRand := nodeRand(nodeSeed, "start_at_jitter")
+	jitter := func(startAt int64) int64 {
+		if !cfg.startAtJitter || spacing <= 1 {
+			return startAt
+		}
+		return startAt + jitterRand.Int63n(min(maxStartAtJitter, spacing-1)+1)
+	}
+
+	// Next, we generate validators. We make sure a BFT quorum of validators start
+	// at the initial height, and that we have two archive nodes. We also set up
+	// the initial validator set, and validator set updates for delayed nodes.
+	// With dedicated archives, which are full nodes, validators aren't forced
+	// to be archives. Star and bridge testnets give their full nodes fixed
+	// roles, so they keep their archive validators.
+	dedicatedArchives := cfg.dedicatedArchives > 0 && topology != "star" && topology != "bridge"
+	nextStartAt := firstStartAt
+	quorum := numValidators*2/3 + 1
+	growth := cfg.validatorGrowth
+	if growth != nil && (topology == "quad" || topology == "large") {
+		numValidators, quorum = growth.target, growth.start
+	} else {
+		growth = nil
+	}
+	minimalQuorum := cfg.minimalQuorum && topology != "bridge"
+	if minimalQuorum {
+		quorum = minimalQuorumSize(numValidators)
+	}
+	var grownPower int64
+	for i := 1; i <= numValidators; i++ {
+		startAt := int64(0)
+		switch {
+		case i <= quorum:
+		case minimalQuorum:
+			startAt = e2e.StartAtNever
+		case growth != nil:
+			// Growing validators start on schedule, one interval before
+			// joining.
+			startAt = nextStartAt
+			nextStartAt += growth.interval
+		default:
+			startAt = jitter(nextStartAt)
+			nextStartAt += spacing
+		}
+		name := fmt.Sprintf("validator%02d", i)
+		forceArchive := i <= 2 && !dedicatedArchives
+		manifest.Nodes[name] = generateNode(
+			nodeRand(nodeSeed, name), e2e.ModeValidator, startAt, evidenceAge, forceArchive)
+		pinVersion(cfg, name, manifest.Nodes[name])
+		if startAt == e2e.StartAtNever {
+			node := manifest.Nodes[name]
+			node.Perturb, node.FlapInterval, node.DiskBandwidth = nil, 0, 0
+		}
+		if forceArchive {
+			manifest.ArchiveNodes = append(manifest.ArchiveNodes, name)
+		}
+
+		power := int64(30 + r.Intn(71))
+		switch {
+		case topology == "bridge":
+			// With equal power, neither cluster alone holds a BFT quorum.
+			power = 100
+		case cfg.equalPower:
+			power = equalValidatorPower
+		case cfg.powerDistribution != nil:
+			power = cfg.powerDistribution.power(i, min(quorum, numValidators))
+		case minimalQuorum:
+			power = minimalQuorumPower(i, numValidators)
+		case growth != nil && startAt > 0:
+			power = min(power, (grownPower-1)/2)
+		}
+		grownPower += power
+		switch {
+		case startAt == 0 || startAt == e2e.StartAtNever:
+			(*manifest.Validators)[name] = power
+		case growth != nil:
+			manifest.ValidatorUpdates[fmt.Sprint(startAt+growth.interval)] = map[string]int64{name: power}
+		default:
+			// With small spacings, several validators may join at once.
+			updateHeight := fmt.Sprint(startAt + spacing)
+			if manifest.ValidatorUpdates[updateHeight] == nil {
+				manifest.ValidatorUpdates[updateHeight] = map[string]int64{}
+			}
+			manifest.ValidatorUpdates[updateHeight][name] = power
+		}
+	}
+
+	if manifest.Evidence > 0 {
+		generateMisbehaviors(r, manifest)
+	}
+
+	limitGenesisClockSkew(manifest)
+
+	// Move validators to InitChain if specified.
+	switch opt["validators"].(string) {
+	case "genesis":
+	case "initchain":
+		manifest.ValidatorUpdates["0"] = *manifest.Validators
+		manifest.Validators = &map[string]int64{}
+	default:
+		return manifest, fmt.Errorf("invalid validators option %q", opt["validators"])
+	}
+	if cfg.powerDistribution != nil && topology != "bridge" {
+		if err := validatePowerShares(manifest); err != nil {
+			return manifest, fmt.Errorf("power distribution: %w", err)
+		}
+	}
+	if cfg.validatorChurn && topology != "bridge" {
+		generateValidatorChurn(r, manifest)
+	}
+	// With equal powers, proposers rotate round-robin, so the tests can check
+	// that every validator takes its turns.
+	manifest.AssertProposerFairness = cfg.equalPower
+	if minimalQuorum {
+		if err := validateMinimalQuorum(manifest); err != nil {
+			return manifest, fmt.Errorf("minimal quorum: %w", err)
+		}
+	}
+	if cfg.keyRotation {
+		generateKeyRotation(r, manifest)
+	}
+
+	// Finally, we generate random full nodes.
+	for i := 1; i <= numFulls; i++ {
+		startAt := int64(0)
+		if topology != "star" && topology != "bridge" && r.Float64() >= 0.5 {
+			startAt = jitter(nextStartAt)
+			nextStartAt += spacing
+		}
+		name := fmt.Sprintf("full%02d", i)
+		manifest.Nodes[name] = generateNode(
+			nodeRand(nodeSeed, name), e2e.ModeFull, startAt, evidenceAge, false)
+		pinVersion(cfg, name, manifest.Nodes[name])
+	}
+	if dedicatedArchives {
+		generateDedicatedArchives(cfg, &manifest, cfg.dedicatedArchives, nodeSeed, evidenceAge)
+	}
+	if cfg.catchUpStorm > 0 && topology != "star" && topology != "bridge" {
+		generateCatchUpStorm(r, manifest, cfg.catchUpStorm, nextStartAt+catchUpStormDelay)
+	}
+	if cfg.sentryNodes && topology != "ring" && topology != "star" && topology != "bridge" {
+		generateSentries(r, cfg, manifest, nodeSeed, evidenceAge)
+	}
+	if cfg.shortRetention && manifest.Evidence > 0 {
+		generateShortRetention(r, manifest, evidenceAge)
+	}
+	if cfg.bootstrapFromSnapshot {
+		generateSnapshotBootstrap(&manifest, firstStartAt-1)
+	}
+	reconcileStateSync(&manifest)
+	generateBlockParams(r, &manifest)
+	if appConfigApplicable(manifest) && mixedVoteExtensions.Choose(r).(bool) {
+		generateAppConfig(r, manifest)
+	}
+	if len(mempoolNodeNames(manifest)) >= 4 && mempoolCachesDisabled.Choose(r).(bool) {
+		generateMempoolCacheDisabled(r, manifest)
+	}
+	reconcileRPCSurface(manifest)
+	reconcileZoneLatencies(&manifest)
+	reconcileSnapshotFormats(manifest)
+
+	lightProviders := generateTopology(r, &manifest, topology)
+	wireSentries(manifest)
+
+	if cfg.deterministic {
+		for _, node := range manifest.Nodes {
+			sort.Strings(node.Seeds)
+			sort.Strings(node.PersistentPeers)
+		}
+	}
+
+	if kvstore {
+		reconcileInitialAppHash(&manifest)
+	}
+
+	// lastly, set up the light clients
+	if numLightClients > 0 && len(lightProviders) < 2 {
+		return manifest, fmt.Errorf("light clients need at least 2 providers, found %d", len(lightProviders))
+	}
+	primaries := lightPrimaries(r, lightProviders, numLightClients)
+	for i := 1; i <= numLightClients; i++ {
+		name := fmt.Sprintf("light%02d", i)
+		manifest.Nodes[name] = generateLightNode(
+			nodeRand(nodeSeed, name), jitter(firstStartAt+(spacing*int64(i))), manifest.InitialHeight, primaries[i-1],
+			lightProviders,
+		)
+		pinVersion(cfg, name, manifest.Nodes[name])
+	}
+	if cfg.mempoolFlood {
+		generateMempoolFlood(r, manifest)
+	}
+
+	reconcileTestnet(r, cfg, &manifest, ipStack)
+	return manifest, nil
+}
+
+// limitGenesisClockSkew bounds the total clock skew of the validators starting
+// at genesis, removing the skews beyond genesisClockSkewBudget. It must run
+// once all validators exist.
+func limitGenesisClockSkew(manifest e2e.Manifest) {
+	skewBudget := genesisClockSkewBudget
+	for _, name := range nodeNamesByMode(manifest, e2e.ModeValidator) {
+		node := manifest.Nodes[name]
+		if node.StartAt != 0 {
+			continue
+		}
+		skew := node.ClockSkew
+		if skew < 0 {
+			skew = -skew
+		}
+		if skew > skewBudget {
+			node.ClockSkew = 0
+		} else {
+			skewBudget -= skew
+		}
+	}
+}
+
+// reconcileZoneLatencies adds the latencies between the zones of all nodes.
+func reconcileZoneLatencies(manifest *e2e.Manifest) {
+	for _, name := range sortedNodeNames(*manifest) {
+		zone := manifest.Nodes[name].Zone
+		if zone == "" {
+			continue
+		}
+		if manifest.ZoneLatencies == nil {
+			manifest.ZoneLatencies = map[string]map[string]time.Duration{}
+		}
+		manifest.ZoneLatencies[zone] = map[string]time.Duration{}
+		for otherZone, latency := range zoneLatencies[zone] {
+			manifest.ZoneLatencies[zone][otherZone] = latency
+		}
+	}
+}
+
+// reconcileSnapshotFormats makes state syncing nodes use the snapshot format
+// of the first archive node, since they can only restore snapshots of their
+// own format. Nodes not running the local version only support the default
+// format, which the archive node must then use.
+//
+// There must be an archive node taking snapshots. generateTestnet ensures it
+// by adding either the forced archive validators or the dedicated archive full
+// nodes, which all take snapshots, to manifest.ArchiveNodes before this runs.
+func reconcileSnapshotFormats(manifest e2e.Manifest) {
+	archive := manifest.Nodes[manifest.ArchiveNodes[0]]
+	for _, name := range sortedNodeNames(manifest) {
+		if node := manifest.Nodes[name]; node.StateSync && node.Version != "" {
+			archive.SnapshotFormat = 0
+		}
+	}
+	for _, name := range sortedNodeNames(manifest) {
+		if node := manifest.Nodes[name]; node.StateSync {
+			node.SnapshotFormat = archive.SnapshotFormat
+		}
+	}
+}
+
+// reconcileInitialAppHash sets the initial app hash expected from the kvstore
+// application. Older versions of the application may hash their state
+// differently, so it is only known if all nodes run the local version, and
+// this must run once the versions of all nodes but light clients are settled.
+func reconcileInitialAppHash(manifest *e2e.Manifest) {
+	for _, node := range manifest.Nodes {
+		if node.Version != "" {
+			return
+		}
+	}
+	manifest.ExpectedInitialAppHash = hex.EncodeToString(app.InitChainAppHash(manifest.InitialState))
+}
+
+// reconcileTestnet runs the passes which depend on every node of a testnet,
+// including light clients, having been generated. They run in order, each
+// one relying on the choices settled by the ones before it.
+func reconcileTestnet(r *rand.Rand, cfg *generateConfig, manifest *e2e.Manifest, ipStack string) {
+	reconcileClockSkew(*manifest)
+	if cfg.upgradeAtHeight > 0 {
+		reconcileUpgrade(manifest, cfg.upgradeAtHeight)
+	}
+	reconcilePerturbations(r, cfg, *manifest)
+
+	// Which validators can be absent depends on the perturbations of the
+	// others, and on the peers of every node, but the nodes recovering from a
+	// corrupted database must only count on the ones which start.
+	if cfg.absentValidators > 0 {
+		generateAbsentValidators(r, *manifest, cfg.absentValidators)
+	}
+
+	// Which full node can be promoted depends on the perturbations of every
+	// node, and on the absent validators.
+	if cfg.observerPromotion {
+		generateObserverPromotion(r, cfg, *manifest)
+	}
+
+	// Full nodes of builtin_connsync testnets always check that they replay
+	// their blocks consistently after being killed and restarted.
+	if !cfg.noPerturbations {
+		generateReplayAssertions(*manifest)
+	}
+
+	// Whether a node can recover from a corrupted database depends on the
+	// other nodes, so this must happen once all nodes exist.
+	generateRecoveryModes(r, *manifest)
+
+	// Which nodes are archive nodes is only settled once their recovery
+	// modes are.
+	if cfg.archiveBlackoutAt > 0 {
+		generateArchiveBlackout(manifest, cfg.archiveBlackoutAt)
+	}
+	if cfg.restartAllAt > 0 {
+		generateGlobalRestart(manifest, cfg.restartAllAt)
+	}
+
+	// Light clients must trust a block one of their providers still retains,
+	// so this must happen once their retention is settled.
+	reconcileLightTrust(*manifest)
+
+	reconcileKeyTypes(cfg, *manifest)
+
+	if ipStack == "dual" {
+		generateAddressFamilies(r, *manifest)
+	}
+
+	// Which nodes can be behind NAT depends on their peers, including the
+	// implicit ones of dual-stack testnets.
+	reconcileNAT(*manifest)
+	if cfg.degradedLink {
+		generateDegradedLink(r, manifest)
+	}
+
+	// Whether gossip rates suffice depends on the load and block interval of
+	// the testnet, which are settled by now.
+	if cfg.throttleGossip {
+		generateThrottledGossip(r, manifest)
+	} else {
+		reconcileGossipRates(*manifest)
+	}
+
+	manifest.GenesisTimeOffset = cfg.genesisTimeOffset
+	manifest.ExpectedFirstBlockBy, manifest.ExpectedCatchUpBy = StartupSLAs(*manifest)
+	reconcileStartupBackoff(*manifest)
+	reconcilePeerLimits(*manifest)
+	manifest.MetricThresholds = MetricThresholds(*manifest)
+	reconcileDebugPorts(*manifest)
+}
+
+// reconcileClockSkew removes clock skews from testnets whose nodes don't run
+// CometBFT in the node process, which offsets the clocks, i.e. testnets
+// without a builtin protocol.
+func reconcileClockSkew(manifest e2e.Manifest) {
+	if manifest.ABCIProtocol == string(e2e.ProtocolBuiltin) || manifest.ABCIProtocol == string(e2e.ProtocolBuiltinConnSync) {
+		return
+	}
+	for _, node := range manifest.Nodes {
+		node.ClockSkew = 0
+		node.Perturb = removePerturbation(node.Perturb, e2e.PerturbationSkew)
+	}
+}
+
+// reconcileUpgrade upgrades a testnet as a whole the given number of heights
+// after its initial height, in place of the 'upgrade' perturbation of single
+// nodes. Nodes starting after the upgrade run the local version right away,
+// so this must run once all start heights are settled.
+func reconcileUpgrade(manifest *e2e.Manifest, afterHeights int64) {
+	manifest.UpgradeHeight = manifest.InitialHeight + afterHeights
+	if manifest.InitialHeight == 0 {
+		manifest.UpgradeHeight++
+	}
+	for _, node := range manifest.Nodes {
+		node.Perturb = removePerturbation(node.Perturb, e2e.PerturbationUpgrade)
+		if node.StartAt >= manifest.UpgradeHeight {
+			node.Version = ""
+		}
+	}
+}
+
+// reconcilePerturbations removes the opt-in and the excess perturbations of a
+// testnet, and then applies cfg's perturbation overrides. It must run once
+// all nodes and validator powers exist.
+func reconcilePerturbations(r *rand.Rand, cfg *generateConfig, manifest e2e.Manifest) {
+	// Disk throttling is opt-in. It is removed only once all nodes exist, so
+	// that the remaining choices don't depend on it.
+	if !cfg.throttleDisk {
+		for _, node := range manifest.Nodes {
+			node.Perturb = removePerturbation(node.Perturb, e2e.PerturbationThrottleDisk)
+			node.DiskBandwidth = 0
+		}
+	}
+
+	// Which validators may keep these perturbations depends on their powers,
+	// so this must happen before forcing perturbations on the nodes left
+	// without any.
+	limitPerturbedPower(manifest, e2e.PerturbationPrivvalDisconnect)
+	limitPerturbedPower(manifest, e2e.PerturbationFlap)
+	limitPerturbedPower(manifest, e2e.PerturbationWALTruncate)
+
+	switch {
+	case cfg.noPerturbations:
+		for _, node := range manifest.Nodes {
+			node.Perturb = nil
+			node.DiskBandwidth = 0
+			node.FlapInterval = 0
+		}
+	case cfg.forcePerturbations:
+		generateForcedPerturbations(r, manifest)
+	}
+}
+
+// reconcileKeyTypes falls back to the default key type for all nodes unless
+// every node runs the local version, the only one supporting mixed key types.
+// Nodes sharing their keys across testnets must also share their key types.
+// This must run once all nodes, including light clients, exist and their
+// versions are settled.
+func reconcileKeyTypes(cfg *generateConfig, manifest e2e.Manifest) {
+	for _, name := range sortedNodeNames(manifest) {
+		if manifest.Nodes[name].Version != "" || cfg.keySeed != 0 {
+			for _, node := range manifest.Nodes {
+				node.KeyType = ""
+			}
+			return
+		}
+	}
+}
+
+// reconcileDebugPorts allocates unique host ports to the enabled debugging
+// endpoints. They are allocated from separate ranges, which don't overlap the
+// RPC ports.
+func reconcileDebugPorts(manifest e2e.Manifest) {
+	prometheusPort, pprofPort := e2e.PrometheusProxyPortFirst, e2e.PprofProxyPortFirst
+	for _, name := range sortedNodeNames(manifest) {
+		node := manifest.Nodes[name]
+		if manifest.Prometheus || node.EnablePrometheus {
+			node.PrometheusPort = prometheusPort
+			prometheusPort++
+		}
+		if node.EnablePprof {
+			node.PprofPort = pprofPort
+			pprofPort++
+		}
+	}
+}
+
+// generateTopology sets up peer discovery for the nodes of a testnet other
+// than light clients, and returns the nodes that can serve as light providers.
+// Seed nodes are fully meshed with each other, while non-seed nodes either use
+// a set of random seeds or a set of random peers that start before themselves,
+// unless the topology wires them up in a fixed way.
+func generateTopology(r *rand.Rand, manifest *e2e.Manifest, topology string) []string {
+	var seedNames, peerNames, lightProviders []string
+	for _, name := range sortedNodeNames(*manifest) {
+		node := manifest.Nodes[name]
+		if node.Mode == string(e2e.ModeSeed) {
+			seedNames = append(seedNames, name)
+		} else {
+			// if the full node or validator is an ideal candidate, it is added as a light provider.
+			// There are at least two archive nodes so there should be at least two ideal candidates.
+			// Nodes restoring a corrupted database from a snapshot lose their blocks, so they aren't.
+			if (node.StartAt == 0 || node.StartAt == manifest.InitialHeight) && node.RetainBlocks == 0 &&
+				node.RecoveryMode != string(e2e.RecoveryModeStateSync) {
+				lightProviders = append(lightProviders, name)
+			}
+			peerNames = append(peerNames, name)
+		}
+	}
+
+	for _, name := range seedNames {
+		for _, otherName := range seedNames {
+			if name != otherName {
+				manifest.Nodes[name].Seeds = append(manifest.Nodes[name].Seeds, otherName)
+			}
+		}
+	}
+
+	// Absent validators never start, so they come last, and no node picks
+	// them as a peer.
+	startAt := func(name string) int64 {
+		if node := manifest.Nodes[name]; node.StartAt != e2e.StartAtNever {
+			return node.StartAt
+		}
+		return math.MaxInt64
+	}
+	sort.Slice(peerNames, func(i, j int) bool {
+		iName, jName := peerNames[i], peerNames[j]
+		switch {
+		case startAt(iName) < startAt(jName):
+			return true
+		case startAt(iName) > startAt(jName):
+			return false
+		default:
+			return strings.Compare(iName, jName) == -1
+		}
+	})
+	switch topology {
+	case "ring":
+		// Each validator is connected to its two neighbours, forming a cycle.
+		// Validators are numbered in start order, so the delayed ones are
+		// adjacent and the ring stays connected until they start.
+		validatorNames := nodeNamesByMode(*manifest, e2e.ModeValidator)
+		for i, name := range validatorNames {
+			prev := validatorNames[(i+len(validatorNames)-1)%len(validatorNames)]
+			next := validatorNames[(i+1)%len(validatorNames)]
+			manifest.Nodes[name].PersistentPeers = []string{prev, next}
+		}
+	case "star":
+		// The hub is the only peer of every validator.
+		validatorNames := nodeNamesByMode(*manifest, e2e.ModeValidator)
+		for _, name := range validatorNames {
+			manifest.Nodes[name].PersistentPeers = []string{"full01"}
+		}
+		manifest.Nodes["full01"].PersistentPeers = validatorNames
+	case "bridge":
+		// Validators are fully meshed within their cluster, and the clusters
+		// are only connected through the bridge nodes, which peer with every
+		// validator.
+		validatorNames := nodeNamesByMode(*manifest, e2e.ModeValidator)
+		bridgeNames := nodeNamesByMode(*manifest, e2e.ModeFull)
+		clusters := [][]string{
+			validatorNames[:len(validatorNames)/2],
+			validatorNames[len(validatorNames)/2:],
+		}
+		for _, cluster := range clusters {
+			for _, name := range cluster {
+				for _, otherName := range cluster {
+					if name != otherName {
+						manifest.Nodes[name].PersistentPeers = append(manifest.Nodes[name].PersistentPeers, otherName)
+					}
+				}
+				manifest.Nodes[name].PersistentPeers = append(manifest.Nodes[name].PersistentPeers, bridgeNames...)
+			}
+		}
+		for _, name := range bridgeNames {
+			manifest.Nodes[name].PersistentPeers = validatorNames
+		}
+		manifest.BridgeNodes = bridgeNames
+	default:
+		for i, name := range peerNames {
+			if manifest.SeedOnlyDiscovery {
+				manifest.Nodes[name].Seeds = uniformSetChoice(seedNames).Choose(r)
+			} else if len(seedNames) > 0 && (i == 0 || r.Float64() >= 0.5) {
+				manifest.Nodes[name].Seeds = uniformSetChoice(seedNames).Choose(r)
+			} else if i > 0 {
+				manifest.Nodes[name].PersistentPeers = uniformSetChoice(earlierPeers(*manifest, peerNames, i)).Choose(r)
+			}
+		}
+	}
+	// Dedicated archive nodes are meant to serve light clients, so they are
+	// preferred when there are enough of them.
+	if dedicated := dedicatedArchiveNames(*manifest); len(dedicated) >= 2 {
+		lightProviders = dedicated
+	}
+	return lightProviders
+}
+
+// generateNode randomly generates a node, with some constraints to avoid
+// generating invalid configurations. We do not set Seeds or PersistentPeers
+// here, since we need to know the overall network topology and startup
+// sequencing. r is the node's own RNG, see nodeRand. Nodes pruning blocks
+// retain at least evidenceAge of them, the testnet's evidence max age.
+func generateNode(
+	r *rand.Rand, mode e2e.Mode, startAt int64, evidenceAge int64, forceArchive bool,
+) *e2e.ManifestNode {
+	node := e2e.ManifestNode{
+		Version:          nodeVersions.Choose(r).(string),
+		Mode:             string(mode),
+		StartAt:          startAt,
+		Database:         nodeDatabases.Choose(r).(string),
+		PrivvalProtocol:  nodePrivvalProtocols.Choose(r).(string),
+		BlockSyncVersion: nodeBlockSyncs.Choose(r).(string),
+		StateSync:        nodeStateSyncs.Choose(r).(bool) && startAt > 0,
+		PersistInterval:  ptrUint64(uint64(nodePersistIntervals.Choose(r).(int))),
+		SnapshotInterval: uint64(nodeSnapshotIntervals.Choose(r).(int)),
+		RetainBlocks:     uint64(nodeRetainBlocks.Choose(r).(int)) * uint64(evidenceAge),
+		Perturb:          nodePerturbations.Choose(r),
+		Zone:             nodeZones.Choose(r).(string),
+	}
+
+	if mode == e2e.ModeValidator || mode == e2e.ModeFull {
+		// Older versions of the application only support the default snapshot
+		// format and chunk size.
+		if node.Version == "" {
+			node.SnapshotFormat = nodeSnapshotFormats.Choose(r).(uint32)
+			node.SnapshotChunkSize = nodeSnapshotChunkSizes.Choose(r).(uint64)
+		}
+		node.MempoolCacheSize = ptrInt(nodeMempoolCacheSizes.Choose(r).(int))
+		node.MempoolRecheck = ptrBool(nodeMempoolRechecks.Choose(r).(bool))
+		node.RPCConfig.Unsafe = nodeRPCUnsafe.Choose(r).(bool)
+		node.RPCConfig.MaxSubscriptionsPerClient = ptrInt(nodeRPCMaxSubscriptions.Choose(r).(int))
+		timeouts := nodeTimeouts.Choose(r).(consensusTimeouts)
+		node.TimeoutPropose = timeouts.propose
+		node.TimeoutCommit = timeouts.commit
+		node.ClockSkew = nodeClockSkews.Choose(r).(time.Duration)
+		node.StartupBackoff = nodeStartupBackoffs.Choose(r).(time.Duration)
+		if node.StartupBackoff > 0 {
+			node.MaxDialRetries = nodeMaxDialRetries.Choose(r).(int)
+		}
+		node.LoadWeight = nodeLoadWeights.Choose(r).(int)
+		node.WALEnabled = ptrBool(nodeWALEnabled.Choose(r).(bool))
+		limits := nodePeerLimits.Choose(r).(peerLimits)
+		node.MaxInboundPeers, node.MaxOutboundPeers = limits.inbound, limits.outbound
+		node.SendRate = nodeGossipRates.Choose(r).(int64)
+		node.RecvRate = nodeGossipRates.Choose(r).(int64)
+	}
+	// Only votes are skewed, and full nodes don't sign any.
+	if mode != e2e.ModeValidator {
+		node.ClockSkew = 0
+		node.Perturb = removePerturbation(node.Perturb, e2e.PerturbationSkew)
+	}
+
+	reconcileVersion(&node)
+
+	// Only validators with a socket signer running the local version can have
+	// their signer disconnected.
+	if mode != e2e.ModeValidator || node.PrivvalProtocol == string(e2e.ProtocolFile) || node.Version != "" {
+		node.Perturb = removePerturbation(node.Perturb, e2e.PerturbationPrivvalDisconnect)
+	}
+
+	// Only validators with a consensus WAL can have it truncated.
+	if mode != e2e.ModeValidator || (node.WALEnabled != nil && !*node.WALEnabled) {
+		node.Perturb = removePerturbation(node.Perturb, e2e.PerturbationWALTruncate)
+	}
+
+	// Genesis validators never get throttled disks nor flap, so that the
+	// genesis quorum keeps up with the network.
+	if mode == e2e.ModeValidator && startAt == 0 {
+		node.Perturb = removePerturbation(node.Perturb, e2e.PerturbationThrottleDisk)
+		node.Perturb = removePerturbation(node.Perturb, e2e.PerturbationFlap)
+	}
+	for _, p := range node.Perturb {
+		switch p {
+		case string(e2e.PerturbationThrottleDisk):
+			node.DiskBandwidth = nodeDiskBandwidths.Choose(r).(uint64)
+		case string(e2e.PerturbationFlap):
+			node.FlapInterval = e2e.MinFlapInterval + r.Int63n(e2e.MaxFlapInterval-e2e.MinFlapInterval+1)
+		}
+	}
+
+	// Only validators running the local version may use a key type other than
+	// the testnet's, since older versions of the application do not support
+	// mixed validator key types.
+	if mode == e2e.ModeValidator && node.Version == "" {
+		node.KeyType = nodeKeyTypes.Choose(r).(string)
+	}
+
+	for _, endpoint := range nodeDebugEndpoints.Choose(r) {
+		switch endpoint {
+		case "prometheus":
+			node.EnablePrometheus = true
+		case "pprof":
+			node.EnablePprof = true
+		}
+	}
+
+	// If this node is forced to be an archive node, retain all blocks and
+	// enable state sync snapshotting.
+	if forceArchive {
+		node.RetainBlocks = 0
+		node.SnapshotInterval = 3
+	}
+
+	// Mark some validators as slow extenders, so that their ExtendVote and
+	// VerifyVoteExtension calls lag behind the rest of the network.
+	if mode == e2e.ModeValidator && r.Float64() < slowVoteExtensionThreshold {
+		node.VoteExtensionDelay = slowVoteExtensionDelay
+	}
+
+	// If a node which does not persist state also does not retain blocks, randomly
+	// choose to either persist state or retain all blocks. The latter is done
+	// by reconcileRetention.
+	if node.PersistInterval != nil && *node.PersistInterval == 0 && node.RetainBlocks > 0 && r.Float64() <= 0.5 {
+		node.PersistInterval = ptrUint64(node.RetainBlocks)
+	}
+	reconcileRetention(&node, evidenceAge)
+
+	// Only the images of the local version emulate NAT, and seeds and light
+	// clients must remain directly reachable.
+	if (mode == e2e.ModeValidator || mode == e2e.ModeFull) && node.Version == "" {
+		node.BehindNAT = nodeNATs.Choose(r).(bool)
+	}
+
+	return &node
+}
+
+// reconcileVersion clears the settings of a node that only the local version
+// supports, if it runs another version. Other versions can't offset their
+// clocks nor disconnect their signers, their images don't emulate the latency
+// of zones nor NAT, and older versions of the application only support the
+// default snapshot format and chunk size, and the testnet's key type.
+func reconcileVersion(node *e2e.ManifestNode) {
+	if node.Version == "" {
+		return
+	}
+	node.Zone = ""
+	node.BehindNAT = false
+	node.ClockSkew = 0
+	node.Perturb = removePerturbation(node.Perturb, e2e.PerturbationSkew)
+	node.Perturb = removePerturbation(node.Perturb, e2e.PerturbationPrivvalDisconnect)
+	node.SnapshotFormat = 0
+	node.SnapshotChunkSize = 0
+	node.KeyType = ""
+}
+
+// pinVersion has a node run the version pinned for it in cfg.pinnedVersions,
+// if any, instead of the one chosen at random.
+func pinVersion(cfg *generateConfig, name string, node *e2e.ManifestNode) {
+	version, ok := cfg.pinnedVersions[name]
+	if !ok {
+		return
+	}
+	node.Version = version
+	reconcileVersion(node)
+}
+
+// generateCatchUpStorm has the given fraction of full nodes, rounded up, start
+// at the same height and block sync from there. The genesis validators keep
+// the network live meanwhile, and the nodes are capped to what its archive
+// nodes can serve, see e2e.MaxSyncersPerServer. Dedicated archive nodes serve
+// the storm rather than join it.
+func generateCatchUpStorm(r *rand.Rand, manifest e2e.Manifest, fraction float64, startAt int64) {
+	fullNames := []string{}
+	for _, name := range nodeNamesByMode(manifest, e2e.ModeFull) {
+		if !slices.Contains(manifest.ArchiveNodes, name) {
+			fullNames = append(fullNames, name)
+		}
+	}
+	size := int(math.Ceil(fraction * float64(len(fullNames))))
+	archiveNodes := 0
+	for _, name := range nodeNamesByMode(manifest, e2e.ModeValidator) {
+		if node := manifest.Nodes[name]; node.StartAt == 0 && node.RetainBlocks == 0 {
+			archiveNodes++
+		}
+	}
+	archiveNodes += len(dedicatedArchiveNames(manifest))
+	if size > e2e.MaxSyncersPerServer*archiveNodes {
+		size = e2e.MaxSyncersPerServer * archiveNodes
+	}
+	for _, i := range r.Perm(len(fullNames))[:size] {
+		node := manifest.Nodes[fullNames[i]]
+		node.StartAt = startAt
+		node.StateSync = false
+		node.StartupBackoff = stormStartupBackoff
+		node.MaxDialRetries = stormMaxDialRetries
+	}
+}
+
+// generateMempoolFlood has a random full node receive the whole transaction
+// load, and all other nodes none, so that the network's mempools only fill up
+// through gossip from that node. Testnets without full nodes are left as
+// they are.
+func generateMempoolFlood(r *rand.Rand, manifest e2e.Manifest) {
+	fullNames := nodeNamesByMode(manifest, e2e.ModeFull)
+	if len(fullNames) == 0 {
+		return
+	}
+	flooder := fullNames[r.Intn(len(fullNames))]
+	for name, node := range manifest.Nodes {
+		node.SendNoLoad = name != flooder
+		node.LoadWeight = 0
+	}
+}
+
+// generateDegradedLink slows down the link from a random node running the
+// local version to one of its persistent peers, see e2e.LinkLatency. Light
+// clients, whose persistent peers are their providers, and absent validators
+// are left out, as are testnets without such a link.
+func generateDegradedLink(r *rand.Rand, manifest *e2e.Manifest) {
+	links := [][2]string{}
+	seen := map[[2]string]bool{}
+	addLink := func(from, to string) {
+		if manifest.Nodes[from].StartAt == e2e.StartAtNever || manifest.Nodes[to].StartAt == e2e.StartAtNever {
+			return
+		}
+		if manifest.Nodes[from].Version == "" && !seen[[2]string{from, to}] {
+			seen[[2]string{from, to}] = true
+			links = append(links, [2]string{from, to})
+		}
+	}
+	for _, name := range sortedNodeNames(*manifest) {
+		if nodeMode(manifest.Nodes[name]) == e2e.ModeLight {
+			continue
+		}
+		for _, peer := range manifest.Nodes[name].PersistentPeers {
+			if nodeMode(manifest.Nodes[peer]) != e2e.ModeLight {
+				addLink(name, peer)
+				addLink(peer, name)
+			}
+		}
+	}
+	if len(links) == 0 {
+		return
+	}
+	link := links[r.Intn(len(links))]
+	delay := degradedLinkDelays.Choose(r).(time.Duration)
+	manifest.LinkLatencies = []e2e.LinkLatency{{
+		From:   link[0],
+		To:     link[1],
+		Delay:  delay,
+		Jitter: delay / 10,
+		Loss:   degradedLinkLosses.Choose(r).(float64),
+	}}
+}
+
+// generateThrottledGossip limits the send and receive rates of every node but
+// light clients, which don't gossip, to one of throttledGossipRates, and marks
+// the testnet as throttled, so that its rates aren't checked against its load
+// and the runner waits longer for it, see e2e.Manifest.ThrottledGossip.
+func generateThrottledGossip(r *rand.Rand, manifest *e2e.Manifest) {
+	rate := throttledGossipRates.Choose(r).(int64)
+	for _, node := range manifest.Nodes {
+		if node.Mode == string(e2e.ModeLight) {
+			continue
+		}
+		node.SendRate, node.RecvRate = rate, rate
+	}
+	manifest.ThrottledGossip = true
+}
+
+// reconcileGossipRates resets to the CometBFT defaults the send and receive
+// rates too low for blocks to propagate within the block interval under the
+// testnet's load, see e2e.Manifest.MinGossipRate.
+func reconcileGossipRates(manifest e2e.Manifest) {
+	minRate := manifest.MinGossipRate()
+	for _, node := range manifest.Nodes {
+		if node.SendRate < minRate {
+			node.SendRate = 0
+		}
+		if node.RecvRate < minRate {
+			node.RecvRate = 0
+		}
+	}
+}
+
+// mempoolNodeNames returns the names of the validators and full nodes, whose
+// mempools are configured by the generator.
+func mempoolNodeNames(manifest e2e.Manifest) []string {
+	return append(nodeNamesByMode(manifest, e2e.ModeValidator), nodeNamesByMode(manifest, e2e.ModeFull)...)
+}
+
+// generateMempoolCacheDisabled disables the mempool cache of a random minority
+// of the validators and full nodes, i.e. less than a third of them, so that
+// they let duplicate transactions through to CheckTx, while the others
+// reject them early.
+func generateMempoolCacheDisabled(r *rand.Rand, manifest e2e.Manifest) {
+	names := mempoolNodeNames(manifest)
+	for _, i := range r.Perm(len(names))[:(len(names)-1)/3] {
+		manifest.Nodes[names[i]].MempoolCacheSize = ptrInt(0)
+	}
+}
+
+// reconcileStartupBackoff only keeps the dial retries of nodes listing seeds
+// or persistent peers to dial, and caps them so that their startup backoffs
+// add up to less than the catch-up SLA.
+func reconcileStartupBackoff(manifest e2e.Manifest) {
+	for _, node := range manifest.Nodes {
+		if node.MaxDialRetries == 0 || manifest.ExpectedCatchUpBy == 0 {
+			continue
+		}
+		if len(node.Seeds)+len(node.PersistentPeers) == 0 {
+			node.MaxDialRetries = 0
+			continue
+		}
+		if budget := time.Duration(node.MaxDialRetries) * node.StartupBackoff; budget >= manifest.ExpectedCatchUpBy {
+			node.MaxDialRetries = int((manifest.ExpectedCatchUpBy - 1) / node.StartupBackoff)
+		}
+	}
+}
+
+// reconcilePeerLimits raises the P2P connection limits of the nodes setting
+// them to what their peers require, see e2e.ManifestNode.MaxInboundPeers.
+// Nodes without seeds or persistent peers may connect to all others, see
+// e2e.Testnet, so they are counted as dialing every other node.
+func reconcilePeerLimits(manifest e2e.Manifest) {
+	inbound, outbound := map[string]int{}, map[string]int{}
+	for _, name := range sortedNodeNames(manifest) {
+		node := manifest.Nodes[name]
+		if nodeMode(node) == e2e.ModeLight {
+			continue
+		}
+		peers := node.PersistentPeers
+		if len(node.Seeds)+len(node.PersistentPeers) == 0 && !manifest.SeedOnlyDiscovery {
+			peers = slices.DeleteFunc(sortedNodeNames(manifest), func(peer string) bool { return peer == name })
+		}
+		outbound[name] = len(node.Seeds) + len(peers)
+		for _, peer := range peers {
+			inbound[peer]++
+		}
+	}
+	for name, node := range manifest.Nodes {
+		if node.MaxInboundPeers > 0 {
+			node.MaxInboundPeers = max(node.MaxInboundPeers, inbound[name])
+		}
+		if node.MaxOutboundPeers > 0 {
+			node.MaxOutboundPeers = max(node.MaxOutboundPeers, outbound[name])
+		}
+	}
+}
+
+// reconcileRPCSurface has the first validator accept websocket subscriptions
+// again if no validator nor full node does, as the testnet validation
+// requires.
+func reconcileRPCSurface(manifest e2e.Manifest) {
+	names := mempoolNodeNames(manifest)
+	for _, name := range names {
+		if limit := manifest.Nodes[name].RPCConfig.MaxSubscriptionsPerClient; limit == nil || *limit > 0 {
+			return
+		}
+	}
+	if len(names) > 0 {
+		manifest.Nodes[names[0]].RPCConfig.MaxSubscriptionsPerClient = nil
+	}
+}
+
+// generateForcedPerturbations gives a random perturbation of forcedPerturbations
+// to every unperturbed node, except for light clients, which only support the
+// upgrade perturbation, and genesis validators, which must keep the network
+// live. A corrupt_db perturbation may still be removed by
+// generateRecoveryModes, so it does not count.
+func generateForcedPerturbations(r *rand.Rand, manifest e2e.Manifest) {
+	for _, name := range sortedNodeNames(manifest) {
+		node := manifest.Nodes[name]
+		mode := nodeMode(node)
+		if mode == e2e.ModeLight || (mode == e2e.ModeValidator && node.StartAt == 0) {
+			continue
+		}
+		if len(removePerturbation(node.Perturb, e2e.PerturbationCorruptDB)) == 0 {
+			node.Perturb = append(node.Perturb, forcedPerturbations.Choose(r).(string))
+		}
+	}
+}
+
+// generateSnapshotBootstrap has the delayed validators and full nodes state sync
+// from a snapshot trusting the block at the given height, which is below the
+// start height of all of them. Only the first archive node is sure to serve snapshots
+// of their format, so at most e2e.MaxSyncersPerServer nodes state sync from
+// each height, and the others keep block syncing.
+func generateSnapshotBootstrap(manifest *e2e.Manifest, height int64) {
+	syncers := map[int64]int{}
+	for _, node := range manifest.Nodes {
+		if node.StateSync {
+			syncers[node.StartAt]++
+		}
+	}
+	for _, name := range sortedNodeNames(*manifest) {
+		node := manifest.Nodes[name]
+		mode := nodeMode(node)
+		if node.StateSync || node.StartAt <= height || (mode != e2e.ModeValidator && mode != e2e.ModeFull) ||
+			syncers[node.StartAt] >= e2e.MaxSyncersPerServer {
+			continue
+		}
+		node.StateSync = true
+		syncers[node.StartAt]++
+	}
+	if len(syncers) > 0 {
+		manifest.Snapshot = &e2e.ManifestSnapshot{Height: height}
+	}
+}
+
+// reconcileStateSync has nodes without a snapshot to restore when they start
+// block sync instead, e.g. when they start before any snapshot is taken, see
+// e2e.Manifest.StateSyncSources. The snapshot to bootstrap from is dropped if
+// no node state syncs anymore.
+func reconcileStateSync(manifest *e2e.Manifest) {
+	syncers := 0
+	for _, name := range sortedNodeNames(*manifest) {
+		node := manifest.Nodes[name]
+		if !node.StateSync {
+			continue
+		}
+		if len(manifest.StateSyncSources(name)) == 0 {
+			node.StateSync = false
+			continue
+		}
+		syncers++
+	}
+	if syncers == 0 {
+		manifest.Snapshot = nil
+	}
+}
+
+// generateDedicatedArchives adds count full nodes, numbered after the other
+// full nodes, which start with the network, retain all blocks and take
+// snapshots, so that they can serve the nodes catching up and the light
+// clients in place of the validators.
+func generateDedicatedArchives(cfg *generateConfig, manifest *e2e.Manifest, count int, nodeSeed int64, evidenceAge int64) {
+	numFulls := len(nodeNamesByMode(*manifest, e2e.ModeFull))
+	for i := 1; i <= count; i++ {
+		name := fmt.Sprintf("full%02d", numFulls+i)
+		manifest.Nodes[name] = generateNode(nodeRand(nodeSeed, name), e2e.ModeFull, 0, evidenceAge, true)
+		pinVersion(cfg, name, manifest.Nodes[name])
+		manifest.ArchiveNodes = append(manifest.ArchiveNodes, name)
+	}
+}
+
+// dedicatedArchiveNames returns the names of the dedicated archive nodes of a
+// manifest, i.e. the full nodes among its archive nodes.
+func dedicatedArchiveNames(manifest e2e.Manifest) []string {
+	names := []string{}
+	for _, name := range manifest.ArchiveNodes {
+		if node, ok := manifest.Nodes[name]; ok && nodeMode(node) == e2e.ModeFull {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// generateShortRetention has up to a third, and at least one, of the
+// validators and full nodes pruning blocks retain fewer blocks than the
+// evidence age, i.e. half of it or their persist and snapshot intervals if
+// larger. Archive nodes keep all blocks, and the validators with short
+// retention hold less than 1/3 of the voting power at every height, as the
+// testnet validation requires.
+func generateShortRetention(r *rand.Rand, manifest e2e.Manifest, evidenceAge int64) {
+	candidates := []string{}
+	for _, name := range mempoolNodeNames(manifest) {
+		if manifest.Nodes[name].RetainBlocks > 0 && !slices.Contains(manifest.ArchiveNodes, name) {
+			candidates = append(candidates, name)
+		}
+	}
+	heights := append([]int64{max(manifest.InitialHeight, 1)}, validatorUpdateHeights(manifest)...)
+	short := map[string]bool{}
+	minorityPower := func() bool {
+		for _, height := range heights {
+			var total, shortPower int64
+			for name, power := range validatorPowersAt(manifest, height) {
+				total += power
+				if short[name] {
+					shortPower += power
+				}
+			}
+			if 3*shortPower >= total && shortPower > 0 {
+				return false
+			}
+		}
+		return true
+	}
+	for _, i := range r.Perm(len(candidates)) {
+		if len(short) >= max(1, len(candidates)/3) {
+			break
+		}
+		name := candidates[i]
+		node := manifest.Nodes[name]
+		persistInterval := uint64(1)
+		if node.PersistInterval != nil {
+			persistInterval = *node.PersistInterval
+		}
+		retainBlocks := max(uint64(evidenceAge)/2, persistInterval, node.SnapshotInterval)
+		if retainBlocks >= uint64(evidenceAge) {
+			continue
+		}
+		short[name] = true
+		if !minorityPower() {
+			delete(short, name)
+			continue
+		}
+		node.RetainBlocks = retainBlocks
+		node.ShortRetention = true
+	}
+}
+
+// generateSentries gives each genesis validator one or two dedicated sentry
+// full nodes, numbered after the other full nodes. Sentries start with the
+// network, since their validator can't reach it without them.
+func generateSentries(r *rand.Rand, cfg *generateConfig, manifest e2e.Manifest, nodeSeed int64, evidenceAge int64) {
+	numFulls := len(nodeNamesByMode(manifest, e2e.ModeFull))
+	for _, validatorName := range nodeNamesByMode(manifest, e2e.ModeValidator) {
+		if manifest.Nodes[validatorName].StartAt != 0 {
+			continue
+		}
+		numSentries := 1 + r.Intn(2)
+		for i := 0; i < numSentries; i++ {
+			numFulls++
+			name := fmt.Sprintf("full%02d", numFulls)
+			node := generateNode(nodeRand(nodeSeed, name), e2e.ModeFull, 0, evidenceAge, false)
+			node.SentryFor = validatorName
+			manifest.Nodes[name] = node
+			pinVersion(cfg, name, node)
+		}
+	}
+}
+
+// wireSentries has validators with sentries peer with their sentries only,
+// and the other nodes but light clients peer with the sentries of those
+// validators instead of with the validators themselves.
+func wireSentries(manifest e2e.Manifest) {
+	sentries := map[string][]string{}
+	for _, name := range sortedNodeNames(manifest) {
+		if validatorName := manifest.Nodes[name].SentryFor; validatorName != "" {
+			sentries[validatorName] = append(sentries[validatorName], name)
+		}
+	}
+	if len(sentries) == 0 {
+		return
+	}
+	for _, name := range sortedNodeNames(manifest) {
+		node := manifest.Nodes[name]
+		if nodeMode(node) == e2e.ModeLight {
+			continue
+		}
+		if validatorSentries, ok := sentries[name]; ok {
+			node.Seeds = nil
+			node.PersistentPeers = append([]string{}, validatorSentries...)
+			continue
+		}
+		peers := []string{}
+		for _, peer := range node.PersistentPeers {
+			replacements := []string{peer}
+			if validatorSentries, ok := sentries[peer]; ok && node.SentryFor != peer {
+				replacements = validatorSentries
+			}
+			for _, replacement := range replacements {
+				if replacement != name && !slices.Contains(peers, replacement) {
+					peers = append(peers, replacement)
+				}
+			}
+		}
+		node.PersistentPeers = peers
+	}
+}
+
+// earlierPeers returns the candidate persistent peers of the i-th node in
+// peerNames, which is sorted by start height: the nodes before it, except
+// that delayed nodes only get peers that start strictly before them, so that
+// nodes starting at the same height don't depend on each other.
+func earlierPeers(manifest e2e.Manifest, peerNames []string, i int) []string {
+	startAt := manifest.Nodes[peerNames[i]].StartAt
+	if startAt == 0 {
+		return peerNames[:i]
+	}
+	j := i
+	for j > 0 && manifest.Nodes[peerNames[j-1]].StartAt == startAt {
+		j--
+	}
+	if j == 0 {
+		return peerNames[:i]
+	}
+	return peerNames[:j]
+}
+
+// generateRecoveryModes chooses how the nodes with a corrupt_db perturbation
+// recover, and removes the perturbation from nodes that have nothing to recover
+// from. Blocksync requires another archive node, and state sync requires two
+// other archive nodes and a snapshot provider. Light clients rely on their
+// providers for the entire blockchain history, so these never state sync.
+func generateRecoveryModes(r *rand.Rand, manifest e2e.Manifest) {
+	lightProviders := map[string]bool{}
+	for _, node := range manifest.Nodes {
+		if node.Mode == string(e2e.ModeLight) {
+			for _, name := range append(append([]string{}, node.PersistentPeers...), node.Witnesses...) {
+				lightProviders[name] = true
+			}
+		}
+	}
+	for _, name := range sortedNodeNames(manifest) {
+		node := manifest.Nodes[name]
+		if !slices.Contains(node.Perturb, string(e2e.PerturbationCorruptDB)) {
+			continue
+		}
+		if node.Mode == string(e2e.ModeSeed) || node.Mode == string(e2e.ModeLight) {
+			node.Perturb = removePerturbation(node.Perturb, e2e.PerturbationCorruptDB)
+			continue
+		}
+		node.RecoveryMode = nodeRecoveryModes.Choose(r).(string)
+		if node.RecoveryMode == string(e2e.RecoveryModeStateSync) &&
+			(lightProviders[name] || slices.Contains(manifest.ArchiveNodes, name) || !recoverySourcesViable(manifest)) {
+			node.RecoveryMode = string(e2e.RecoveryModeBlockSync)
+		}
+		if !recoverySourcesViable(manifest) {
+			node.RecoveryMode = ""
+			node.Perturb = removePerturbation(node.Perturb, e2e.PerturbationCorruptDB)
+		}
+	}
+}
+
+// limitPerturbedPower removes a perturbation from validators, starting with
+// the ones added last, until those left with it hold less than 1/3 of the
+// voting power at the initial height and after every validator update,
+// together with the validators which never start, so that it never hits a
+// quorum at once.
+func limitPerturbedPower(manifest e2e.Manifest, p e2e.Perturbation) {
+	heights := append([]int64{max(manifest.InitialHeight, 1)}, validatorUpdateHeights(manifest)...)
+	names := nodeNamesByMode(manifest, e2e.ModeValidator)
+	slices.Reverse(names)
+	for _, height := range heights {
+		var total, perturbed, absent int64
+		powers := validatorPowersAt(manifest, height)
+		for name, power := range powers {
+			total += power
+			switch {
+			case manifest.Nodes[name].StartAt == e2e.StartAtNever:
+				absent += power
+			case slices.Contains(manifest.Nodes[name].Perturb, string(p)):
+				perturbed += power
+			}
+		}
+		for _, name := range names {
+			if 3*(perturbed+absent) < total {
+				break
+			}
+			node := manifest.Nodes[name]
+			if !slices.Contains(node.Perturb, string(p)) {
+				continue
+			}
+			node.Perturb = removePerturbation(node.Perturb, p)
+			if p == e2e.PerturbationFlap {
+				node.FlapInterval = 0
+			}
+			perturbed -= powers[name]
+		}
+	}
+}
+
+// generateChainID returns the chain ID of a generated testnet, made of the
+// given prefix, or defaultChainIDPrefix, the testnet's topology, and a short
+// hash of the seed its nodes are generated from, e.g. "e2e-large-ab12cd".
+func generateChainID(prefix string, topology string, seed int64) string {
+	if prefix == "" {
+		prefix = defaultChainIDPrefix
+	}
+	hash := sha256.Sum256([]byte(strconv.FormatInt(seed, 10)))
+	return fmt.Sprintf("%s-%s-%s", prefix, topology, hex.EncodeToString(hash[:3]))
+}
+
+// generateAbsentValidators has up to n random genesis validators never start,
+// see e2e.StartAtNever, and drops their perturbations. Validators other nodes
+// rely on are left out: archive nodes, snapshot providers, light client
+// providers, validators with sentries, and those some node would have no
+// peer left to reach without, see e2e.Manifest.Validate, as are misbehaving
+// and rotating validators. Validators are only made absent while
+// absentQuorumViable holds.
+func generateAbsentValidators(r *rand.Rand, manifest e2e.Manifest, n int) {
+	relied := map[string]bool{}
+	for _, node := range manifest.Nodes {
+		if node.SentryFor != "" {
+			relied[node.SentryFor] = true
+		}
+		if node.Mode == string(e2e.ModeLight) {
+			for _, name := range append(append([]string{}, node.PersistentPeers...), node.Witnesses...) {
+				relied[name] = true
+			}
+		}
+	}
+	genesis := validatorPowersAt(manifest, max(manifest.InitialHeight, 1))
+	candidates := []string{}
+	for _, name := range nodeNamesByMode(manifest, e2e.ModeValidator) {
+		node := manifest.Nodes[name]
+		if _, ok := genesis[name]; !ok || relied[name] || isArchiveNode(manifest, name) ||
+			(node.StartAt != 0 && node.StartAt != manifest.InitialHeight) || node.SnapshotInterval > 0 ||
+			len(node.Misbehaviors) > 0 || len(node.KeyRotations) > 0 {
+			continue
+		}
+		candidates = append(candidates, name)
+	}
+	r.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+
+	for _, name := range candidates {
+		if n == 0 {
+			break
+		}
+		node := manifest.Nodes[name]
+		absent := *node
+		absent.StartAt = e2e.StartAtNever
+		absent.Perturb, absent.FlapInterval, absent.DiskBandwidth = nil, 0, 0
+		manifest.Nodes[name] = &absent
+		if !absentQuorumViable(manifest) || manifest.Validate() != nil {
+			manifest.Nodes[name] = node
+			continue
+		}
+		n--
+	}
+}
+
+// generateObserverPromotion promotes a random full node of a testnet to a
+// validator observerPromotionDelay blocks after it starts, with a validator
+// update of its own, see e2e.ManifestNode.PromoteAt. Sentries are left out, as
+// their validators rely on them. The promoted node gets a random power, or
+// equalValidatorPower with generateConfig.equalPower, bounded so that it
+// holds less than 1/3 of the voting power together with the absent
+// validators, and stops flapping, which would count against the quorum. Nodes
+// are only promoted if the testnet stays valid.
+func generateObserverPromotion(r *rand.Rand, cfg *generateConfig, manifest e2e.Manifest) {
+	candidates := []string{}
+	for _, name := range nodeNamesByMode(manifest, e2e.ModeFull) {
+		if manifest.Nodes[name].SentryFor == "" {
+			candidates = append(candidates, name)
+		}
+	}
+	r.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	power := int64(30 + r.Intn(71))
+	if cfg.equalPower {
+		power = equalValidatorPower
+	}
+
+	for _, name := range candidates {
+		node := manifest.Nodes[name]
+		promoteAt := max(node.StartAt, manifest.InitialHeight, 1) + observerPromotionDelay
+		var total, absent int64
+		for validator, p := range validatorPowersAt(manifest, promoteAt) {
+			total += p
+			if manifest.Nodes[validator].StartAt == e2e.StartAtNever {
+				absent += p
+			}
+		}
+		// The largest power p such that 3(p + absent) < total + p.
+		if maxPower := (total - 3*absent - 1) / 2; power > maxPower {
+			if cfg.equalPower || maxPower <= 0 {
+				continue
+			}
+			power = maxPower
+		}
+
+		promoted := *node
+		promoted.PromoteAt = promoteAt
+		promoted.PrivvalProtocol = string(e2e.ProtocolFile)
+		promoted.Perturb = removePerturbation(promoted.Perturb, e2e.PerturbationFlap)
+		promoted.FlapInterval = 0
+		manifest.Nodes[name] = &promoted
+		height := strconv.FormatInt(promoteAt, 10)
+		if manifest.ValidatorUpdates[height] == nil {
+			manifest.ValidatorUpdates[height] = map[string]int64{}
+		}
+		manifest.ValidatorUpdates[height][name] = power
+		if manifest.Validate() == nil {
+			return
+		}
+		manifest.Nodes[name] = node
+		delete(manifest.ValidatorUpdates[height], name)
+		if len(manifest.ValidatorUpdates[height]) == 0 {
+			delete(manifest.ValidatorUpdates, height)
+		}
+	}
+}
+
+// generateReplayAssertions gives every full node of a testnet using the
+// builtin_connsync ABCI protocol, whose unsynchronized connections replay
+// blocks differently, the 'kill' and 'restart' perturbations if it lacks them,
+// and has the runner assert that it replayed its blocks consistently after
+// recovering from them, see e2e.ManifestNode.AssertReplayConsistency.
+// Validators are left alone, as their perturbations count against the quorum.
+func generateReplayAssertions(manifest e2e.Manifest) {
+	if manifest.ABCIProtocol != string(e2e.ProtocolBuiltinConnSync) {
+		return
+	}
+	for _, name := range nodeNamesByMode(manifest, e2e.ModeFull) {
+		node := manifest.Nodes[name]
+		if node.PromoteAt != 0 {
+			continue
+		}
+		for _, p := range []e2e.Perturbation{e2e.PerturbationKill, e2e.PerturbationRestart} {
+			if !slices.Contains(node.Perturb, string(p)) {
+				node.Perturb = append(node.Perturb, string(p))
+			}
+		}
+		node.AssertReplayConsistency = true
+	}
+}
+
+// absentQuorumViable returns whether the absent validators of a manifest hold
+// less than 1/3 of the voting power at the initial height and after every
+// validator update, together with the misbehaving or rotating validators, or
+// those with any perturbation e2e.Testnet checks the quorum of, mirroring
+// e2e.Testnet's validation.
+func absentQuorumViable(manifest e2e.Manifest) bool {
+	heights := append([]int64{max(manifest.InitialHeight, 1)}, validatorUpdateHeights(manifest)...)
+	for _, height := range heights {
+		var total, absent, misbehaving, rotating int64
+		perturbed := map[string]int64{}
+		for name, power := range validatorPowersAt(manifest, height) {
+			node := manifest.Nodes[name]
+			total += power
+			switch {
+			case node.StartAt == e2e.StartAtNever:
+				absent += power
+			case len(node.Misbehaviors) > 0:
+				misbehaving += power
+			case len(node.KeyRotations) > 0:
+				rotating += power
+			}
+			for _, p := range node.Perturb {
+				perturbed[p] += power
+			}
+		}
+		faulty := max(misbehaving, rotating)
+		for _, p := range []e2e.Perturbation{
+			e2e.PerturbationPrivvalDisconnect, e2e.PerturbationFlap, e2e.PerturbationWALTruncate,
+		} {
+			faulty = max(faulty, perturbed[string(p)])
+		}
+		if 3*(absent+faulty) >= total {
+			return false
+		}
+	}
+	return true
+}
+
+// generateArchiveBlackout schedules an archive blackout the given number of
+// blocks after the initial height, unless the archive validators hold 1/3 or
+// more of the voting power by then, which would halt the network.
+func generateArchiveBlackout(manifest *e2e.Manifest, blocks int64) {
+	height := manifest.InitialHeight + blocks
+	if manifest.InitialHeight == 0 {
+		height++
+	}
+	var total, archived int64
+	for name, power := range validatorPowersAt(*manifest, height) {
+		total += power
+		if isArchiveNode(*manifest, name) {
+			archived += power
+		}
+	}
+	if 3*archived < total {
+		manifest.ArchiveBlackoutHeight = height
+	}
+}
+
+// generateGlobalRestart schedules a global restart the given number of blocks
+// after the last node starts, and has every node but light clients persist
+// its state at every height if it didn't, so that none loses it.
+func generateGlobalRestart(manifest *e2e.Manifest, blocks int64) {
+	lastStartAt := max(manifest.InitialHeight, 1)
+	for _, node := range manifest.Nodes {
+		lastStartAt = max(lastStartAt, node.StartAt)
+		if nodeMode(node) != e2e.ModeLight && node.PersistInterval != nil && *node.PersistInterval == 0 {
+			node.PersistInterval = ptrUint64(1)
+		}
+	}
+	manifest.GlobalRestartHeight = lastStartAt + blocks
+}
+
+// isArchiveNode returns whether a node of a manifest is an archive node, which
+// starts at genesis and retains all blocks, mirroring e2e.Testnet.ArchiveNodes.
+func isArchiveNode(manifest e2e.Manifest, name string) bool {
+	node := manifest.Nodes[name]
+	return (node.Mode == "" || node.Mode == string(e2e.ModeValidator) || node.Mode == string(e2e.ModeFull)) &&
+		(node.StartAt == 0 || node.StartAt == manifest.InitialHeight) && node.RetainBlocks == 0 &&
+		node.RecoveryMode != string(e2e.RecoveryModeStateSync)
+}
+
+// recoverySourcesViable returns whether every node with a recovery mode has
+// the nodes it needs to recover from, mirroring e2e.Testnet's validation.
+func recoverySourcesViable(manifest e2e.Manifest) bool {
+	snapshotFormat := func(node *e2e.ManifestNode) uint32 {
+		if node.SnapshotFormat == 0 {
+			return 1
+		}
+		return node.SnapshotFormat
+	}
+	for name, node := range manifest.Nodes {
+		if node.RecoveryMode == "" {
+			continue
+		}
+		archiveNodes, snapshotProviders := 0, 0
+		for peerName, peer := range manifest.Nodes {
+			if peerName == name {
+				continue
+			}
+			if isArchiveNode(manifest, peerName) {
+				archiveNodes++
+			}
+			if peer.Mode != string(e2e.ModeSeed) && peer.Mode != string(e2e.ModeLight) && peer.SnapshotInterval > 0 &&
+				snapshotFormat(peer) == snapshotFormat(node) && (snapshotFormat(peer) == 1 || peer.Version == "") {
+				snapshotProviders++
+			}
+		}
+		switch e2e.RecoveryMode(node.RecoveryMode) {
+		case e2e.RecoveryModeBlockSync:
+			if archiveNodes == 0 {
+				return false
+			}
+		case e2e.RecoveryModeStateSync:
+			if archiveNodes < 2 || snapshotProviders == 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// removePerturbation returns the given perturbations without p.
+func removePerturbation(perturb []string, p e2e.Perturbation) []string {
+	result := []string{}
+	for _, q := range perturb {
+		if q != string(p) {
+			result = append(result, q)
+		}
+	}
+	return result
+}
+
+// reconcileRetention adjusts a node's block retention to its persist and
+// snapshot intervals. Afterwards, the node either retains all blocks, or it
+// persists state and retains at least as many blocks as its persist interval,
+// its snapshot interval and the evidence age, so that it never prunes blocks
+// it still needs to recover its state or to serve its own snapshots.
+func reconcileRetention(node *e2e.ManifestNode, evidenceAge int64) {
+	if node.RetainBlocks == 0 {
+		return
+	}
+
+	// Nodes default to persisting state at every height.
+	persistInterval := uint64(1)
+	if node.PersistInterval != nil {
+		persistInterval = *node.PersistInterval
+	}
+	if persistInterval == 0 {
+		// Nodes which do not persist state replay all blocks on restart.
+		node.RetainBlocks = 0
+		return
+	}
+
+	if node.RetainBlocks < persistInterval {
+		node.RetainBlocks = persistInterval
+	}
+	if node.RetainBlocks < node.SnapshotInterval {
+		node.RetainBlocks = node.SnapshotInterval
+	}
+	if node.RetainBlocks < uint64(evidenceAge) {
+		node.RetainBlocks = uint64(evidenceAge)
+	}
+}
+
+// generateLightNode randomly generates a light client, using the given primary
+// and 1 to lightNodeMaxWitnesses distinct witnesses from the given providers,
+// of which there must be at least two. The trust height is chosen between the
+// testnet's initial height and the node's start height. r is the node's own
+// RNG, see nodeRand.
+func generateLightNode(
+	r *rand.Rand, startAt int64, initialHeight int64, primary string, providers []string,
+) *e2e.ManifestNode {
+	node := &e2e.ManifestNode{
+		Mode:            string(e2e.ModeLight),
+		Version:         nodeVersions.Choose(r).(string),
+		StartAt:         startAt,
+		Database:        nodeDatabases.Choose(r).(string),
+		PersistInterval: ptrUint64(0),
+		Perturb:         lightNodePerturbations.Choose(r),
+		TrustPeriod:     lightNodeTrustPeriods.Choose(r).(time.Duration),
+	}
+
+	generateLightProviders(r, node, primary, providers)
+
+	if initialHeight < 1 {
+		initialHeight = 1
+	}
+	node.TrustHeight = initialHeight + r.Int63n(startAt-initialHeight+1)
+	return node
+}
+
+// reconcileLightTrust raises the trust height of light clients whose providers
+// have all pruned it by the time they start, to the lowest height the provider
+// retaining the most blocks still has then, see e2e.Testnet.Validate.
+func reconcileLightTrust(manifest e2e.Manifest) {
+	initialHeight := max(manifest.InitialHeight, 1)
+	for _, name := range nodeNamesByMode(manifest, e2e.ModeLight) {
+		node := manifest.Nodes[name]
+		trustHeight := node.TrustHeight
+		if trustHeight == 0 {
+			trustHeight = initialHeight
+		}
+		head := max(node.StartAt, initialHeight)
+		lowest := int64(math.MaxInt64)
+		for _, providerName := range append(append([]string{}, node.PersistentPeers...), node.Witnesses...) {
+			provider := manifest.Nodes[providerName]
+			retained := initialHeight
+			if provider.RetainBlocks > 0 && head-int64(provider.RetainBlocks) >= initialHeight {
+				retained = head - int64(provider.RetainBlocks) + 1
+			}
+			lowest = min(lowest, retained)
+		}
+		if lowest != math.MaxInt64 && lowest > trustHeight {
+			node.TrustHeight = lowest
+		}
+	}
+}
+
+// lightPrimaries picks the primaries of n light clients from the given
+// providers, going through them in a random order so that no provider is the
+// primary of more light clients than necessary.
+func lightPrimaries(r *rand.Rand, providers []string, n int) []string {
+	primaries := make([]string, 0, n)
+	for len(primaries) < n && len(providers) > 0 {
+		for _, i := range r.Perm(len(providers)) {
+			if len(primaries) < n {
+				primaries = append(primaries, providers[i])
+			}
+		}
+	}
+	return primaries
+}
+
+// generateLightProviders sets the primary of a light client, and randomly picks
+// 1 to lightNodeMaxWitnesses distinct witnesses from the other given
+// providers, of which there must be at least one.
+func generateLightProviders(r *rand.Rand, node *e2e.ManifestNode, primary string, providers []string) {
+	others := slices.DeleteFunc(slices.Clone(providers), func(p string) bool { return p == primary })
+	shuffled := make([]string, len(others))
+	for i, j := range r.Perm(len(others)) {
+		shuffled[i] = others[j]
+	}
+	numWitnesses := 1 + r.Intn(lightNodeMaxWitnesses)
+	if numWitnesses > len(shuffled) {
+		numWitnesses = len(shuffled)
+	}
+	node.PersistentPeers = []string{primary}
+	node.Witnesses = shuffled[:numWitnesses]
+	sort.Strings(node.Witnesses)
+}
+
+// RegenerateTopology returns a copy of a manifest with a new random topology,
+// which lets a hand-tuned testnet be rerun with a different topology only. It
+// keeps every other setting of the nodes, and the validator set, but replaces
+// the seeds and persistent peers of all nodes, and the primaries and witnesses
+// of light clients, using the same wiring as generateTestnet. Nodes still only
+// peer with nodes starting before themselves. Ring, star and bridge topologies
+// are wired up in a fixed way, and thus only rebuilt. The topology of
+// dual-stack testnets can't be regenerated, since their address families
+// depend on it. Nodes behind NAT keep it unless no wiring leaves them
+// reachable, and degraded links are dropped unless their nodes remain
+// persistent peers. The given manifest is not modified.
+func RegenerateTopology(m e2e.Manifest, r *rand.Rand) (e2e.Manifest, error) {
+	if m.DualStack() {
+		return m, errors.New("cannot regenerate the topology of a dual-stack testnet, " +
+			"whose address families depend on it")
+	}
+	topology := "default"
+	if t := quadTopology(m); len(t) > 0 && t[0] != "quad" {
+		topology = t[0]
+	}
+
+	original := m.Nodes
+	var lightProviders []string
+	for attempt := 0; ; attempt++ {
+		nodes := make(map[string]*e2e.ManifestNode, len(original))
+		for name, node := range original {
+			n := *node
+			n.Seeds, n.PersistentPeers, n.Witnesses = nil, nil, nil
+			nodes[name] = &n
+		}
+		m.Nodes = nodes
+		m.BridgeNodes = nil
+
+		lightProviders = generateTopology(r, &m, topology)
+		wireSentries(m)
+		// Rewire until the nodes behind NAT stay reachable, rather than
+		// dropping their NAT setting below.
+		if natReachable(m) || attempt == regenerateTopologyAttempts {
+			break
+		}
+	}
+	lightNames := nodeNamesByMode(m, e2e.ModeLight)
+	if len(lightNames) > 0 && len(lightProviders) < 2 {
+		return m, fmt.Errorf("light clients need at least 2 providers, found %d", len(lightProviders))
+	}
+	primaries := lightPrimaries(r, lightProviders, len(lightNames))
+	for i, name := range lightNames {
+		generateLightProviders(r, m.Nodes[name], primaries[i], lightProviders)
+	}
+	reconcileNAT(m)
+	reconcilePeerLimits(m)
+
+	// Degraded links only remain between nodes which are still peers.
+	links := []e2e.LinkLatency{}
+	for _, link := range m.LinkLatencies {
+		from, to := m.Nodes[link.From], m.Nodes[link.To]
+		if from != nil && to != nil && (slices.Contains(from.PersistentPeers, link.To) ||
+			slices.Contains(to.PersistentPeers, link.From)) {
+			links = append(links, link)
 		}
-		manifests = append(manifests, manifest)
 	}
-	return manifests, nil
+	if len(m.LinkLatencies) > 0 {
+		m.LinkLatencies = links
+	}
+	return m, nil
 }
 
-// generateTestnet generates a single testnet with the given options.
-func generateTestnet(r *rand.Rand, opt map[string]interface{}, upgradeVersion string, prometheus bool) (e2e.Manifest, error) {
-	manifest := e2e.Manifest{
-		IPv6:             ipv6.Choose(r).(bool),
-		ABCIProtocol:     nodeABCIProtocols.Choose(r).(string),
-		InitialHeight:    int64(opt["initialHeight"].(int)),
-		InitialState:     opt["initialState"].(map[string]string),
-		Validators:       &map[string]int64{},
-		ValidatorUpdates: map[string]map[string]int64{},
-		Evidence:         evidence.Choose(r).(int),
-		Nodes:            map[string]*e2e.ManifestNode{},
-		UpgradeVersion:   upgradeVersion,
-		Prometheus:       prometheus,
+// generateMisbehaviors makes random genesis validators misbehave once, except
+// for the archive nodes, validator01 and validator02 unless there are
+// dedicated ones, while keeping the voting
+// power of the misbehaving validators below 1/3, together with the validators
+// which never start, so that an honest quorum remains.
+func generateMisbehaviors(r *rand.Rand, manifest e2e.Manifest) {
+	var total, byzantine int64
+	candidates := []string{}
+	for _, name := range sortedNodeNames(manifest) {
+		power, ok := (*manifest.Validators)[name]
+		if !ok {
+			continue
+		}
+		total += power
+		switch {
+		case manifest.Nodes[name].StartAt == e2e.StartAtNever:
+			byzantine += power
+		case !slices.Contains(manifest.ArchiveNodes, name):
+			candidates = append(candidates, name)
+		}
 	}
 
-	switch abciDelays.Choose(r).(string) {
-	case "none":
-	case "small":
-		manifest.PrepareProposalDelay = 100 * time.Millisecond
-		manifest.ProcessProposalDelay = 100 * time.Millisecond
-		manifest.VoteExtensionDelay = 20 * time.Millisecond
-		manifest.FinalizeBlockDelay = 200 * time.Millisecond
-	case "large":
-		manifest.PrepareProposalDelay = 200 * time.Millisecond
-		manifest.ProcessProposalDelay = 200 * time.Millisecond
-		manifest.CheckTxDelay = 20 * time.Millisecond
-		manifest.VoteExtensionDelay = 100 * time.Millisecond
-		manifest.FinalizeBlockDelay = 500 * time.Millisecond
+	initialHeight := manifest.InitialHeight
+	if initialHeight < 1 {
+		initialHeight = 1
+	}
+	for _, i := range r.Perm(len(candidates)) {
+		name := candidates[i]
+		power := (*manifest.Validators)[name]
+		if 3*(byzantine+power) >= total {
+			continue
+		}
+		byzantine += power
+		height := initialHeight + misbehaviorMinHeightOffset + r.Int63n(10)
+		manifest.Nodes[name].Misbehaviors = map[string]string{
+			strconv.FormatInt(height, 10): nodeMisbehaviors.Choose(r).(string),
+		}
 	}
+}
 
-	if voteExtensionEnabled.Choose(r).(bool) {
-		manifest.VoteExtensionsEnableHeight = manifest.InitialHeight + voteExtensionEnableHeightOffset.Choose(r).(int64)
+// generateBlockParams randomly limits the size and gas of the testnet's blocks,
+// and marks the load as overloaded if the limits make it so. The block size is
+// set on every validator, since they must agree on it. Sizes without room for
+// a commit and vote extensions of every validator, evidence, and the largest
+// load transaction are not used.
+func generateBlockParams(r *rand.Rand, manifest *e2e.Manifest) {
+	manifest.MaxGas = blockMaxGas.Choose(r).(int64)
+	maxBytes := blockMaxBytes.Choose(r).(int64)
+	validators := nodeNamesByMode(*manifest, e2e.ModeValidator)
+	if maxBytes > 0 {
+		txSize := int64(0)
+		if manifest.LoadProfile != nil {
+			for _, size := range manifest.LoadProfile.TxSizes {
+				txSize = max(txSize, int64(size))
+			}
+		}
+		// The kvstore carries the hex-encoded extended commit of the last
+		// block in a transaction of its own.
+		extensionBytes := int64(0)
+		if manifest.VoteExtensionsEnableHeight > 0 {
+			extensionBytes = 2 * int64(len(validators)) * (int64(manifest.VoteExtensionSize) + 512)
+		}
+		dataBytes := maxBytes - e2e.MaxEvidenceBytes(maxBytes) -
+			types.MaxOverheadForBlock - types.MaxHeaderBytes - types.MaxCommitBytes(len(validators))
+		if dataBytes < extensionBytes+txSize {
+			maxBytes = 0
+		}
+	}
+	for _, name := range validators {
+		manifest.Nodes[name].MaxBlockBytes = maxBytes
 	}
+	if manifest.LoadProfile != nil {
+		manifest.LoadProfile.Overloaded = loadOverloaded(*manifest, manifest.LoadProfile)
+	}
+}
 
-	manifest.VoteExtensionSize = voteExtensionSize.Choose(r).(uint)
+// appConfigApplicable returns whether the nodes of a testnet can be given
+// app_config toggles, i.e. whether it has vote extensions and all nodes run
+// the local version of the kvstore app.
+func appConfigApplicable(manifest e2e.Manifest) bool {
+	if manifest.VoteExtensionsEnableHeight == 0 {
+		return false
+	}
+	if manifest.ABCIApp != "" && manifest.ABCIApp != e2e.ABCIAppKVStore {
+		return false
+	}
+	for _, node := range manifest.Nodes {
+		if node.Version != "" {
+			return false
+		}
+	}
+	return true
+}
 
-	var numSeeds, numValidators, numFulls, numLightClients int
-	switch opt["topology"].(string) {
-	case "single":
-		numValidators = 1
-	case "quad":
-		numValidators = 4
-	case "large":
-		// FIXME Networks are kept small since large ones use too much CPU.
-		numSeeds = r.Intn(2)
-		numLightClients = r.Intn(3)
-		numValidators = 4 + r.Intn(4)
-		numFulls = r.Intn(4)
-	default:
-		return manifest, fmt.Errorf("unknown topology %q", opt["topology"])
+// generateAppConfig has half of the validators, picked at random, omit their
+// vote extensions. All other nodes must then accept empty vote extensions,
+// or the network could not reach consensus.
+func generateAppConfig(r *rand.Rand, manifest e2e.Manifest) {
+	validators := nodeNamesByMode(manifest, e2e.ModeValidator)
+	omitting := map[string]bool{}
+	for _, i := range r.Perm(len(validators))[:max(len(validators)/2, 1)] {
+		omitting[validators[i]] = true
+	}
+	for _, name := range sortedNodeNames(manifest) {
+		node := manifest.Nodes[name]
+		if nodeMode(node) == e2e.ModeLight {
+			continue
+		}
+		node.AppConfig = map[string]string{app.AppConfigEmptyVoteExtensions: "accept"}
+		if omitting[name] {
+			node.AppConfig[app.AppConfigVoteExtensions] = "omit"
+		}
 	}
+}
 
-	// First we generate seed nodes, starting at the initial height.
-	for i := 1; i <= numSeeds; i++ {
-		manifest.Nodes[fmt.Sprintf("seed%02d", i)] = generateNode(
-			r, e2e.ModeSeed, 0, false)
+// generateValidatorChurn schedules validatorChurnSteps random changes to the
+// voting power of the validators, after all other validator updates and
+// misbehaviors so that it can't affect their honest quorum. Every change keeps
+// a BFT quorum live: the validators retaining their power across the update
+// must hold more than 2/3 of the power before it. Changes that would violate
+// this are made to another validator, and if none qualifies, the validator's
+// power is increased instead.
+func generateValidatorChurn(r *rand.Rand, manifest e2e.Manifest) {
+	powers := validatorPowersAt(manifest, math.MaxInt64)
+	initialHeight := manifest.InitialHeight
+	if initialHeight < 1 {
+		initialHeight = 1
+	}
+	height := initialHeight + misbehaviorMinHeightOffset + 10
+	for _, h := range validatorUpdateHeights(manifest) {
+		if h > height {
+			height = h
+		}
 	}
 
-	// Next, we generate validators. We make sure a BFT quorum of validators start
-	// at the initial height, and that we have two archive nodes. We also set up
-	// the initial validator set, and validator set updates for delayed nodes.
-	nextStartAt := manifest.InitialHeight + 5
-	quorum := numValidators*2/3 + 1
-	for i := 1; i <= numValidators; i++ {
-		startAt := int64(0)
-		if i > quorum {
-			startAt = nextStartAt
-			nextStartAt += 5
+	for i := 0; i < validatorChurnSteps; i++ {
+		height += validatorChurnInterval
+		names := make([]string, 0, len(powers))
+		var total int64
+		for name, power := range powers {
+			names = append(names, name)
+			total += power
 		}
-		name := fmt.Sprintf("validator%02d", i)
-		manifest.Nodes[name] = generateNode(
-			r, e2e.ModeValidator, startAt, i <= 2)
+		sort.Strings(names)
 
-		if startAt == 0 {
-			(*manifest.Validators)[name] = int64(30 + r.Intn(71))
-		} else {
-			manifest.ValidatorUpdates[fmt.Sprint(startAt+5)] = map[string]int64{
-				name: int64(30 + r.Intn(71)),
+		action := validatorChurnActions.Choose(r).(string)
+		name, power := "", int64(0)
+		for _, j := range r.Perm(len(names)) {
+			old := powers[names[j]]
+			next := int64(0)
+			switch action {
+			case "increase":
+				next = old + 10 + r.Int63n(41)
+			case "decrease":
+				next = old / 2
+			}
+			if next == 0 && (action == "decrease" || len(powers) == 1) {
+				continue
+			}
+			if 3*(total-old+min(old, next)) > 2*total {
+				name, power = names[j], next
+				break
 			}
 		}
-	}
+		if name == "" {
+			name = names[r.Intn(len(names))]
+			power = powers[name] + 10 + r.Int63n(41)
+		}
 
-	// Move validators to InitChain if specified.
-	switch opt["validators"].(string) {
-	case "genesis":
-	case "initchain":
-		manifest.ValidatorUpdates["0"] = *manifest.Validators
-		manifest.Validators = &map[string]int64{}
-	default:
-		return manifest, fmt.Errorf("invalid validators option %q", opt["validators"])
+		if power == 0 {
+			delete(powers, name)
+		} else {
+			powers[name] = power
+		}
+		manifest.ValidatorUpdates[strconv.FormatInt(height, 10)] = map[string]int64{name: power}
 	}
+}
 
-	// Finally, we generate random full nodes.
-	for i := 1; i <= numFulls; i++ {
-		startAt := int64(0)
-		if r.Float64() >= 0.5 {
-			startAt = nextStartAt
-			nextStartAt += 5
+// generateKeyRotation has a random genesis validator using the file privval
+// protocol, and holding less than 1/3 of the voting power, rotate its key
+// keyRotationDelay blocks after the last validator update, along with the
+// matching validator update, which keeps its power. Misbehaving validators
+// sign with their genesis key, and don't rotate.
+func generateKeyRotation(r *rand.Rand, manifest e2e.Manifest) {
+	initialHeight := manifest.InitialHeight
+	if initialHeight < 1 {
+		initialHeight = 1
+	}
+	height := initialHeight + keyRotationDelay
+	for _, h := range validatorUpdateHeights(manifest) {
+		height = max(height, h+keyRotationDelay)
+	}
+	powers := validatorPowersAt(manifest, height)
+	var total int64
+	for _, power := range powers {
+		total += power
+	}
+	candidates := []string{}
+	for _, name := range nodeNamesByMode(manifest, e2e.ModeValidator) {
+		node := manifest.Nodes[name]
+		if node.StartAt != 0 || len(node.Misbehaviors) > 0 || powers[name] == 0 || 3*powers[name] >= total ||
+			(node.PrivvalProtocol != "" && node.PrivvalProtocol != string(e2e.ProtocolFile)) {
+			continue
 		}
-		manifest.Nodes[fmt.Sprintf("full%02d", i)] = generateNode(
-			r, e2e.ModeFull, startAt, false)
+		candidates = append(candidates, name)
 	}
+	if len(candidates) == 0 {
+		return
+	}
+	name := candidates[r.Intn(len(candidates))]
+	manifest.Nodes[name].KeyRotations = map[string]string{strconv.FormatInt(height, 10): "rotated"}
+	manifest.ValidatorUpdates[strconv.FormatInt(height, 10)] = map[string]int64{name: powers[name]}
+}
 
-	// We now set up peer discovery for nodes. Seed nodes are fully meshed with
-	// each other, while non-seed nodes either use a set of random seeds or a
-	// set of random peers that start before themselves.
-	var seedNames, peerNames, lightProviders []string
-	for name, node := range manifest.Nodes {
-		if node.Mode == string(e2e.ModeSeed) {
-			seedNames = append(seedNames, name)
-		} else {
-			// if the full node or validator is an ideal candidate, it is added as a light provider.
-			// There are at least two archive nodes so there should be at least two ideal candidates
-			if (node.StartAt == 0 || node.StartAt == manifest.InitialHeight) && node.RetainBlocks == 0 {
-				lightProviders = append(lightProviders, name)
-			}
-			peerNames = append(peerNames, name)
+// validatorUpdateHeights returns the heights of the validator updates of a
+// manifest in ascending order.
+func validatorUpdateHeights(manifest e2e.Manifest) []int64 {
+	heights := make([]int64, 0, len(manifest.ValidatorUpdates))
+	for h := range manifest.ValidatorUpdates {
+		height, err := strconv.ParseInt(h, 10, 64)
+		if err != nil {
+			continue
 		}
+		heights = append(heights, height)
 	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	return heights
+}
 
-	for _, name := range seedNames {
-		for _, otherName := range seedNames {
-			if name != otherName {
-				manifest.Nodes[name].Seeds = append(manifest.Nodes[name].Seeds, otherName)
-			}
+// validatorPowersAt returns the voting power of each validator of a manifest
+// after applying the genesis validators and all validator updates up to the
+// given height, like e2e.Testnet.ValidatorPowersAt.
+func validatorPowersAt(manifest e2e.Manifest, height int64) map[string]int64 {
+	powers := map[string]int64{}
+	if manifest.Validators != nil {
+		for name, power := range *manifest.Validators {
+			powers[name] = power
 		}
 	}
-
-	sort.Slice(peerNames, func(i, j int) bool {
-		iName, jName := peerNames[i], peerNames[j]
-		switch {
-		case manifest.Nodes[iName].StartAt < manifest.Nodes[jName].StartAt:
-			return true
-		case manifest.Nodes[iName].StartAt > manifest.Nodes[jName].StartAt:
-			return false
-		default:
-			return strings.Compare(iName, jName) == -1
+	for _, h := range validatorUpdateHeights(manifest) {
+		if h > height {
+			break
 		}
-	})
-	for i, name := range peerNames {
-		if len(seedNames) > 0 && (i == 0 || r.Float64() >= 0.5) {
-			manifest.Nodes[name].Seeds = uniformSetChoice(seedNames).Choose(r)
-		} else if i > 0 {
-			manifest.Nodes[name].PersistentPeers = uniformSetChoice(peerNames[:i]).Choose(r)
+		for name, power := range manifest.ValidatorUpdates[strconv.FormatInt(h, 10)] {
+			if power == 0 {
+				delete(powers, name)
+			} else {
+				powers[name] = power
+			}
 		}
 	}
+	return powers
+}
 
-	// lastly, set up the light clients
-	for i := 1; i <= numLightClients; i++ {
-		startAt := manifest.InitialHeight + 5
-		manifest.Nodes[fmt.Sprintf("light%02d", i)] = generateLightNode(
-			r, startAt+(5*int64(i)), lightProviders,
-		)
+// validatorPowerChanges returns how each validator update of a manifest
+// changes the power of a validator that was already part of the set: an
+// increase, decrease, or removal. Validators joining the set are skipped.
+func validatorPowerChanges(manifest e2e.Manifest) []string {
+	powers := map[string]int64{}
+	if manifest.Validators != nil {
+		for name, power := range *manifest.Validators {
+			powers[name] = power
+		}
 	}
-
-	return manifest, nil
+	changes := []string{}
+	for _, h := range validatorUpdateHeights(manifest) {
+		update := manifest.ValidatorUpdates[strconv.FormatInt(h, 10)]
+		names := make([]string, 0, len(update))
+		for name := range update {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			old, ok := powers[name]
+			power := update[name]
+			switch {
+			case !ok:
+			case power == 0:
+				changes = append(changes, "remove")
+			case power > old:
+				changes = append(changes, "increase")
+			case power < old:
+				changes = append(changes, "decrease")
+			}
+			if power == 0 {
+				delete(powers, name)
+			} else {
+				powers[name] = power
+			}
+		}
+	}
+	return changes
 }
 
-// generateNode randomly generates a node, with some constraints to avoid
-// generating invalid configurations. We do not set Seeds or PersistentPeers
-// here, since we need to know the overall network topology and startup
-// sequencing.
-func generateNode(
-	r *rand.Rand, mode e2e.Mode, startAt int64, forceArchive bool,
-) *e2e.ManifestNode {
-	node := e2e.ManifestNode{
-		Version:          nodeVersions.Choose(r).(string),
-		Mode:             string(mode),
-		StartAt:          startAt,
-		Database:         nodeDatabases.Choose(r).(string),
-		PrivvalProtocol:  nodePrivvalProtocols.Choose(r).(string),
-		BlockSyncVersion: nodeBlockSyncs.Choose(r).(string),
-		StateSync:        nodeStateSyncs.Choose(r).(bool) && startAt > 0,
-		PersistInterval:  ptrUint64(uint64(nodePersistIntervals.Choose(r).(int))),
-		SnapshotInterval: uint64(nodeSnapshotIntervals.Choose(r).(int)),
-		RetainBlocks:     uint64(nodeRetainBlocks.Choose(r).(int)),
-		Perturb:          nodePerturbations.Choose(r),
+// generateAddressFamilies randomly assigns an address family to every node of
+// a dual-stack testnet. Nodes that don't share an address family with all of
+// their seeds, persistent peers and witnesses are made dual-homed, which keeps
+// every connection of the topology, and thus the network, intact. Nodes
+// without any of those connect to all nodes they share a family with, so they
+// are only made dual-homed if there is no such node.
+func generateAddressFamilies(r *rand.Rand, manifest e2e.Manifest) {
+	bridgeNodes := map[string]bool{}
+	for _, name := range manifest.BridgeNodes {
+		bridgeNodes[name] = true
 	}
-
-	// If this node is forced to be an archive node, retain all blocks and
-	// enable state sync snapshotting.
-	if forceArchive {
-		node.RetainBlocks = 0
-		node.SnapshotInterval = 3
+	for _, name := range sortedNodeNames(manifest) {
+		node := manifest.Nodes[name]
+		node.AddressFamily = nodeAddressFamilies.Choose(r).(string)
+		if node.Mode == string(e2e.ModeSeed) || bridgeNodes[name] {
+			node.AddressFamily = string(e2e.AddressFamilyDual)
+		}
+	}
+	for _, name := range sortedNodeNames(manifest) {
+		node := manifest.Nodes[name]
+		family := e2e.AddressFamily(node.AddressFamily)
+		if len(node.Seeds) == 0 && len(node.PersistentPeers) == 0 {
+			// Validators with sentries aren't among the default peers, and
+			// absent validators never accept connections.
+			hidden := map[string]bool{}
+			for otherName, other := range manifest.Nodes {
+				if other.SentryFor != "" {
+					hidden[other.SentryFor] = true
+				}
+				if other.StartAt == e2e.StartAtNever {
+					hidden[otherName] = true
+				}
+			}
+			reachable := false
+			for _, otherName := range sortedNodeNames(manifest) {
+				_, ok := family.Common(e2e.AddressFamily(manifest.Nodes[otherName].AddressFamily))
+				reachable = reachable || (ok && otherName != name && !hidden[otherName])
+			}
+			if !reachable {
+				node.AddressFamily = string(e2e.AddressFamilyDual)
+			}
+			continue
+		}
+		for _, peer := range append(append(append([]string{}, node.Seeds...), node.PersistentPeers...), node.Witnesses...) {
+			if _, ok := family.Common(e2e.AddressFamily(manifest.Nodes[peer].AddressFamily)); !ok {
+				node.AddressFamily = string(e2e.AddressFamilyDual)
+				break
+			}
+		}
 	}
+}
 
-	// If a node which does not persist state also does not retain blocks, randomly
-	// choose to either persist state or retain all blocks.
-	if node.PersistInterval != nil && *node.PersistInterval == 0 && node.RetainBlocks > 0 {
-		if r.Float64() > 0.5 {
-			node.RetainBlocks = 0
-		} else {
-			node.PersistInterval = ptrUint64(node.RetainBlocks)
+// reconcileNAT takes nodes out from behind NAT, in lexical order, unless
+// every node still has a peer which is not behind NAT, so that no node only
+// dials peers refusing its connections. Seeds and bridge nodes are never
+// behind NAT.
+func reconcileNAT(manifest e2e.Manifest) {
+	for _, name := range sortedNodeNames(manifest) {
+		node := manifest.Nodes[name]
+		if !node.BehindNAT {
+			continue
+		}
+		if nodeMode(node) == e2e.ModeSeed || nodeMode(node) == e2e.ModeLight ||
+			slices.Contains(manifest.BridgeNodes, name) || !natReachable(manifest) {
+			node.BehindNAT = false
 		}
 	}
+}
 
-	// If either PersistInterval or SnapshotInterval are greater than RetainBlocks,
-	// expand the block retention time.
-	if node.RetainBlocks > 0 {
-		if node.PersistInterval != nil && node.RetainBlocks < *node.PersistInterval {
-			node.RetainBlocks = *node.PersistInterval
+// natReachable returns whether every validator and full node with peers has
+// one which is not behind NAT, nor absent. Nodes without seeds or persistent peers connect
+// to all others they share an address family with, see e2e.Testnet.
+func natReachable(manifest e2e.Manifest) bool {
+	for _, name := range sortedNodeNames(manifest) {
+		node := manifest.Nodes[name]
+		if nodeMode(node) == e2e.ModeLight || node.StartAt == e2e.StartAtNever {
+			continue
+		}
+		peers := append(append([]string{}, node.Seeds...), node.PersistentPeers...)
+		if len(peers) == 0 && !manifest.SeedOnlyDiscovery {
+			family := e2e.AddressFamily(node.AddressFamily)
+			for _, peer := range sortedNodeNames(manifest) {
+				_, ok := family.Common(e2e.AddressFamily(manifest.Nodes[peer].AddressFamily))
+				if (ok || !manifest.DualStack()) && peer != name {
+					peers = append(peers, peer)
+				}
+			}
+		}
+		if len(peers) == 0 {
+			continue
+		}
+		reachable := false
+		for _, peer := range peers {
+			peer := manifest.Nodes[peer]
+			reachable = reachable || (!peer.BehindNAT && peer.StartAt != e2e.StartAtNever)
 		}
-		if node.RetainBlocks < node.SnapshotInterval {
-			node.RetainBlocks = node.SnapshotInterval
+		if !reachable {
+			return false
 		}
 	}
+	return true
+}
 
-	return &node
+// sortedNodeNames returns the manifest's node names in lexical order, since
+// iterating over the Nodes map directly would make generation nondeterministic.
+func sortedNodeNames(manifest e2e.Manifest) []string {
+	names := make([]string, 0, len(manifest.Nodes))
+	for name := range manifest.Nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
-func generateLightNode(r *rand.Rand, startAt int64, providers []string) *e2e.ManifestNode {
-	return &e2e.ManifestNode{
-		Mode:            string(e2e.ModeLight),
-		Version:         nodeVersions.Choose(r).(string),
-		StartAt:         startAt,
-		Database:        nodeDatabases.Choose(r).(string),
-		PersistInterval: ptrUint64(0),
-		PersistentPeers: providers,
-		Perturb:         lightNodePerturbations.Choose(r),
+// nodeNamesByMode returns the sorted names of all nodes with the given mode.
+func nodeNamesByMode(manifest e2e.Manifest, mode e2e.Mode) []string {
+	names := []string{}
+	for _, name := range sortedNodeNames(manifest) {
+		if manifest.Nodes[name].Mode == string(mode) {
+			names = append(names, name)
+		}
 	}
+	return names
 }
 
 func ptrUint64(i uint64) *uint64 {
 	return &i
 }
 
+func ptrInt(i int) *int {
+	return &i
+}
+
+func ptrBool(b bool) *bool {
+	return &b
+}
+
+// resolvePinnedVersions resolves the versions of generateConfig.pinnedVersions
+// into the images nodes run: "local" is the local version, and "latest" the
+// latest release of the current major version. Other versions are tags, or
+// images with a tag, where the tag must be one of the Git repository in
+// gitRepoDir. Images default to cometbft/e2e-node.
+func resolvePinnedVersions(pins map[string]string, gitRepoDir string) (map[string]string, error) {
+	resolved := make(map[string]string, len(pins))
+	var tags []string
+	for name, pin := range pins {
+		switch pin {
+		case "local":
+			resolved[name] = ""
+			continue
+		case "latest":
+			latestVersion, err := gitRepoLatestReleaseVersion(gitRepoDir)
+			if err != nil {
+				return nil, err
+			}
+			if latestVersion == "" {
+				return nil, fmt.Errorf("found no release of version %v to pin node %q to", version.TMCoreSemVer, name)
+			}
+			resolved[name] = "cometbft/e2e-node:" + latestVersion
+			continue
+		}
+		image, tag := "cometbft/e2e-node", pin
+		if i := strings.LastIndex(pin, ":"); i >= 0 {
+			image, tag = pin[:i], pin[i+1:]
+		}
+		if tags == nil {
+			var err error
+			tags, err = gitRepoTags(gitRepoDir)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve the version pinned for node %q: %w", name, err)
+			}
+		}
+		if !slices.Contains(tags, tag) {
+			return nil, fmt.Errorf("version %q pinned for node %q is not a tag of the Git repository", pin, name)
+		}
+		resolved[name] = image + ":" + tag
+	}
+	return resolved, nil
+}
+
 // Parses strings like "v0.34.21:1,v0.34.22:2" to represent two versions
 // ("v0.34.21" and "v0.34.22") with weights of 1 and 2 respectively.
 // Versions may be specified as cometbft/e2e-node:v0.34.27-alpha.1:1 or
 // ghcr.io/informalsystems/tendermint:v0.34.26:1.
 // If only the tag and weight are specified, cometbft/e2e-node is assumed.
+// A range of releases may be given as "v0.34.20..v0.34.27:3", in which case
+// every release tag between the two (inclusive) found in the Git repository at
+// gitRepoDir gets a weight of 3.
 // Also returns the last version in the list, which will be used for updates.
-func parseWeightedVersions(s string) (weightedChoice, string, error) {
+func parseWeightedVersions(s string, gitRepoDir string) (weightedChoice, string, error) {
 	wc := make(weightedChoice)
 	lv := ""
+	var tags []string
 	wvs := strings.Split(strings.TrimSpace(s), ",")
 	for _, wv := range wvs {
 		parts := strings.Split(strings.TrimSpace(wv), ":")
-		var ver string
+		var image, tag string
 		if len(parts) == 2 {
-			ver = strings.TrimSpace(strings.Join([]string{"cometbft/e2e-node", parts[0]}, ":"))
+			image, tag = "cometbft/e2e-node", strings.TrimSpace(parts[0])
 		} else if len(parts) == 3 {
-			ver = strings.TrimSpace(strings.Join([]string{parts[0], parts[1]}, ":"))
+			image, tag = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
 		} else {
 			return nil, "", fmt.Errorf("unexpected weight:version combination: %s", wv)
 		}
@@ -375,8 +3718,30 @@ func parseWeightedVersions(s string) (weightedChoice, string, error) {
 		if wt < 1 {
 			return nil, "", errors.New("version weights must be >= 1")
 		}
-		wc[ver] = uint(wt)
-		lv = ver
+
+		if !strings.Contains(tag, "..") {
+			ver := strings.Join([]string{image, tag}, ":")
+			wc[ver] = uint(wt)
+			lv = ver
+			continue
+		}
+
+		if tags == nil {
+			tags, err = gitRepoTags(gitRepoDir)
+			if err != nil {
+				return nil, "", err
+			}
+		}
+		bounds := strings.SplitN(tag, "..", 2)
+		rangeTags, err := findReleaseTagsInRange(bounds[0], bounds[1], tags)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, rangeTag := range rangeTags {
+			ver := strings.Join([]string{image, rangeTag}, ":")
+			wc[ver] = uint(wt)
+			lv = ver
+		}
 	}
 	return wc, lv, nil
 }
@@ -385,26 +3750,35 @@ func parseWeightedVersions(s string) (weightedChoice, string, error) {
 // current version of CometBFT to establish the "major" version
 // currently in use.
 func gitRepoLatestReleaseVersion(gitRepoDir string) (string, error) {
+	tags, err := gitRepoTags(gitRepoDir)
+	if err != nil {
+		return "", err
+	}
+	return findLatestReleaseTag(version.TMCoreSemVer, tags)
+}
+
+// Lists the names of all annotated tags in the given Git repository.
+func gitRepoTags(gitRepoDir string) ([]string, error) {
 	opts := &git.PlainOpenOptions{
 		DetectDotGit: true,
 	}
 	r, err := git.PlainOpenWithOptions(gitRepoDir, opts)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	tags := make([]string, 0)
 	tagObjs, err := r.TagObjects()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	err = tagObjs.ForEach(func(tagObj *object.Tag) error {
 		tags = append(tags, tagObj.Name)
 		return nil
 	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return findLatestReleaseTag(version.TMCoreSemVer, tags)
+	return tags, nil
 }
 
 func findLatestReleaseTag(baseVer string, tags []string) (string, error) {
@@ -455,3 +3829,57 @@ func findLatestReleaseTag(baseVer string, tags []string) (string, error) {
 	}
 	return vs, nil
 }
+
+// Returns all release tags (i.e. excluding pre-releases) between minTag and
+// maxTag inclusive, in ascending order. Both bounds must be present in tags,
+// and the range must contain at least one release tag.
+func findReleaseTagsInRange(minTag, maxTag string, tags []string) ([]string, error) {
+	minVer, err := semver.NewVersion(minTag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse minimum version \"%s\": %w", minTag, err)
+	}
+	maxVer, err := semver.NewVersion(maxTag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse maximum version \"%s\": %w", maxTag, err)
+	}
+	if minVer.GreaterThan(maxVer) {
+		return nil, fmt.Errorf("invalid version range %s..%s: minimum is greater than maximum", minTag, maxTag)
+	}
+	var minFound, maxFound bool
+	versions := make([]*semver.Version, 0)
+	for _, tag := range tags {
+		minFound = minFound || tag == minTag
+		maxFound = maxFound || tag == maxTag
+		if !strings.HasPrefix(tag, "v") {
+			continue
+		}
+		curVer, err := semver.NewVersion(tag)
+		// Skip tags that are not valid semantic versions
+		if err != nil {
+			continue
+		}
+		// Skip pre-releases
+		if len(curVer.Prerelease()) != 0 {
+			continue
+		}
+		if curVer.LessThan(minVer) || curVer.GreaterThan(maxVer) {
+			continue
+		}
+		versions = append(versions, curVer)
+	}
+	if !minFound {
+		return nil, fmt.Errorf("unknown tag \"%s\" in version range %s..%s", minTag, minTag, maxTag)
+	}
+	if !maxFound {
+		return nil, fmt.Errorf("unknown tag \"%s\" in version range %s..%s", maxTag, minTag, maxTag)
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("version range %s..%s contains no release tags", minTag, maxTag)
+	}
+	sort.Sort(semver.Collection(versions))
+	rangeTags := make([]string, 0, len(versions))
+	for _, v := range versions {
+		rangeTags = append(rangeTags, v.Original())
+	}
+	return rangeTags, nil
+}
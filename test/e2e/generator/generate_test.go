@@ -1,32 +1,2204 @@
 package main
 
 import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
 	"math/rand"
+	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/cometbft/cometbft/config"
+	"github.com/cometbft/cometbft/crypto"
+	"github.com/cometbft/cometbft/libs/log"
+	"github.com/cometbft/cometbft/test/e2e/app"
 	e2e "github.com/cometbft/cometbft/test/e2e/pkg"
+	"github.com/cometbft/cometbft/types"
 )
 
 // TestGenerator tests that only valid manifests are generated
 func TestGenerator(t *testing.T) {
 	cfg := &generateConfig{
-		randSource: rand.New(rand.NewSource(randomSeed)),
+		seed: randomSeed,
 	}
-	manifests, err := Generate(cfg)
+	manifests, _, err := Generate(cfg)
 	require.NoError(t, err)
 
 	for idx, m := range manifests {
 		t.Run(fmt.Sprintf("Case%04d", idx), func(t *testing.T) {
-			infra, err := e2e.NewDockerInfrastructureData(m)
+			newTestnet(t, m)
+		})
+	}
+}
+
+// forEachGeneratedTestnet generates the testnets of seeds 0 to 4 with the given
+// options, and runs check on each of them in a subtest, once it has been
+// loaded as a valid testnet.
+func forEachGeneratedTestnet(t *testing.T, cfg generateConfig, check func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet)) {
+	t.Helper()
+	for seed := int64(0); seed < 5; seed++ {
+		cfg.seed = seed
+		manifests, _, err := Generate(&cfg)
+		require.NoError(t, err, "seed %d", seed)
+		for idx, m := range manifests {
+			t.Run(fmt.Sprintf("Seed%d/Case%04d", seed, idx), func(t *testing.T) {
+				check(t, m, newTestnet(t, m))
+			})
+		}
+	}
+}
+
+// newTestnet loads a generated manifest as a testnet, requiring it to be valid.
+func newTestnet(t *testing.T, m e2e.Manifest) *e2e.Testnet {
+	t.Helper()
+	infra, err := e2e.NewDockerInfrastructureData(m)
+	require.NoError(t, err)
+	testnet, err := e2e.NewTestnetFromManifest(m, filepath.Join(t.TempDir(), "testnet"), infra)
+	require.NoError(t, err)
+	return testnet
+}
+
+// TestGeneratorCatchUpStorm tests that catch-up storms start full nodes at the
+// same height, after every staggered node, and still give valid testnets.
+func TestGeneratorCatchUpStorm(t *testing.T) {
+	_, _, err := Generate(&generateConfig{seed: randomSeed, catchUpStorm: 1.5})
+	require.ErrorContains(t, err, "catch-up storm fraction must be between 0 and 1")
+
+	storms := 0
+	forEachGeneratedTestnet(t, generateConfig{catchUpStorm: 1}, func(t *testing.T, m e2e.Manifest, _ *e2e.Testnet) {
+		stormAt := int64(0)
+		for _, name := range nodeNamesByMode(m, e2e.ModeFull) {
+			if len(m.BridgeNodes) > 0 || m.Nodes[name].StartAt == 0 {
+				continue
+			}
+			if stormAt == 0 {
+				stormAt = m.Nodes[name].StartAt
+			}
+			assert.Equal(t, stormAt, m.Nodes[name].StartAt, name)
+			assert.False(t, m.Nodes[name].StateSync, name)
+			assert.Equal(t, stormStartupBackoff, m.Nodes[name].StartupBackoff, name)
+			assert.Positive(t, m.Nodes[name].MaxDialRetries, name)
+		}
+		if stormAt == 0 {
+			return
+		}
+		storms++
+		for name, node := range m.Nodes {
+			if node.Mode != string(e2e.ModeFull) && node.Mode != string(e2e.ModeLight) {
+				assert.Less(t, node.StartAt, stormAt, name)
+			}
+		}
+	})
+	assert.Positive(t, storms, "no catch-up storm generated")
+}
+
+// TestGeneratorGenesisTime tests that the genesis time offset is recorded in
+// testnets, whether in the past or the future, and that the first block SLA
+// leaves room for a future one.
+func TestGeneratorGenesisTime(t *testing.T) {
+	for _, offset := range []time.Duration{-time.Hour, 0, 30 * time.Second, 24 * time.Hour} {
+		t.Run(offset.String(), func(t *testing.T) {
+			forEachGeneratedTestnet(t, generateConfig{genesisTimeOffset: offset}, func(t *testing.T, m e2e.Manifest, _ *e2e.Testnet) {
+				assert.True(t, m.GenesisTime.IsZero())
+				assert.Equal(t, offset, m.GenesisTimeOffset)
+				assert.Greater(t, m.ExpectedFirstBlockBy, offset)
+			})
+		})
+	}
+}
+
+// TestGeneratorFilter tests that a filter only lets matching testnets through,
+// that sampling goes on until enough of them match, and that a seed and a
+// filter reproduce the same testnets.
+func TestGeneratorFilter(t *testing.T) {
+	stateSyncs := func(m e2e.Manifest) bool {
+		for _, node := range m.Nodes {
+			if node.StateSync {
+				return true
+			}
+		}
+		return false
+	}
+	cfg := &generateConfig{seed: randomSeed, numTestnets: 8, filter: stateSyncs}
+	manifests, _, err := Generate(cfg)
+	require.NoError(t, err)
+	require.Len(t, manifests, 8)
+	for idx, m := range manifests {
+		assert.True(t, stateSyncs(m), "testnet %d", idx)
+	}
+	again, _, err := Generate(cfg)
+	require.NoError(t, err)
+	require.Len(t, again, len(manifests))
+	for idx := range manifests {
+		assert.Equal(t, encodeManifest(t, manifests[idx]), encodeManifest(t, again[idx]), "testnet %d", idx)
+	}
+
+	all, _, err := Generate(&generateConfig{seed: randomSeed})
+	require.NoError(t, err)
+	filtered, _, err := Generate(&generateConfig{seed: randomSeed, filter: stateSyncs})
+	require.NoError(t, err)
+	assert.NotEmpty(t, filtered)
+	assert.Less(t, len(filtered), len(all))
+	for idx, m := range filtered {
+		assert.True(t, stateSyncs(m), "testnet %d", idx)
+	}
+
+	_, _, err = Generate(&generateConfig{
+		seed: randomSeed, numTestnets: 3, filterAttempts: 5, filter: func(e2e.Manifest) bool { return false },
+	})
+	require.EqualError(t, err, "only 0 of 3 testnets matched the filter after 5 attempts")
+}
+
+// TestGeneratorDegradedLink tests that a degraded link connects two peers,
+// from a node running the local version.
+func TestGeneratorDegradedLink(t *testing.T) {
+	degraded := 0
+	forEachGeneratedTestnet(t, generateConfig{degradedLink: true}, func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) {
+		if len(m.LinkLatencies) == 0 {
+			return
+		}
+		degraded++
+		require.Len(t, m.LinkLatencies, 1)
+		link := m.LinkLatencies[0]
+		from, to := m.Nodes[link.From], m.Nodes[link.To]
+		require.NotNil(t, from, link.From)
+		require.NotNil(t, to, link.To)
+		assert.True(t, slices.Contains(from.PersistentPeers, link.To) || slices.Contains(to.PersistentPeers, link.From),
+			"%v and %v are not peers", link.From, link.To)
+		assert.NotEqual(t, e2e.ModeLight, nodeMode(from))
+		assert.NotEqual(t, e2e.ModeLight, nodeMode(to))
+		assert.Empty(t, from.Version)
+		assert.Contains(t, degradedLinkDelays, link.Delay)
+		assert.True(t, testnet.LookupNode(link.From).EmulatesLatency())
+	})
+	assert.Positive(t, degraded)
+}
+
+// TestGeneratorMempoolFlood tests that mempool flooding sends the whole load of
+// a testnet to one full node, and that the load shares of all generated
+// testnets add up.
+func TestGeneratorMempoolFlood(t *testing.T) {
+	floods := 0
+	forEachGeneratedTestnet(t, generateConfig{mempoolFlood: true}, func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) {
+		loaded := []string{}
+		for name, node := range m.Nodes {
+			if !node.SendNoLoad {
+				loaded = append(loaded, name)
+			}
+		}
+		if len(nodeNamesByMode(m, e2e.ModeFull)) > 0 {
+			require.Len(t, loaded, 1)
+			assert.Equal(t, e2e.ModeFull, nodeMode(m.Nodes[loaded[0]]))
+			floods++
+		}
+		total := 0.0
+		for _, share := range testnet.LoadShares() {
+			total += share
+		}
+		assert.InDelta(t, 1, total, 1e-9)
+	})
+	assert.Positive(t, floods)
+}
+
+// TestGeneratorValidatorChurn tests that validator churn schedules power
+// increases, decreases and removals, and that the validators keeping their
+// power across every validator update hold a BFT quorum of the power before
+// it.
+func TestGeneratorValidatorChurn(t *testing.T) {
+	changes := map[string]int{}
+	forEachGeneratedTestnet(t, generateConfig{validatorChurn: true}, func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) {
+		for _, change := range validatorPowerChanges(m) {
+			changes[change]++
+		}
+		heights := []int64{}
+		for h := range testnet.ValidatorUpdates {
+			heights = append(heights, h)
+		}
+		sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+		prev := testnet.ValidatorPowersAt(-1)
+		for _, h := range heights {
+			next := testnet.ValidatorPowersAt(h)
+			var total, carried int64
+			for node, power := range prev {
+				total += power
+				carried += min(power, next[node])
+			}
+			assert.NotEmpty(t, next, "height %d", h)
+			if total > 0 {
+				assert.Greater(t, 3*carried, 2*total, "height %d", h)
+			}
+			prev = next
+		}
+	})
+	for _, action := range validatorChurnActions {
+		assert.Positive(t, changes[action.(string)], action)
+	}
+}
+
+func TestGeneratorKeyRotation(t *testing.T) {
+	_, _, err := Generate(&generateConfig{seed: randomSeed, keyRotation: true, restartAllAt: 10})
+	require.ErrorContains(t, err, "key rotations cannot be combined")
+
+	rotatingTestnets := 0
+	forEachGeneratedTestnet(t, generateConfig{keyRotation: true}, func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) {
+		if !testnet.HasKeyRotations() {
+			return
+		}
+		rotatingTestnets++
+
+		// The rotating validator keeps its power, and is the last one to be
+		// updated.
+		for name, node := range m.Nodes {
+			for height := range node.KeyRotations {
+				h, err := strconv.ParseInt(height, 10, 64)
+				require.NoError(t, err)
+				heights := validatorUpdateHeights(m)
+				assert.Equal(t, h, heights[len(heights)-1], name)
+				assert.Equal(t, validatorPowersAt(m, h-1)[name], m.ValidatorUpdates[height][name], name)
+			}
+		}
+	})
+	assert.Positive(t, rotatingTestnets)
+}
+
+func TestGeneratorSnapshotBootstrap(t *testing.T) {
+	bootstrapped := 0
+	forEachGeneratedTestnet(t, generateConfig{bootstrapFromSnapshot: true}, func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) {
+		if m.Snapshot == nil {
+			return
+		}
+		bootstrapped++
+		for _, node := range testnet.Nodes {
+			if node.StartAt == 0 {
+				assert.False(t, node.StateSync, node.Name)
+			}
+			if node.StateSync {
+				assert.Greater(t, node.StartAt, testnet.SnapshotHeight, node.Name)
+			}
+		}
+	})
+	assert.Positive(t, bootstrapped)
+}
+
+func TestGeneratorEvidenceMaxAge(t *testing.T) {
+	ages := map[int64]bool{}
+	forEachGeneratedTestnet(t, generateConfig{}, func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) {
+		age := m.ConsensusParams.EvidenceMaxAgeNumBlocks
+		ages[age] = true
+		assert.Equal(t, age, testnet.EvidenceMaxAgeNumBlocks)
+		for name, node := range m.Nodes {
+			if node.RetainBlocks > 0 {
+				assert.GreaterOrEqual(t, node.RetainBlocks, uint64(age), name)
+			}
+		}
+	})
+	assert.Len(t, ages, len(evidenceMaxAges))
+}
+
+func TestGeneratorPeerLimits(t *testing.T) {
+	limited, seeds := 0, 0
+	forEachGeneratedTestnet(t, generateConfig{seedContention: true}, func(t *testing.T, _ e2e.Manifest, testnet *e2e.Testnet) {
+		inbound := map[*e2e.Node]int{}
+		for _, node := range testnet.Nodes {
+			if node.Mode != e2e.ModeLight {
+				for _, peer := range node.PersistentPeers {
+					inbound[peer]++
+				}
+			}
+		}
+		for _, node := range testnet.Nodes {
+			if node.Mode == e2e.ModeSeed {
+				seeds++
+				assert.Positive(t, node.MaxInboundPeers, node.Name)
+				assert.Positive(t, node.MaxOutboundPeers, node.Name)
+			}
+			if node.MaxInboundPeers == 0 && node.MaxOutboundPeers == 0 {
+				continue
+			}
+			limited++
+			assert.NotEqual(t, e2e.ModeLight, node.Mode, node.Name)
+			assert.GreaterOrEqual(t, node.MaxOutboundPeers, len(node.Seeds)+len(node.PersistentPeers), node.Name)
+			assert.GreaterOrEqual(t, node.MaxInboundPeers, inbound[node], node.Name)
+		}
+	})
+	assert.Positive(t, limited)
+	assert.Positive(t, seeds)
+}
+
+func TestGeneratorChainIDs(t *testing.T) {
+	for _, prefix := range []string{"", "nightly.v1"} {
+		chainIDs := map[string]bool{}
+		manifests, _, err := Generate(&generateConfig{seed: randomSeed, numTestnets: 50, chainIDPrefix: prefix})
+		require.NoError(t, err)
+		for _, m := range manifests {
+			if prefix == "" {
+				assert.True(t, strings.HasPrefix(m.ChainID, defaultChainIDPrefix+"-"), m.ChainID)
+			} else {
+				assert.True(t, strings.HasPrefix(m.ChainID, prefix+"-"), m.ChainID)
+			}
+			assert.False(t, chainIDs[m.ChainID], "duplicate chain ID %q", m.ChainID)
+			chainIDs[m.ChainID] = true
+			assert.Equal(t, m.ChainID, newTestnet(t, m).ChainID)
+		}
+	}
+
+	// The longest prefix still leaves room for the longest topology.
+	chainID := generateChainID(strings.Repeat("a", maxChainIDPrefixLen), "bridge", 1) + "-99"
+	assert.LessOrEqual(t, len(chainID), types.MaxChainIDLen)
+
+	for _, prefix := range []string{"e2e net", strings.Repeat("a", maxChainIDPrefixLen+1)} {
+		_, _, err := Generate(&generateConfig{seed: randomSeed, chainIDPrefix: prefix})
+		require.ErrorContains(t, err, "chain ID prefix")
+	}
+}
+
+func TestGeneratorAbsentValidators(t *testing.T) {
+	absent := 0
+	forEachGeneratedTestnet(t, generateConfig{absentValidators: 2}, func(t *testing.T, _ e2e.Manifest, testnet *e2e.Testnet) {
+		perTestnet := 0
+		for _, node := range testnet.Nodes {
+			if !node.Absent() {
+				continue
+			}
+			perTestnet++
+			assert.Equal(t, e2e.ModeValidator, node.Mode, node.Name)
+			assert.Contains(t, testnet.ValidatorPowersAt(testnet.InitialHeight), node, node.Name)
+			assert.Empty(t, node.Perturbations, node.Name)
+		}
+		assert.LessOrEqual(t, perTestnet, 2)
+		absent += perTestnet
+
+		// Absent validators never hold 1/3 of the voting power, so they can't
+		// break the quorum.
+		heights := []int64{testnet.InitialHeight}
+		for height := range testnet.ValidatorUpdates {
+			heights = append(heights, height)
+		}
+		for _, height := range heights {
+			var total, absentPower int64
+			for node, power := range testnet.ValidatorPowersAt(height) {
+				total += power
+				if node.Absent() {
+					absentPower += power
+				}
+			}
+			assert.Less(t, 3*absentPower, total, "height %d", height)
+		}
+	})
+	assert.Positive(t, absent)
+}
+
+// TestGeneratorTimeline tests that the timeline of generated testnets has
+// every scheduled event exactly once, in height order.
+func TestGeneratorTimeline(t *testing.T) {
+	manifests := []e2e.Manifest{}
+	for _, cfg := range []generateConfig{{seed: randomSeed, keyRotation: true}, {seed: randomSeed, restartAllAt: 5}} {
+		generated, _, err := Generate(&cfg)
+		require.NoError(t, err)
+		manifests = append(manifests, generated...)
+	}
+	for _, m := range manifests {
+		expect := map[e2e.TimelineEventKind]int{}
+		for _, node := range m.Nodes {
+			if node.StartAt != e2e.StartAtNever {
+				expect[e2e.TimelineNodeStart]++
+			}
+			expect[e2e.TimelineMisbehavior] += len(node.Misbehaviors)
+			expect[e2e.TimelineKeyRotation] += len(node.KeyRotations)
+			expect[e2e.TimelinePerturbation] += len(node.Perturb)
+		}
+		for _, update := range m.ValidatorUpdates {
+			expect[e2e.TimelineValidatorUpdate] += len(update)
+		}
+		if m.VoteExtensionsEnableHeight > 0 {
+			expect[e2e.TimelineVoteExtensionsEnable]++
+		}
+		if m.GlobalRestartHeight > 0 {
+			expect[e2e.TimelineGlobalRestart]++
+		}
+		for kind, n := range expect {
+			if n == 0 {
+				delete(expect, kind)
+			}
+		}
+
+		timeline := m.Timeline()
+		kinds := map[e2e.TimelineEventKind]int{}
+		for i, event := range timeline {
+			kinds[event.Kind]++
+			if i > 0 {
+				assert.LessOrEqual(t, timeline[i-1].Height, event.Height, m.ChainID)
+			}
+		}
+		assert.Equal(t, expect, kinds, m.ChainID)
+	}
+
+	var buf bytes.Buffer
+	printTimelines(&buf, manifests[:1])
+	assert.Contains(t, buf.String(), manifests[0].ChainID+":")
+	assert.Contains(t, buf.String(), "starts")
+}
+
+func TestGeneratorEqualPower(t *testing.T) {
+	forEachGeneratedTestnet(t, generateConfig{equalPower: true, keyRotation: true}, func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) {
+		assert.True(t, m.AssertProposerFairness)
+		heights := []int64{testnet.InitialHeight}
+		for height := range testnet.ValidatorUpdates {
+			heights = append(heights, height)
+		}
+		for _, height := range heights {
+			for node, power := range testnet.ValidatorPowersAt(height) {
+				assert.Equal(t, int64(equalValidatorPower), power, "height %d, node %s", height, node.Name)
+			}
+		}
+	})
+
+	skewed, err := parsePowerDistribution("skewed")
+	require.NoError(t, err)
+	_, _, err = Generate(&generateConfig{seed: randomSeed, equalPower: true, powerDistribution: skewed})
+	require.ErrorContains(t, err, "skewed power distribution")
+	uniform, err := parsePowerDistribution("uniform")
+	require.NoError(t, err)
+	_, _, err = Generate(&generateConfig{seed: randomSeed, equalPower: true, powerDistribution: uniform})
+	require.NoError(t, err)
+}
+
+// TestGeneratorObserverPromotion tests that promoted full nodes join the
+// validator set observerPromotionDelay blocks after they start, through a
+// validator update of their own, holding less than 1/3 of the voting power
+// together with the absent validators.
+func TestGeneratorObserverPromotion(t *testing.T) {
+	promoted := 0
+	cfg := generateConfig{observerPromotion: true, absentValidators: 1}
+	forEachGeneratedTestnet(t, cfg, func(t *testing.T, _ e2e.Manifest, testnet *e2e.Testnet) {
+		for _, node := range testnet.Nodes {
+			if node.PromoteAt == 0 {
+				continue
+			}
+			promoted++
+			assert.Equal(t, e2e.ModeFull, node.Mode, node.Name)
+			assert.Equal(t, max(node.StartAt, testnet.InitialHeight)+observerPromotionDelay, node.PromoteAt, node.Name)
+			assert.NotContains(t, testnet.ValidatorPowersAt(node.PromoteAt-1), node, node.Name)
+			assert.Positive(t, testnet.ValidatorUpdates[node.PromoteAt][node], node.Name)
+
+			var total, faulty int64
+			for validator, power := range testnet.ValidatorPowersAt(node.PromoteAt) {
+				total += power
+				if validator == node || validator.Absent() {
+					faulty += power
+				}
+			}
+			assert.Less(t, 3*faulty, total, node.Name)
+		}
+	})
+	assert.Positive(t, promoted)
+
+	_, _, err := Generate(&generateConfig{seed: randomSeed, observerPromotion: true, minimalQuorum: true})
+	require.Error(t, err)
+}
+
+// TestGeneratorGossipRates tests that throttled gossip gives every node but
+// light clients the same send and receive rate, and no metric thresholds to
+// the testnet, see also the "gossip rate limits" case of TestGeneratorOptions.
+func TestGeneratorGossipRates(t *testing.T) {
+	forEachGeneratedTestnet(t, generateConfig{throttleGossip: true}, func(t *testing.T, _ e2e.Manifest, testnet *e2e.Testnet) {
+		assert.True(t, testnet.ThrottledGossip)
+		assert.Nil(t, testnet.MetricThresholds)
+		rates := map[int64]bool{}
+		for _, node := range testnet.Nodes {
+			if node.Mode == e2e.ModeLight {
+				continue
+			}
+			assert.Contains(t, throttledGossipRates, node.SendRate, node.Name)
+			assert.Equal(t, node.SendRate, node.RecvRate, node.Name)
+			rates[node.SendRate] = true
+		}
+		assert.Len(t, rates, 1)
+	})
+}
+
+// TestMinimalQuorumPower tests that exactly 2f+1 validators start at genesis
+// in minimal quorum testnets of any size, holding more than 2/3 of the voting
+// power, but no longer without any one of them.
+func TestMinimalQuorumPower(t *testing.T) {
+	for n := 1; n <= 30; n++ {
+		var total, live int64
+		numLive := 0
+		for i := 1; i <= n; i++ {
+			power := minimalQuorumPower(i, n)
+			require.Positive(t, power, "%d validators, validator %d", n, i)
+			total += power
+			if i <= minimalQuorumSize(n) {
+				numLive++
+				live += power
+			}
+		}
+		assert.Equal(t, 2*(n/3)+1, numLive, "%d validators", n)
+		assert.Greater(t, 3*live, 2*total, "%d validators", n)
+		assert.LessOrEqual(t, 3*(live-minimalQuorumLivePower), 2*total, "%d validators", n)
+	}
+}
+
+func TestGeneratorMinimalQuorum(t *testing.T) {
+	absent := 0
+	forEachGeneratedTestnet(t, generateConfig{minimalQuorum: true}, func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) {
+		if len(testnet.BridgeNodes) > 0 {
+			return
+		}
+		require.NoError(t, validateMinimalQuorum(m))
+		validators := testnet.ValidatorPowersAt(testnet.InitialHeight)
+		live := 0
+		for node := range validators {
+			if !node.Absent() {
+				live++
+			}
+		}
+		assert.Equal(t, 2*(len(validators)/3)+1, live)
+		absent += len(validators) - live
+	})
+	assert.Positive(t, absent)
+
+	_, _, err := Generate(&generateConfig{seed: randomSeed, minimalQuorum: true, absentValidators: 1})
+	require.Error(t, err)
+}
+
+// assertPerturbedMinority asserts that the validators with a perturbation
+// hold less than 1/3 of the voting power at every height.
+func assertPerturbedMinority(t *testing.T, testnet *e2e.Testnet, p e2e.Perturbation) {
+	t.Helper()
+	heights := []int64{testnet.InitialHeight}
+	for height := range testnet.ValidatorUpdates {
+		heights = append(heights, height)
+	}
+	for _, height := range heights {
+		var total, perturbed int64
+		for node, power := range testnet.ValidatorPowersAt(height) {
+			total += power
+			if slices.Contains(node.Perturbations, p) {
+				perturbed += power
+			}
+		}
+		assert.Less(t, 3*perturbed, total, "%s: %v at height %d", testnet.Name, p, height)
+	}
+}
+
+func TestGeneratorPowerDistribution(t *testing.T) {
+	for _, input := range []string{"", "whale", "100,x", "100,0,100,100", "100,10,10"} {
+		d, err := parsePowerDistribution(input)
+		if err == nil {
+			err = (&generateConfig{powerDistribution: d}).Validate()
+		}
+		require.Error(t, err, input)
+	}
+	uniform, err := parsePowerDistribution("uniform")
+	require.NoError(t, err)
+	_, _, err = Generate(&generateConfig{seed: randomSeed, powerDistribution: uniform, validatorChurn: true})
+	require.ErrorContains(t, err, "cannot be combined")
+
+	testCases := map[string]func(t *testing.T, m e2e.Manifest, powers map[string]int64){
+		"uniform": func(t *testing.T, m e2e.Manifest, powers map[string]int64) {
+			for name, power := range powers {
+				assert.EqualValues(t, 100, power, name)
+			}
+		},
+		"skewed": func(t *testing.T, m e2e.Manifest, powers map[string]int64) {
+			genesis := validatorPowersAt(m, max(m.InitialHeight, 1))
+			var total int64
+			for name, power := range genesis {
+				total += power
+				if name != "validator01" {
+					assert.EqualValues(t, 100, power, name)
+				}
+			}
+			whale := genesis["validator01"]
+			if len(genesis) < 4 {
+				assert.EqualValues(t, 100, whale)
+				return
+			}
+			// Just under 1/3 of the genesis power: one more would reach it.
+			assert.Less(t, 3*whale, total)
+			assert.GreaterOrEqual(t, 3*(whale+1), total+1)
+		},
+		"100,100,100,50,50": func(t *testing.T, m e2e.Manifest, powers map[string]int64) {
+			list := []int64{100, 100, 100, 50, 50}
+			for i, name := range nodeNamesByMode(m, e2e.ModeValidator) {
+				assert.Equal(t, list[i%len(list)], powers[name], name)
+			}
+		},
+	}
+	for input, check := range testCases {
+		t.Run(input, func(t *testing.T) {
+			d, err := parsePowerDistribution(input)
 			require.NoError(t, err)
-			_, err = e2e.NewTestnetFromManifest(m, filepath.Join(t.TempDir(), fmt.Sprintf("Case%04d", idx)), infra)
+			forEachGeneratedTestnet(t, generateConfig{powerDistribution: d}, func(t *testing.T, m e2e.Manifest, _ *e2e.Testnet) {
+				if len(m.BridgeNodes) > 0 {
+					return
+				}
+				require.NoError(t, validatePowerShares(m))
+				check(t, m, validatorPowersAt(m, math.MaxInt64))
+			})
+		})
+	}
+}
+
+func TestGeneratorGlobalRestart(t *testing.T) {
+	_, _, err := Generate(&generateConfig{seed: randomSeed, restartAllAt: 10, archiveBlackoutAt: 10})
+	require.ErrorContains(t, err, "global restarts cannot be combined")
+
+	forEachGeneratedTestnet(t, generateConfig{restartAllAt: 10}, func(t *testing.T, _ e2e.Manifest, testnet *e2e.Testnet) {
+		require.Positive(t, testnet.GlobalRestartHeight)
+		for _, node := range testnet.Nodes {
+			assert.Less(t, node.StartAt, testnet.GlobalRestartHeight, node.Name)
+			if node.Mode != e2e.ModeLight {
+				assert.NotZero(t, node.PersistInterval, "%s does not persist its state", node.Name)
+			}
+		}
+	})
+}
+
+// makeTaggedGitRepo creates a Git repository with a commit having the given
+// annotated tags, returning its directory.
+func makeTaggedGitRepo(t *testing.T, tags ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	require.NoError(t, err)
+	worktree, err := repo.Worktree()
+	require.NoError(t, err)
+	signature := &object.Signature{Name: "e2e", Email: "e2e@example.com", When: time.Now()}
+	hash, err := worktree.Commit("initial commit", &git.CommitOptions{Author: signature, AllowEmptyCommits: true})
+	require.NoError(t, err)
+	for _, tag := range tags {
+		_, err := repo.CreateTag(tag, hash, &git.CreateTagOptions{Tagger: signature, Message: tag})
+		require.NoError(t, err)
+	}
+	return dir
+}
+
+func TestGeneratorInitialStateGen(t *testing.T) {
+	state := map[string]string{"account/alice": "100", "account/bob": "250"}
+	withState := 0
+	cfg := generateConfig{initialStateGen: func(*rand.Rand) map[string]string { return state }}
+	forEachGeneratedTestnet(t, cfg, func(t *testing.T, m e2e.Manifest, _ *e2e.Testnet) {
+		if len(m.InitialState) == 0 {
+			return
+		}
+		withState++
+		assert.Equal(t, state, m.InitialState)
+		if m.ExpectedInitialAppHash != "" {
+			assert.Equal(t, hex.EncodeToString(app.InitChainAppHash(state)), m.ExpectedInitialAppHash)
+		}
+	})
+	assert.Positive(t, withState)
+
+	cfg = generateConfig{initialStateGen: initialStateGenerators["accounts"]}
+	forEachGeneratedTestnet(t, cfg, func(t *testing.T, m e2e.Manifest, _ *e2e.Testnet) {
+		for key := range m.InitialState {
+			assert.True(t, strings.HasPrefix(key, "account/"), key)
+		}
+	})
+}
+
+func TestGeneratorKeySeed(t *testing.T) {
+	_, _, err := Generate(&generateConfig{seed: randomSeed, sharedNodeKeys: true})
+	require.ErrorContains(t, err, "shared node keys require a key seed")
+
+	manifests, _, err := Generate(&generateConfig{seed: randomSeed, keySeed: 42})
+	require.NoError(t, err)
+	require.Greater(t, len(manifests), 1)
+	keys := map[string]crypto.PubKey{}
+	shared := 0
+	for idx, m := range manifests {
+		assert.EqualValues(t, 42, m.KeySeed)
+		for _, node := range newTestnet(t, m).Nodes {
+			if node.Mode != e2e.ModeValidator {
+				continue
+			}
+			key, ok := keys[node.Name]
+			if !ok {
+				keys[node.Name] = node.PrivvalKey.PubKey()
+				continue
+			}
+			assert.Equal(t, key, node.PrivvalKey.PubKey(), "testnet %d: %s", idx, node.Name)
+			shared++
+		}
+	}
+	assert.Positive(t, shared)
+}
+
+// TestGeneratorSentryNodes tests that validators with sentries only peer with
+// them, and that no other node but light clients peers with those validators.
+func TestGeneratorSentryNodes(t *testing.T) {
+	_, _, err := Generate(&generateConfig{seed: randomSeed, sentryNodes: true, seedOnlyDiscovery: true})
+	require.ErrorContains(t, err, "sentry nodes cannot be combined with seed-only discovery")
+
+	protected := 0
+	forEachGeneratedTestnet(t, generateConfig{sentryNodes: true}, func(t *testing.T, _ e2e.Manifest, testnet *e2e.Testnet) {
+		for _, validator := range testnet.Nodes {
+			sentries := testnet.Sentries(validator)
+			if len(sentries) == 0 {
+				continue
+			}
+			protected++
+			assert.Equal(t, e2e.ModeValidator, validator.Mode)
+			assert.Zero(t, validator.StartAt, validator.Name)
+			assert.LessOrEqual(t, len(sentries), 2, validator.Name)
+			assert.Empty(t, validator.Seeds, validator.Name)
+			assert.ElementsMatch(t, sentries, validator.PersistentPeers, validator.Name)
+			for _, sentry := range sentries {
+				assert.Equal(t, e2e.ModeFull, sentry.Mode, sentry.Name)
+				assert.Zero(t, sentry.StartAt, sentry.Name)
+			}
+			for _, node := range testnet.Nodes {
+				if node.Mode == e2e.ModeLight || node.SentryFor == validator {
+					continue
+				}
+				assert.NotContains(t, node.Seeds, validator, node.Name)
+				assert.NotContains(t, node.PersistentPeers, validator, node.Name)
+			}
+		}
+	})
+	assert.Positive(t, protected)
+}
+
+func TestGeneratorDedicatedArchives(t *testing.T) {
+	_, _, err := Generate(&generateConfig{seed: randomSeed, dedicatedArchives: -1})
+	require.ErrorContains(t, err, "dedicated archives must not be negative")
+
+	dedicated, fallback := 0, 0
+	for _, count := range []int{0, 2} {
+		forEachGeneratedTestnet(t, generateConfig{dedicatedArchives: count}, func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) {
+			require.NotEmpty(t, testnet.ArchiveNodes())
+
+			archives := dedicatedArchiveNames(m)
+			if len(archives) == 0 {
+				// Without dedicated archives, or in star and bridge testnets,
+				// the first two validators are archive nodes.
+				assert.Subset(t, []string{"validator01", "validator02"}, m.ArchiveNodes)
+				assert.Contains(t, m.ArchiveNodes, "validator01")
+				fallback++
+				return
+			}
+			dedicated++
+			assert.Equal(t, 2, count)
+			assert.Equal(t, archives, m.ArchiveNodes)
+			for _, name := range archives {
+				node := m.Nodes[name]
+				assert.Zero(t, node.StartAt, name)
+				assert.Zero(t, node.RetainBlocks, name)
+				assert.Positive(t, node.SnapshotInterval, name)
+			}
+			for _, name := range nodeNamesByMode(m, e2e.ModeLight) {
+				node := m.Nodes[name]
+				assert.Subset(t, archives, node.PersistentPeers, name)
+				assert.Subset(t, archives, node.Witnesses, name)
+			}
+		})
+	}
+	assert.Positive(t, dedicated)
+	assert.Positive(t, fallback)
+}
+
+func TestGeneratorShortRetention(t *testing.T) {
+	shortTestnets := 0
+	forEachGeneratedTestnet(t, generateConfig{shortRetention: true}, func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) {
+		short := 0
+		for _, node := range testnet.Nodes {
+			if !node.ShortRetention {
+				continue
+			}
+			short++
+			assert.Positive(t, m.Evidence)
+			assert.NotContains(t, m.ArchiveNodes, node.Name)
+			assert.Positive(t, node.RetainBlocks, node.Name)
+			assert.Less(t, int64(node.RetainBlocks), testnet.EvidenceMaxAgeNumBlocks, node.Name)
+		}
+		if short > 0 {
+			shortTestnets++
+		}
+	})
+	assert.Positive(t, shortTestnets)
+
+	// Without the option, nodes retain the whole evidence age.
+	manifests, _, err := Generate(&generateConfig{seed: randomSeed})
+	require.NoError(t, err)
+	for _, m := range manifests {
+		for name, node := range m.Nodes {
+			assert.False(t, node.ShortRetention, name)
+		}
+	}
+}
+
+func TestGeneratorValidatorGrowth(t *testing.T) {
+	for _, s := range []string{"4:10", "a:10:5", "1:10:5", "4:4:5", "4:100:5", "4:10:0"} {
+		growth, err := parseValidatorGrowth(s)
+		if err == nil {
+			err = growth.Validate()
+		}
+		assert.Error(t, err, s)
+	}
+	_, _, err := Generate(&generateConfig{
+		seed: randomSeed, validatorGrowth: &validatorGrowth{start: 4, target: 8, interval: 3}, validatorChurn: true,
+	})
+	require.ErrorContains(t, err, "cannot be combined")
+
+	grownTestnets := 0
+	cfg := generateConfig{validatorGrowth: &validatorGrowth{start: 4, target: 8, interval: 3}}
+	forEachGeneratedTestnet(t, cfg, func(t *testing.T, m e2e.Manifest, _ *e2e.Testnet) {
+		if m.Nodes["validator08"] == nil || m.Validators == nil || len(*m.Validators) != 4 {
+			return
+		}
+		grownTestnets++
+
+		// Validators join one at a time, after starting, and the others keep
+		// more than 2/3 of the power while the newest catches up.
+		for _, height := range validatorUpdateHeights(m) {
+			update := m.ValidatorUpdates[fmt.Sprint(height)]
+			require.Len(t, update, 1, "height %d", height)
+			powers := validatorPowersAt(m, height)
+			var total int64
+			for _, power := range powers {
+				total += power
+			}
+			for name, power := range update {
+				assert.Less(t, m.Nodes[name].StartAt, height, name)
+				assert.Greater(t, 3*(total-power), 2*total, name)
+			}
+		}
+		assert.Len(t, validatorPowersAt(m, math.MaxInt64), 8)
+	})
+	assert.Positive(t, grownTestnets)
+}
+
+func TestGeneratorPinnedVersions(t *testing.T) {
+	dir := makeTaggedGitRepo(t, "v0.38.0")
+
+	_, _, err := Generate(&generateConfig{
+		seed: randomSeed, outputDir: dir, pinnedVersions: map[string]string{"validator1": "local"},
+	})
+	require.ErrorContains(t, err, "unknown node \"validator1\"")
+	_, _, err = Generate(&generateConfig{
+		seed: randomSeed, outputDir: dir, pinnedVersions: map[string]string{"validator01": "v0.37.0"},
+	})
+	require.ErrorContains(t, err, "is not a tag of the Git repository")
+
+	pins := map[string]string{
+		"validator01": "v0.38.0",
+		"validator02": "local",
+		"full01":      "cometbft/e2e-node:v0.38.0",
+	}
+	pinnedNodes := 0
+	for seed := int64(0); seed < 5; seed++ {
+		cfg := &generateConfig{seed: seed, outputDir: dir, multiVersion: "v0.38.0:1,local:1"}
+		unpinned, _, err := Generate(cfg)
+		require.NoError(t, err)
+		cfg.pinnedVersions = pins
+		pinned, _, err := Generate(cfg)
+		require.NoError(t, err)
+		require.Len(t, pinned, len(unpinned))
+
+		for idx, m := range pinned {
+			newTestnet(t, m)
+			for name, node := range m.Nodes {
+				unpinnedNode := unpinned[idx].Nodes[name]
+				require.NotNil(t, unpinnedNode, "seed %d, testnet %d: %s", seed, idx, name)
+				// Nodes starting after an upgrade run the local version anyway.
+				if m.UpgradeHeight > 0 && node.StartAt >= m.UpgradeHeight {
+					continue
+				}
+				switch name {
+				case "validator01", "full01":
+					assert.Equal(t, "cometbft/e2e-node:v0.38.0", node.Version, "seed %d, testnet %d: %s", seed, idx, name)
+					pinnedNodes++
+				case "validator02":
+					assert.Empty(t, node.Version, "seed %d, testnet %d: %s", seed, idx, name)
+					pinnedNodes++
+				default:
+					assert.Equal(t, unpinnedNode.Version, node.Version, "seed %d, testnet %d: %s", seed, idx, name)
+				}
+			}
+		}
+	}
+	assert.Positive(t, pinnedNodes)
+}
+
+func TestGeneratorArchiveBlackout(t *testing.T) {
+	_, _, err := Generate(&generateConfig{seed: randomSeed, archiveBlackoutAt: 10, upgradeAtHeight: 10})
+	require.ErrorContains(t, err, "archive blackouts cannot be combined with upgrade tests")
+
+	blackouts := 0
+	forEachGeneratedTestnet(t, generateConfig{archiveBlackoutAt: 10}, func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) {
+		assert.NotEmpty(t, m.ArchiveNodes)
+		if m.ArchiveBlackoutHeight == 0 {
+			return
+		}
+		blackouts++
+		assert.EqualValues(t, max(m.InitialHeight, 1)+10, testnet.ArchiveBlackoutHeight)
+	})
+	assert.Positive(t, blackouts)
+}
+
+func TestGeneratorSeedOnlyDiscovery(t *testing.T) {
+	seedOnly := 0
+	forEachGeneratedTestnet(t, generateConfig{seedOnlyDiscovery: true}, func(t *testing.T, m e2e.Manifest, _ *e2e.Testnet) {
+		if !m.SeedOnlyDiscovery {
+			return
+		}
+		seedOnly++
+		require.NotEmpty(t, nodeNamesByMode(m, e2e.ModeSeed))
+		for name, node := range m.Nodes {
+			switch nodeMode(node) {
+			case e2e.ModeSeed:
+				assert.Empty(t, node.PersistentPeers, name)
+			case e2e.ModeValidator, e2e.ModeFull:
+				assert.Empty(t, node.PersistentPeers, name)
+				assert.NotEmpty(t, node.Seeds, name)
+			}
+		}
+	})
+	assert.Positive(t, seedOnly)
+}
+
+func TestLightPrimaries(t *testing.T) {
+	r := rand.New(rand.NewSource(randomSeed)) //nolint:gosec
+	providers := []string{"validator01", "validator02", "full01"}
+	primaries := lightPrimaries(r, providers, 7)
+	require.Len(t, primaries, 7)
+	counts := map[string]int{}
+	for _, primary := range primaries {
+		counts[primary]++
+	}
+	for _, provider := range providers {
+		assert.GreaterOrEqual(t, counts[provider], 2, provider)
+		assert.LessOrEqual(t, counts[provider], 3, provider)
+	}
+	assert.Empty(t, lightPrimaries(r, providers, 0))
+}
+
+func TestReconcileLightTrust(t *testing.T) {
+	manifest := e2e.Manifest{Nodes: map[string]*e2e.ManifestNode{
+		"validator01": {Mode: string(e2e.ModeValidator), RetainBlocks: 20},
+		"validator02": {Mode: string(e2e.ModeValidator), RetainBlocks: 10},
+		"light01": {
+			Mode: string(e2e.ModeLight), StartAt: 30, TrustHeight: 5,
+			PersistentPeers: []string{"validator01"}, Witnesses: []string{"validator02"},
+		},
+		"light02": {
+			Mode: string(e2e.ModeLight), StartAt: 30, TrustHeight: 25,
+			PersistentPeers: []string{"validator02"}, Witnesses: []string{"validator01"},
+		},
+		"light03": {
+			Mode: string(e2e.ModeLight), StartAt: 15, TrustHeight: 2,
+			PersistentPeers: []string{"validator01"}, Witnesses: []string{"validator02"},
+		},
+	}}
+	reconcileLightTrust(manifest)
+	// validator01 retains the blocks from height 11 on once the network
+	// reaches height 30, and everything before reaching height 21.
+	assert.EqualValues(t, 11, manifest.Nodes["light01"].TrustHeight)
+	assert.EqualValues(t, 25, manifest.Nodes["light02"].TrustHeight)
+	assert.EqualValues(t, 2, manifest.Nodes["light03"].TrustHeight)
+}
+
+// TestGeneratorUpgradeAtHeight tests that upgrade tests start every node on
+// the latest release, and schedule a valid coordinated upgrade.
+func TestGeneratorUpgradeAtHeight(t *testing.T) {
+	_, _, err := Generate(&generateConfig{seed: randomSeed, upgradeAtHeight: -1})
+	require.ErrorContains(t, err, "upgrade height must not be negative")
+	_, _, err = Generate(&generateConfig{seed: randomSeed, upgradeAtHeight: 20, multiVersion: "latest"})
+	require.ErrorContains(t, err, "cannot be combined with multiple versions")
+	_, _, err = Generate(&generateConfig{seed: randomSeed, upgradeAtHeight: 20, outputDir: t.TempDir()})
+	require.ErrorContains(t, err, "failed to find the latest release")
+
+	// Generate resolves the latest release from the Git repository, which
+	// we bypass here.
+	defer func(versions weightedChoice) { nodeVersions = versions }(nodeVersions)
+	nodeVersions = weightedChoice{"cometbft/e2e-node:v0.38.0": 1}
+	manifests, _, err := generateTestnets(&generateConfig{seed: randomSeed, upgradeAtHeight: 20}, "")
+	require.NoError(t, err)
+	for _, m := range manifests {
+		initialHeight := m.InitialHeight
+		if initialHeight == 0 {
+			initialHeight = 1
+		}
+		require.Equal(t, initialHeight+20, m.UpgradeHeight)
+		for name, node := range m.Nodes {
+			assert.NotContains(t, node.Perturb, string(e2e.PerturbationUpgrade), name)
+			if node.Version == "" {
+				assert.GreaterOrEqual(t, node.StartAt, m.UpgradeHeight, name)
+			} else {
+				assert.Less(t, node.StartAt, m.UpgradeHeight, name)
+			}
+		}
+		newTestnet(t, m)
+	}
+}
+
+// TestGeneratorOptions tests that every randomly chosen option of the
+// generator is produced at least once across a few seeds, and that the
+// testnets using it are valid. Each check returns how many times its option
+// occurs in a testnet, asserting the option's invariants along the way.
+func TestGeneratorOptions(t *testing.T) {
+	testCases := []struct {
+		name  string
+		check func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int
+	}{
+		{
+			name: "grpc protocol",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				if m.ABCIProtocol != string(e2e.ProtocolGRPC) {
+					return 0
+				}
+				for _, node := range testnet.Nodes {
+					if node.Mode == e2e.ModeLight {
+						assert.Equal(t, e2e.ProtocolBuiltin, node.ABCIProtocol)
+					} else {
+						assert.Equal(t, e2e.ProtocolGRPC, node.ABCIProtocol)
+					}
+				}
+				return 1
+			},
+		},
+		{
+			name: "small blocks",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				if testnet.MaxBlockBytes != 64*1024 {
+					return 0
+				}
+				for _, node := range testnet.Nodes {
+					if node.Mode == e2e.ModeValidator {
+						assert.Equal(t, testnet.MaxBlockBytes, node.MaxBlockBytes, node.Name)
+					}
+				}
+				return 1
+			},
+		},
+		{
+			name: "gas-limited blocks",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				if testnet.MaxGas == 0 {
+					return 0
+				}
+				if m.LoadProfile != nil && m.LoadProfile.PeakRate() > int(m.MaxGas) {
+					assert.True(t, m.LoadProfile.Overloaded)
+				}
+				return 1
+			},
+		},
+		{
+			name: "mixed vote extensions",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				omitting := 0
+				for _, node := range testnet.Nodes {
+					if node.AppConfig[app.AppConfigVoteExtensions] == "omit" {
+						assert.Equal(t, e2e.ModeValidator, node.Mode)
+						omitting++
+					}
+				}
+				if omitting == 0 {
+					return 0
+				}
+				for _, node := range testnet.Nodes {
+					if node.Mode != e2e.ModeLight {
+						assert.Equal(t, "accept", node.AppConfig[app.AppConfigEmptyVoteExtensions], node.Name)
+					}
+				}
+				return 1
+			},
+		},
+		{
+			name: "mempool caches disabled",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				disabled, mempools := 0, 0
+				for _, node := range testnet.Nodes {
+					if node.Mode != e2e.ModeValidator && node.Mode != e2e.ModeFull {
+						continue
+					}
+					mempools++
+					if node.MempoolCacheSize == 0 {
+						disabled++
+					}
+				}
+				if disabled == 0 {
+					return 0
+				}
+				assert.Less(t, 3*disabled, mempools)
+				return 1
+			},
+		},
+		{
+			name: "builtin_connsync protocol with small ABCI delays",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				if m.ABCIProtocol != string(e2e.ProtocolBuiltinConnSync) {
+					return 0
+				}
+				assert.LessOrEqual(t, m.PrepareProposalDelay+m.PrepareProposalJitter, connSyncMaxPrepareProposalDelay)
+				return 1
+			},
+		},
+		{
+			name: "ring topology",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				validators := nodeNamesByMode(m, e2e.ModeValidator)
+				if len(validators) < 3 {
+					return 0
+				}
+				for i, name := range validators {
+					peers := m.Nodes[name].PersistentPeers
+					if len(peers) != 2 || peers[1] != validators[(i+1)%len(validators)] {
+						return 0
+					}
+				}
+				return 1
+			},
+		},
+		{
+			name: "star topology",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				for _, name := range nodeNamesByMode(m, e2e.ModeValidator) {
+					if !slices.Equal(m.Nodes[name].PersistentPeers, []string{"full01"}) {
+						return 0
+					}
+				}
+				return 1
+			},
+		},
+		{
+			name: "bridge topology",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				return len(m.BridgeNodes)
+			},
+		},
+		{
+			name: "large initial state",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				switch len(m.InitialState) {
+				case 0:
+					assert.Equal(t, "af5570f5a1810b7af78caf4bc70a660f0df51e42baf91d4de5b2328de0e83dfc", m.ExpectedInitialAppHash)
+				case 500:
+					assert.Equal(t, "7482a264768fb46f25cd1ed42322d19e3c83069a0ab67acb079fcf7fc02e2877", m.ExpectedInitialAppHash)
+					return 1
+				default:
+					assert.NotEmpty(t, m.ExpectedInitialAppHash)
+				}
+				return 0
+			},
+		},
+		{
+			name: "secp256k1 validator keys",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				count := 0
+				for name, node := range m.Nodes {
+					if node.Mode != string(e2e.ModeValidator) {
+						assert.Empty(t, node.KeyType, name)
+					}
+					if node.KeyType == "secp256k1" {
+						count++
+					}
+				}
+				return count
+			},
+		},
+		{
+			name: "ed25519 validator keys",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				count := 0
+				for _, node := range m.Nodes {
+					if node.KeyType == "ed25519" {
+						count++
+					}
+				}
+				return count
+			},
+		},
+		{
+			name: "clock skew",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				count := 0
+				genesisSkew := time.Duration(0)
+				for name, node := range m.Nodes {
+					if node.ClockSkew == 0 {
+						continue
+					}
+					count++
+					assert.Empty(t, node.Version, name)
+					assert.Contains(t, []string{string(e2e.ProtocolBuiltin), string(e2e.ProtocolBuiltinConnSync)}, m.ABCIProtocol)
+					assert.Equal(t, e2e.ModeValidator, nodeMode(node), name)
+					if node.StartAt == 0 {
+						if node.ClockSkew < 0 {
+							genesisSkew -= node.ClockSkew
+						} else {
+							genesisSkew += node.ClockSkew
+						}
+					}
+				}
+				assert.LessOrEqual(t, genesisSkew, genesisClockSkewBudget)
+				return count
+			},
+		},
+		{
+			name: "zones",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				count := 0
+				for name, node := range m.Nodes {
+					if node.Mode == string(e2e.ModeLight) || node.Version != "" {
+						assert.Empty(t, node.Zone, name)
+						continue
+					}
+					require.NotEmpty(t, node.Zone, name)
+					count++
+					for _, other := range m.Nodes {
+						if other.Zone == "" {
+							continue
+						}
+						latency, ok := m.ZoneLatencies[node.Zone][other.Zone]
+						require.True(t, ok)
+						assert.Equal(t, latency, m.ZoneLatencies[other.Zone][node.Zone])
+						if other.Zone != node.Zone {
+							assert.Less(t, m.ZoneLatencies[node.Zone][node.Zone], latency)
+						}
+					}
+				}
+				return count
+			},
+		},
+		{
+			name: "light clients",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				count := 0
+				for _, node := range m.Nodes {
+					if node.Mode != string(e2e.ModeLight) {
+						continue
+					}
+					count++
+					require.Len(t, node.PersistentPeers, 1)
+					assert.NotEmpty(t, node.Witnesses)
+					assert.LessOrEqual(t, len(node.Witnesses), lightNodeMaxWitnesses)
+					assert.NotContains(t, node.Witnesses, node.PersistentPeers[0])
+					assert.GreaterOrEqual(t, node.TrustHeight, m.InitialHeight)
+					assert.LessOrEqual(t, node.TrustHeight, node.StartAt)
+				}
+				return count
+			},
+		},
+		{
+			name: "misbehaviors",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				count := 0
+				for name, node := range m.Nodes {
+					if len(node.Misbehaviors) == 0 {
+						continue
+					}
+					count++
+					assert.Positive(t, m.Evidence)
+					assert.Equal(t, string(e2e.ModeValidator), node.Mode)
+					assert.NotContains(t, []string{"validator01", "validator02"}, name)
+				}
+				return count
+			},
+		},
+		{
+			name: "non-default snapshot formats",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				count := 0
+				for name, node := range m.Nodes {
+					if node.SnapshotFormat > 1 {
+						assert.Empty(t, node.Version, name)
+						count++
+					}
+				}
+				return count
+			},
+		},
+		{
+			name: "snapshot chunk sizes",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				count := 0
+				for name, node := range m.Nodes {
+					if node.SnapshotChunkSize > 0 {
+						assert.Empty(t, node.Version, name)
+						count++
+					}
+				}
+				return count
+			},
+		},
+		{
+			name: "extreme ABCI delays",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				if m.FinalizeBlockDelay != time.Second {
+					return 0
+				}
+				assert.Equal(t, 300*time.Millisecond, m.VoteExtensionDelay)
+				assert.Equal(t, m.VoteExtensionDelay, testnet.VoteExtensionDelay)
+				assert.Equal(t, m.FinalizeBlockDelay, testnet.FinalizeBlockDelay)
+				assert.Equal(t, 300*time.Millisecond, testnet.PrepareProposalJitter)
+				assert.Equal(t, 300*time.Millisecond, testnet.ProcessProposalJitter)
+				return 1
+			},
+		},
+		{
+			name: "ABCI delay jitter",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				if m.PrepareProposalJitter == 0 {
+					assert.Zero(t, m.ProcessProposalJitter)
+					return 0
+				}
+				assert.Contains(t, []time.Duration{500 * time.Millisecond, time.Second}, m.FinalizeBlockDelay)
+				return 1
+			},
+		},
+		{
+			name: "slow vote extenders",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				count := 0
+				for _, node := range testnet.Nodes {
+					if m.Nodes[node.Name].VoteExtensionDelay == 0 {
+						assert.Equal(t, testnet.VoteExtensionDelay, node.VoteExtensionDelay, node.Name)
+						continue
+					}
+					count++
+					assert.Equal(t, e2e.ModeValidator, node.Mode, node.Name)
+					assert.Equal(t, slowVoteExtensionDelay, node.VoteExtensionDelay, node.Name)
+				}
+				return count
+			},
+		},
+		{
+			name: "per-node consensus timeouts",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				count := 0
+				for _, node := range testnet.Nodes {
+					assert.LessOrEqual(t, node.TimeoutPropose, e2e.MaxConsensusTimeout, node.Name)
+					assert.LessOrEqual(t, node.TimeoutCommit, e2e.MaxConsensusTimeout, node.Name)
+					if node.TimeoutPropose > 0 || node.TimeoutCommit > 0 {
+						count++
+					}
+				}
+				return count
+			},
+		},
+		{
+			name: "validators disagreeing on timeouts",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				timeouts := map[time.Duration]bool{}
+				for _, node := range testnet.Nodes {
+					if node.Mode == e2e.ModeValidator {
+						timeouts[node.TimeoutPropose] = true
+					}
+				}
+				if len(timeouts) > 1 {
+					return 1
+				}
+				return 0
+			},
+		},
+		{
+			name: "bursty load profile",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				require.NotNil(t, testnet.LoadProfile)
+				if testnet.LoadProfile.Name != "bursty" {
+					return 0
+				}
+				assert.NotEmpty(t, testnet.LoadProfile.Bursts)
+				assert.Greater(t, testnet.LoadProfile.PeakRate(), testnet.LoadProfile.TxRate)
+				return 1
+			},
+		},
+		{
+			name: "overloaded load profile",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				maxTxSize := slices.Max(m.LoadProfile.TxSizes)
+				overloaded := float64(m.LoadProfile.PeakRate()) > loadCapacity(m, maxTxSize)
+				assert.Equal(t, overloaded, m.LoadProfile.Overloaded)
+				if overloaded {
+					return 1
+				}
+				return 0
+			},
+		},
+		{
+			name: "dual stack",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				if !m.DualStack() {
+					assert.Nil(t, testnet.IPv6Net)
+					return 0
+				}
+				require.NotNil(t, testnet.IPv6Net)
+				for _, name := range m.BridgeNodes {
+					assert.Equal(t, string(e2e.AddressFamilyDual), m.Nodes[name].AddressFamily, name)
+				}
+				for name, node := range m.Nodes {
+					if node.Mode == string(e2e.ModeSeed) {
+						assert.Equal(t, string(e2e.AddressFamilyDual), node.AddressFamily, name)
+					}
+				}
+				return 1
+			},
+		},
+		{
+			name: "single-family nodes in dual stack testnets",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				count := 0
+				for _, node := range m.Nodes {
+					if node.AddressFamily != "" && node.AddressFamily != string(e2e.AddressFamilyDual) {
+						count++
+					}
+				}
+				return count
+			},
+		},
+		{
+			name: "throttle_disk perturbation",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				count := 0
+				for name, node := range m.Nodes {
+					if !slices.Contains(node.Perturb, string(e2e.PerturbationThrottleDisk)) {
+						assert.Zero(t, node.DiskBandwidth, name)
+						continue
+					}
+					count++
+					assert.Positive(t, node.DiskBandwidth, name)
+					if node.Mode == string(e2e.ModeValidator) {
+						assert.Positive(t, node.StartAt, name)
+					}
+				}
+				return count
+			},
+		},
+		{
+			name: "corrupt_db recovering with blocksync",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				return countRecoveryModes(t, m, e2e.RecoveryModeBlockSync)
+			},
+		},
+		{
+			name: "corrupt_db recovering with state sync",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				for _, node := range testnet.ArchiveNodes() {
+					assert.NotEqual(t, e2e.RecoveryModeStateSync, node.RecoveryMode, node.Name)
+				}
+				return countRecoveryModes(t, m, e2e.RecoveryModeStateSync)
+			},
+		},
+		{
+			name: "startup backoff",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				count := 0
+				for name, node := range m.Nodes {
+					if node.StartupBackoff == 0 {
+						assert.Zero(t, node.MaxDialRetries, name)
+						continue
+					}
+					count++
+					assert.Contains(t, []e2e.Mode{e2e.ModeValidator, e2e.ModeFull}, nodeMode(node), name)
+				}
+				return count
+			},
+		},
+		{
+			name: "dial retries within the catch-up SLA",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				count := 0
+				for name, node := range m.Nodes {
+					if node.MaxDialRetries == 0 {
+						continue
+					}
+					count++
+					assert.Less(t, time.Duration(node.MaxDialRetries)*node.StartupBackoff, m.ExpectedCatchUpBy, name)
+				}
+				return count
+			},
+		},
+		{
+			name: "privval_disconnect perturbation",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				count := 0
+				for _, node := range testnet.Nodes {
+					if !slices.Contains(node.Perturbations, e2e.PerturbationPrivvalDisconnect) {
+						continue
+					}
+					count++
+					assert.Equal(t, e2e.ModeValidator, node.Mode, node.Name)
+					assert.Contains(t, []e2e.Protocol{e2e.ProtocolTCP, e2e.ProtocolUNIX}, node.PrivvalProtocol, node.Name)
+				}
+				// A quorum of validators never loses its signer at once.
+				assertPerturbedMinority(t, testnet, e2e.PerturbationPrivvalDisconnect)
+				return count
+			},
+		},
+		{
+			name: "wal_truncate perturbation",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				count := 0
+				for _, node := range testnet.Nodes {
+					if !slices.Contains(node.Perturbations, e2e.PerturbationWALTruncate) {
+						continue
+					}
+					count++
+					assert.Equal(t, e2e.ModeValidator, node.Mode, node.Name)
+					assert.True(t, node.WALEnabled, node.Name)
+				}
+				// A quorum of validators never has its WAL truncated.
+				assertPerturbedMinority(t, testnet, e2e.PerturbationWALTruncate)
+				return count
+			},
+		},
+		{
+			name: "WAL disabled",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				count := 0
+				for _, node := range testnet.Nodes {
+					if !node.WALEnabled {
+						count++
+					}
+				}
+				return count
+			},
+		},
+		{
+			name: "flap perturbation",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				count := 0
+				for _, node := range testnet.Nodes {
+					if !slices.Contains(node.Perturbations, e2e.PerturbationFlap) {
+						assert.Zero(t, node.FlapInterval, node.Name)
+						continue
+					}
+					count++
+					assert.GreaterOrEqual(t, node.FlapInterval, e2e.MinFlapInterval, node.Name)
+					assert.LessOrEqual(t, node.FlapInterval, e2e.MaxFlapInterval, node.Name)
+					_, genesis := testnet.Validators[node]
+					assert.False(t, genesis, "genesis validator %s flaps", node.Name)
+				}
+				assertPerturbedMinority(t, testnet, e2e.PerturbationFlap)
+				return count
+			},
+		},
+		{
+			// Seeds, bridge nodes and light clients are never behind NAT, and
+			// every node keeps a peer which is not.
+			name: "nodes behind NAT",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				count := 0
+				for _, node := range testnet.Nodes {
+					if node.BehindNAT {
+						count++
+						assert.Contains(t, []e2e.Mode{e2e.ModeValidator, e2e.ModeFull}, node.Mode, node.Name)
+						assert.NotContains(t, testnet.BridgeNodes, node, node.Name)
+					}
+					if node.Mode == e2e.ModeLight {
+						continue
+					}
+					peers := append(append([]*e2e.Node{}, node.Seeds...), node.PersistentPeers...)
+					reachable := len(peers) == 0
+					for _, peer := range peers {
+						reachable = reachable || !peer.BehindNAT
+					}
+					assert.True(t, reachable, "all peers of %s are behind NAT", node.Name)
+				}
+				return count
+			},
+		},
+		{
+			// The full nodes of builtin_connsync testnets always get the
+			// 'kill' and 'restart' perturbations together with the replay
+			// consistency assertion, and other nodes never get the assertion.
+			name: "replay consistency assertions",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				count := 0
+				for _, node := range testnet.Nodes {
+					connSyncFull := node.Mode == e2e.ModeFull && node.ABCIProtocol == e2e.ProtocolBuiltinConnSync
+					assert.Equal(t, connSyncFull, node.AssertReplayConsistency, node.Name)
+					if !node.AssertReplayConsistency {
+						continue
+					}
+					count++
+					assert.Contains(t, node.Perturbations, e2e.PerturbationKill, node.Name)
+					assert.Contains(t, node.Perturbations, e2e.PerturbationRestart, node.Name)
+				}
+				return count
+			},
+		},
+		{
+			// With at least two providers, no two light clients share a
+			// primary until every provider is the primary of one.
+			name: "light clients with distinct primaries",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				lights := nodeNamesByMode(m, e2e.ModeLight)
+				primaries := map[string]int{}
+				for _, name := range lights {
+					node := m.Nodes[name]
+					require.Len(t, node.PersistentPeers, 1, name)
+					assert.NotEmpty(t, node.Witnesses, name)
+					assert.NotContains(t, node.Witnesses, node.PersistentPeers[0], name)
+					primaries[node.PersistentPeers[0]]++
+				}
+				if len(lights) < 2 {
+					return 0
+				}
+				assert.Greater(t, len(primaries), 1, "all light clients share a primary")
+				for primary, count := range primaries {
+					assert.LessOrEqual(t, count, (len(lights)+1)/2, primary)
+				}
+				return 1
+			},
+		},
+		{
+			name: "gossip rate limits",
+			check: func(t *testing.T, m e2e.Manifest, testnet *e2e.Testnet) int {
+				assert.False(t, testnet.ThrottledGossip)
+				assert.Equal(t, testnet.MinGossipRate(), m.MinGossipRate())
+				count := 0
+				for _, node := range testnet.Nodes {
+					if node.SendRate > 0 || node.RecvRate > 0 {
+						count++
+					}
+				}
+				return count
+			},
+		},
+	}
+
+	type testnet struct {
+		manifest e2e.Manifest
+		testnet  *e2e.Testnet
+	}
+	var testnets []testnet
+	forEachGeneratedTestnet(t, generateConfig{throttleDisk: true}, func(_ *testing.T, m e2e.Manifest, tn *e2e.Testnet) {
+		testnets = append(testnets, testnet{manifest: m, testnet: tn})
+	})
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			count := 0
+			for _, tn := range testnets {
+				count += tc.check(t, tn.manifest, tn.testnet)
+			}
+			assert.Positive(t, count, "option never generated")
+		})
+	}
+}
+
+// countRecoveryModes counts the nodes recovering from a corrupt_db perturbation
+// with the given mode, checking that only these nodes have a recovery mode.
+func countRecoveryModes(t *testing.T, m e2e.Manifest, mode e2e.RecoveryMode) int {
+	count := 0
+	for name, node := range m.Nodes {
+		corruptDB := slices.Contains(node.Perturb, string(e2e.PerturbationCorruptDB))
+		assert.Equal(t, corruptDB, node.RecoveryMode != "", name)
+		if node.RecoveryMode == string(mode) {
+			count++
+		}
+	}
+	return count
+}
+
+// TestGeneratorThrottleDiskOptIn tests that the throttle_disk perturbation is
+// only generated when enabled.
+func TestGeneratorThrottleDiskOptIn(t *testing.T) {
+	manifests, _, err := Generate(&generateConfig{seed: randomSeed})
+	require.NoError(t, err)
+	for _, m := range manifests {
+		for name, node := range m.Nodes {
+			assert.NotContains(t, node.Perturb, string(e2e.PerturbationThrottleDisk), name)
+			assert.Zero(t, node.DiskBandwidth, name)
+		}
+	}
+}
+
+func TestGeneratorNoPerturbations(t *testing.T) {
+	for seed := int64(0); seed < 20; seed++ {
+		manifests, _, err := Generate(&generateConfig{seed: seed, noPerturbations: true})
+		require.NoError(t, err)
+		for idx, m := range manifests {
+			for name, node := range m.Nodes {
+				assert.Empty(t, node.Perturb, "seed %d, testnet %d, node %s", seed, idx, name)
+				assert.Empty(t, node.RecoveryMode, "seed %d, testnet %d, node %s", seed, idx, name)
+				assert.False(t, node.AssertReplayConsistency, "seed %d, testnet %d, node %s", seed, idx, name)
+			}
+		}
+	}
+}
+
+func TestGeneratorForcePerturbations(t *testing.T) {
+	_, _, err := Generate(&generateConfig{seed: randomSeed, noPerturbations: true, forcePerturbations: true})
+	require.ErrorContains(t, err, "perturbations cannot be both disabled and forced")
+
+	forEachGeneratedTestnet(t, generateConfig{forcePerturbations: true}, func(t *testing.T, m e2e.Manifest, _ *e2e.Testnet) {
+		for name, node := range m.Nodes {
+			mode := nodeMode(node)
+			if mode == e2e.ModeLight || (mode == e2e.ModeValidator && node.StartAt == 0) {
+				continue
+			}
+			assert.NotEmpty(t, node.Perturb, name)
+		}
+	})
+}
+
+func TestGeneratorNoLightClients(t *testing.T) {
+	for seed := int64(0); seed < 20; seed++ {
+		manifests, _, err := Generate(&generateConfig{seed: seed, noLightClients: true})
+		require.NoError(t, err)
+		for idx, m := range manifests {
+			assert.Empty(t, nodeNamesByMode(m, e2e.ModeLight), "seed %d, testnet %d", seed, idx)
+		}
+	}
+}
+
+func TestGeneratorForceLightClients(t *testing.T) {
+	_, _, err := Generate(&generateConfig{seed: randomSeed, noLightClients: true, forceLightClients: 2})
+	require.ErrorContains(t, err, "light clients cannot be both disabled and forced")
+	_, _, err = Generate(&generateConfig{seed: randomSeed, forceLightClients: -1})
+	require.ErrorContains(t, err, "forced light clients must be between 0 and 99")
+
+	// Only large testnets have light clients.
+	lightTestnets := 0
+	forEachGeneratedTestnet(t, generateConfig{forceLightClients: 4}, func(t *testing.T, m e2e.Manifest, _ *e2e.Testnet) {
+		if lightClients := nodeNamesByMode(m, e2e.ModeLight); len(lightClients) > 0 {
+			assert.Len(t, lightClients, 4)
+			lightTestnets++
+		}
+	})
+	assert.Positive(t, lightTestnets)
+}
+
+// TestGeneratorDecisionLog tests that a JSON record of its choices is logged
+// for every generated node.
+func TestGeneratorDecisionLog(t *testing.T) {
+	var buf bytes.Buffer
+	manifests, _, err := Generate(&generateConfig{seed: randomSeed, logger: log.NewTMJSONLoggerNoTS(&buf)})
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, countNodes(manifests))
+	for _, line := range lines {
+		var record struct {
+			Seed    int64
+			Testnet int
+			Node    string
+			Choices map[string]interface{}
+		}
+		require.NoError(t, json.Unmarshal([]byte(line), &record), line)
+		assert.Equal(t, randomSeed, record.Seed)
+		node := manifests[record.Testnet].Nodes[record.Node]
+		require.NotNil(t, node, line)
+		assert.Equal(t, node.Database, record.Choices["database"], line)
+		assert.Equal(t, node.Mode, record.Choices["mode"], line)
+	}
+}
+
+// TestGeneratorABCIApp tests that testnets running an application other than
+// the kvstore use a socket protocol and no kvstore-specific settings.
+func TestGeneratorABCIApp(t *testing.T) {
+	forEachGeneratedTestnet(t, generateConfig{abciApp: "stress-app"}, func(t *testing.T, m e2e.Manifest, _ *e2e.Testnet) {
+		assert.Equal(t, "stress-app", m.ABCIApp)
+		assert.NotEqual(t, string(e2e.ProtocolBuiltin), m.ABCIProtocol)
+		assert.NotEqual(t, string(e2e.ProtocolBuiltinConnSync), m.ABCIProtocol)
+		assert.Empty(t, m.InitialState)
+		assert.Empty(t, m.ExpectedInitialAppHash)
+	})
+}
+
+// TestGeneratorCgoDatabases tests that the databases requiring cgo are only
+// generated when cgo is enabled, and that nodeDatabases is left intact.
+func TestGeneratorCgoDatabases(t *testing.T) {
+	databases := func(noCgo bool) map[string]bool {
+		found := map[string]bool{}
+		for seed := int64(0); seed < 5; seed++ {
+			manifests, _, err := Generate(&generateConfig{seed: seed, noCgo: noCgo})
 			require.NoError(t, err)
+			for _, m := range manifests {
+				for _, node := range m.Nodes {
+					found[node.Database] = true
+				}
+			}
+		}
+		return found
+	}
+
+	for database := range databases(true) {
+		assert.False(t, cgoDatabases[database], database)
+	}
+	found := databases(false)
+	for database := range nodeDatabases {
+		assert.True(t, found[database.(string)], database)
+	}
+}
+
+// TestGeneratorDatabaseWeights tests that databases are generated in
+// proportion to their weights, and never with a weight of 0.
+func TestGeneratorDatabaseWeights(t *testing.T) {
+	_, _, err := Generate(&generateConfig{seed: randomSeed, databaseWeights: map[string]uint{"sqlite": 1}})
+	require.ErrorContains(t, err, "unknown database \"sqlite\"")
+	_, _, err = Generate(&generateConfig{seed: randomSeed, noCgo: true, databaseWeights: map[string]uint{"rocksdb": 1}})
+	require.ErrorContains(t, err, "no database left to generate")
+
+	weights := map[string]uint{"goleveldb": 6, "boltdb": 3, "badgerdb": 1, "rocksdb": 0}
+	counts := map[string]int{}
+	total := 0
+	for seed := int64(0); seed < 5; seed++ {
+		manifests, _, err := Generate(&generateConfig{seed: seed, databaseWeights: weights})
+		require.NoError(t, err)
+		for _, m := range manifests {
+			for _, node := range m.Nodes {
+				counts[node.Database]++
+				total++
+			}
+		}
+	}
+	assert.Len(t, counts, 3)
+	for database, weight := range weights {
+		assert.InDelta(t, float64(weight)/10, float64(counts[database])/float64(total), 0.05, database)
+	}
+	assert.Equal(t, weightedChoice{"goleveldb": 1, "cleveldb": 1, "rocksdb": 1, "boltdb": 1, "badgerdb": 1},
+		nodeDatabases)
+}
+
+// TestGeneratorSkipDuplicates tests that skipping duplicates keeps the first
+// testnet of each fingerprint, in order.
+func TestGeneratorSkipDuplicates(t *testing.T) {
+	cfg := &generateConfig{seed: randomSeed, numTestnets: 100}
+	manifests, _, err := Generate(cfg)
+	require.NoError(t, err)
+	expected := []e2e.Manifest{}
+	seen := map[string]bool{}
+	for _, m := range manifests {
+		if !seen[m.Fingerprint()] {
+			seen[m.Fingerprint()] = true
+			expected = append(expected, m)
+		}
+	}
+	require.Less(t, len(expected), len(manifests), "no duplicates to skip")
+
+	cfg.skipDuplicates = true
+	deduplicated, _, err := Generate(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, expected, deduplicated)
+}
+
+// TestGenerateFromSeed tests that generation is reproducible from the seed
+// recorded in the manifests, and that the seed survives a save/load round trip.
+func TestGenerateFromSeed(t *testing.T) {
+	cfg := &generateConfig{
+		seed: randomSeed,
+	}
+	manifests, _, err := Generate(cfg)
+	require.NoError(t, err)
+	require.NotEmpty(t, manifests)
+
+	file := filepath.Join(t.TempDir(), "manifest.toml")
+	require.NoError(t, manifests[0].Save(file))
+	loaded, err := e2e.LoadManifest(file)
+	require.NoError(t, err)
+	require.Equal(t, int64(randomSeed), loaded.GeneratorSeed)
+	require.Equal(t, manifests[0].GeneratorVersion, loaded.GeneratorVersion)
+
+	regenerated, _, err := GenerateFromSeed(loaded.GeneratorSeed, &generateConfig{})
+	require.NoError(t, err)
+	require.Equal(t, manifests, regenerated)
+}
+
+// TestGenerateSeq tests that the streamed testnets are the ones generated by
+// Generate for the same seed, with or without a node budget, and that the
+// stream stops when asked to.
+func TestGenerateSeq(t *testing.T) {
+	for _, cfg := range []*generateConfig{
+		{seed: randomSeed},
+		{seed: randomSeed, numTestnets: 5},
+		{seed: randomSeed, maxTotalNodes: 40},
+	} {
+		manifests, _, err := Generate(cfg)
+		require.NoError(t, err)
+
+		streamed := []e2e.Manifest{}
+		GenerateSeq(cfg)(func(m e2e.Manifest, err error) bool {
+			require.NoError(t, err)
+			streamed = append(streamed, m)
+			return true
+		})
+		require.Equal(t, manifests, streamed)
+
+		count := 0
+		GenerateSeq(cfg)(func(m e2e.Manifest, err error) bool {
+			require.NoError(t, err)
+			require.Equal(t, manifests[count], m)
+			count++
+			return count < 2
 		})
+		require.Equal(t, 2, count)
+	}
+
+	errs := 0
+	GenerateSeq(&generateConfig{upgradeAtHeight: -1})(func(m e2e.Manifest, err error) bool {
+		require.Error(t, err)
+		errs++
+		return true
+	})
+	require.Equal(t, 1, errs)
+}
+
+// TestGeneratorTopologies tests that the ring and star topologies are wired
+// up explicitly.
+func TestGeneratorTopologies(t *testing.T) {
+	r := rand.New(rand.NewSource(randomSeed))
+	opt := map[string]interface{}{
+		"initialHeight": 0,
+		"initialState":  map[string]string{},
+		"validators":    "genesis",
+	}
+
+	opt["topology"] = "ring"
+	m, err := generateTestnet(r, opt, "", &generateConfig{})
+	require.NoError(t, err)
+	validators := nodeNamesByMode(m, e2e.ModeValidator)
+	require.Len(t, m.Nodes, len(validators))
+	for i, name := range validators {
+		peers := m.Nodes[name].PersistentPeers
+		require.Len(t, peers, 2)
+		assert.Equal(t, validators[(i+1)%len(validators)], peers[1])
+	}
+
+	opt["topology"] = "bridge"
+	m, err = generateTestnet(r, opt, "", &generateConfig{})
+	require.NoError(t, err)
+	require.NotEmpty(t, m.BridgeNodes)
+	validators = nodeNamesByMode(m, e2e.ModeValidator)
+	cluster := map[string]int{}
+	for i, name := range validators {
+		cluster[name] = i * 2 / len(validators)
+	}
+	for _, name := range validators {
+		for _, peer := range m.Nodes[name].PersistentPeers {
+			if _, ok := cluster[peer]; ok {
+				assert.Equal(t, cluster[name], cluster[peer])
+			} else {
+				assert.Contains(t, m.BridgeNodes, peer)
+			}
+		}
+	}
+
+	opt["topology"] = "star"
+	m, err = generateTestnet(r, opt, "", &generateConfig{})
+	require.NoError(t, err)
+	require.Contains(t, m.Nodes, "full01")
+	assert.Zero(t, m.Nodes["full01"].StartAt)
+	for _, name := range nodeNamesByMode(m, e2e.ModeValidator) {
+		assert.Equal(t, []string{"full01"}, m.Nodes[name].PersistentPeers)
+	}
+}
+
+// TestRegenerateTopology tests that regenerating the topology of a manifest
+// leaves everything but the topology untouched, and yields a valid testnet
+// whose nodes only peer with nodes starting no later than themselves.
+func TestRegenerateTopology(t *testing.T) {
+	manifests, _, err := Generate(&generateConfig{seed: randomSeed})
+	require.NoError(t, err)
+	changed, dualStack := 0, 0
+	for idx, m := range manifests {
+		before := encodeWithoutTopology(t, m)
+		original := encodeManifest(t, m)
+		regenerated, err := RegenerateTopology(m, rand.New(rand.NewSource(int64(idx))))
+		if m.DualStack() {
+			require.ErrorContains(t, err, "dual-stack")
+			dualStack++
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, original, encodeManifest(t, m), "testnet %d was modified", idx)
+		assert.Equal(t, before, encodeWithoutTopology(t, regenerated), "testnet %d", idx)
+		assert.Equal(t, quadTopology(m), quadTopology(regenerated), "testnet %d", idx)
+		if encodeManifest(t, regenerated) != original {
+			changed++
+		}
+
+		for name, node := range regenerated.Nodes {
+			if node.Mode == string(e2e.ModeLight) || node.Mode == string(e2e.ModeSeed) {
+				continue
+			}
+			for _, peer := range node.PersistentPeers {
+				if node.StartAt > 0 {
+					assert.LessOrEqual(t, regenerated.Nodes[peer].StartAt, node.StartAt, "%s peers with %s", name, peer)
+				}
+			}
+		}
+		newTestnet(t, regenerated)
+	}
+	assert.Positive(t, changed, "no topology changed")
+	assert.Less(t, dualStack, len(manifests))
+}
+
+// encodeManifest returns a manifest as saved to a file.
+func encodeManifest(t *testing.T, m e2e.Manifest) string {
+	t.Helper()
+	nodes := make(map[string]*e2e.ManifestNode, len(m.Nodes))
+	for name, node := range m.Nodes {
+		n := *node
+		n.Seeds = slices.Clone(node.Seeds)
+		n.PersistentPeers = slices.Clone(node.PersistentPeers)
+		n.Witnesses = slices.Clone(node.Witnesses)
+		nodes[name] = &n
+	}
+	m.Nodes = nodes
+	m.BridgeNodes = slices.Clone(m.BridgeNodes)
+	file := filepath.Join(t.TempDir(), "manifest.toml")
+	require.NoError(t, m.Save(file))
+	bz, err := os.ReadFile(file)
+	require.NoError(t, err)
+	return string(bz)
+}
+
+// encodeWithoutTopology returns a manifest as saved to a file, without the
+// settings making up its topology, nor the peer limits raised to fit it.
+func encodeWithoutTopology(t *testing.T, m e2e.Manifest) string {
+	t.Helper()
+	nodes := make(map[string]*e2e.ManifestNode, len(m.Nodes))
+	for name, node := range m.Nodes {
+		n := *node
+		n.Seeds, n.PersistentPeers, n.Witnesses = nil, nil, nil
+		n.MaxInboundPeers, n.MaxOutboundPeers = 0, 0
+		nodes[name] = &n
+	}
+	m.Nodes = nodes
+	m.BridgeNodes, m.LinkLatencies = nil, nil
+	return encodeManifest(t, m)
+}
+
+// TestGeneratorDeterministic tests that the deterministic mode sorts peers.
+func TestGeneratorDeterministic(t *testing.T) {
+	manifests, _, err := Generate(&generateConfig{seed: randomSeed, deterministic: true})
+	require.NoError(t, err)
+	for _, m := range manifests {
+		for _, node := range m.Nodes {
+			assert.True(t, sort.StringsAreSorted(node.Seeds))
+			assert.True(t, sort.StringsAreSorted(node.PersistentPeers))
+		}
+	}
+}
+
+func TestCoverageReport(t *testing.T) {
+	manifests, _, err := Generate(&generateConfig{seed: randomSeed})
+	require.NoError(t, err)
+	report := NewCoverageReport(manifests)
+
+	assert.Equal(t, len(manifests),
+		report.Counts["ip_stack"]["ipv4"]+report.Counts["ip_stack"]["ipv6"]+report.Counts["ip_stack"]["dual"])
+	nodes := 0
+	for _, m := range manifests {
+		for _, node := range m.Nodes {
+			if node.Mode != string(e2e.ModeLight) {
+				nodes++
+			}
+		}
+	}
+	databases := 0
+	for _, count := range report.Counts["database"] {
+		databases += count
+	}
+	assert.Equal(t, nodes, databases)
+	assert.Empty(t, report.Unchosen["database"])
+	assert.Contains(t, report.String(), "- database:")
+}
+
+// TestCoverageChoices tests that every package-level choice of the generator
+// is tracked by the coverage report, by checking that coverage.go refers to
+// every variable of a choice type declared in generate.go.
+func TestCoverageChoices(t *testing.T) {
+	fset := token.NewFileSet()
+	generate, err := parser.ParseFile(fset, "generate.go", nil, 0)
+	require.NoError(t, err)
+	coverage, err := parser.ParseFile(fset, "coverage.go", nil, 0)
+	require.NoError(t, err)
+
+	var choices []string
+	for _, decl := range generate.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			spec := spec.(*ast.ValueSpec)
+			for i, value := range spec.Values {
+				lit, ok := value.(*ast.CompositeLit)
+				if !ok {
+					continue
+				}
+				if typ, ok := lit.Type.(*ast.Ident); ok &&
+					slices.Contains([]string{"uniformChoice", "weightedChoice", "probSetChoice"}, typ.Name) {
+					choices = append(choices, spec.Names[i].Name)
+				}
+			}
+		}
+	}
+	require.Contains(t, choices, "nodeDatabases")
+
+	referenced := map[string]bool{}
+	ast.Inspect(coverage, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok {
+			referenced[ident.Name] = true
+		}
+		return true
+	})
+	for _, choice := range choices {
+		assert.True(t, referenced[choice], "choice %v is missing from coverageChoices", choice)
+	}
+
+	names := map[string]bool{}
+	for _, choice := range coverageChoices {
+		assert.False(t, names[choice.name], "duplicate coverage choice %v", choice.name)
+		names[choice.name] = true
+	}
+}
+
+func TestGeneratorValidateSchema(t *testing.T) {
+	_, _, err := Generate(&generateConfig{seed: randomSeed, validateSchema: true})
+	require.NoError(t, err)
+
+	err = e2e.ValidateManifestBytes([]byte(`
+ipv6 = true
+initial_hieght = 1000
+
+[node.validator01]
+mode = "validator"
+retain_blocks = "10"
+`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `line 3: unknown key "initial_hieght"`)
+	assert.Contains(t, err.Error(), `line 7: key "node.validator01.retain_blocks" has type string`)
+}
+
+func TestGeneratorMaxTotalNodes(t *testing.T) {
+	manifests, _, err := Generate(&generateConfig{seed: randomSeed})
+	require.NoError(t, err)
+	budget := countNodes(manifests) / 2
+
+	manifests, _, err = Generate(&generateConfig{seed: randomSeed, maxTotalNodes: budget})
+	require.NoError(t, err)
+	require.NotEmpty(t, manifests)
+	assert.LessOrEqual(t, countNodes(manifests), budget)
+	for _, m := range manifests {
+		validators := 0
+		for _, node := range m.Nodes {
+			if node.Mode == string(e2e.ModeValidator) {
+				validators++
+			}
+		}
+		assert.True(t, validators == 1 || validators >= 4)
 	}
 }
 
@@ -68,3 +2240,339 @@ func TestVersionFinder(t *testing.T) {
 		assert.Equal(t, tc.expectedLatest, actualLatest)
 	}
 }
+
+func TestVersionRangeFinder(t *testing.T) {
+	tags := []string{"v0.34.19", "v0.34.20", "v0.34.21-rc1", "v0.34.21", "v0.34.22", "v0.35.0", "dev-v0.34.21"}
+	testCases := []struct {
+		minTag, maxTag string
+		expectedTags   []string
+		expectErr      bool
+	}{
+		{minTag: "v0.34.20", maxTag: "v0.34.22", expectedTags: []string{"v0.34.20", "v0.34.21", "v0.34.22"}},
+		{minTag: "v0.34.19", maxTag: "v0.34.19", expectedTags: []string{"v0.34.19"}},
+		{minTag: "v0.34.22", maxTag: "v0.34.20", expectErr: true},
+		{minTag: "v0.34.18", maxTag: "v0.34.20", expectErr: true},
+		{minTag: "v0.34.20", maxTag: "v0.34.30", expectErr: true},
+		{minTag: "v0.34.21-rc1", maxTag: "v0.34.21-rc1", expectErr: true},
+	}
+	for _, tc := range testCases {
+		actualTags, err := findReleaseTagsInRange(tc.minTag, tc.maxTag, tags)
+		if tc.expectErr {
+			require.Error(t, err)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, tc.expectedTags, actualTags)
+	}
+}
+
+// TestGeneratorMultiVersion tests that testnets mixing the local version with
+// other versions are valid, in particular with respect to key types.
+func TestGeneratorMultiVersion(t *testing.T) {
+	defer func(versions weightedChoice) { nodeVersions = versions }(nodeVersions)
+	nodeVersions = weightedChoice{"": 1, "cometbft/e2e-node:v0.38.0": 1}
+
+	mixed := 0
+	forEachGeneratedTestnet(t, generateConfig{}, func(t *testing.T, m e2e.Manifest, _ *e2e.Testnet) {
+		versions := map[string]bool{}
+		for name, node := range m.Nodes {
+			versions[node.Version] = true
+			if node.Version != "" {
+				assert.Empty(t, node.Zone, name)
+				assert.Zero(t, node.SnapshotFormat, name)
+				assert.Zero(t, node.SnapshotChunkSize, name)
+			}
+		}
+		if len(versions) > 1 {
+			mixed++
+		}
+	})
+	assert.Positive(t, mixed)
+}
+
+func TestReconcileRetention(t *testing.T) {
+	persistIntervals := []*uint64{nil, ptrUint64(0), ptrUint64(1), ptrUint64(5), ptrUint64(20)}
+	snapshotIntervals := []uint64{0, 3, 30}
+	retainBlocks := []uint64{0, 2, 10, 14}
+
+	for _, persist := range persistIntervals {
+		for _, snapshot := range snapshotIntervals {
+			for _, retain := range retainBlocks {
+				node := &e2e.ManifestNode{
+					PersistInterval:  persist,
+					SnapshotInterval: snapshot,
+					RetainBlocks:     retain,
+				}
+				reconcileRetention(node, e2e.EvidenceAgeHeight)
+				name := fmt.Sprintf("persist=nil snapshot=%v retain=%v", snapshot, retain)
+				if persist != nil {
+					name = fmt.Sprintf("persist=%v snapshot=%v retain=%v", *persist, snapshot, retain)
+				}
+
+				// The intervals themselves are never changed.
+				assert.Equal(t, persist, node.PersistInterval, name)
+				assert.Equal(t, snapshot, node.SnapshotInterval, name)
+
+				if retain == 0 || (persist != nil && *persist == 0) {
+					assert.Zero(t, node.RetainBlocks, name)
+					continue
+				}
+				assert.GreaterOrEqual(t, node.RetainBlocks, retain, name)
+				assert.GreaterOrEqual(t, node.RetainBlocks, uint64(e2e.EvidenceAgeHeight), name)
+				assert.GreaterOrEqual(t, node.RetainBlocks, snapshot, name)
+				if persist != nil {
+					assert.GreaterOrEqual(t, node.RetainBlocks, *persist, name)
+				}
+			}
+		}
+	}
+}
+
+func TestNewTestnetEstimate(t *testing.T) {
+	manifest := e2e.Manifest{
+		InitialHeight: 1000,
+		Nodes: map[string]*e2e.ManifestNode{
+			"seed01":      {Mode: string(e2e.ModeSeed)},
+			"validator01": {Mode: string(e2e.ModeValidator), SnapshotInterval: 10},
+			"validator02": {Mode: string(e2e.ModeValidator), RetainBlocks: 20},
+			"full01":      {Mode: string(e2e.ModeFull), StartAt: 1050, StateSync: true},
+			"light01":     {Mode: string(e2e.ModeLight), StartAt: 1010},
+		},
+	}
+	estimate := NewTestnetEstimate(manifest)
+	assert.Equal(t, TestnetEstimate{
+		Nodes:          5,
+		Validators:     2,
+		LightClients:   1,
+		Height:         150,
+		RetainedBlocks: 150 + 20 + 100,
+		Snapshots:      15,
+	}, estimate)
+}
+
+func TestStartupSLAs(t *testing.T) {
+	manifest := e2e.Manifest{
+		InitialHeight: 1000,
+		Nodes: map[string]*e2e.ManifestNode{
+			"validator01": {Mode: string(e2e.ModeValidator)},
+			"validator02": {Mode: string(e2e.ModeValidator)},
+		},
+	}
+	interval := config.DefaultConsensusConfig().TimeoutCommit
+	firstBlockBy, catchUpBy := StartupSLAs(manifest)
+	assert.Equal(t, 2*(startupBase+2*startupPerNode+interval), firstBlockBy)
+	assert.Equal(t, 2*startupBase, catchUpBy)
+
+	// Waiting for a genesis time in the future delays the first block.
+	manifest.GenesisTimeOffset = time.Minute
+	offsetFirstBlockBy, _ := StartupSLAs(manifest)
+	assert.Equal(t, firstBlockBy+time.Minute, offsetFirstBlockBy)
+	manifest.GenesisTimeOffset = -time.Minute
+	offsetFirstBlockBy, _ = StartupSLAs(manifest)
+	assert.Equal(t, firstBlockBy, offsetFirstBlockBy)
+	manifest.GenesisTimeOffset = 0
+
+	manifest.Nodes["full01"] = &e2e.ManifestNode{Mode: string(e2e.ModeFull), StartAt: 1050}
+	_, catchUpBy = StartupSLAs(manifest)
+	assert.Equal(t, 2*(startupBase+50*interval+catchUpPerNode), catchUpBy)
+
+	// ABCI delays and longer commit timeouts of validators slow down blocks.
+	manifest.FinalizeBlockDelay = time.Second
+	manifest.Nodes["validator01"].TimeoutCommit = interval + time.Second
+	slowFirstBlockBy, slowCatchUpBy := StartupSLAs(manifest)
+	assert.Equal(t, firstBlockBy+2*2*time.Second, slowFirstBlockBy)
+	assert.Equal(t, 2*(startupBase+50*(interval+2*time.Second)+catchUpPerNode), slowCatchUpBy)
+	// The chain is expected to reach the last start height by then.
+	assert.GreaterOrEqual(t, manifest.ExpectedHeightAt(slowCatchUpBy), int64(1050))
+
+	manifests, _, err := Generate(&generateConfig{seed: randomSeed})
+	require.NoError(t, err)
+	for idx, m := range manifests {
+		assert.Positive(t, m.ExpectedFirstBlockBy, "testnet %d", idx)
+		assert.Positive(t, m.ExpectedCatchUpBy, "testnet %d", idx)
+	}
+}
+
+func TestMetricThresholds(t *testing.T) {
+	manifest := e2e.Manifest{
+		Nodes: map[string]*e2e.ManifestNode{
+			"validator01": {Mode: string(e2e.ModeValidator)},
+			"validator02": {Mode: string(e2e.ModeValidator)},
+		},
+	}
+	assert.Nil(t, MetricThresholds(manifest))
+
+	manifest.Nodes["validator02"].EnablePrometheus = true
+	interval := config.DefaultConsensusConfig().TimeoutCommit
+	thresholds := MetricThresholds(manifest)
+	require.Len(t, thresholds, 2)
+	maxInterval := *thresholds["cometbft_consensus_block_interval_seconds"].Max
+	assert.Equal(t, (3 * interval).Seconds(), maxInterval)
+	assert.Equal(t, 2*(maxInterval+mempoolBacklog.Seconds()), *thresholds["cometbft_mempool_size"].Max)
+
+	// ABCI delays and zone latencies slow down blocks.
+	manifest.FinalizeBlockDelay = time.Second
+	manifest.ZoneLatencies = map[string]map[string]time.Duration{
+		"us": {"us": 5 * time.Millisecond, "eu": 40 * time.Millisecond},
+		"eu": {"us": 40 * time.Millisecond, "eu": 5 * time.Millisecond},
+	}
+	thresholds = MetricThresholds(manifest)
+	assert.InDelta(t, (3 * (interval + time.Second + 120*time.Millisecond)).Seconds(),
+		*thresholds["cometbft_consensus_block_interval_seconds"].Max, 1e-9)
+
+	// Overloaded networks have no bound on their mempool.
+	manifest.LoadProfile = &e2e.LoadProfile{Name: "overload", TxRate: 1000, Overloaded: true}
+	thresholds = MetricThresholds(manifest)
+	assert.NotContains(t, thresholds, "cometbft_mempool_size")
+
+	// Generated thresholds are valid.
+	forEachGeneratedTestnet(t, generateConfig{prometheus: true}, func(t *testing.T, m e2e.Manifest, _ *e2e.Testnet) {
+		assert.NotEmpty(t, m.MetricThresholds)
+	})
+}
+
+// TestGenerateEstimates tests that Generate returns an estimate for each
+// testnet, and that the CLI's table sums them up.
+func TestGenerateEstimates(t *testing.T) {
+	manifests, estimates, err := Generate(&generateConfig{seed: randomSeed})
+	require.NoError(t, err)
+	require.Len(t, estimates, len(manifests))
+	for i, m := range manifests {
+		assert.Equal(t, NewTestnetEstimate(m), estimates[i])
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, printEstimates(&buf, estimates[:2]))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 4)
+	total := strings.Fields(lines[3])
+	assert.Equal(t, "total", total[0])
+	assert.Equal(t, fmt.Sprint(estimates[0].Nodes+estimates[1].Nodes), total[1])
+}
+
+// TestGeneratorScheduleSpacing tests that a spacing of 0 makes delayed nodes
+// start together, with their validator updates at their start height.
+func TestGeneratorScheduleSpacing(t *testing.T) {
+	spacing := int64(0)
+	manifests, _, err := Generate(&generateConfig{seed: randomSeed, scheduleSpacing: &spacing})
+	require.NoError(t, err)
+
+	collisions := 0
+	for _, m := range manifests {
+		newTestnet(t, m)
+		for name, node := range m.Nodes {
+			if node.StartAt == 0 {
+				continue
+			}
+			assert.Greater(t, node.StartAt, m.InitialHeight)
+			if node.Mode == string(e2e.ModeValidator) {
+				assert.Contains(t, m.ValidatorUpdates[fmt.Sprint(node.StartAt)], name)
+				collisions++
+			}
+		}
+	}
+	assert.Positive(t, collisions)
+
+	spacing = -1
+	_, _, err = Generate(&generateConfig{seed: randomSeed, scheduleSpacing: &spacing})
+	require.ErrorContains(t, err, "schedule spacing must not be negative")
+}
+
+// TestGeneratorStartAtJitter tests that jittered start heights stay within
+// maxStartAtJitter of the scheduled ones, keep the nodes' order, and leave the
+// genesis quorum of validators starting with the network.
+func TestGeneratorStartAtJitter(t *testing.T) {
+	jittered := 0
+	for seed := int64(0); seed < 5; seed++ {
+		scheduled, _, err := Generate(&generateConfig{seed: seed})
+		require.NoError(t, err)
+		manifests, _, err := Generate(&generateConfig{seed: seed, startAtJitter: true})
+		require.NoError(t, err)
+		require.Len(t, manifests, len(scheduled))
+
+		for idx, m := range manifests {
+			newTestnet(t, m)
+			validators := nodeNamesByMode(m, e2e.ModeValidator)
+			atGenesis := 0
+			for _, name := range validators {
+				if m.Nodes[name].StartAt == 0 {
+					atGenesis++
+				}
+			}
+			assert.GreaterOrEqual(t, atGenesis, len(validators)*2/3+1, "seed %d, testnet %d", seed, idx)
+
+			for name, node := range m.Nodes {
+				scheduledStartAt := scheduled[idx].Nodes[name].StartAt
+				if scheduledStartAt == 0 {
+					assert.Zero(t, node.StartAt, "seed %d, testnet %d: %s", seed, idx, name)
+					continue
+				}
+				assert.GreaterOrEqual(t, node.StartAt, scheduledStartAt, "seed %d, testnet %d: %s", seed, idx, name)
+				assert.LessOrEqual(t, node.StartAt, scheduledStartAt+maxStartAtJitter,
+					"seed %d, testnet %d: %s", seed, idx, name)
+				if node.StartAt != scheduledStartAt {
+					jittered++
+				}
+				for otherName, other := range m.Nodes {
+					if scheduled[idx].Nodes[otherName].StartAt > scheduledStartAt {
+						assert.Greater(t, other.StartAt, node.StartAt, "seed %d, testnet %d: %s starts before %s",
+							seed, idx, otherName, name)
+					}
+				}
+			}
+		}
+	}
+	assert.Positive(t, jittered)
+}
+
+func TestGeneratorOverrides(t *testing.T) {
+	overrides := e2e.Manifest{
+		PrepareProposalDelay: 3 * time.Second,
+		Nodes:                map[string]*e2e.ManifestNode{e2e.AllNodes: {Database: "rocksdb"}},
+	}
+	manifests, _, err := Generate(&generateConfig{seed: randomSeed, overrides: &overrides})
+	require.NoError(t, err)
+	for _, m := range manifests {
+		assert.Equal(t, 3*time.Second, m.PrepareProposalDelay)
+		for _, node := range m.Nodes {
+			assert.Equal(t, "rocksdb", node.Database)
+			assert.NotEmpty(t, node.Mode)
+		}
+	}
+}
+
+func TestGeneratorDebugPorts(t *testing.T) {
+	for _, prometheus := range []bool{false, true} {
+		manifests, _, err := Generate(&generateConfig{seed: randomSeed, prometheus: prometheus})
+		require.NoError(t, err)
+		var prometheusNodes, pprofNodes int
+		for _, m := range manifests {
+			infra, err := e2e.NewDockerInfrastructureData(m)
+			require.NoError(t, err)
+			ports := map[uint32]string{}
+			for _, instance := range infra.Instances {
+				ports[instance.Port] = "rpc"
+			}
+			for name, node := range m.Nodes {
+				if prometheus || node.EnablePrometheus {
+					require.NotZero(t, node.PrometheusPort, name)
+					require.NotContains(t, ports, node.PrometheusPort)
+					ports[node.PrometheusPort] = name
+					prometheusNodes++
+				} else {
+					assert.Zero(t, node.PrometheusPort, name)
+				}
+				if node.EnablePprof {
+					require.NotZero(t, node.PprofPort, name)
+					require.NotContains(t, ports, node.PprofPort)
+					ports[node.PprofPort] = name
+					pprofNodes++
+				} else {
+					assert.Zero(t, node.PprofPort, name)
+				}
+			}
+		}
+		assert.Positive(t, prometheusNodes)
+		assert.Positive(t, pprofNodes)
+	}
+}
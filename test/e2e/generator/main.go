@@ -1,15 +1,18 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"math"
-	"math/rand"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 
 	"github.com/cometbft/cometbft/libs/log"
+	e2e "github.com/cometbft/cometbft/test/e2e/pkg"
 )
 
 const (
@@ -31,7 +34,7 @@ type CLI struct {
 func NewCLI() *CLI {
 	cli := &CLI{}
 	cli.root = &cobra.Command{
-		Use:           "generator -d dir [-g int] [-m version_weight_csv] [-p]",
+		Use:           "generator -d dir [-g int] [-m version_weight_csv] [-p] [-s seed]",
 		Short:         "End-to-end testnet generator",
 		SilenceUsage:  true,
 		SilenceErrors: true, // we'll output them ourselves in Run()
@@ -44,49 +47,321 @@ func NewCLI() *CLI {
 			if err != nil {
 				return err
 			}
-			multiVersion, err := cmd.Flags().GetString("multi-version")
+			cfg := &generateConfig{}
+			if err := parseConfigFlags(cmd, cfg); err != nil {
+				return err
+			}
+			scheduleSpacing, err := cmd.Flags().GetInt64("schedule-spacing")
+			if err != nil {
+				return err
+			}
+			cfg.scheduleSpacing = &scheduleSpacing
+			cgo, err := cmd.Flags().GetBool("cgo")
+			if err != nil {
+				return err
+			}
+			cfg.noCgo = !cgo
+			powerDistribution, err := cmd.Flags().GetString("power-distribution")
 			if err != nil {
 				return err
 			}
-			prometheus, err := cmd.Flags().GetBool("prometheus")
+			if powerDistribution != "" {
+				cfg.powerDistribution, err = parsePowerDistribution(powerDistribution)
+				if err != nil {
+					return err
+				}
+			}
+			initialState, err := cmd.Flags().GetString("initial-state")
+			if err != nil {
+				return err
+			}
+			if initialState != "" {
+				gen, ok := initialStateGenerators[initialState]
+				if !ok {
+					return fmt.Errorf("unknown initial state generator %q", initialState)
+				}
+				cfg.initialStateGen = gen
+			}
+			cfg.pinnedVersions, err = cmd.Flags().GetStringToString("pin-versions")
+			if err != nil {
+				return err
+			}
+			validatorGrowth, err := cmd.Flags().GetString("validator-growth")
+			if err != nil {
+				return err
+			}
+			if validatorGrowth != "" {
+				cfg.validatorGrowth, err = parseValidatorGrowth(validatorGrowth)
+				if err != nil {
+					return err
+				}
+			}
+			databaseWeights, err := cmd.Flags().GetStringToInt("database-weights")
 			if err != nil {
 				return err
 			}
-			return cli.generate(dir, groups, multiVersion, prometheus)
+			if len(databaseWeights) > 0 {
+				cfg.databaseWeights = map[string]uint{}
+				for database, weight := range databaseWeights {
+					if weight < 0 {
+						return fmt.Errorf("database %q has a negative weight", database)
+					}
+					cfg.databaseWeights[database] = uint(weight)
+				}
+			}
+			overridesFile, err := cmd.Flags().GetString("overrides")
+			if err != nil {
+				return err
+			}
+			if overridesFile != "" {
+				overrides, err := e2e.LoadManifest(overridesFile)
+				if err != nil {
+					return err
+				}
+				cfg.overrides = &overrides
+			}
+			decisionLog, err := cmd.Flags().GetString("decision-log")
+			if err != nil {
+				return err
+			}
+			if decisionLog != "" {
+				f, err := os.Create(decisionLog)
+				if err != nil {
+					return fmt.Errorf("failed to create decision log %q: %w", decisionLog, err)
+				}
+				defer f.Close()
+				cfg.logger = log.NewTMJSONLoggerNoTS(f)
+			}
+			driftFile, err := cmd.Flags().GetString("check-drift")
+			if err != nil {
+				return err
+			}
+			if driftFile != "" {
+				return checkDrift(driftFile, cfg)
+			}
+			if dir == "" {
+				return errors.New(`required flag(s) "dir" not set`)
+			}
+			return cli.generate(dir, groups, cfg)
 		},
 	}
 
-	cli.root.PersistentFlags().StringP("dir", "d", "", "Output directory for manifests")
-	_ = cli.root.MarkPersistentFlagRequired("dir")
+	cli.root.PersistentFlags().StringP("dir", "d", "", "Output directory for manifests, required unless checking drift")
 	cli.root.PersistentFlags().StringP("multi-version", "m", "", "Comma-separated list of versions of CometBFT to test in the generated testnets, "+
 		"or empty to only use this branch's version")
 	cli.root.PersistentFlags().IntP("groups", "g", 0, "Number of groups")
 	cli.root.PersistentFlags().BoolP("prometheus", "p", false, "Enable generation of Prometheus metrics on all manifests")
+	cli.root.PersistentFlags().Int64P("seed", "s", randomSeed, "Seed for the random number generator, as recorded in generated manifests")
+	cli.root.PersistentFlags().Bool("deterministic", false, "Sort node peer lists in generated manifests, to make them easier to diff")
+	cli.root.PersistentFlags().Bool("coverage", false, "Print how often each value of each random choice was picked")
+	cli.root.PersistentFlags().Bool("validate-schema", false, "Validate every generated manifest against the manifest schema")
+	cli.root.PersistentFlags().Int("max-total-nodes", 0, "Maximum number of nodes across all generated testnets, or 0 for no limit")
+	cli.root.PersistentFlags().IntP("num-testnets", "n", 0, "Number of testnets to randomly sample according to the option weights, "+
+		"or 0 to generate a testnet for every combination of options")
+	cli.root.PersistentFlags().Int64("schedule-spacing", defaultScheduleSpacing, "Number of heights between node startups and "+
+		"validator updates, where 0 or 1 make them collide")
+	cli.root.PersistentFlags().String("overrides", "", "Manifest file whose set values override those of every generated manifest, "+
+		`where node."*" applies to all nodes`)
+	cli.root.PersistentFlags().Bool("dot", false, "Also write a Graphviz .dot file of the peer graph next to each manifest")
+	cli.root.PersistentFlags().Bool("timeline", false, "Print the node starts, validator updates, perturbations, "+
+		"upgrades and other events scheduled by each generated testnet")
+	cli.root.PersistentFlags().Int64("upgrade-at-height", 0, "Generate upgrade tests, where all nodes start on the latest release "+
+		"and are upgraded to the local version this many heights after the initial height")
+	cli.root.PersistentFlags().Bool("throttle-disk", false, "Enable the throttle_disk perturbation, which requires root on the Docker host")
+	cli.root.PersistentFlags().Bool("cgo", true, "Generate nodes using the cleveldb and rocksdb databases, which require "+
+		"nodes built with cgo")
+	cli.root.PersistentFlags().Float64("catch-up-storm", 0, "Fraction of full nodes that start at the same height, "+
+		"to stress the nodes serving block sync")
+	cli.root.PersistentFlags().String("abci-app", "", "ABCI application binary run by the nodes instead of the kvstore, "+
+		"see the abci_app manifest setting")
+	cli.root.PersistentFlags().Bool("validator-churn", false, "Schedule a series of validator power increases, "+
+		"decreases and removals in every testnet, which keep a BFT quorum live")
+	cli.root.PersistentFlags().Bool("bootstrap-from-snapshot", false, "Have delayed validators and full nodes state "+
+		"sync from a snapshot taken before the first of them starts, rather than block sync from genesis")
+	cli.root.PersistentFlags().Bool("no-perturbations", false, "Generate no perturbations, e.g. for baseline "+
+		"performance measurements")
+	cli.root.PersistentFlags().Bool("force-perturbations", false, "Perturb every node but light clients and "+
+		"genesis validators at least once")
+	cli.root.PersistentFlags().Bool("seed-only-discovery", false, "Have nodes discover their peers through seeds "+
+		"only, adding a seed to testnets without one")
+	cli.root.PersistentFlags().Int64("archive-blackout-at", 0, "Kill every archive node at once this many "+
+		"blocks after the initial height, and start them again after a while")
+	cli.root.PersistentFlags().Int64("restart-all-at", 0, "Restart every node at once this many blocks "+
+		"after the last node starts")
+	cli.root.PersistentFlags().String("power-distribution", "", "Voting powers of the validators of every testnet: "+
+		"uniform, skewed (one validator just under 1/3 of the power), or a comma-separated list of powers")
+	cli.root.PersistentFlags().Int64("key-seed", 0, "Seed deriving the consensus keys of nodes from their names "+
+		"alone, so that they are the same in every testnet")
+	cli.root.PersistentFlags().Bool("shared-node-keys", false, "Also derive the P2P keys of nodes from the key seed")
+	cli.root.PersistentFlags().Bool("start-at-jitter", false, "Start delayed nodes up to 4 heights after their "+
+		"scheduled heights, off the multiples of the schedule spacing")
+	cli.root.PersistentFlags().String("initial-state", "", "Generator of the initial state of testnets with "+
+		"one: large (500 key/value pairs) or accounts (pre-funded accounts)")
+	cli.root.PersistentFlags().Bool("sentry-nodes", false, "Give each genesis validator one or two sentry "+
+		"full nodes, which are its only peers")
+	cli.root.PersistentFlags().StringToString("pin-versions", nil, "Versions to run given nodes with, "+
+		"overriding the random ones, e.g. validator01=v0.38.0,full01=local")
+	cli.root.PersistentFlags().String("validator-growth", "", "Grow the validator set of quad and large testnets "+
+		"as start:target:interval, e.g. 4:10:5 starts with 4 validators and adds one every 5 blocks up to 10")
+	cli.root.PersistentFlags().Bool("no-light-clients", false, "Generate no light clients")
+	cli.root.PersistentFlags().Int("force-light-clients", 0, "Number of light clients of every large testnet, "+
+		"in place of a random one")
+	cli.root.PersistentFlags().Bool("key-rotation", false, "Have a minority validator of every testnet "+
+		"rotate its consensus key mid-run")
+	cli.root.PersistentFlags().Duration("genesis-time-offset", 0, "Offset of the genesis time of every "+
+		"testnet from the time the runner sets it up, negative for the past and positive for the future")
+	cli.root.PersistentFlags().Bool("mempool-flood", false, "Send the whole transaction load of every "+
+		"testnet with full nodes to a single full node")
+	cli.root.PersistentFlags().Bool("degraded-link", false, "Slow down one direction of a random peer link "+
+		"of every testnet")
+	cli.root.PersistentFlags().Bool("paired", false, "Pair up the generated testnets as two chains each, "+
+		"with relayer nodes on both, writing pair-NNNN-a.toml, pair-NNNN-b.toml and pair-NNNN-relayers.toml")
+	cli.root.PersistentFlags().Bool("seed-contention", false, "Give the seeds of every testnet tiny P2P "+
+		"connection limits, so that peer discovery contends for their slots")
+	cli.root.PersistentFlags().String("chain-id-prefix", defaultChainIDPrefix, "Prefix of the chain IDs of "+
+		"the generated testnets, which are followed by their topology and a short hash of their seed")
+	cli.root.PersistentFlags().Int("absent-validators", 0, "Number of genesis validators of every testnet "+
+		"that never start, while staying in the validator set with less than 1/3 of its voting power")
+	cli.root.PersistentFlags().Bool("minimal-quorum", false, "Have exactly 2f+1 of the validators of every "+
+		"testnet start at genesis, and the other ones never start, so that losing any live validator stalls the chain")
+	cli.root.PersistentFlags().Bool("equal-power", false, "Give every validator of every testnet the same voting "+
+		"power, so that proposers rotate round-robin, and have the tests check that they take turns")
+	cli.root.PersistentFlags().Bool("observer-promotion", false, "Promote a full node of every testnet to a "+
+		"validator some blocks after it starts, and have the tests check that it begins signing")
+	cli.root.PersistentFlags().Bool("throttle-gossip", false, "Limit the send and receive rates of every node "+
+		"of every testnet to a low rate, to stress block propagation, and have the runner wait longer for it")
+	cli.root.PersistentFlags().Bool("skip-duplicates", false, "Skip testnets with the same nodes, protocols, "+
+		"perturbations and peers as an earlier one")
+	cli.root.PersistentFlags().Bool("short-retention", false, "Have a minority of the validators and full nodes "+
+		"pruning blocks retain fewer blocks than the evidence age, in testnets with evidence")
+	cli.root.PersistentFlags().StringToInt("database-weights", nil, "Weights of the databases to generate, "+
+		"replacing the uniform ones, e.g. goleveldb=6,boltdb=1 to only generate these two")
+	cli.root.PersistentFlags().Int("dedicated-archives", 0, "Number of archive full nodes serving block sync, "+
+		"snapshots and light clients in place of validators; 0 keeps two archive validators")
+	cli.root.PersistentFlags().String("decision-log", "", "File to write a JSON line with the choices made for every "+
+		"generated node to")
+	cli.root.PersistentFlags().String("check-drift", "", "Manifest file to regenerate from its recorded seed with the "+
+		"given options, printing how the generator's output drifted from it instead of writing manifests")
+	cli.root.PersistentFlags().Bool("dry-run", false, "Print resource estimates of the generated testnets instead of writing manifests")
 
 	return cli
 }
 
+// parseConfigFlags sets the fields of cfg which map directly to a flag. Flags
+// which need parsing or validation are handled by the command itself.
+func parseConfigFlags(cmd *cobra.Command, cfg *generateConfig) error {
+	boolFlags := map[string]*bool{
+		"prometheus":              &cfg.prometheus,
+		"deterministic":           &cfg.deterministic,
+		"coverage":                &cfg.coverage,
+		"validate-schema":         &cfg.validateSchema,
+		"dry-run":                 &cfg.dryRun,
+		"dot":                     &cfg.dot,
+		"timeline":                &cfg.timeline,
+		"throttle-disk":           &cfg.throttleDisk,
+		"validator-churn":         &cfg.validatorChurn,
+		"bootstrap-from-snapshot": &cfg.bootstrapFromSnapshot,
+		"no-perturbations":        &cfg.noPerturbations,
+		"force-perturbations":     &cfg.forcePerturbations,
+		"seed-only-discovery":     &cfg.seedOnlyDiscovery,
+		"shared-node-keys":        &cfg.sharedNodeKeys,
+		"start-at-jitter":         &cfg.startAtJitter,
+		"sentry-nodes":            &cfg.sentryNodes,
+		"no-light-clients":        &cfg.noLightClients,
+		"key-rotation":            &cfg.keyRotation,
+		"mempool-flood":           &cfg.mempoolFlood,
+		"degraded-link":           &cfg.degradedLink,
+		"paired":                  &cfg.paired,
+		"seed-contention":         &cfg.seedContention,
+		"minimal-quorum":          &cfg.minimalQuorum,
+		"equal-power":             &cfg.equalPower,
+		"observer-promotion":      &cfg.observerPromotion,
+		"throttle-gossip":         &cfg.throttleGossip,
+		"skip-duplicates":         &cfg.skipDuplicates,
+		"short-retention":         &cfg.shortRetention,
+	}
+	for name, value := range boolFlags {
+		var err error
+		if *value, err = cmd.Flags().GetBool(name); err != nil {
+			return err
+		}
+	}
+	intFlags := map[string]*int{
+		"max-total-nodes":     &cfg.maxTotalNodes,
+		"num-testnets":        &cfg.numTestnets,
+		"force-light-clients": &cfg.forceLightClients,
+		"absent-validators":   &cfg.absentValidators,
+		"dedicated-archives":  &cfg.dedicatedArchives,
+	}
+	for name, value := range intFlags {
+		var err error
+		if *value, err = cmd.Flags().GetInt(name); err != nil {
+			return err
+		}
+	}
+	int64Flags := map[string]*int64{
+		"seed":                &cfg.seed,
+		"archive-blackout-at": &cfg.archiveBlackoutAt,
+		"restart-all-at":      &cfg.restartAllAt,
+		"key-seed":            &cfg.keySeed,
+		"upgrade-at-height":   &cfg.upgradeAtHeight,
+	}
+	for name, value := range int64Flags {
+		var err error
+		if *value, err = cmd.Flags().GetInt64(name); err != nil {
+			return err
+		}
+	}
+	stringFlags := map[string]*string{
+		"multi-version":   &cfg.multiVersion,
+		"abci-app":        &cfg.abciApp,
+		"chain-id-prefix": &cfg.chainIDPrefix,
+	}
+	for name, value := range stringFlags {
+		var err error
+		if *value, err = cmd.Flags().GetString(name); err != nil {
+			return err
+		}
+	}
+	var err error
+	if cfg.catchUpStorm, err = cmd.Flags().GetFloat64("catch-up-storm"); err != nil {
+		return err
+	}
+	if cfg.genesisTimeOffset, err = cmd.Flags().GetDuration("genesis-time-offset"); err != nil {
+		return err
+	}
+	return nil
+}
+
 // generate generates manifests in a directory.
-func (cli *CLI) generate(dir string, groups int, multiVersion string, prometheus bool) error {
-	err := os.MkdirAll(dir, 0o755)
+func (cli *CLI) generate(dir string, groups int, cfg *generateConfig) error {
+	if cfg.paired {
+		return generatePaired(dir, cfg)
+	}
+	manifests, estimates, err := Generate(cfg)
 	if err != nil {
 		return err
 	}
-
-	cfg := &generateConfig{
-		randSource:   rand.New(rand.NewSource(randomSeed)), //nolint:gosec
-		multiVersion: multiVersion,
-		prometheus:   prometheus,
+	if cfg.timeline {
+		printTimelines(os.Stdout, manifests)
 	}
-	manifests, err := Generate(cfg)
+	if cfg.dryRun {
+		return printEstimates(os.Stdout, estimates)
+	}
+
+	err = os.MkdirAll(dir, 0o755)
 	if err != nil {
 		return err
 	}
 	if groups <= 0 {
-		for i, manifest := range manifests {
-			err = manifest.Save(filepath.Join(dir, fmt.Sprintf("gen-%04d.toml", i)))
-			if err != nil {
-				return err
+		if err := WriteManifestSet(manifests, dir); err != nil {
+			return err
+		}
+		if cfg.dot {
+			for i, manifest := range manifests {
+				if err := saveDOT(manifest, filepath.Join(dir, manifestSetFile(i))); err != nil {
+					return err
+				}
 			}
 		}
 	} else {
@@ -94,7 +369,7 @@ func (cli *CLI) generate(dir string, groups int, multiVersion string, prometheus
 		for g := 0; g < groups; g++ {
 			for i := 0; i < groupSize && g*groupSize+i < len(manifests); i++ {
 				manifest := manifests[g*groupSize+i]
-				err = manifest.Save(filepath.Join(dir, fmt.Sprintf("gen-group%02d-%04d.toml", g, i)))
+				err = saveManifest(manifest, filepath.Join(dir, fmt.Sprintf("gen-group%02d-%04d.toml", g, i)), cfg.dot)
 				if err != nil {
 					return err
 				}
@@ -104,6 +379,71 @@ func (cli *CLI) generate(dir string, groups int, multiVersion string, prometheus
 	return nil
 }
 
+// generatePaired writes the paired testnets generated from cfg to dir, see
+// GeneratePaired.
+func generatePaired(dir string, cfg *generateConfig) error {
+	pairs, err := GeneratePaired(cfg)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, pair := range pairs {
+		if err := pair.Save(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkDrift regenerates the manifest in file from its recorded seed, prints
+// the differences, and fails if there are any.
+func checkDrift(file string, cfg *generateConfig) error {
+	old, err := e2e.LoadManifest(file)
+	if err != nil {
+		return err
+	}
+	diffs, err := CheckManifestDrift(old, old.GeneratorSeed, cfg)
+	if err != nil {
+		return err
+	}
+	return printDrift(os.Stdout, file, diffs)
+}
+
+// saveManifest saves a manifest to a file, and optionally its peer graph to
+// a .dot file with the same base name.
+func saveManifest(manifest e2e.Manifest, file string, dot bool) error {
+	if err := manifest.Save(file); err != nil {
+		return err
+	}
+	if !dot {
+		return nil
+	}
+	return saveDOT(manifest, file)
+}
+
+// printTimelines prints the events scheduled by each manifest, see
+// e2e.Manifest.Timeline, under the manifest's chain ID.
+func printTimelines(w io.Writer, manifests []e2e.Manifest) {
+	for i, manifest := range manifests {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s:\n", manifest.ChainID)
+		for _, event := range manifest.Timeline() {
+			fmt.Fprintf(w, "  %v\n", event)
+		}
+	}
+}
+
+// saveDOT saves the peer graph of a manifest saved to the given file to a
+// .dot file with the same base name.
+func saveDOT(manifest e2e.Manifest, file string) error {
+	dotFile := strings.TrimSuffix(file, filepath.Ext(file)) + ".dot"
+	return os.WriteFile(dotFile, []byte(manifest.ToDOT()), 0o644) //nolint:gosec
+}
+
 // Run runs the CLI.
 func (cli *CLI) Run() {
 	if err := cli.root.Execute(); err != nil {
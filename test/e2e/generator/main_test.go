@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfigFlags(t *testing.T) {
+	cli := NewCLI()
+	require.NoError(t, cli.root.ParseFlags(nil))
+	cfg := &generateConfig{}
+	require.NoError(t, parseConfigFlags(cli.root, cfg))
+	assert.Equal(t, &generateConfig{seed: randomSeed, chainIDPrefix: defaultChainIDPrefix}, cfg)
+
+	require.NoError(t, cli.root.ParseFlags([]string{
+		"-s", "42", "-p", "--equal-power", "--num-testnets", "3", "--abci-app", "app",
+		"--catch-up-storm", "0.5", "--genesis-time-offset", "1m",
+	}))
+	cfg = &generateConfig{}
+	require.NoError(t, parseConfigFlags(cli.root, cfg))
+	assert.Equal(t, &generateConfig{
+		seed:              42,
+		prometheus:        true,
+		equalPower:        true,
+		numTestnets:       3,
+		abciApp:           "app",
+		chainIDPrefix:     defaultChainIDPrefix,
+		catchUpStorm:      0.5,
+		genesisTimeOffset: time.Minute,
+	}, cfg)
+}
+
+// TestCLIDefaults tests that the generator writes manifests with all of its
+// options left at their defaults.
+func TestCLIDefaults(t *testing.T) {
+	dir := t.TempDir()
+	cli := NewCLI()
+	cli.root.SetArgs([]string{"-d", dir, "-n", "2"})
+	require.NoError(t, cli.root.Execute())
+	manifests, _, err := ReadManifestSet(dir)
+	require.NoError(t, err)
+	assert.Len(t, manifests, 2)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	e2e "github.com/cometbft/cometbft/test/e2e/pkg"
+)
+
+// manifestSetIndex is the name of the index file of a manifest set, see
+// WriteManifestSet.
+const manifestSetIndex = "index.json"
+
+// ManifestSetEntry describes a manifest of a set, as recorded in its index,
+// e.g. for CI to select testnets by size or topology.
+type ManifestSetEntry struct {
+	File             string `json:"file"`
+	Nodes            int    `json:"nodes"`
+	Topology         string `json:"topology"`
+	Seed             int64  `json:"seed"`
+	GeneratorVersion string `json:"generator_version"`
+}
+
+// WriteManifestSet writes manifests to a directory, each to a file named after
+// its position in the set, along with an index describing them. Regenerating
+// a set from the same seed thus writes the same files.
+func WriteManifestSet(manifests []e2e.Manifest, dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	index := make([]ManifestSetEntry, 0, len(manifests))
+	for i, m := range manifests {
+		entry := ManifestSetEntry{
+			File:             manifestSetFile(i),
+			Nodes:            len(m.Nodes),
+			Topology:         manifestTopology(m),
+			Seed:             m.GeneratorSeed,
+			GeneratorVersion: m.GeneratorVersion,
+		}
+		if err := m.Save(filepath.Join(dir, entry.File)); err != nil {
+			return err
+		}
+		index = append(index, entry)
+	}
+	bz, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, manifestSetIndex), append(bz, '\n'), 0o644) //nolint:gosec
+}
+
+// ReadManifestSet reads the manifests written to a directory by
+// WriteManifestSet, in the order of its index, and returns them along with the
+// index.
+func ReadManifestSet(dir string) ([]e2e.Manifest, []ManifestSetEntry, error) {
+	bz, err := os.ReadFile(filepath.Join(dir, manifestSetIndex))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read manifest set index: %w", err)
+	}
+	var index []ManifestSetEntry
+	if err := json.Unmarshal(bz, &index); err != nil {
+		return nil, nil, fmt.Errorf("invalid manifest set index: %w", err)
+	}
+	manifests := make([]e2e.Manifest, 0, len(index))
+	for _, entry := range index {
+		m, err := e2e.LoadManifest(filepath.Join(dir, entry.File))
+		if err != nil {
+			return nil, nil, err
+		}
+		manifests = append(manifests, m)
+	}
+	return manifests, index, nil
+}
+
+// manifestSetFile returns the name of the file of the i-th manifest of a set.
+func manifestSetFile(i int) string {
+	return fmt.Sprintf("gen-%04d.toml", i)
+}
+
+// manifestTopology returns the topology of a manifest, as recognized from its
+// nodes: one of the quad topologies, "single", or "large" otherwise.
+func manifestTopology(m e2e.Manifest) string {
+	if topology := quadTopology(m); len(topology) > 0 {
+		return topology[0]
+	}
+	if len(m.Nodes) == 1 {
+		return "single"
+	}
+	return "large"
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifestSet(t *testing.T) {
+	manifests, _, err := Generate(&generateConfig{seed: randomSeed})
+	require.NoError(t, err)
+	dir := t.TempDir()
+	require.NoError(t, WriteManifestSet(manifests, dir))
+
+	read, index, err := ReadManifestSet(dir)
+	require.NoError(t, err)
+	require.Len(t, read, len(manifests))
+	require.Len(t, index, len(manifests))
+	topologies := map[string]bool{}
+	for i, m := range manifests {
+		assert.Equal(t, encodeManifest(t, m), encodeManifest(t, read[i]), "testnet %d", i)
+		assert.Equal(t, ManifestSetEntry{
+			File:             manifestSetFile(i),
+			Nodes:            len(m.Nodes),
+			Topology:         manifestTopology(m),
+			Seed:             randomSeed,
+			GeneratorVersion: m.GeneratorVersion,
+		}, index[i])
+		topologies[index[i].Topology] = true
+	}
+	assert.True(t, topologies["single"])
+	assert.True(t, topologies["large"])
+
+	// Regenerating the set from the same seed writes the same files.
+	manifests, _, err = Generate(&generateConfig{seed: randomSeed})
+	require.NoError(t, err)
+	otherDir := t.TempDir()
+	require.NoError(t, WriteManifestSet(manifests, otherDir))
+	for _, file := range append([]string{manifestSetIndex}, manifestSetFile(0), manifestSetFile(len(manifests)-1)) {
+		want, err := os.ReadFile(filepath.Join(dir, file))
+		require.NoError(t, err)
+		got, err := os.ReadFile(filepath.Join(otherDir, file))
+		require.NoError(t, err)
+		assert.Equal(t, string(want), string(got), file)
+	}
+
+	require.NoError(t, os.Remove(filepath.Join(dir, manifestSetFile(0))))
+	_, _, err = ReadManifestSet(dir)
+	require.Error(t, err)
+}
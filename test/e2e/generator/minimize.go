@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"slices"
+
+	"github.com/BurntSushi/toml"
+
+	e2e "github.com/cometbft/cometbft/test/e2e/pkg"
+)
+
+// Minimize shrinks a failing manifest into a smaller one that still fails,
+// to ease debugging. It greedily removes perturbations and misbehaviors,
+// drops nodes, and clears peer lists, keeping every change for which
+// stillFails returns true, until no change is left to keep. stillFails is only
+// called with valid manifests in which the started validators hold a BFT
+// quorum of the voting power at every height, see liveQuorum. Validators are
+// thus only dropped if the others keep a quorum. The given manifest, which
+// stillFails must fail, is not modified.
+func Minimize(m e2e.Manifest, stillFails func(e2e.Manifest) bool) e2e.Manifest {
+	try := func(change func(*e2e.Manifest) bool) bool {
+		candidate, err := cloneManifest(m)
+		if err != nil || !change(&candidate) || !minimizable(candidate) || !stillFails(candidate) {
+			return false
+		}
+		m = candidate
+		return true
+	}
+
+	for shrunk := true; shrunk; {
+		shrunk = false
+
+		for _, name := range sortedNodeNames(m) {
+			for _, p := range m.Nodes[name].Perturb {
+				shrunk = try(func(c *e2e.Manifest) bool {
+					c.Nodes[name].Perturb = removePerturbation(c.Nodes[name].Perturb, e2e.Perturbation(p))
+					// Only nodes with a corrupted database recover from it, and
+					// only flapping nodes have a flap interval.
+					switch e2e.Perturbation(p) {
+					case e2e.PerturbationCorruptDB:
+						c.Nodes[name].RecoveryMode = ""
+					case e2e.PerturbationFlap:
+						c.Nodes[name].FlapInterval = 0
+					}
+					return true
+				}) || shrunk
+			}
+			if len(m.Nodes[name].Misbehaviors) > 0 {
+				shrunk = try(func(c *e2e.Manifest) bool {
+					c.Nodes[name].Misbehaviors = nil
+					return true
+				}) || shrunk
+			}
+		}
+
+		// Light clients and other non-validators go first, and validators
+		// last, starting with the ones added last.
+		names := sortedNodeNames(m)
+		slices.Reverse(names)
+		for _, mode := range []e2e.Mode{e2e.ModeLight, e2e.ModeFull, e2e.ModeSeed, e2e.ModeValidator} {
+			for _, name := range names {
+				if node, ok := m.Nodes[name]; !ok || nodeMode(node) != mode {
+					continue
+				}
+				shrunk = try(func(c *e2e.Manifest) bool {
+					removeNode(c, name)
+					return true
+				}) || shrunk
+			}
+		}
+
+		// Nodes without seeds and persistent peers connect to all others.
+		for _, name := range sortedNodeNames(m) {
+			if nodeMode(m.Nodes[name]) == e2e.ModeLight {
+				continue
+			}
+			shrunk = try(func(c *e2e.Manifest) bool {
+				node := c.Nodes[name]
+				if len(node.Seeds) == 0 && len(node.PersistentPeers) == 0 {
+					return false
+				}
+				node.Seeds, node.PersistentPeers = nil, nil
+				return true
+			}) || shrunk
+		}
+	}
+	return m
+}
+
+// minimizable returns whether Minimize may pass a manifest to its predicate:
+// it must be valid, and keep a live BFT quorum.
+func minimizable(m e2e.Manifest) bool {
+	infra, err := e2e.NewDockerInfrastructureData(m)
+	if err != nil {
+		return false
+	}
+	if _, err := e2e.NewTestnetFromManifest(m, "minimize.toml", infra); err != nil {
+		return false
+	}
+	return liveQuorum(m)
+}
+
+// liveQuorum returns whether the validators that have started hold more than
+// 2/3 of the voting power at the initial height and at every validator update.
+func liveQuorum(m e2e.Manifest) bool {
+	initialHeight := max(m.InitialHeight, 1)
+	heights := []int64{initialHeight}
+	for _, h := range validatorUpdateHeights(m) {
+		if h > initialHeight {
+			heights = append(heights, h)
+		}
+	}
+	for _, height := range heights {
+		var total, started int64
+		for name, power := range validatorPowersAt(m, height) {
+			total += power
+			if node := m.Nodes[name]; node != nil && node.StartAt <= height {
+				started += power
+			}
+		}
+		if 3*started <= 2*total {
+			return false
+		}
+	}
+	return true
+}
+
+// removeNode removes a node from a manifest, along with all references to it.
+// A light client losing its primary uses its first witness instead.
+func removeNode(m *e2e.Manifest, name string) {
+	delete(m.Nodes, name)
+	remove := func(names []string) []string {
+		return slices.DeleteFunc(names, func(n string) bool { return n == name })
+	}
+	for _, node := range m.Nodes {
+		node.Seeds = remove(node.Seeds)
+		node.PersistentPeers = remove(node.PersistentPeers)
+		node.Witnesses = remove(node.Witnesses)
+		if nodeMode(node) == e2e.ModeLight && len(node.PersistentPeers) == 0 && len(node.Witnesses) > 0 {
+			node.PersistentPeers, node.Witnesses = node.Witnesses[:1], node.Witnesses[1:]
+		}
+	}
+	m.BridgeNodes = remove(m.BridgeNodes)
+	m.ArchiveNodes = remove(m.ArchiveNodes)
+	if m.Validators != nil {
+		delete(*m.Validators, name)
+	}
+	for height, update := range m.ValidatorUpdates {
+		delete(update, name)
+		if len(update) == 0 {
+			delete(m.ValidatorUpdates, height)
+		}
+	}
+}
+
+// nodeMode returns the mode of a manifest node, which defaults to validator.
+func nodeMode(node *e2e.ManifestNode) e2e.Mode {
+	if node.Mode == "" {
+		return e2e.ModeValidator
+	}
+	return e2e.Mode(node.Mode)
+}
+
+// cloneManifest returns a deep copy of a manifest.
+func cloneManifest(m e2e.Manifest) (e2e.Manifest, error) {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(m); err != nil {
+		return e2e.Manifest{}, err
+	}
+	var clone e2e.Manifest
+	if _, err := toml.Decode(buf.String(), &clone); err != nil {
+		return e2e.Manifest{}, err
+	}
+	return clone, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	e2e "github.com/cometbft/cometbft/test/e2e/pkg"
+)
+
+// largestManifest returns the generated testnet with the most nodes.
+func largestManifest(t *testing.T) e2e.Manifest {
+	t.Helper()
+	manifests, _, err := Generate(&generateConfig{seed: randomSeed})
+	require.NoError(t, err)
+	largest := manifests[0]
+	for _, m := range manifests {
+		if len(m.Nodes) > len(largest.Nodes) {
+			largest = m
+		}
+	}
+	return largest
+}
+
+func TestMinimize(t *testing.T) {
+	m := largestManifest(t)
+	original, err := cloneManifest(m)
+	require.NoError(t, err)
+
+	// The synthetic failure is caused by a perturbation of a full node.
+	culprit, perturbation := "", ""
+	for _, name := range nodeNamesByMode(m, e2e.ModeFull) {
+		if len(m.Nodes[name].Perturb) > 0 {
+			culprit, perturbation = name, m.Nodes[name].Perturb[0]
+			break
+		}
+	}
+	if culprit == "" {
+		culprit, perturbation = "full01", string(e2e.PerturbationKill)
+		m.Nodes[culprit] = &e2e.ManifestNode{Mode: string(e2e.ModeFull), Perturb: []string{perturbation}}
+		original, err = cloneManifest(m)
+		require.NoError(t, err)
+	}
+	calls := 0
+	stillFails := func(c e2e.Manifest) bool {
+		calls++
+		require.True(t, liveQuorum(c), "predicate called without a live quorum")
+		node, ok := c.Nodes[culprit]
+		return ok && len(node.Perturb) > 0 && node.Perturb[0] == perturbation
+	}
+
+	minimal := Minimize(m, stillFails)
+	assert.Positive(t, calls)
+	assert.Equal(t, original, m, "the manifest was modified")
+	require.True(t, stillFails(minimal))
+	assert.True(t, minimizable(minimal))
+	assert.Less(t, len(minimal.Nodes), len(m.Nodes))
+	assert.Equal(t, []string{perturbation}, minimal.Nodes[culprit].Perturb)
+	for name, node := range minimal.Nodes {
+		if name != culprit {
+			assert.Empty(t, node.Perturb, name)
+		}
+		assert.Empty(t, node.Misbehaviors, name)
+		if node.Mode != string(e2e.ModeLight) {
+			assert.Empty(t, node.Seeds, name)
+			assert.Empty(t, node.PersistentPeers, name)
+		}
+	}
+
+	// Removing any remaining node would break the testnet or the failure.
+	for _, name := range sortedNodeNames(minimal) {
+		c, err := cloneManifest(minimal)
+		require.NoError(t, err)
+		removeNode(&c, name)
+		assert.False(t, minimizable(c) && stillFails(c), "node %s could have been removed", name)
+	}
+}
+
+func TestMinimizeUnchanged(t *testing.T) {
+	m := largestManifest(t)
+	minimal := Minimize(m, func(e2e.Manifest) bool { return false })
+	assert.Equal(t, m, minimal)
+}
+
+func TestLiveQuorum(t *testing.T) {
+	m := e2e.Manifest{
+		Validators: &map[string]int64{"validator01": 30, "validator02": 30, "validator03": 30},
+		ValidatorUpdates: map[string]map[string]int64{
+			"20": {"validator04": 30},
+		},
+		Nodes: map[string]*e2e.ManifestNode{
+			"validator01": {},
+			"validator02": {},
+			"validator03": {},
+			"validator04": {StartAt: 15},
+		},
+	}
+	assert.True(t, liveQuorum(m))
+
+	// A third of the power starting late leaves no quorum at genesis.
+	m.Nodes["validator03"].StartAt = 10
+	assert.False(t, liveQuorum(m))
+	m.Nodes["validator03"].StartAt = 0
+
+	// Nor does adding a validator holding a third of the power before it
+	// starts.
+	m.ValidatorUpdates["20"]["validator04"] = 45
+	m.Nodes["validator04"].StartAt = 25
+	assert.False(t, liveQuorum(m))
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/BurntSushi/toml"
+
+	e2e "github.com/cometbft/cometbft/test/e2e/pkg"
+)
+
+// PairedTestnet is a pair of testnets run side by side as two chains, e.g. to
+// test relaying between them, see GeneratePaired.
+type PairedTestnet struct {
+	// Name is the name of the pair, which the chain IDs and file names of its
+	// testnets are derived from.
+	Name string
+	// ChainIDs are the chain IDs of the two testnets, as set in their
+	// manifests, which Save also names after them.
+	ChainIDs  [2]string
+	Manifests [2]e2e.Manifest
+	// RelayerNodes are the nodes whose RPC servers relayers connect to, on
+	// both chains.
+	RelayerNodes []RelayerNode
+}
+
+// RelayerNode is a node of one of the chains of a PairedTestnet that relayers
+// connect to.
+type RelayerNode struct {
+	ChainID string `toml:"chain_id"`
+	Node    string `toml:"node"`
+}
+
+// GeneratePaired generates testnets as Generate does, and pairs them up as
+// two chains with distinct chain IDs, e.g. to test relaying between them.
+// Testnets without a node relayers can use, see relayerCandidates, are left
+// out, as is the last testnet if there is an odd number of them. The chains
+// of a pair get distinct key seeds, so that their validator sets are
+// independent, and relayers are drawn from the full nodes of both chains
+// running the local version, so that they only need to support that one.
+func GeneratePaired(cfg *generateConfig) ([]PairedTestnet, error) {
+	if cfg.keySeed != 0 {
+		return nil, errors.New("paired testnets have independent validator sets, so they take no key seed")
+	}
+	manifests, _, err := Generate(cfg)
+	if err != nil {
+		return nil, err
+	}
+	r := rand.New(rand.NewSource(cfg.seed)) //nolint:gosec
+
+	pairs := []PairedTestnet{}
+	chains := []e2e.Manifest{}
+	for _, m := range manifests {
+		if len(relayerCandidates(m)) == 0 {
+			continue
+		}
+		chains = append(chains, m)
+		if len(chains) < 2 {
+			continue
+		}
+		pair := PairedTestnet{Name: fmt.Sprintf("pair-%04d", len(pairs))}
+		pair.ChainIDs = [2]string{pair.Name + "-a", pair.Name + "-b"}
+		pair.Manifests = [2]e2e.Manifest{chains[0], chains[1]}
+		for i := range pair.Manifests {
+			pair.Manifests[i].ChainID = pair.ChainIDs[i]
+			pair.Manifests[i].KeySeed = 1 + r.Int63n(1<<62)
+			for _, name := range uniformSetChoice(relayerCandidates(pair.Manifests[i])).Choose(r) {
+				pair.RelayerNodes = append(pair.RelayerNodes, RelayerNode{ChainID: pair.ChainIDs[i], Node: name})
+			}
+		}
+		if err := pair.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid paired testnet %v: %w", pair.Name, err)
+		}
+		pairs = append(pairs, pair)
+		chains = chains[:0]
+	}
+	return pairs, nil
+}
+
+// relayerCandidates returns the sorted names of the full nodes of a testnet
+// that relayers can connect to: those running the local version from the
+// initial height, and accepting websocket subscriptions.
+func relayerCandidates(manifest e2e.Manifest) []string {
+	names := []string{}
+	for _, name := range nodeNamesByMode(manifest, e2e.ModeFull) {
+		node := manifest.Nodes[name]
+		if node.Version != "" || (node.StartAt != 0 && node.StartAt != manifest.InitialHeight) {
+			continue
+		}
+		if subs := node.RPCConfig.MaxSubscriptionsPerClient; subs != nil && *subs == 0 {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// Validate checks that both chains of the pair are valid testnets on their
+// own, including their quorums, that their chain IDs and validator keys are
+// distinct, and that relayers can connect to a node of each of them.
+func (p PairedTestnet) Validate() error {
+	if p.ChainIDs[0] == "" || p.ChainIDs[0] == p.ChainIDs[1] {
+		return fmt.Errorf("chain IDs %q and %q must be distinct and non-empty", p.ChainIDs[0], p.ChainIDs[1])
+	}
+	validators := map[string]string{}
+	for i, m := range p.Manifests {
+		if m.ChainID != p.ChainIDs[i] {
+			return fmt.Errorf("manifest of chain %q has chain ID %q", p.ChainIDs[i], m.ChainID)
+		}
+		infra, err := e2e.NewDockerInfrastructureData(m)
+		if err != nil {
+			return err
+		}
+		testnet, err := e2e.NewTestnetFromManifest(m, p.ChainIDs[i]+".toml", infra)
+		if err != nil {
+			return fmt.Errorf("invalid chain %q: %w", p.ChainIDs[i], err)
+		}
+		for node := range testnet.Validators {
+			key := node.PrivvalKey.PubKey().Address().String()
+			if chainID, ok := validators[key]; ok && chainID != p.ChainIDs[i] {
+				return fmt.Errorf("validator %q of chain %q shares its key with chain %q",
+					node.Name, p.ChainIDs[i], chainID)
+			}
+			validators[key] = p.ChainIDs[i]
+		}
+
+		relayers := 0
+		for _, relayer := range p.RelayerNodes {
+			if relayer.ChainID != p.ChainIDs[i] {
+				continue
+			}
+			if !slices.Contains(relayerCandidates(m), relayer.Node) {
+				return fmt.Errorf("relayer node %q of chain %q must be a full node running the local version "+
+					"from the initial height and accepting subscriptions", relayer.Node, relayer.ChainID)
+			}
+			relayers++
+		}
+		if relayers == 0 {
+			return fmt.Errorf("chain %q has no relayer node", p.ChainIDs[i])
+		}
+	}
+	for _, relayer := range p.RelayerNodes {
+		if relayer.ChainID != p.ChainIDs[0] && relayer.ChainID != p.ChainIDs[1] {
+			return fmt.Errorf("relayer node %q belongs to unknown chain %q", relayer.Node, relayer.ChainID)
+		}
+	}
+	return nil
+}
+
+// Save writes the manifests of the pair to dir, named after their chain IDs,
+// and its relayer nodes to a file named after the pair.
+func (p PairedTestnet) Save(dir string) error {
+	for i, m := range p.Manifests {
+		if err := m.Save(filepath.Join(dir, p.ChainIDs[i]+".toml")); err != nil {
+			return err
+		}
+	}
+	var buf bytes.Buffer
+	err := toml.NewEncoder(&buf).Encode(struct {
+		ChainIDs     []string      `toml:"chain_ids"`
+		RelayerNodes []RelayerNode `toml:"relayer_nodes"`
+	}{p.ChainIDs[:], p.RelayerNodes})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, p.Name+"-relayers.toml"), buf.Bytes(), 0o644) //nolint:gosec
+}
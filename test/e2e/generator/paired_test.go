@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	e2e "github.com/cometbft/cometbft/test/e2e/pkg"
+)
+
+func TestGeneratePaired(t *testing.T) {
+	total := 0
+	for seed := int64(0); seed < 5; seed++ {
+		pairs, err := GeneratePaired(&generateConfig{seed: seed})
+		require.NoError(t, err)
+		total += len(pairs)
+		for _, pair := range pairs {
+			require.NoError(t, pair.Validate(), pair.Name)
+			assert.NotEqual(t, pair.ChainIDs[0], pair.ChainIDs[1])
+			assert.NotEqual(t, pair.Manifests[0].KeySeed, pair.Manifests[1].KeySeed)
+
+			relayers := map[string]int{}
+			for _, relayer := range pair.RelayerNodes {
+				relayers[relayer.ChainID]++
+				i := 0
+				if relayer.ChainID == pair.ChainIDs[1] {
+					i = 1
+				}
+				node := pair.Manifests[i].Nodes[relayer.Node]
+				require.NotNil(t, node, "%v: %v", pair.Name, relayer.Node)
+				assert.Equal(t, string(e2e.ModeFull), node.Mode)
+				assert.Empty(t, node.Version)
+			}
+			assert.Positive(t, relayers[pair.ChainIDs[0]], pair.Name)
+			assert.Positive(t, relayers[pair.ChainIDs[1]], pair.Name)
+		}
+	}
+	assert.Positive(t, total)
+
+	_, err := GeneratePaired(&generateConfig{seed: randomSeed, keySeed: 1})
+	require.Error(t, err)
+}
+
+func TestPairedTestnetValidate(t *testing.T) {
+	pairs, err := GeneratePaired(&generateConfig{seed: randomSeed})
+	require.NoError(t, err)
+	require.NotEmpty(t, pairs)
+
+	pair := pairs[0]
+	pair.ChainIDs[1] = pair.ChainIDs[0]
+	require.ErrorContains(t, pair.Validate(), "must be distinct")
+
+	pair = pairs[0]
+	pair.Manifests[1].ChainID = pair.ChainIDs[0]
+	require.ErrorContains(t, pair.Validate(), "has chain ID")
+
+	// Chains with the same key seed give nodes with the same name the same keys.
+	pair = pairs[0]
+	pair.Manifests[1] = pair.Manifests[0]
+	pair.Manifests[1].ChainID = pair.ChainIDs[1]
+	require.ErrorContains(t, pair.Validate(), "shares its key with chain")
+
+	pair = pairs[0]
+	pair.RelayerNodes = []RelayerNode{{ChainID: pair.ChainIDs[0], Node: "validator01"}}
+	require.ErrorContains(t, pair.Validate(), `relayer node "validator01"`)
+
+	pair = pairs[0]
+	pair.RelayerNodes = []RelayerNode{pairs[0].RelayerNodes[0]}
+	require.ErrorContains(t, pair.Validate(), "has no relayer node")
+}
+
+func TestPairedTestnetSave(t *testing.T) {
+	pairs, err := GeneratePaired(&generateConfig{seed: randomSeed})
+	require.NoError(t, err)
+	require.NotEmpty(t, pairs)
+	pair := pairs[0]
+
+	dir := t.TempDir()
+	require.NoError(t, pair.Save(dir))
+	for i, chainID := range pair.ChainIDs {
+		infra, err := e2e.NewDockerInfrastructureData(pair.Manifests[i])
+		require.NoError(t, err)
+		testnet, err := e2e.LoadTestnet(filepath.Join(dir, chainID+".toml"), infra)
+		require.NoError(t, err)
+		assert.Equal(t, chainID, testnet.Name)
+		assert.Equal(t, chainID, testnet.ChainID)
+	}
+	bz, err := os.ReadFile(filepath.Join(dir, pair.Name+"-relayers.toml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(bz), pair.RelayerNodes[0].Node)
+}
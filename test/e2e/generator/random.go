@@ -1,10 +1,21 @@
 package main
 
 import (
+	"fmt"
+	"hash/fnv"
 	"math/rand"
 	"sort"
 )
 
+// nodeRand returns the RNG making the choices of the node with the given name,
+// derived from a seed drawn once per testnet. Each node thus has a stream of
+// its own, which choices made for other nodes or the testnet don't shift.
+func nodeRand(seed int64, name string) *rand.Rand {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	return rand.New(rand.NewSource(seed ^ int64(h.Sum64()))) //nolint:gosec
+}
+
 // combinations takes input in the form of a map of item lists, and returns a
 // list of all combinations of each item for each key. E.g.:
 //
@@ -49,6 +60,33 @@ func combiner(head map[string]interface{}, pending []string, items map[string][]
 	return result
 }
 
+// sampleCombinations randomly picks n combinations of the given items, i.e.
+// maps containing one item for each key. Items of keys that have weights are
+// chosen according to them, while other items are chosen uniformly.
+func sampleCombinations(
+	r *rand.Rand, items map[string][]interface{}, weights map[string]weightedChoice, n int,
+) []map[string]interface{} {
+	keys := []string{}
+	for key := range items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := []map[string]interface{}{}
+	for i := 0; i < n; i++ {
+		combination := map[string]interface{}{}
+		for _, key := range keys {
+			if wc, ok := weights[key]; ok {
+				combination[key] = wc.Choose(r)
+			} else {
+				combination[key] = uniformChoice(items[key]).Choose(r)
+			}
+		}
+		result = append(result, combination)
+	}
+	return result
+}
+
 // uniformChoice chooses a single random item from the argument list, uniformly weighted.
 type uniformChoice []interface{}
 
@@ -59,10 +97,24 @@ func (uc uniformChoice) Choose(r *rand.Rand) interface{} {
 // probSetChoice picks a set of strings based on each string's probability (0-1).
 type probSetChoice map[string]float64
 
+func (pc probSetChoice) keys() []interface{} {
+	keys := make([]interface{}, 0, len(pc))
+	for item := range pc {
+		keys = append(keys, item)
+	}
+	return keys
+}
+
 func (pc probSetChoice) Choose(r *rand.Rand) []string {
+	items := make([]string, 0, len(pc))
+	for item := range pc {
+		items = append(items, item)
+	}
+	sort.Strings(items)
+
 	choices := []string{}
-	for item, prob := range pc {
-		if r.Float64() <= prob {
+	for _, item := range items {
+		if r.Float64() <= pc[item] {
 			choices = append(choices, item)
 		}
 	}
@@ -87,6 +139,14 @@ func (usc uniformSetChoice) Choose(r *rand.Rand) []string {
 // weightedChoice chooses a single random key from a map of keys and weights.
 type weightedChoice map[interface{}]uint
 
+func (wc weightedChoice) keys() []interface{} {
+	keys := make([]interface{}, 0, len(wc))
+	for choice := range wc {
+		keys = append(keys, choice)
+	}
+	return keys
+}
+
 func (wc weightedChoice) Choose(r *rand.Rand) interface{} {
 	total := 0
 	choices := make([]interface{}, 0, len(wc))
@@ -94,11 +154,16 @@ func (wc weightedChoice) Choose(r *rand.Rand) interface{} {
 		total += int(weight)
 		choices = append(choices, choice)
 	}
+	// Sort the choices so that the outcome only depends on the RNG, and not on
+	// the map iteration order.
+	sort.Slice(choices, func(i, j int) bool {
+		return fmt.Sprint(choices[i]) < fmt.Sprint(choices[j])
+	})
 
 	rem := r.Intn(total)
 	for _, choice := range choices {
 		rem -= int(wc[choice])
-		if rem <= 0 {
+		if rem < 0 {
 			return choice
 		}
 	}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"math/rand"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	e2e "github.com/cometbft/cometbft/test/e2e/pkg"
 )
 
 func TestCombinations(t *testing.T) {
@@ -29,3 +33,49 @@ func TestCombinations(t *testing.T) {
 		{"bool": true, "int": 3, "string": "bar"},
 	}, c)
 }
+
+func TestSampleCombinations(t *testing.T) {
+	input := map[string][]interface{}{
+		"int":    {1, 2, 3},
+		"string": {"foo", "bar"},
+	}
+	weights := map[string]weightedChoice{
+		"string": {"foo": 1, "bar": 3},
+	}
+
+	c := sampleCombinations(rand.New(rand.NewSource(1)), input, weights, 1000)
+	require.Len(t, c, 1000)
+	counts := map[interface{}]int{}
+	for _, combination := range c {
+		assert.Contains(t, input["int"], combination["int"])
+		counts[combination["string"]]++
+	}
+	assert.Greater(t, counts["bar"], 2*counts["foo"])
+	assert.Equal(t, c, sampleCombinations(rand.New(rand.NewSource(1)), input, weights, 1000))
+}
+
+func TestWeightedChoice(t *testing.T) {
+	wc := weightedChoice{"a": 1, "b": 1}
+	r := rand.New(rand.NewSource(1))
+	counts := map[interface{}]int{}
+	for i := 0; i < 1000; i++ {
+		counts[wc.Choose(r)]++
+	}
+	assert.Positive(t, counts["a"])
+	assert.Positive(t, counts["b"])
+}
+
+func TestNodeRand(t *testing.T) {
+	const seed = int64(42)
+	validator02 := generateNode(nodeRand(seed, "validator02"), e2e.ModeValidator, 0, e2e.EvidenceAgeHeight, false)
+
+	// A choice added to another node draws from that node's stream, and
+	// leaves the choices made for validator02 unchanged.
+	r := nodeRand(seed, "validator01")
+	nodeVersions.Choose(r)
+	generateNode(r, e2e.ModeValidator, 0, e2e.EvidenceAgeHeight, true)
+	assert.Equal(t, validator02, generateNode(nodeRand(seed, "validator02"), e2e.ModeValidator, 0, e2e.EvidenceAgeHeight, false))
+
+	assert.NotEqual(t, nodeRand(seed, "validator01").Int63(), nodeRand(seed, "validator02").Int63())
+	assert.NotEqual(t, nodeRand(seed, "validator01").Int63(), nodeRand(seed+1, "validator01").Int63())
+}
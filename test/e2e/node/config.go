@@ -11,19 +11,32 @@ import (
 
 // Config is the application configuration.
 type Config struct {
-	ChainID          string                      `toml:"chain_id"`
-	Listen           string                      `toml:"listen"`
-	Protocol         string                      `toml:"protocol"`
-	Dir              string                      `toml:"dir"`
-	Mode             string                      `toml:"mode"`
-	PersistInterval  uint64                      `toml:"persist_interval"`
-	SnapshotInterval uint64                      `toml:"snapshot_interval"`
-	RetainBlocks     uint64                      `toml:"retain_blocks"`
-	ValidatorUpdates map[string]map[string]uint8 `toml:"validator_update"`
-	PrivValServer    string                      `toml:"privval_server"`
-	PrivValKey       string                      `toml:"privval_key"`
-	PrivValState     string                      `toml:"privval_state"`
-	KeyType          string                      `toml:"key_type"`
+	ChainID           string                      `toml:"chain_id"`
+	Listen            string                      `toml:"listen"`
+	Protocol          string                      `toml:"protocol"`
+	Dir               string                      `toml:"dir"`
+	Mode              string                      `toml:"mode"`
+	PersistInterval   uint64                      `toml:"persist_interval"`
+	SnapshotInterval  uint64                      `toml:"snapshot_interval"`
+	SnapshotFormat    uint32                      `toml:"snapshot_format"`
+	SnapshotChunkSize uint64                      `toml:"snapshot_chunk_size"`
+	RetainBlocks      uint64                      `toml:"retain_blocks"`
+	ValidatorUpdates  map[string]map[string]uint8 `toml:"validator_update"`
+	ValidatorKeyTypes map[string]string           `toml:"validator_key_types"`
+	PrivValServer     string                      `toml:"privval_server"`
+	PrivValKey        string                      `toml:"privval_key"`
+	PrivValState      string                      `toml:"privval_state"`
+	KeyType           string                      `toml:"key_type"`
+
+	// ClockSkewFile, if set, holds the offset of the node's clock as a Go
+	// duration, which is re-read while the node is running. The offset is
+	// applied to the timestamps of the votes signed by this process, so it is
+	// only effective with the builtin ABCI protocols.
+	ClockSkewFile string `toml:"clock_skew_file"`
+
+	// PrivvalDisconnectFile, if set, tells whether the remote signer must be
+	// disconnected from the node, and is re-read while the node is running.
+	PrivvalDisconnectFile string `toml:"privval_disconnect_file"`
 
 	PrepareProposalDelay time.Duration `toml:"prepare_proposal_delay"`
 	ProcessProposalDelay time.Duration `toml:"process_proposal_delay"`
@@ -31,7 +44,13 @@ type Config struct {
 	FinalizeBlockDelay   time.Duration `toml:"finalize_block_delay"`
 	VoteExtensionDelay   time.Duration `toml:"vote_extension_delay"`
 
+	PrepareProposalJitter time.Duration `toml:"prepare_proposal_jitter"`
+	ProcessProposalJitter time.Duration `toml:"process_proposal_jitter"`
+	JitterSeed            int64         `toml:"jitter_seed"`
+
 	VoteExtensionSize uint `toml:"vote_extension_size"`
+
+	AppConfig map[string]string `toml:"app_config"`
 }
 
 // App extracts out the application specific configuration parameters
@@ -39,9 +58,12 @@ func (cfg *Config) App() *app.Config {
 	return &app.Config{
 		Dir:                  cfg.Dir,
 		SnapshotInterval:     cfg.SnapshotInterval,
+		SnapshotFormat:       cfg.SnapshotFormat,
+		SnapshotChunkSize:    cfg.SnapshotChunkSize,
 		RetainBlocks:         cfg.RetainBlocks,
 		KeyType:              cfg.KeyType,
 		ValidatorUpdates:     cfg.ValidatorUpdates,
+		ValidatorKeyTypes:    cfg.ValidatorKeyTypes,
 		PersistInterval:      cfg.PersistInterval,
 		PrepareProposalDelay: cfg.PrepareProposalDelay,
 		ProcessProposalDelay: cfg.ProcessProposalDelay,
@@ -49,6 +71,11 @@ func (cfg *Config) App() *app.Config {
 		FinalizeBlockDelay:   cfg.FinalizeBlockDelay,
 		VoteExtensionDelay:   cfg.VoteExtensionDelay,
 		VoteExtensionSize:    cfg.VoteExtensionSize,
+
+		PrepareProposalJitter: cfg.PrepareProposalJitter,
+		ProcessProposalJitter: cfg.ProcessProposalJitter,
+		JitterSeed:            cfg.JitterSeed,
+		AppConfig:             cfg.AppConfig,
 	}
 }
 
@@ -8,6 +8,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/spf13/viper"
@@ -25,10 +27,12 @@ import (
 	"github.com/cometbft/cometbft/node"
 	"github.com/cometbft/cometbft/p2p"
 	"github.com/cometbft/cometbft/privval"
+	cmtproto "github.com/cometbft/cometbft/proto/tendermint/types"
 	"github.com/cometbft/cometbft/proxy"
 	rpcserver "github.com/cometbft/cometbft/rpc/jsonrpc/server"
 	"github.com/cometbft/cometbft/test/e2e/app"
 	e2e "github.com/cometbft/cometbft/test/e2e/pkg"
+	"github.com/cometbft/cometbft/types"
 )
 
 var logger = log.NewTMLogger(log.NewSyncWriter(os.Stdout))
@@ -57,11 +61,22 @@ func run(configFile string) error {
 		return err
 	}
 
+	// Read the clock skew before the node signs any vote.
+	if cfg.ClockSkewFile != "" {
+		if err = watchClockSkew(cfg.ClockSkewFile); err != nil {
+			return err
+		}
+	}
+
 	// Start remote signer (must start before node if running builtin).
 	if cfg.PrivValServer != "" {
-		if err = startSigner(cfg); err != nil {
+		var signer *privval.SignerServer
+		if signer, err = startSigner(cfg); err != nil {
 			return err
 		}
+		if cfg.PrivvalDisconnectFile != "" {
+			watchPrivvalDisconnect(cfg, signer)
+		}
 		if cfg.Protocol == "builtin" || cfg.Protocol == "builtin_connsync" {
 			time.Sleep(1 * time.Second)
 		}
@@ -132,8 +147,12 @@ func startNode(cfg *Config) error {
 		nodeLogger.Info("Using default (synchronized) local client creator")
 	}
 
+	var pv types.PrivValidator = privval.LoadOrGenFilePV(cmtcfg.PrivValidatorKeyFile(), cmtcfg.PrivValidatorStateFile())
+	if cfg.ClockSkewFile != "" {
+		pv = &skewedPrivValidator{PrivValidator: pv}
+	}
 	n, err := node.NewNode(context.Background(), cmtcfg,
-		privval.LoadOrGenFilePV(cmtcfg.PrivValidatorKeyFile(), cmtcfg.PrivValidatorStateFile()),
+		pv,
 		nodeKey,
 		clientCreator,
 		node.DefaultGenesisDocProviderFunc(cmtcfg),
@@ -205,7 +224,7 @@ func startLightClient(cfg *Config) error {
 }
 
 // startSigner starts a signer server connecting to the given endpoint.
-func startSigner(cfg *Config) error {
+func startSigner(cfg *Config) (*privval.SignerServer, error) {
 	filePV := privval.LoadFilePV(cfg.PrivValKey, cfg.PrivValState)
 
 	protocol, address := cmtnet.ProtocolAndAddress(cfg.PrivValServer)
@@ -216,18 +235,52 @@ func startSigner(cfg *Config) error {
 	case "unix":
 		dialFn = privval.DialUnixFn(address)
 	default:
-		return fmt.Errorf("invalid privval protocol %q", protocol)
+		return nil, fmt.Errorf("invalid privval protocol %q", protocol)
 	}
 
 	endpoint := privval.NewSignerDialerEndpoint(logger, dialFn,
 		privval.SignerDialerEndpointRetryWaitInterval(1*time.Second),
 		privval.SignerDialerEndpointConnRetries(100))
-	err := privval.NewSignerServer(endpoint, cfg.ChainID, filePV).Start()
-	if err != nil {
-		return err
+	var pv types.PrivValidator = filePV
+	if cfg.ClockSkewFile != "" {
+		pv = &skewedPrivValidator{PrivValidator: pv}
+	}
+	signer := privval.NewSignerServer(endpoint, cfg.ChainID, pv)
+	if err := signer.Start(); err != nil {
+		return nil, err
 	}
 	logger.Info("start signer", "msg", log.NewLazySprintf("Remote signer connecting to %v", cfg.PrivValServer))
-	return nil
+	return signer, nil
+}
+
+// watchPrivvalDisconnect polls the file telling whether the remote signer
+// must be disconnected, stopping the signer while it must, and starting a new
+// one to reconnect afterwards.
+func watchPrivvalDisconnect(cfg *Config, signer *privval.SignerServer) {
+	go func() {
+		for {
+			time.Sleep(time.Second)
+			bz, err := os.ReadFile(cfg.PrivvalDisconnectFile)
+			if err != nil {
+				logger.Error("failed to read privval disconnect file", "err", err)
+				continue
+			}
+			disconnected := strings.TrimSpace(string(bz)) == "disconnected"
+			switch {
+			case disconnected && signer != nil:
+				if err := signer.Stop(); err != nil {
+					logger.Error("failed to stop signer", "err", err)
+					continue
+				}
+				signer = nil
+				logger.Info("disconnect signer", "msg", "Remote signer disconnected")
+			case !disconnected && signer == nil:
+				if signer, err = startSigner(cfg); err != nil {
+					logger.Error("failed to restart signer", "err", err)
+				}
+			}
+		}
+	}()
 }
 
 func setupNode() (*config.Config, log.Logger, *p2p.NodeKey, error) {
@@ -276,6 +329,83 @@ func setupNode() (*config.Config, log.Logger, *p2p.NodeKey, error) {
 	return cmtcfg, nodeLogger, nodeKey, nil
 }
 
+// clockSkew is the offset of the node's clock from the host clock, in
+// nanoseconds, see watchClockSkew. CometBFT reads the host clock directly, so
+// the offset is only applied to the timestamps of the votes the node signs,
+// from which the time of blocks is derived, see skewedPrivValidator.
+var clockSkew atomic.Int64
+
+// skewedPrivValidator offsets the timestamps of the votes it signs by the
+// node's clock skew, since consensus adopts the timestamp of a signed vote.
+// Like those of a node whose clock is behind, which consensus moves past the
+// voted block, its timestamps keep increasing from one height to the next,
+// so that block times do too.
+type skewedPrivValidator struct {
+	types.PrivValidator
+
+	mtx    sync.Mutex
+	height int64
+	// floor is the latest timestamp signed at lower heights, and latest the
+	// latest one signed at height.
+	floor, latest time.Time
+}
+
+// SignVote implements types.PrivValidator.
+func (pv *skewedPrivValidator) SignVote(chainID string, vote *cmtproto.Vote) error {
+	pv.mtx.Lock()
+	defer pv.mtx.Unlock()
+	if vote.Height > pv.height {
+		pv.height, pv.floor = vote.Height, pv.latest
+	}
+	vote.Timestamp = vote.Timestamp.Add(time.Duration(clockSkew.Load()))
+	if !pv.floor.IsZero() && !vote.Timestamp.After(pv.floor) {
+		vote.Timestamp = pv.floor.Add(time.Millisecond)
+	}
+	if err := pv.PrivValidator.SignVote(chainID, vote); err != nil {
+		return err
+	}
+	if vote.Height == pv.height && vote.Timestamp.After(pv.latest) {
+		pv.latest = vote.Timestamp
+	}
+	return nil
+}
+
+// watchClockSkew sets the node's clock skew to the duration in the given
+// file, and then polls the file every second so that the runner can change
+// the skew while the node is running.
+func watchClockSkew(file string) error {
+	readSkew := func() (time.Duration, error) {
+		bz, err := os.ReadFile(file)
+		if err != nil {
+			return 0, err
+		}
+		return time.ParseDuration(strings.TrimSpace(string(bz)))
+	}
+	skew, err := readSkew()
+	if err != nil {
+		return fmt.Errorf("failed to read clock skew: %w", err)
+	}
+	clockSkew.Store(int64(skew))
+	logger.Info("skew clock", "msg", log.NewLazySprintf("Skewing clock by %v", skew))
+
+	go func() {
+		for {
+			time.Sleep(time.Second)
+			newSkew, err := readSkew()
+			if err != nil {
+				logger.Error("failed to read clock skew", "err", err)
+				continue
+			}
+			if newSkew != skew {
+				skew = newSkew
+				clockSkew.Store(int64(skew))
+				logger.Info("skew clock", "msg", log.NewLazySprintf("Skewing clock by %v", skew))
+			}
+		}
+	}()
+	return nil
+}
+
 // rpcEndpoints takes a list of persistent peers and splits them into a list of rpc endpoints
 // using 26657 as the port number
 func rpcEndpoints(peers string) []string {
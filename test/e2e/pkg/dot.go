@@ -0,0 +1,82 @@
+package e2e
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// dotModeColors are the fill colors of nodes in the Graphviz graph, by mode.
+var dotModeColors = map[Mode]string{
+	ModeValidator: "lightblue",
+	ModeFull:      "palegreen",
+	ModeLight:     "lightyellow",
+	ModeSeed:      "lightgrey",
+}
+
+// ToDOT renders the testnet's peer graph in the Graphviz DOT language. Nodes
+// are colored by mode and labeled with their start height, and edges point
+// from a node to the nodes it connects to:
+//
+//   - seeds are dashed
+//   - persistent peers are solid
+//   - a light client's primary is bold blue, and its other providers and
+//     witnesses are dotted blue
+//
+// Bridge nodes are drawn with a double border. The output is deterministic.
+func (m Manifest) ToDOT() string {
+	names := make([]string, 0, len(m.Nodes))
+	for name := range m.Nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	bridgeNodes := map[string]bool{}
+	for _, name := range m.BridgeNodes {
+		bridgeNodes[name] = true
+	}
+
+	var b strings.Builder
+	b.WriteString("digraph testnet {\n")
+	b.WriteString("  node [style=filled];\n")
+	for _, name := range names {
+		node := m.Nodes[name]
+		mode := Mode(node.Mode)
+		if mode == "" {
+			mode = ModeValidator
+		}
+		startAt := "genesis"
+		switch {
+		case node.StartAt == StartAtNever:
+			startAt = "absent"
+		case node.StartAt > 0 && node.StartAt != m.InitialHeight:
+			startAt = fmt.Sprintf("start at %d", node.StartAt)
+		}
+		peripheries := 1
+		if bridgeNodes[name] {
+			peripheries = 2
+		}
+		fmt.Fprintf(&b, "  %q [label=\"%s\\n%s\\n%s\", fillcolor=%s, peripheries=%d];\n",
+			name, name, mode, startAt, dotModeColors[mode], peripheries)
+	}
+	for _, name := range names {
+		node := m.Nodes[name]
+		for _, seed := range node.Seeds {
+			fmt.Fprintf(&b, "  %q -> %q [style=dashed];\n", name, seed)
+		}
+		for i, peer := range node.PersistentPeers {
+			switch {
+			case node.Mode != string(ModeLight):
+				fmt.Fprintf(&b, "  %q -> %q [style=solid];\n", name, peer)
+			case i == 0:
+				fmt.Fprintf(&b, "  %q -> %q [style=bold, color=blue, label=primary];\n", name, peer)
+			default:
+				fmt.Fprintf(&b, "  %q -> %q [style=dotted, color=blue];\n", name, peer)
+			}
+		}
+		for _, witness := range node.Witnesses {
+			fmt.Fprintf(&b, "  %q -> %q [style=dotted, color=blue, label=witness];\n", name, witness)
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
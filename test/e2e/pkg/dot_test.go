@@ -0,0 +1,82 @@
+package e2e
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifestToDOT(t *testing.T) {
+	testCases := []struct {
+		name     string
+		manifest Manifest
+		expect   []string
+	}{
+		{
+			name: "node modes and start heights",
+			manifest: Manifest{InitialHeight: 1000, Nodes: map[string]*ManifestNode{
+				"seed01":      {Mode: "seed"},
+				"validator01": {},
+				"validator02": {StartAt: 1000},
+				"validator03": {StartAt: 1005},
+				"full01":      {Mode: "full"},
+			}},
+			expect: []string{
+				`"seed01" [label="seed01\nseed\ngenesis", fillcolor=lightgrey, peripheries=1];`,
+				`"validator01" [label="validator01\nvalidator\ngenesis", fillcolor=lightblue, peripheries=1];`,
+				`"validator02" [label="validator02\nvalidator\ngenesis", fillcolor=lightblue, peripheries=1];`,
+				`"validator03" [label="validator03\nvalidator\nstart at 1005", fillcolor=lightblue, peripheries=1];`,
+				`"full01" [label="full01\nfull\ngenesis", fillcolor=palegreen, peripheries=1];`,
+			},
+		},
+		{
+			name: "bridge nodes",
+			manifest: Manifest{BridgeNodes: []string{"full01"}, Nodes: map[string]*ManifestNode{
+				"full01": {Mode: "full"},
+			}},
+			expect: []string{
+				`"full01" [label="full01\nfull\ngenesis", fillcolor=palegreen, peripheries=2];`,
+			},
+		},
+		{
+			name: "seeds and persistent peers",
+			manifest: Manifest{Nodes: map[string]*ManifestNode{
+				"seed01":      {Mode: "seed"},
+				"validator01": {Seeds: []string{"seed01"}},
+				"validator02": {PersistentPeers: []string{"validator01"}},
+			}},
+			expect: []string{
+				`"validator01" -> "seed01" [style=dashed];`,
+				`"validator02" -> "validator01" [style=solid];`,
+			},
+		},
+		{
+			name: "light client providers and witnesses",
+			manifest: Manifest{Nodes: map[string]*ManifestNode{
+				"validator01": {},
+				"validator02": {},
+				"validator03": {},
+				"light01": {
+					Mode:            "light",
+					PersistentPeers: []string{"validator01", "validator02"},
+					Witnesses:       []string{"validator03"},
+				},
+			}},
+			expect: []string{
+				`"light01" [label="light01\nlight\ngenesis", fillcolor=lightyellow, peripheries=1];`,
+				`"light01" -> "validator01" [style=bold, color=blue, label=primary];`,
+				`"light01" -> "validator02" [style=dotted, color=blue];`,
+				`"light01" -> "validator03" [style=dotted, color=blue, label=witness];`,
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dot := tc.manifest.ToDOT()
+			assert.Equal(t, dot, tc.manifest.ToDOT(), "output must be deterministic")
+			for _, line := range tc.expect {
+				assert.Contains(t, dot, "  "+line+"\n")
+			}
+		})
+	}
+}
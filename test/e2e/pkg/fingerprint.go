@@ -0,0 +1,52 @@
+package e2e
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Fingerprint returns a stable hash of the shape of the testnet, i.e. its ABCI
+// protocol and bridge nodes, and the name, mode, version, privval protocol,
+// perturbations, seeds, persistent peers and witnesses of every node. Other
+// settings, such as key material and ports, are ignored, and so is the order
+// of the nodes and of their lists, so that logically identical testnets share
+// a fingerprint, e.g. to skip duplicates among generated testnets. As in Sort,
+// a light client's primary stays first among its persistent peers. Unset
+// modes, ABCI and privval protocols count as their defaults.
+func (m Manifest) Fingerprint() string {
+	sorted := func(list []string) string {
+		list = append([]string{}, list...)
+		sort.Strings(list)
+		return strings.Join(list, ",")
+	}
+	orDefault := func(value string, defaultValue string) string {
+		if value == "" {
+			return defaultValue
+		}
+		return value
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "abci_protocol=%s\n", orDefault(m.ABCIProtocol, string(ProtocolBuiltin)))
+	fmt.Fprintf(&b, "bridge_nodes=%s\n", sorted(m.BridgeNodes))
+	for _, name := range sortNodeNames(m) {
+		node := m.Nodes[name]
+		if node == nil {
+			node = &ManifestNode{}
+		}
+		mode := orDefault(node.Mode, string(ModeValidator))
+		peers := sorted(node.PersistentPeers)
+		if mode == string(ModeLight) && len(node.PersistentPeers) > 0 {
+			peers = node.PersistentPeers[0] + ";" + sorted(node.PersistentPeers[1:])
+		}
+		fmt.Fprintf(&b, "node=%q mode=%s version=%q privval_protocol=%s perturb=%s seeds=%s "+
+			"persistent_peers=%s witnesses=%s\n",
+			name, mode, node.Version, orDefault(node.PrivvalProtocol, string(ProtocolFile)),
+			sorted(node.Perturb), sorted(node.Seeds), peers, sorted(node.Witnesses))
+	}
+	hash := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,61 @@
+package e2e
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifestFingerprint(t *testing.T) {
+	manifest := func() Manifest {
+		return Manifest{
+			KeySeed:       1,
+			GeneratorSeed: 2,
+			Nodes: map[string]*ManifestNode{
+				"validator01": {Perturb: []string{"kill", "pause"}, PrometheusPort: 6001},
+				"validator02": {Mode: "validator", PersistentPeers: []string{"validator01", "full01"}},
+				"full01":      {Mode: "full", Seeds: []string{"seed01"}, KeyType: "ed25519"},
+				"seed01":      {Mode: "seed"},
+				"light01":     {Mode: "light", PersistentPeers: []string{"validator01", "validator02", "full01"}},
+			},
+		}
+	}
+	base := manifest().Fingerprint()
+	assert.Len(t, base, 64)
+	assert.Equal(t, base, manifest().Fingerprint())
+
+	// Manifests differing only in key material, ports, the order of lists
+	// and defaulted settings share a fingerprint.
+	same := manifest()
+	same.KeySeed = 3
+	same.SharedNodeKeys = true
+	same.GeneratorSeed = 4
+	same.ABCIProtocol = string(ProtocolBuiltin)
+	same.Nodes["validator01"].Perturb = []string{"pause", "kill"}
+	same.Nodes["validator01"].PrometheusPort = 7001
+	same.Nodes["validator01"].PrivvalProtocol = string(ProtocolFile)
+	same.Nodes["validator02"].Mode = ""
+	same.Nodes["validator02"].PersistentPeers = []string{"full01", "validator01"}
+	same.Nodes["full01"].KeyType = "secp256k1"
+	same.Nodes["light01"].PersistentPeers = []string{"validator01", "full01", "validator02"}
+	assert.Equal(t, base, same.Fingerprint())
+
+	// Manifests with a different shape don't.
+	for name, change := range map[string]func(m *Manifest){
+		"abci protocol": func(m *Manifest) { m.ABCIProtocol = string(ProtocolGRPC) },
+		"version":       func(m *Manifest) { m.Nodes["validator01"].Version = "v0.38.0" },
+		"mode":          func(m *Manifest) { m.Nodes["full01"].Mode = "validator" },
+		"privval":       func(m *Manifest) { m.Nodes["validator02"].PrivvalProtocol = "tcp" },
+		"perturbation":  func(m *Manifest) { m.Nodes["validator01"].Perturb = []string{"kill"} },
+		"seed":          func(m *Manifest) { m.Nodes["full01"].Seeds = nil },
+		"edge":          func(m *Manifest) { m.Nodes["validator02"].PersistentPeers = []string{"validator01"} },
+		"primary": func(m *Manifest) {
+			m.Nodes["light01"].PersistentPeers = []string{"full01", "validator01", "validator02"}
+		},
+		"node": func(m *Manifest) { m.Nodes["full02"] = &ManifestNode{Mode: "full"} },
+	} {
+		other := manifest()
+		change(&other)
+		assert.NotEqual(t, base, other.Fingerprint(), name)
+	}
+}
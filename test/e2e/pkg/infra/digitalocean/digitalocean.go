@@ -76,6 +76,15 @@ func (p Provider) Reconnect(ctx context.Context, _ string, ip string) error {
 	return execAnsible(ctx, p.Testnet.Dir, playbookFile, []string{ip})
 }
 
+func (p Provider) ThrottleDisk(ctx context.Context, _ string, ip string, bandwidth uint64) error {
+	playbook := ansibleThrottleDiskBytes(bandwidth)
+	playbookFile := getNextPlaybookFilename()
+	if err := p.writePlaybook(playbookFile, playbook); err != nil {
+		return err
+	}
+	return execAnsible(ctx, p.Testnet.Dir, playbookFile, []string{ip})
+}
+
 func (p Provider) CheckUpgraded(_ context.Context, node *e2e.Node) (string, bool, error) {
 	// Upgrade not supported yet by DO provider
 	return node.Name, false, nil
@@ -146,6 +155,17 @@ func ansiblePerturbConnectionBytes(disconnect bool) string {
 	return playbook
 }
 
+// ansibleThrottleDiskBytes generates an Ansible playbook limiting the disk
+// bandwidth of the node's systemd unit, or removing the limit if 0.
+func ansibleThrottleDiskBytes(bandwidth uint64) string {
+	limit := ""
+	if bandwidth > 0 {
+		limit = fmt.Sprintf("'/ %d'", bandwidth)
+	}
+	return ansibleAddShellTasks(basePlaybook, "throttle disk",
+		fmt.Sprintf("systemctl set-property --runtime testappd IOReadBandwidthMax=%s IOWriteBandwidthMax=%s", limit, limit))
+}
+
 // ExecCompose runs a Docker Compose command for a testnet.
 func execAnsible(ctx context.Context, dir, playbook string, nodeIPs []string, args ...string) error {
 	playbook = filepath.Join(dir, playbook)
@@ -3,8 +3,10 @@ package docker
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"text/template"
 
 	e2e "github.com/cometbft/cometbft/test/e2e/pkg"
@@ -53,6 +55,49 @@ func (p Provider) Reconnect(ctx context.Context, name string, _ string) error {
 	return Exec(ctx, "network", "connect", p.Testnet.Name+"_"+p.Testnet.Name, name)
 }
 
+// diskDeviceScript prints the major:minor number of the disk backing a node's
+// data directory, resolving partitions to their disk since cgroup I/O limits
+// only apply to whole disks.
+const diskDeviceScript = `dev=$(stat -c %Hd:%Ld /cometbft)
+if [ -e /sys/dev/block/$dev/partition ]; then dev=$(cat /sys/dev/block/$dev/../dev); fi
+echo $dev`
+
+// ThrottleDisk sets the io.max limit of the container's cgroup for the disk
+// backing the node's data directory. This requires cgroup v2, and write
+// access to the host's cgroup filesystem, e.g. running as root.
+func (p Provider) ThrottleDisk(ctx context.Context, name string, _ string, bandwidth uint64) error {
+	out, err := exec.CommandOutput(ctx, "docker", "inspect", "-f", "{{ .Id }}", name)
+	if err != nil {
+		return err
+	}
+	id := strings.TrimSpace(string(out))
+	out, err = exec.CommandOutput(ctx, "docker", "exec", name, "sh", "-c", diskDeviceScript)
+	if err != nil {
+		return err
+	}
+	device := strings.TrimSpace(string(out))
+
+	limit := "rbps=max wbps=max"
+	if bandwidth > 0 {
+		limit = fmt.Sprintf("rbps=%d wbps=%d", bandwidth, bandwidth)
+	}
+	// The container's cgroup depends on Docker's cgroup driver.
+	for _, cgroup := range []string{"system.slice/docker-" + id + ".scope", "docker/" + id} {
+		ioMax := filepath.Join("/sys/fs/cgroup", cgroup, "io.max")
+		if _, err := os.Stat(ioMax); err != nil {
+			continue
+		}
+		//nolint: gosec
+		// G306: Expect WriteFile permissions to be 0600 or less
+		if err := os.WriteFile(ioMax, []byte(device+" "+limit+"\n"), 0o644); err != nil {
+			return fmt.Errorf("failed to throttle the disk of container %v, which requires "+
+				"root and a writable cgroup filesystem on the Docker host: %w", name, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("no cgroup v2 io.max file found for container %v", name)
+}
+
 func (p Provider) CheckUpgraded(ctx context.Context, node *e2e.Node) (string, bool, error) {
 	testnet := node.Testnet
 	out, err := ExecComposeOutput(ctx, testnet.Dir, "ps", "-q", node.Name)
@@ -78,13 +123,16 @@ networks:
     labels:
       e2e: true
     driver: bridge
-{{- if .IPv6 }}
+{{- if or .IPv6 .IPv6Net }}
     enable_ipv6: true
 {{- end }}
     ipam:
       driver: default
       config:
       - subnet: {{ .IP }}
+{{- if .IPv6Net }}
+      - subnet: {{ .IPv6Net }}
+{{- end }}
 
 services:
 {{- range .Nodes }}
@@ -95,6 +143,13 @@ services:
     image: {{ .Version }}
 {{- if or (eq .ABCIProtocol "builtin") (eq .ABCIProtocol "builtin_connsync") }}
     entrypoint: /usr/bin/entrypoint-builtin
+{{- else if ne $.ABCIApp "kvstore" }}
+    environment:
+    - ABCI_APP=/usr/bin/{{ $.ABCIApp }}
+{{- end }}
+{{- if or .EmulatesLatency .BehindNAT }}
+    cap_add:
+    - NET_ADMIN
 {{- end }}
     init: true
     ports:
@@ -103,7 +158,7 @@ services:
 {{- if .PrometheusProxyPort }}
     - {{ .PrometheusProxyPort }}:26660
 {{- end }}
-    - 6060
+    - {{ if .PprofProxyPort }}{{ .PprofProxyPort }}:{{ end }}6060
     - 2345
     - 2346
     volumes:
@@ -112,6 +167,9 @@ services:
     networks:
       {{ $.Name }}:
         ipv{{ if $.IPv6 }}6{{ else }}4{{ end}}_address: {{ .InternalIP }}
+{{- if .InternalIPv6 }}
+        ipv6_address: {{ .InternalIPv6 }}
+{{- end }}
 {{- if ne .Version $.UpgradeVersion}}
 
   {{ .Name }}_u:
@@ -121,6 +179,13 @@ services:
     image: {{ $.UpgradeVersion }}
 {{- if or (eq .ABCIProtocol "builtin") (eq .ABCIProtocol "builtin_connsync") }}
     entrypoint: /usr/bin/entrypoint-builtin
+{{- else if ne $.ABCIApp "kvstore" }}
+    environment:
+    - ABCI_APP=/usr/bin/{{ $.ABCIApp }}
+{{- end }}
+{{- if or .EmulatesLatency .BehindNAT }}
+    cap_add:
+    - NET_ADMIN
 {{- end }}
     init: true
     ports:
@@ -129,7 +194,7 @@ services:
 {{- if .PrometheusProxyPort }}
     - {{ .PrometheusProxyPort }}:26660
 {{- end }}
-    - 6060
+    - {{ if .PprofProxyPort }}{{ .PprofProxyPort }}:{{ end }}6060
     - 2345
     - 2346
     volumes:
@@ -138,6 +203,9 @@ services:
     networks:
       {{ $.Name }}:
         ipv{{ if $.IPv6 }}6{{ else }}4{{ end}}_address: {{ .InternalIP }}
+{{- if .InternalIPv6 }}
+        ipv6_address: {{ .InternalIPv6 }}
+{{- end }}
 {{- end }}
 
 {{end}}`)
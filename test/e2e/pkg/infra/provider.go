@@ -29,6 +29,10 @@ type Provider interface {
 	// This should only be called after Disconnect
 	Reconnect(context.Context, string, string) error
 
+	// Limits the read and write bandwidth of the node's disk to the given
+	// number of bytes per second, or removes the limit if it is 0.
+	ThrottleDisk(context.Context, string, string, uint64) error
+
 	// Returns the the provider's infrastructure data
 	GetInfrastructureData() *e2e.InfrastructureData
 
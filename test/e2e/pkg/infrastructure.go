@@ -34,6 +34,11 @@ type InfrastructureData struct {
 	// Network is the CIDR notation range of IP addresses that all of the instances'
 	// IP addresses are expected to be within.
 	Network string `json:"network"`
+
+	// IPv6Network is the CIDR notation range of the instances' IPv6 addresses
+	// in dual-stack testnets, in which case Network is the IPv4 range. Empty
+	// for single-stack testnets.
+	IPv6Network string `json:"ipv6_network,omitempty"`
 }
 
 // InstanceData contains the relevant information for a machine instance backing
@@ -42,6 +47,9 @@ type InstanceData struct {
 	IPAddress    net.IP `json:"ip_address"`
 	ExtIPAddress net.IP `json:"ext_ip_address"`
 	Port         uint32 `json:"port"`
+
+	// IPv6Address is the instance's IPv6 address in dual-stack testnets.
+	IPv6Address net.IP `json:"ipv6_address,omitempty"`
 }
 
 func sortNodeNames(m Manifest) []string {
@@ -56,7 +64,7 @@ func sortNodeNames(m Manifest) []string {
 
 func NewDockerInfrastructureData(m Manifest) (InfrastructureData, error) {
 	netAddress := dockerIPv4CIDR
-	if m.IPv6 {
+	if m.IPv6 && !m.DualStack() {
 		netAddress = dockerIPv6CIDR
 	}
 	_, ipNet, err := net.ParseCIDR(netAddress)
@@ -71,14 +79,26 @@ func NewDockerInfrastructureData(m Manifest) (InfrastructureData, error) {
 		Instances: make(map[string]InstanceData),
 		Network:   netAddress,
 	}
+	var ipv6Gen *ipGenerator
+	if m.DualStack() {
+		_, ipv6Net, err := net.ParseCIDR(dockerIPv6CIDR)
+		if err != nil {
+			return InfrastructureData{}, fmt.Errorf("invalid IP network address %q: %w", dockerIPv6CIDR, err)
+		}
+		ipv6Gen = newIPGenerator(ipv6Net)
+		ifd.IPv6Network = dockerIPv6CIDR
+	}
 	localHostIP := net.ParseIP("127.0.0.1")
 	for _, name := range sortNodeNames(m) {
-		ifd.Instances[name] = InstanceData{
+		instance := InstanceData{
 			IPAddress:    ipGen.Next(),
 			ExtIPAddress: localHostIP,
 			Port:         portGen.Next(),
 		}
-
+		if ipv6Gen != nil {
+			instance.IPv6Address = ipv6Gen.Next()
+		}
+		ifd.Instances[name] = instance
 	}
 	return ifd, nil
 }
@@ -0,0 +1,94 @@
+package e2e
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// minLoadTxSizeBytes is the smallest transaction size the load generator can
+// produce, since every transaction carries a payload header.
+const minLoadTxSizeBytes = 128
+
+// LoadProfile shapes the transaction load sent to a testnet.
+type LoadProfile struct {
+	// Name describes the profile, e.g. the generator's profile it came from.
+	// It is informational only.
+	Name string `toml:"name"`
+
+	// TxRate is the number of transactions sent per second outside of bursts.
+	TxRate int `toml:"tx_rate"`
+
+	// TxSizes are the transaction sizes in bytes, of which each transaction
+	// uses one at random. Defaults to the testnet's load_tx_size_bytes.
+	TxSizes []int `toml:"tx_sizes"`
+
+	// Bursts is a schedule of rates replayed in order from the start of the
+	// load, and repeated once it ends, e.g. to ramp the load up and down. A
+	// burst with a zero rate pauses the load. Defaults to none, i.e. a
+	// constant rate of TxRate.
+	Bursts []LoadBurst `toml:"bursts"`
+
+	// Overloaded marks testnets whose peak rate is expected to exceed what
+	// the network can commit, e.g. to put the mempool under pressure. Tests
+	// must then not expect every submitted transaction to be committed.
+	Overloaded bool `toml:"overloaded"`
+}
+
+// LoadBurst is a phase of a load profile's burst schedule.
+type LoadBurst struct {
+	Duration time.Duration `toml:"duration"`
+	TxRate   int           `toml:"tx_rate"`
+}
+
+// RateAt returns the number of transactions per second to send the given time
+// after the start of the load.
+func (p LoadProfile) RateAt(elapsed time.Duration) int {
+	var period time.Duration
+	for _, burst := range p.Bursts {
+		period += burst.Duration
+	}
+	if period <= 0 || elapsed < 0 {
+		return p.TxRate
+	}
+	elapsed %= period
+	for _, burst := range p.Bursts {
+		if elapsed < burst.Duration {
+			return burst.TxRate
+		}
+		elapsed -= burst.Duration
+	}
+	return p.TxRate
+}
+
+// PeakRate returns the highest rate of the profile, in transactions per second.
+func (p LoadProfile) PeakRate() int {
+	peak := p.TxRate
+	for _, burst := range p.Bursts {
+		if burst.TxRate > peak {
+			peak = burst.TxRate
+		}
+	}
+	return peak
+}
+
+// Validate validates the load profile.
+func (p LoadProfile) Validate() error {
+	if p.TxRate <= 0 {
+		return errors.New("tx_rate must be positive")
+	}
+	for _, size := range p.TxSizes {
+		if size < minLoadTxSizeBytes {
+			return fmt.Errorf("tx size %v is below the minimum of %v bytes", size, minLoadTxSizeBytes)
+		}
+	}
+	for i, burst := range p.Bursts {
+		if burst.Duration <= 0 {
+			return fmt.Errorf("burst %v has no duration", i)
+		}
+		if burst.TxRate < 0 {
+			return fmt.Errorf("burst %v has a negative tx_rate", i)
+		}
+	}
+	return nil
+}
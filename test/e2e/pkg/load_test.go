@@ -0,0 +1,106 @@
+package e2e
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadProfileRateAt(t *testing.T) {
+	bursty := LoadProfile{TxRate: 10, Bursts: []LoadBurst{
+		{Duration: 10 * time.Second, TxRate: 10},
+		{Duration: 5 * time.Second, TxRate: 100},
+		{Duration: 5 * time.Second, TxRate: 0},
+	}}
+	testCases := []struct {
+		name    string
+		profile LoadProfile
+		elapsed time.Duration
+		expect  int
+	}{
+		{"constant", LoadProfile{TxRate: 10}, time.Minute, 10},
+		{"first burst", bursty, 0, 10},
+		{"second burst", bursty, 12 * time.Second, 100},
+		{"pause", bursty, 19 * time.Second, 0},
+		{"repeated schedule", bursty, 32 * time.Second, 100},
+		{"negative elapsed time", bursty, -time.Second, 10},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expect, tc.profile.RateAt(tc.elapsed))
+		})
+	}
+	assert.Equal(t, 100, bursty.PeakRate())
+}
+
+func TestLoadProfileValidate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		manifest  string
+		expectErr string
+	}{
+		{
+			name: "valid",
+			manifest: `
+[load_profile]
+tx_rate = 10
+tx_sizes = [256, 1024]
+[[load_profile.bursts]]
+duration = "5s"
+tx_rate = 100
+`,
+		},
+		{
+			name: "no rate",
+			manifest: `
+[load_profile]
+tx_sizes = [256]
+`,
+			expectErr: "invalid load profile: tx_rate must be positive",
+		},
+		{
+			name: "tiny transactions",
+			manifest: `
+[load_profile]
+tx_rate = 10
+tx_sizes = [16]
+`,
+			expectErr: "tx size 16 is below the minimum",
+		},
+		{
+			name: "burst without duration",
+			manifest: `
+[load_profile]
+tx_rate = 10
+[[load_profile.bursts]]
+tx_rate = 100
+`,
+			expectErr: "burst 0 has no duration",
+		},
+		{
+			name: "negative burst rate",
+			manifest: `
+[load_profile]
+tx_rate = 10
+[[load_profile.bursts]]
+duration = "5s"
+tx_rate = -1
+`,
+			expectErr: "burst 0 has a negative tx_rate",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testnet, err := loadTestnetTOML(t, tc.manifest+"\n[node.validator01]\n")
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, testnet.LoadProfile)
+			assert.Equal(t, 100, testnet.LoadProfile.PeakRate())
+		})
+	}
+}
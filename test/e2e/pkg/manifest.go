@@ -1,21 +1,44 @@
 package e2e
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"reflect"
 	"time"
 
 	"github.com/BurntSushi/toml"
+
+	"github.com/cometbft/cometbft/config"
 )
 
 // Manifest represents a TOML testnet manifest.
 type Manifest struct {
-	// IPv6 uses IPv6 networking instead of IPv4. Defaults to IPv4.
+	// ChainID is the chain ID of the testnet, set in genesis. It is made of at
+	// most 50 letters, digits, '.', '_' and '-'. Defaults to the name of the
+	// testnet, i.e. the name of the manifest file without its extension,
+	// which also names the Docker network and containers in any case.
+	ChainID string `toml:"chain_id"`
+
+	// IPv6 uses IPv6 networking instead of IPv4. Defaults to IPv4. Ignored
+	// for dual-stack testnets, see ManifestNode.AddressFamily.
 	IPv6 bool `toml:"ipv6"`
 
 	// InitialHeight specifies the initial block height, set in genesis. Defaults to 1.
 	InitialHeight int64 `toml:"initial_height"`
 
+	// GenesisTime specifies the genesis time. Nodes wait for a genesis time
+	// in the future before producing the block at the initial height, while
+	// a genesis time in the past lets them produce it right away. Defaults to
+	// the time the runner sets the testnet up, see GenesisTimeOffset.
+	GenesisTime time.Time `toml:"genesis_time,omitempty"`
+
+	// GenesisTimeOffset sets the genesis time this far from the time the
+	// runner sets the testnet up, so that the manifest doesn't depend on when
+	// it was written. A future offset must be less than
+	// expected_first_block_by. Can't be combined with GenesisTime.
+	GenesisTimeOffset time.Duration `toml:"genesis_time_offset"`
+
 	// InitialState is an initial set of key/value pairs for the application,
 	// set in genesis. Defaults to nothing.
 	InitialState map[string]string `toml:"initial_state"`
@@ -48,10 +71,30 @@ type Manifest struct {
 	// Nodes specifies the network nodes. At least one node must be given.
 	Nodes map[string]*ManifestNode `toml:"node"`
 
+	// BridgeNodes lists the nodes that are the only connection between two
+	// otherwise partitioned clusters of validators. The runner may cut these
+	// to test recovery from a network partition. Defaults to none.
+	BridgeNodes []string `toml:"bridge_nodes"`
+
+	// SeedOnlyDiscovery has nodes discover their peers through seeds only:
+	// nodes other than light clients must not have persistent peers, and
+	// those other than seeds must have seeds, of which there must be at least
+	// one. Defaults to false.
+	SeedOnlyDiscovery bool `toml:"seed_only_discovery"`
+
 	// KeyType sets the curve that will be used by validators.
 	// Options are ed25519 & secp256k1
 	KeyType string `toml:"key_type"`
 
+	// KeySeed, if non-zero, derives the consensus key of every node from this
+	// seed and the node's name alone, so that nodes with the same name have
+	// the same keys in every testnet with the same seed, e.g. to compare the
+	// logs and metrics of several testnets. Otherwise, keys depend on all the
+	// nodes of the testnet. SharedNodeKeys also derives the P2P keys of nodes
+	// this way, and requires KeySeed.
+	KeySeed        int64 `toml:"key_seed"`
+	SharedNodeKeys bool  `toml:"shared_node_keys"`
+
 	// Evidence indicates the amount of evidence that will be injected into the
 	// testnet via the RPC endpoint of a random node. Default is 0
 	Evidence int `toml:"evidence"`
@@ -73,6 +116,18 @@ type Manifest struct {
 	// replicate the same concurrency model locally as the socket client.
 	ABCIProtocol string `toml:"abci_protocol"`
 
+	// ABCIApp is the ABCI application run by the nodes. Defaults to "kvstore",
+	// the test application. Any other value names an application binary in
+	// /usr/bin of the node image, which the entrypoint starts with the
+	// kvstore's app.toml in its place, and which should apply the validator
+	// updates in it. Other applications require the "unix", "tcp" or "grpc"
+	// protocol, since the builtin protocols link the kvstore into the node.
+	//
+	// initial_state and expected_initial_app_hash are specific to the kvstore,
+	// and must not be set for other applications. The tests in the tests
+	// package that query the kvstore's state are skipped for them.
+	ABCIApp string `toml:"abci_app"`
+
 	// Add artificial delays to each of the main ABCI calls to mimic computation time
 	// of the application
 	PrepareProposalDelay time.Duration `toml:"prepare_proposal_delay"`
@@ -81,14 +136,35 @@ type Manifest struct {
 	VoteExtensionDelay   time.Duration `toml:"vote_extension_delay"`
 	FinalizeBlockDelay   time.Duration `toml:"finalize_block_delay"`
 
+	// PrepareProposalJitter and ProcessProposalJitter add a random delay of up
+	// to the given duration to each respective call, on top of the delays
+	// above, so that processing times vary from block to block. Each node
+	// draws its delays from a seed derived from its name, for reproducibility.
+	// Only nodes running the local version apply them. Default to none.
+	PrepareProposalJitter time.Duration `toml:"prepare_proposal_jitter"`
+	ProcessProposalJitter time.Duration `toml:"process_proposal_jitter"`
+
 	// UpgradeVersion specifies to which version nodes need to upgrade.
 	// Currently only uncoordinated upgrade is supported
 	UpgradeVersion string `toml:"upgrade_version"`
 
+	// UpgradeHeight, if set, schedules a coordinated upgrade of the whole
+	// network: once the testnet reaches this height, the runner upgrades
+	// every node not running UpgradeVersion at once, instead of one by one
+	// with the 'upgrade' perturbation. Nodes must then start below this
+	// height unless they already run UpgradeVersion, and must not use the
+	// 'upgrade' perturbation. Defaults to 0, i.e. no coordinated upgrade.
+	UpgradeHeight int64 `toml:"upgrade_height"`
+
 	LoadTxSizeBytes   int `toml:"load_tx_size_bytes"`
 	LoadTxBatchSize   int `toml:"load_tx_batch_size"`
 	LoadTxConnections int `toml:"load_tx_connections"`
 
+	// LoadProfile shapes the transaction load over time, see LoadProfile. If
+	// set, its rate replaces load_tx_batch_size transactions per second.
+	// Defaults to none, i.e. a constant load.
+	LoadProfile *LoadProfile `toml:"load_profile"`
+
 	// Enable or disable Prometheus metrics on all nodes.
 	// Defaults to false (disabled).
 	Prometheus bool `toml:"prometheus"`
@@ -96,8 +172,195 @@ type Manifest struct {
 	// Defines a minimum size for the vote extensions.
 	VoteExtensionSize uint `toml:"vote_extension_size"`
 
+	// MaxGas is the maximum total gas wanted by the transactions of a block,
+	// a consensus parameter set in the genesis. The kvstore wants 1 gas per
+	// transaction. Defaults to 0, i.e. unlimited.
+	MaxGas int64 `toml:"max_gas"`
+
 	// Upper bound of sleep duration then gossipping votes and block parts
 	PeerGossipIntraloopSleepDuration time.Duration `toml:"peer_gossip_intraloop_sleep_duration"`
+
+	// GeneratorSeed is the seed that was used by the testnet generator to
+	// produce this manifest. Passing it back to the generator reproduces the
+	// same set of testnets. Unset for manifests written by hand.
+	GeneratorSeed int64 `toml:"generator_seed"`
+
+	// GeneratorVersion is the Git commit of the generator that produced this
+	// manifest. Unset for manifests written by hand.
+	GeneratorVersion string `toml:"generator_version"`
+
+	// ExpectedInitialAppHash is the hex-encoded app hash the application is
+	// expected to return from InitChain, and thus the app hash of the block at
+	// the initial height. Defaults to none, i.e. not checked.
+	ExpectedInitialAppHash string `toml:"expected_initial_app_hash"`
+
+	// ExpectedFirstBlockBy, if set, is how long the network may take to
+	// produce the block at the initial height once the runner starts the
+	// initial nodes, or once the genesis time is due if it is later.
+	// ExpectedCatchUpBy, if set, is how long the runner may take from that
+	// block on until every node has started and caught up. The runner fails
+	// the testnet if either is exceeded. The generator derives
+	// them from the testnet's size, ABCI delays and start heights. Default to
+	// none, i.e. no deadline beyond the runner's stall detection.
+	ExpectedFirstBlockBy time.Duration `toml:"expected_first_block_by"`
+	ExpectedCatchUpBy    time.Duration `toml:"expected_catch_up_by"`
+
+	// ZoneLatencies specifies the one-way network latency between nodes in
+	// each pair of zones, emulated by the runner with netem. It must contain
+	// symmetric entries for every pair of zones used by nodes, and latencies
+	// within a zone must be lower than latencies to other zones. For example:
+	//
+	// [zone_latencies.us]
+	// us = "5ms"
+	// eu = "40ms"
+	ZoneLatencies map[string]map[string]time.Duration `toml:"zone_latencies"`
+
+	// LinkLatencies degrade single links between peers, in one direction
+	// each, e.g. to reproduce a propagation bug that needs one slow link. For
+	// example:
+	//
+	// [[link_latencies]]
+	// from = "validator01"
+	// to = "validator02"
+	// delay = "200ms"
+	//
+	// Defaults to none.
+	LinkLatencies []LinkLatency `toml:"link_latencies"`
+
+	// Snapshot, if set, has every state syncing node bootstrap from a snapshot
+	// trusting the given block, instead of the block at the initial height.
+	// Defaults to none.
+	Snapshot *ManifestSnapshot `toml:"snapshot"`
+
+	// ArchiveNodes lists nodes that must be archive nodes, i.e. start at
+	// genesis and retain all blocks, as recorded by the generator for the
+	// nodes it forces to be. Defaults to none.
+	ArchiveNodes []string `toml:"archive_nodes"`
+
+	// ArchiveBlackoutHeight, if set, has the runner kill every archive node
+	// of the testnet at once when it reaches this height, and start them
+	// again after ArchiveBlackoutDuration, e.g. to test catching up nodes
+	// whose block and snapshot providers vanish. Archive validators must
+	// hold less than 1/3 of the voting power then, so that the network stays
+	// live. ArchiveBlackoutDuration defaults to DefaultArchiveBlackoutDuration,
+	// and must be below expected_catch_up_by if set.
+	ArchiveBlackoutHeight   int64         `toml:"archive_blackout_height"`
+	ArchiveBlackoutDuration time.Duration `toml:"archive_blackout_duration"`
+
+	// GlobalRestartHeight, if set, has the runner stop every node of the
+	// testnet at once when it reaches this height, and start them all again,
+	// e.g. to test that the network recovers from a rollout restarting all
+	// of its nodes. Every node must have started by then, and every node but
+	// light clients must persist its state, i.e. have a non-zero
+	// persist_interval. Cannot be combined with upgrade_height or
+	// archive_blackout_height.
+	GlobalRestartHeight int64 `toml:"global_restart_height"`
+
+	// ConsensusParams sets the consensus parameters of the genesis that have
+	// no setting of their own. The block limits and the vote extensions
+	// enable height are set with max_block_bytes, max_gas and
+	// vote_extensions_enable_height instead.
+	ConsensusParams ManifestConsensusParams `toml:"consensus_params"`
+
+	// MetricThresholds bounds the Prometheus metrics of the nodes, by metric
+	// name, e.g. cometbft_consensus_block_interval_seconds. The runner scrapes
+	// every node exposing Prometheus metrics while the testnet is under load,
+	// and fails the testnet if any value is out of bounds. Histograms and
+	// summaries are bounded by their mean. Nodes not exporting a metric are
+	// skipped, but some node must export every bounded metric. Defaults to
+	// none, i.e. no metric is checked.
+	MetricThresholds map[string]MetricThreshold `toml:"metric_thresholds"`
+
+	// AssertProposerFairness has the tests check that every validator
+	// proposes its share of the blocks committed after the last change to
+	// the validator set, which requires validators of equal voting power,
+	// so that proposers rotate round-robin, and none of them absent.
+	AssertProposerFairness bool `toml:"assert_proposer_fairness"`
+
+	// ThrottledGossip marks testnets whose nodes' send_rate and recv_rate
+	// are intentionally too low for blocks to propagate within the block
+	// interval, e.g. to stress gossip. Their rates are then not checked
+	// against the expected block size, and the runner waits longer for the
+	// network to make progress before considering it stalled.
+	ThrottledGossip bool `toml:"throttled_gossip"`
+}
+
+// ManifestConsensusParams sets consensus parameters of a testnet's genesis,
+// see Manifest.ConsensusParams.
+type ManifestConsensusParams struct {
+	// EvidenceMaxAgeNumBlocks and EvidenceMaxAgeDuration bound the age of
+	// valid evidence. Nodes pruning blocks must retain at least
+	// EvidenceMaxAgeNumBlocks of them. Default to EvidenceAgeHeight and
+	// EvidenceAgeTime.
+	EvidenceMaxAgeNumBlocks int64         `toml:"evidence_max_age_num_blocks"`
+	EvidenceMaxAgeDuration  time.Duration `toml:"evidence_max_age_duration"`
+}
+
+// MetricThreshold bounds the values of a metric, see
+// Manifest.MetricThresholds. Either bound may be unset.
+type MetricThreshold struct {
+	Min *float64 `toml:"min"`
+	Max *float64 `toml:"max"`
+}
+
+// Check returns an error if the value is out of bounds.
+func (t MetricThreshold) Check(value float64) error {
+	if t.Min != nil && value < *t.Min {
+		return fmt.Errorf("%v is below the minimum of %v", value, *t.Min)
+	}
+	if t.Max != nil && value > *t.Max {
+		return fmt.Errorf("%v is above the maximum of %v", value, *t.Max)
+	}
+	return nil
+}
+
+// ManifestSnapshot describes the block trusted by the state syncing nodes of
+// a testnet, see Manifest.Snapshot. They restore a snapshot taken at or after
+// its height, which must be below the start height of every one of them, so
+// that the network's genesis nodes have produced it by then.
+type ManifestSnapshot struct {
+	// Height is the height of the trusted block.
+	Height int64 `toml:"height"`
+
+	// Hash is the hex-encoded hash of the trusted block, e.g. to bootstrap
+	// from a snapshot supplied from outside the testnet. Defaults to the hash
+	// the archive nodes report for the block at Height once it exists.
+	Hash string `toml:"hash"`
+}
+
+// LinkLatency degrades the link from one node to a peer, emulated by the
+// runner with netem on top of the latency between their zones, see
+// Manifest.LinkLatencies. It only applies to the packets the sending node
+// sends, so the reverse direction needs a link latency of its own. The
+// sending node must run the local version.
+type LinkLatency struct {
+	// From and To are the names of the sending and the receiving node, which
+	// must be peers, i.e. one of them lists the other as a seed or
+	// persistent peer, or they connect by default.
+	From string `toml:"from"`
+	To   string `toml:"to"`
+
+	// Delay is the latency added to the packets of the link, varying by up to
+	// Jitter either way, with Jitter no greater than Delay.
+	Delay  time.Duration `toml:"delay"`
+	Jitter time.Duration `toml:"jitter"`
+
+	// Loss is the percentage of packets of the link dropped, between 0 and
+	// 100. Defaults to none.
+	Loss float64 `toml:"loss"`
+}
+
+// ManifestRPCConfig toggles features of a node's RPC server, see
+// ManifestNode.RPCConfig.
+type ManifestRPCConfig struct {
+	// Unsafe enables the unsafe RPC methods, e.g. /dial_peers and
+	// /unsafe_flush_mempool. Defaults to false.
+	Unsafe bool `toml:"unsafe"`
+
+	// MaxSubscriptionsPerClient is the number of queries a websocket client
+	// can subscribe to, where 0 disables subscriptions. Defaults to the
+	// CometBFT default of 5.
+	MaxSubscriptionsPerClient *int `toml:"max_subscriptions_per_client"`
 }
 
 // ManifestNode represents a node in a testnet manifest.
@@ -120,9 +383,57 @@ type ManifestNode struct {
 	// PersistentPeers is a list of node names to maintain persistent P2P
 	// connections to. If neither seeds nor persistent peers are specified,
 	// this defaults to all other nodes in the network. For light clients,
-	// this relates to the providers the light client is connected to.
+	// this relates to the providers the light client is connected to, where
+	// the first one is the primary.
 	PersistentPeers []string `toml:"persistent_peers"`
 
+	// StartupBackoff caps the pause between the redials of the node's
+	// persistent peers, i.e. the p2p persistent_peers_max_dial_period.
+	// Defaults to 0, i.e. CometBFT's unbounded exponential backoff.
+	StartupBackoff time.Duration `toml:"startup_backoff"`
+
+	// MaxDialRetries, if set, has the runner fail the testnet unless the
+	// node connects to a peer within that many startup_backoff pauses of
+	// starting, e.g. to test the dial path when many nodes start together.
+	// Requires startup_backoff, and a node with seeds or persistent peers to
+	// dial. The pauses must add up to less than expected_catch_up_by if set.
+	// Defaults to 0, i.e. not checked.
+	MaxDialRetries int `toml:"max_dial_retries"`
+
+	// MaxInboundPeers and MaxOutboundPeers limit the P2P connections the node
+	// accepts and dials, i.e. the p2p max_num_inbound_peers and
+	// max_num_outbound_peers. The outbound limit must cover the node's seeds
+	// and persistent peers, and the inbound limit the other nodes listing it
+	// as a persistent peer, including the implicit ones. Connections to seeds
+	// are short-lived, so nodes may contend for the inbound slots of a seed.
+	// Don't apply to light clients. Default to 0, i.e. the CometBFT defaults.
+	MaxInboundPeers  int `toml:"max_inbound_peers"`
+	MaxOutboundPeers int `toml:"max_outbound_peers"`
+
+	// Witnesses is a list of additional providers a light client cross-checks
+	// the primary against, and must not contain the primary. Only applies to
+	// light clients.
+	Witnesses []string `toml:"witnesses"`
+
+	// TrustPeriod is the light client's trusting period. Defaults to the
+	// CometBFT default. Only applies to light clients.
+	TrustPeriod time.Duration `toml:"trust_period"`
+
+	// TrustHeight is the height of the block a light client initially trusts.
+	// Must be between the initial height and the node's start height. Defaults
+	// to the initial height. Only applies to light clients.
+	TrustHeight int64 `toml:"trust_height"`
+
+	// KeyType sets the curve used by this node's consensus key: "ed25519" or
+	// "secp256k1". Defaults to the testnet-wide key_type. Validators with
+	// different key types can only be mixed if all nodes run the local version.
+	KeyType string `toml:"key_type"`
+
+	// NodeKeyType sets the curve used by this node's P2P key, independently of
+	// its consensus key. Defaults to "ed25519", which is currently the only
+	// type supported by P2P secret connections in any CometBFT version.
+	NodeKeyType string `toml:"node_key_type"`
+
 	// Database specifies the database backend: "goleveldb", "cleveldb",
 	// "rocksdb", "boltdb", or "badgerdb". Defaults to goleveldb.
 	Database string `toml:"database"`
@@ -135,10 +446,22 @@ type ManifestNode struct {
 
 	// StartAt specifies the block height at which the node will be started. The
 	// runner will wait for the network to reach at least this block height.
+	// Validators with StartAt set to -1 (StartAtNever) are never started, but
+	// remain in the validator set, and must hold less than 1/3 of its power.
 	StartAt int64 `toml:"start_at"`
 
+	// PromoteAt, if set, has a full node join the validator set at this
+	// height, through a validator update of its own at the same height, after
+	// having run as a non-voting observer since it started, which must be
+	// before. It signs with the file privval protocol once it is a validator.
+	// The validators promoted at a height must hold less than 1/3 of the
+	// voting power, so that the others stay live while they start voting.
+	// Defaults to 0, i.e. never promoted.
+	PromoteAt int64 `toml:"promote_at"`
+
 	// BlockSyncVersion specifies which version of Block Sync to use (currently
-	// only "v0", the default value).
+	// only "v0", the default value). Nodes refuse to start with the removed
+	// "v1" and "v2" reactors.
 	BlockSyncVersion string `toml:"block_sync_version"`
 
 	// StateSync enables state sync. The runner automatically configures trusted
@@ -156,11 +479,114 @@ type ManifestNode struct {
 	// will take state sync snapshots. Defaults to 0 (disabled).
 	SnapshotInterval uint64 `toml:"snapshot_interval"`
 
+	// SnapshotFormat specifies the format of the state sync snapshots taken by
+	// the application. State syncing nodes only accept snapshots of their own
+	// format, so at least one other node must take snapshots of the same
+	// format. Defaults to 1, which is the only format supported by nodes not
+	// running the local version.
+	SnapshotFormat uint32 `toml:"snapshot_format"`
+
+	// SnapshotChunkSize specifies the size in bytes of the chunks state sync
+	// snapshots are split into. Defaults to 1MB. Only supported by nodes
+	// running the local version.
+	SnapshotChunkSize uint64 `toml:"snapshot_chunk_size"`
+
 	// RetainBlocks specifies the number of recent blocks to retain. Defaults to
 	// 0, which retains all blocks. Must be greater that PersistInterval,
-	// SnapshotInterval and EvidenceAgeHeight.
+	// SnapshotInterval and the evidence max age, see ConsensusParams.
 	RetainBlocks uint64 `toml:"retain_blocks"`
 
+	// ShortRetention lets a validator or full node retain fewer blocks than
+	// the evidence max age, down to its persist and snapshot intervals, so
+	// that evidence may refer to blocks it has pruned. CometBFT keeps the
+	// headers, commits and validator sets of those blocks when pruning, so
+	// the node is expected to keep verifying such evidence, and to at most
+	// fail to serve the pruned blocks, but never to crash or halt. The runner
+	// never injects evidence through it, and such validators must hold less
+	// than 1/3 of the voting power, so that they are never the only ones
+	// verifying evidence. Requires retain_blocks.
+	ShortRetention bool `toml:"short_retention"`
+
+	// MempoolCacheSize is the number of recently seen transactions the
+	// mempool caches to reject duplicates early, where 0 disables the cache.
+	// MempoolRecheck rechecks the transactions left in the mempool after
+	// every block. Neither applies to light clients. Default to the CometBFT
+	// defaults, i.e. a cache of 10000 transactions and rechecking.
+	MempoolCacheSize *int  `toml:"mempool_cache_size"`
+	MempoolRecheck   *bool `toml:"mempool_recheck"`
+
+	// WALEnabled has the node keep its consensus WAL across restarts. CometBFT
+	// cannot run without the WAL, so a node without one has it discarded by
+	// its entrypoint whenever it starts, replaying nothing after a crash.
+	// Doesn't apply to light clients. Defaults to true.
+	WALEnabled *bool `toml:"wal_enabled"`
+
+	// RPCConfig toggles features of the node's RPC server. Doesn't apply to
+	// light clients. At least one validator or full node must keep websocket
+	// subscriptions enabled. Defaults to the CometBFT defaults.
+	RPCConfig ManifestRPCConfig `toml:"rpc_config"`
+
+	// AddressFamily specifies how the node reaches its peers: "ipv4", "ipv6" or
+	// "dual". Setting it on any node makes the testnet dual-stack, i.e. every
+	// node gets both an IPv4 and an IPv6 address, but only advertises and
+	// dials addresses of its own families. Every seed, persistent peer and
+	// witness of a node must share an address family with it, and nodes
+	// without seeds or persistent peers only connect to the nodes they share
+	// an address family with. Defaults to the family of the testnet's network.
+	AddressFamily string `toml:"address_family"`
+
+	// Zone is the geographic zone of the node, used to look up the latency to
+	// other nodes in the testnet's zone_latencies. Defaults to none, i.e. no
+	// emulated latency. Only supported by nodes running the local version,
+	// since older images don't emulate latency.
+	Zone string `toml:"zone"`
+
+	// BehindNAT puts the node behind an emulated NAT: it dials out to its
+	// peers as usual, but drops inbound P2P connections, so that the address
+	// it advertises is unreachable. At least one of its seeds or persistent
+	// peers must not be behind NAT. Seeds, bridge nodes and light clients
+	// must remain directly reachable. Only supported by nodes running the
+	// local version, since older images don't emulate NAT.
+	BehindNAT bool `toml:"behind_nat"`
+
+	// ExternalAddress overrides the P2P address advertised by the node, as
+	// host:port, e.g. to test peers learning an address that differs from
+	// the one the node listens on. Defaults to the node's own address. Can't
+	// be set on nodes behind NAT, which have no reachable address.
+	ExternalAddress string `toml:"external_address"`
+
+	// SentryFor makes this full node a sentry of the given validator, which
+	// then only peers with its sentries: its persistent peers default to
+	// them, it doesn't run the PEX reactor, and its sentries don't gossip its
+	// address. No other node can peer with the validator directly.
+	SentryFor string `toml:"sentry_for"`
+
+	// Misbehaviors sets how a validator misbehaves, as a map of heights to
+	// misbehaviors. The node itself keeps behaving correctly: once each height
+	// is committed, the runner forges duplicate vote evidence by signing
+	// conflicting votes with the validator's key, and broadcasts it, see
+	// InjectMisbehaviors in the runner. The evidence thus exercises evidence
+	// handling, not the detection of misbehaving peers by nodes:
+	//
+	// double-prevote:   signs two prevotes for different blocks
+	// double-precommit: signs two precommits for different blocks
+	//
+	// The misbehaving validators must hold less than 1/3 of the voting power.
+	// Only applies to validators.
+	Misbehaviors map[string]string `toml:"misbehaviors"`
+
+	// KeyRotations has a validator swap its consensus key mid-run, as a map
+	// of heights to the IDs of its new keys, which are derived from the node's
+	// name and the ID. Each rotation must be matched by a validator update of
+	// the node at the same height, which then removes its previous key from the
+	// validator set and adds the new one with the updated power. The runner
+	// swaps the key of the node once the update is committed, restarting it.
+	// The rotating validators must hold less than 1/3 of the voting power, and
+	// use the file privval protocol. Only applies to validators without
+	// misbehaviors, and cannot be combined with upgrade_height,
+	// archive_blackout_height or global_restart_height.
+	KeyRotations map[string]string `toml:"key_rotations"`
+
 	// Perturb lists perturbations to apply to the node after it has been
 	// started and synced with the network:
 	//
@@ -168,21 +594,374 @@ type ManifestNode struct {
 	// kill:       kills the node with SIGKILL then restarts it
 	// pause:      temporarily pauses (freezes) the node
 	// restart:    restarts the node, shutting it down with SIGTERM
+	// skew:       temporarily shifts the node's vote timestamps further by a few seconds
+	// throttle_disk: temporarily limits the node's disk bandwidth to disk_bandwidth
+	// corrupt_db: destroys the node's databases, keeping its privval state,
+	//             then restarts it to recover with recovery_mode
+	// privval_disconnect: temporarily disconnects the node's remote signer,
+	//             only for validators with a tcp or unix privval_protocol.
+	//             They must hold less than 1/3 of the voting power.
+	// flap:       repeatedly disconnects the node from the network and
+	//             reconnects it every flap_interval blocks. Flapping
+	//             validators must hold less than 1/3 of the voting power.
+	// wal_truncate: kills the node with SIGKILL, truncates the tail of its
+	//             consensus WAL as a crash mid-write would, then restarts
+	//             it to repair the WAL. Only for validators with wal_enabled,
+	//             which must hold less than 1/3 of the voting power.
 	Perturb []string `toml:"perturb"`
 
+	// RecoveryMode is how the node recovers from a corrupt_db perturbation,
+	// and is required by it: "blocksync" replays the chain from the other
+	// archive nodes, and "statesync" restores a snapshot, which requires
+	// snapshot providers and two other archive nodes as RPC servers. A node
+	// recovering with state sync is not an archive node.
+	RecoveryMode string `toml:"recovery_mode"`
+
+	// AssertReplayConsistency has the runner check, every time the node
+	// recovers from a kill or restart perturbation, that the app hash its
+	// application reports for its last block matches the one the network
+	// committed, i.e. that it replayed its blocks consistently. Only for full
+	// nodes with the builtin_connsync ABCI protocol, whose unsynchronized
+	// connections replay differently, and with both perturbations.
+	AssertReplayConsistency bool `toml:"assert_replay_consistency"`
+
+	// DiskBandwidth is the read and write bandwidth in bytes per second the
+	// node's disk is limited to during throttle_disk perturbations, using
+	// cgroup I/O limits. Required by throttle_disk. Genesis validators with
+	// throttled disks must hold less than 1/3 of the voting power. With the
+	// Docker provider, the runner must run as root on the Docker host.
+	DiskBandwidth uint64 `toml:"disk_bandwidth"`
+
+	// SendRate and RecvRate limit the rate in bytes per second at which the
+	// node sends to and receives from each of its peers, i.e. how fast it
+	// gossips transactions, block parts and votes. Unless the testnet sets
+	// throttled_gossip, they must let blocks of the expected size propagate
+	// within the block interval, see Testnet.MinGossipRate. Default to 0,
+	// i.e. the CometBFT defaults, which don't limit the e2e load.
+	SendRate int64 `toml:"send_rate"`
+	RecvRate int64 `toml:"recv_rate"`
+
+	// FlapInterval is the number of blocks a node stays connected, and then
+	// disconnected, during flap perturbations. Required by flap, and must be
+	// between MinFlapInterval and MaxFlapInterval.
+	FlapInterval int64 `toml:"flap_interval"`
+
+	// ClockSkew offsets the node's clock from the host clock. CometBFT itself
+	// reads the host clock, so the offset is only applied to the timestamps of
+	// the votes the node signs, from which block times are derived. It thus
+	// requires a validator, or a node promoted to one, running a builtin ABCI
+	// protocol. May be negative, but its magnitude must not exceed
+	// MaxClockSkew. Defaults to 0, i.e. no skew.
+	ClockSkew time.Duration `toml:"clock_skew"`
+
+	// TimeoutPropose and TimeoutCommit override the node's consensus timeouts.
+	// Validators may use different values, e.g. to have a minority run with
+	// aggressive timeouts. Must not exceed MaxConsensusTimeout. Default to the
+	// CometBFT defaults.
+	TimeoutPropose time.Duration `toml:"timeout_propose"`
+	TimeoutCommit  time.Duration `toml:"timeout_commit"`
+
+	// VoteExtensionDelay overrides the testnet-wide vote_extension_delay for
+	// this node, e.g. to simulate a validator that is slow to extend and
+	// verify vote extensions. Defaults to the testnet-wide value.
+	VoteExtensionDelay time.Duration `toml:"vote_extension_delay"`
+
+	// MaxBlockBytes is the maximum size of a block in bytes. It is a consensus
+	// parameter set in the genesis, and thus shared by the whole network: all
+	// validators must set the same value, and other nodes must either set it
+	// too or leave it unset. Blocks must have room for a commit of every
+	// validator, evidence of up to MaxEvidenceBytes, and the largest load
+	// transaction. Defaults to the CometBFT default.
+	MaxBlockBytes int64 `toml:"max_block_bytes"`
+
+	// AppConfig sets feature toggles of the kvstore application run by the
+	// node, e.g. vote_extensions = "omit" to have a validator extend its votes
+	// with empty extensions. See app.AppConfigToggles for the toggles and
+	// their values. Toggles affecting consensus must be set such that the
+	// network can still reach it. Requires the local version.
+	AppConfig map[string]string `toml:"app_config"`
+
+	// EnablePrometheus and EnablePprof expose the node's Prometheus metrics
+	// and pprof endpoints on the host, e.g. for post-mortem debugging. The
+	// testnet-wide prometheus setting enables Prometheus on all nodes.
+	EnablePrometheus bool `toml:"enable_prometheus"`
+	EnablePprof      bool `toml:"enable_pprof"`
+
+	// PrometheusPort and PprofPort are the host ports the node's Prometheus
+	// and pprof endpoints are exposed on, and require the respective endpoint
+	// to be enabled. They must be unique across the testnet and not collide
+	// with the nodes' RPC ports. Default to ports allocated from
+	// PrometheusProxyPortFirst and PprofProxyPortFirst respectively.
+	PrometheusPort uint32 `toml:"prometheus_port"`
+	PprofPort      uint32 `toml:"pprof_port"`
+
 	// SendNoLoad determines if the e2e test should send load to this node.
 	// It defaults to false so unless the configured, the node will
 	// receive load.
 	SendNoLoad bool `toml:"send_no_load"`
+
+	// LoadWeight is the node's share of the transaction load relative to the
+	// other nodes receiving load, e.g. a node with weight 3 receives about
+	// three times as many transactions as a node with weight 1, over three
+	// times as many connections. Defaults to 1, i.e. the load is spread
+	// evenly. Must be unset with send_no_load.
+	LoadWeight int `toml:"load_weight"`
 }
 
-// Save saves the testnet manifest to a file.
+// DualStack returns whether the testnet uses both IPv4 and IPv6 networking,
+// i.e. whether any node has an address family set.
+func (m Manifest) DualStack() bool {
+	for _, node := range m.Nodes {
+		if node != nil && node.AddressFamily != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the manifest for problems in the testnet topology that the
+// testnet validation can't detect once defaults have been applied. Currently,
+// it checks that nodes only refer to other nodes of the manifest, see
+// validatePeerReferences, that every non-seed node with seeds or persistent
+// peers has at least one of them starting no later than itself, and not
+// absent, as it would otherwise be unable to reach anyone when it starts, and that every state
+// syncing node has a snapshot to restore, see validateStateSyncPath.
+func (m Manifest) Validate() error {
+	if err := m.validatePeerReferences(); err != nil {
+		return err
+	}
+	startHeight := func(node *ManifestNode) int64 {
+		if node.StartAt < m.InitialHeight {
+			return m.InitialHeight
+		}
+		return node.StartAt
+	}
+	for _, name := range sortNodeNames(m) {
+		node := m.Nodes[name]
+		if node == nil || node.Mode == string(ModeSeed) || node.StartAt == StartAtNever ||
+			len(node.Seeds)+len(node.PersistentPeers) == 0 {
+			continue
+		}
+		reachable := false
+		for _, peerName := range append(append([]string{}, node.Seeds...), node.PersistentPeers...) {
+			peer, ok := m.Nodes[peerName]
+			if !ok || (peer != nil && peer.StartAt != StartAtNever && startHeight(peer) <= startHeight(node)) {
+				reachable = true
+				break
+			}
+		}
+		if !reachable {
+			return fmt.Errorf("all seeds and persistent peers of node %q start after it at height %v, "+
+				"or never start", name, startHeight(node))
+		}
+	}
+	if err := m.validateStateSyncPath(); err != nil {
+		return err
+	}
+	if m.SharedNodeKeys && m.KeySeed == 0 {
+		return errors.New("shared_node_keys requires a key_seed")
+	}
+	return m.validateInitialQuorum()
+}
+
+// validatePeerReferences checks that the seeds, persistent peers and witnesses
+// of every node, which are the providers of light clients, name other nodes of
+// the manifest. Hand-edited manifests easily have a node list itself, or a
+// node that was renamed or removed.
+func (m Manifest) validatePeerReferences() error {
+	for _, name := range sortNodeNames(m) {
+		node := m.Nodes[name]
+		if node == nil {
+			continue
+		}
+		peersField := "persistent_peers"
+		if node.Mode == string(ModeLight) {
+			peersField = "providers (persistent_peers)"
+		}
+		for _, refs := range []struct {
+			field string
+			names []string
+		}{
+			{"seeds", node.Seeds},
+			{peersField, node.PersistentPeers},
+			{"witnesses", node.Witnesses},
+		} {
+			for _, ref := range refs.names {
+				if ref == name {
+					return fmt.Errorf("node %q lists itself in its %v", name, refs.field)
+				}
+				if _, ok := m.Nodes[ref]; !ok {
+					return fmt.Errorf("node %q lists unknown node %q in its %v", name, ref, refs.field)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// validateStateSyncPath checks that every state syncing node has a snapshot
+// to restore when it starts, see StateSyncSources. Otherwise, state sync never
+// completes.
+func (m Manifest) validateStateSyncPath() error {
+	for _, name := range sortNodeNames(m) {
+		node := m.Nodes[name]
+		if node == nil || !node.StateSync || len(m.StateSyncSources(name)) > 0 {
+			continue
+		}
+		return fmt.Errorf("state syncing node %q has no snapshot to restore when it starts at height %v: "+
+			"another validator or full node must start and take a snapshot by then (snapshot_interval > 0), "+
+			"and retain the blocks from its height on (retain_blocks of 0, or at least snapshot_interval)",
+			name, max(node.StartAt, m.InitialHeight, 1))
+	}
+	return nil
+}
+
+// StateSyncSources returns the names of the validators and full nodes that
+// the given node can restore a snapshot from when it starts. Such a node takes
+// snapshots every snapshot_interval heights, so it must have started by the
+// height of the last snapshot before the given node starts, and still retain
+// the blocks from that height on, which the snapshot is verified with.
+func (m Manifest) StateSyncSources(name string) []string {
+	initialHeight := max(m.InitialHeight, 1)
+	startAt := initialHeight
+	if node := m.Nodes[name]; node != nil {
+		startAt = max(node.StartAt, initialHeight)
+	}
+	sources := []string{}
+	for _, peerName := range sortNodeNames(m) {
+		peer := m.Nodes[peerName]
+		if peerName == name || peer == nil || peer.Mode == string(ModeSeed) || peer.Mode == string(ModeLight) ||
+			peer.SnapshotInterval == 0 {
+			continue
+		}
+		interval := int64(peer.SnapshotInterval)
+		snapshotHeight := startAt / interval * interval
+		if snapshotHeight < max(peer.StartAt, initialHeight) {
+			continue
+		}
+		if peer.RetainBlocks > 0 && startAt-int64(peer.RetainBlocks) >= snapshotHeight {
+			continue
+		}
+		sources = append(sources, peerName)
+	}
+	return sources
+}
+
+// BlockInterval estimates the time it takes the testnet to produce a block:
+// the longest commit timeout of any validator, since validators with a longer
+// commit timeout slow down the whole network, plus the ABCI delays and jitters
+// on the path of every block.
+func (m Manifest) BlockInterval() time.Duration {
+	commit := config.DefaultConsensusConfig().TimeoutCommit
+	for _, node := range m.Nodes {
+		if node != nil && (node.Mode == string(ModeValidator) || node.Mode == "") {
+			commit = max(commit, node.TimeoutCommit)
+		}
+	}
+	return commit + m.PrepareProposalDelay + m.ProcessProposalDelay + m.FinalizeBlockDelay +
+		m.PrepareProposalJitter + m.ProcessProposalJitter
+}
+
+// MinGossipRate returns the lowest send_rate and recv_rate the testnet's
+// nodes may have unless it sets throttled_gossip, using the defaults of unset
+// load settings, see Testnet.MinGossipRate.
+func (m Manifest) MinGossipRate() int64 {
+	rate, txSize := m.LoadTxBatchSize, m.LoadTxSizeBytes
+	if rate == 0 {
+		rate = DefaultLoadTxBatchSize
+	}
+	if txSize == 0 {
+		txSize = defaultTxSizeBytes
+	}
+	if m.LoadProfile != nil {
+		rate = m.LoadProfile.PeakRate()
+		for _, size := range m.LoadProfile.TxSizes {
+			txSize = max(txSize, size)
+		}
+	}
+	var maxBlockBytes int64
+	for _, node := range m.Nodes {
+		if node != nil {
+			maxBlockBytes = max(maxBlockBytes, node.MaxBlockBytes)
+		}
+	}
+	interval := m.BlockInterval()
+	return minGossipRate(expectedBlockBytes(rate, txSize, maxBlockBytes, interval), interval)
+}
+
+// ExpectedHeightAt estimates the height of the chain head the given time after
+// the initial validators start producing blocks, one every BlockInterval. The
+// block at the initial height is committed one interval in, so the head is
+// just below the initial height until then.
+func (m Manifest) ExpectedHeightAt(elapsed time.Duration) int64 {
+	head := max(m.InitialHeight, 1) - 1
+	if elapsed <= 0 {
+		return head
+	}
+	return head + int64(elapsed/m.BlockInterval())
+}
+
+// validateInitialQuorum checks that the validators starting at the initial
+// height hold more than 2/3 of the initial voting power, so that the chain
+// can start. The initial validator set is made of the genesis validators,
+// which default to all validator nodes, updated by the InitChain validator
+// updates at height 0.
+func (m Manifest) validateInitialQuorum() error {
+	initialHeight := max(m.InitialHeight, 1)
+	powers := map[string]int64{}
+	if m.Validators != nil {
+		for name, power := range *m.Validators {
+			powers[name] = power
+		}
+	} else {
+		for name, node := range m.Nodes {
+			if node != nil && (node.Mode == "" || node.Mode == string(ModeValidator)) {
+				powers[name] = 100
+			}
+		}
+	}
+	for name, power := range m.ValidatorUpdates["0"] {
+		if power == 0 {
+			delete(powers, name)
+		} else {
+			powers[name] = power
+		}
+	}
+
+	var total, started int64
+	for name, power := range powers {
+		node, ok := m.Nodes[name]
+		if !ok {
+			continue // reported as an unknown validator by NewTestnetFromManifest
+		}
+		total += power
+		if node == nil || (node.StartAt != StartAtNever && node.StartAt <= initialHeight) {
+			started += power
+		}
+	}
+	if total == 0 {
+		return fmt.Errorf("the validator set at the initial height %v is empty, so the chain cannot start",
+			initialHeight)
+	}
+	if 3*started <= 2*total {
+		return fmt.Errorf("validators starting at the initial height %v hold %v of %v voting power, "+
+			"must be more than 2/3 for the chain to start", initialHeight, started, total)
+	}
+	return nil
+}
+
+// Save sorts the testnet manifest, see Sort, and saves it to a file. Its
+// validator updates and misbehaviors are ordered by height.
 func (m Manifest) Save(file string) error {
-	f, err := os.Create(file)
+	m.Sort()
+	bz, err := m.encode()
 	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := os.WriteFile(file, bz, 0o644); err != nil { //nolint:gosec
 		return fmt.Errorf("failed to create manifest file %q: %w", file, err)
 	}
-	return toml.NewEncoder(f).Encode(m)
+	return nil
 }
 
 // LoadManifest loads a testnet manifest from a file.
@@ -194,3 +973,93 @@ func LoadManifest(file string) (Manifest, error) {
 	}
 	return manifest, nil
 }
+
+// AllNodes is the name of the override node that Manifest.Merge applies to
+// every node, e.g. [node."*"] in a TOML overrides file.
+const AllNodes = "*"
+
+// Merge returns a copy of the manifest with the given overrides applied. Only
+// fields that are set in the overrides take effect, so that zero values never
+// clobber the manifest's values:
+//
+//   - scalar fields replace the manifest's value if non-zero. In particular,
+//     a bool can only be overridden to true.
+//   - pointer fields replace the manifest's value if non-nil, which allows
+//     overriding e.g. persist_interval with an explicit 0.
+//   - slice fields replace the manifest's slice if non-nil, even if empty.
+//   - map fields are merged key by key, recursively for maps of maps, so
+//     e.g. validator_update entries are added to the manifest's ones. Map
+//     values are always set, even if zero.
+//
+// Nodes are overridden field by field with the same rules, where the node
+// named AllNodes applies to every node before the node-specific overrides.
+// Overriding a node that does not exist in the manifest is an error.
+func (m Manifest) Merge(overrides Manifest) (Manifest, error) {
+	nodes, nodeOverrides := m.Nodes, overrides.Nodes
+	m.Nodes, overrides.Nodes = nil, nil
+
+	merged := Manifest{}
+	mergeValue(reflect.ValueOf(&merged).Elem(), reflect.ValueOf(m))
+	mergeValue(reflect.ValueOf(&merged).Elem(), reflect.ValueOf(overrides))
+
+	if nodes != nil {
+		merged.Nodes = make(map[string]*ManifestNode, len(nodes))
+	}
+	for name, node := range nodes {
+		if node == nil {
+			node = &ManifestNode{}
+		}
+		mergedNode := &ManifestNode{}
+		mergeValue(reflect.ValueOf(mergedNode).Elem(), reflect.ValueOf(*node))
+		if override := nodeOverrides[AllNodes]; override != nil {
+			mergeValue(reflect.ValueOf(mergedNode).Elem(), reflect.ValueOf(*override))
+		}
+		merged.Nodes[name] = mergedNode
+	}
+	for name, override := range nodeOverrides {
+		if name == AllNodes || override == nil {
+			continue
+		}
+		node, ok := merged.Nodes[name]
+		if !ok {
+			return Manifest{}, fmt.Errorf("cannot override unknown node %q", name)
+		}
+		mergeValue(reflect.ValueOf(node).Elem(), reflect.ValueOf(*override))
+	}
+	return merged, nil
+}
+
+// mergeValue merges src into dst following the rules of Manifest.Merge. The
+// result never shares slices, maps or pointers with src.
+func mergeValue(dst, src reflect.Value) {
+	if src.IsZero() {
+		return
+	}
+	switch src.Kind() {
+	case reflect.Struct:
+		for i := 0; i < src.NumField(); i++ {
+			mergeValue(dst.Field(i), src.Field(i))
+		}
+	case reflect.Map:
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMapWithSize(src.Type(), src.Len()))
+		}
+		iter := src.MapRange()
+		for iter.Next() {
+			elem := reflect.New(src.Type().Elem()).Elem()
+			if existing := dst.MapIndex(iter.Key()); existing.IsValid() && elem.Kind() == reflect.Map {
+				elem.Set(existing)
+			}
+			mergeValue(elem, iter.Value())
+			dst.SetMapIndex(iter.Key(), elem)
+		}
+	case reflect.Slice:
+		dst.Set(reflect.AppendSlice(reflect.MakeSlice(src.Type(), 0, src.Len()), src))
+	case reflect.Pointer:
+		ptr := reflect.New(src.Type().Elem())
+		mergeValue(ptr.Elem(), src.Elem())
+		dst.Set(ptr)
+	default:
+		dst.Set(src)
+	}
+}
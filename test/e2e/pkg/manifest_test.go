@@ -0,0 +1,563 @@
+package e2e
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifestMerge(t *testing.T) {
+	newBase := func() Manifest {
+		return Manifest{
+			InitialHeight:        1000,
+			PrepareProposalDelay: time.Second,
+			ValidatorUpdates: map[string]map[string]int64{
+				"1010": {"validator01": 10},
+			},
+			Nodes: map[string]*ManifestNode{
+				"validator01": {Database: "goleveldb", Perturb: []string{"kill"}, RetainBlocks: 10},
+				"validator02": {Database: "goleveldb", Perturb: []string{"pause"}},
+			},
+		}
+	}
+	persist := uint64(0)
+
+	testCases := []struct {
+		name      string
+		overrides Manifest
+		expect    func(m *Manifest)
+		expectErr string
+	}{
+		{
+			name:      "empty overrides",
+			overrides: Manifest{},
+			expect:    func(m *Manifest) {},
+		},
+		{
+			name:      "scalars replace the base value",
+			overrides: Manifest{PrepareProposalDelay: 2 * time.Second},
+			expect:    func(m *Manifest) { m.PrepareProposalDelay = 2 * time.Second },
+		},
+		{
+			name: "maps are merged key by key",
+			overrides: Manifest{ValidatorUpdates: map[string]map[string]int64{
+				"1010": {"validator02": 0},
+				"1020": {"validator01": 20},
+			}},
+			expect: func(m *Manifest) {
+				m.ValidatorUpdates = map[string]map[string]int64{
+					"1010": {"validator01": 10, "validator02": 0},
+					"1020": {"validator01": 20},
+				}
+			},
+		},
+		{
+			name: "all nodes are overridden before specific nodes",
+			overrides: Manifest{Nodes: map[string]*ManifestNode{
+				AllNodes:      {Database: "rocksdb", RetainBlocks: 20},
+				"validator01": {Database: "badgerdb"},
+			}},
+			expect: func(m *Manifest) {
+				m.Nodes["validator01"].Database = "badgerdb"
+				m.Nodes["validator01"].RetainBlocks = 20
+				m.Nodes["validator02"].Database = "rocksdb"
+				m.Nodes["validator02"].RetainBlocks = 20
+			},
+		},
+		{
+			name: "empty slices and pointers to zero values are set",
+			overrides: Manifest{Nodes: map[string]*ManifestNode{
+				"validator02": {Perturb: []string{}, PersistInterval: &persist},
+			}},
+			expect: func(m *Manifest) {
+				m.Nodes["validator02"].Perturb = []string{}
+				m.Nodes["validator02"].PersistInterval = &persist
+			},
+		},
+		{
+			name:      "unknown node",
+			overrides: Manifest{Nodes: map[string]*ManifestNode{"full01": {}}},
+			expectErr: `cannot override unknown node "full01"`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			base := newBase()
+			merged, err := base.Merge(tc.overrides)
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			expected := newBase()
+			tc.expect(&expected)
+			assert.Equal(t, expected, merged)
+
+			// The base manifest must not be modified.
+			assert.Equal(t, newBase(), base)
+		})
+	}
+}
+
+func TestManifestValidatePeerStartHeights(t *testing.T) {
+	testCases := []struct {
+		name     string
+		manifest Manifest
+		orphan   string
+	}{
+		{
+			name: "peer starts before node",
+			manifest: Manifest{Nodes: map[string]*ManifestNode{
+				"validator01": {},
+				"full01":      {Mode: "full", StartAt: 10, PersistentPeers: []string{"validator01"}},
+			}},
+		},
+		{
+			name: "peer starts at the same height",
+			manifest: Manifest{Nodes: map[string]*ManifestNode{
+				"validator01": {},
+				"full01":      {Mode: "full", StartAt: 10, PersistentPeers: []string{"full02"}},
+				"full02":      {Mode: "full", StartAt: 10, PersistentPeers: []string{"full01"}},
+			}},
+		},
+		{
+			name: "initial nodes with start_at set to the initial height",
+			manifest: Manifest{InitialHeight: 1000, Nodes: map[string]*ManifestNode{
+				"validator01": {StartAt: 1000},
+				"validator02": {PersistentPeers: []string{"validator01"}},
+			}},
+		},
+		{
+			name: "one of several peers starts before node",
+			manifest: Manifest{Nodes: map[string]*ManifestNode{
+				"seed01":      {Mode: "seed"},
+				"validator01": {},
+				"full01":      {Mode: "full", StartAt: 20},
+				"full02":      {Mode: "full", StartAt: 10, Seeds: []string{"seed01"}, PersistentPeers: []string{"full01"}},
+			}},
+		},
+		{
+			name: "no seeds or peers defaults to all nodes",
+			manifest: Manifest{Nodes: map[string]*ManifestNode{
+				"validator01": {},
+				"full01":      {Mode: "full", StartAt: 10},
+			}},
+		},
+		{
+			name: "seeds may start after each other",
+			manifest: Manifest{Nodes: map[string]*ManifestNode{
+				"seed01":      {Mode: "seed", Seeds: []string{"seed02"}},
+				"seed02":      {Mode: "seed", StartAt: 10, Seeds: []string{"seed01"}},
+				"validator01": {},
+			}},
+		},
+		{
+			name: "only peer starts after node",
+			manifest: Manifest{Nodes: map[string]*ManifestNode{
+				"validator01": {PersistentPeers: []string{"validator02"}},
+				"validator02": {StartAt: 10, PersistentPeers: []string{"validator01"}},
+			}},
+			orphan: "validator01",
+		},
+		{
+			name: "all seeds start after node",
+			manifest: Manifest{Nodes: map[string]*ManifestNode{
+				"seed01":      {Mode: "seed", StartAt: 20},
+				"validator01": {},
+				"full01":      {Mode: "full", StartAt: 10, Seeds: []string{"seed01"}},
+			}},
+			orphan: "full01",
+		},
+		{
+			name: "light client providers start after it",
+			manifest: Manifest{Nodes: map[string]*ManifestNode{
+				"validator01": {StartAt: 20},
+				"light01":     {Mode: "light", StartAt: 10, PersistentPeers: []string{"validator01"}},
+			}},
+			orphan: "light01",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.manifest.Validate()
+			if tc.orphan == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), fmt.Sprintf("%q", tc.orphan))
+		})
+	}
+}
+
+func TestManifestValidatePeerReferences(t *testing.T) {
+	testCases := []struct {
+		name      string
+		node      *ManifestNode
+		expectErr string
+	}{
+		{
+			name: "clean",
+			node: &ManifestNode{Mode: "full", Seeds: []string{"seed01"}, PersistentPeers: []string{"validator01"}},
+		},
+		{
+			name: "clean light client",
+			node: &ManifestNode{
+				Mode: "light", PersistentPeers: []string{"validator01"}, Witnesses: []string{"validator02"},
+			},
+		},
+		{
+			name:      "seed is itself",
+			node:      &ManifestNode{Mode: "full", Seeds: []string{"node01"}},
+			expectErr: `node "node01" lists itself in its seeds`,
+		},
+		{
+			name:      "unknown seed",
+			node:      &ManifestNode{Mode: "full", Seeds: []string{"seed02"}},
+			expectErr: `node "node01" lists unknown node "seed02" in its seeds`,
+		},
+		{
+			name:      "persistent peer is itself",
+			node:      &ManifestNode{Mode: "full", PersistentPeers: []string{"validator01", "node01"}},
+			expectErr: `node "node01" lists itself in its persistent_peers`,
+		},
+		{
+			name:      "unknown persistent peer",
+			node:      &ManifestNode{Mode: "full", PersistentPeers: []string{"validator99"}},
+			expectErr: `node "node01" lists unknown node "validator99" in its persistent_peers`,
+		},
+		{
+			name:      "light provider is itself",
+			node:      &ManifestNode{Mode: "light", PersistentPeers: []string{"node01"}},
+			expectErr: `node "node01" lists itself in its providers (persistent_peers)`,
+		},
+		{
+			name:      "unknown light provider",
+			node:      &ManifestNode{Mode: "light", PersistentPeers: []string{"full01"}},
+			expectErr: `node "node01" lists unknown node "full01" in its providers (persistent_peers)`,
+		},
+		{
+			name: "witness is itself",
+			node: &ManifestNode{
+				Mode: "light", PersistentPeers: []string{"validator01"}, Witnesses: []string{"node01"},
+			},
+			expectErr: `node "node01" lists itself in its witnesses`,
+		},
+		{
+			name: "unknown witness",
+			node: &ManifestNode{
+				Mode: "light", PersistentPeers: []string{"validator01"}, Witnesses: []string{"validator03"},
+			},
+			expectErr: `node "node01" lists unknown node "validator03" in its witnesses`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := Manifest{Nodes: map[string]*ManifestNode{
+				"seed01":      {Mode: "seed"},
+				"validator01": {},
+				"validator02": {},
+				"node01":      tc.node,
+			}}
+			err := m.Validate()
+			if tc.expectErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tc.expectErr)
+		})
+	}
+}
+
+func TestManifestValidateStateSyncPath(t *testing.T) {
+	testCases := []struct {
+		name      string
+		nodes     map[string]*ManifestNode
+		expectErr string
+	}{
+		{
+			name: "archive snapshot provider",
+			nodes: map[string]*ManifestNode{
+				"validator01": {SnapshotInterval: 3},
+				"full01":      {Mode: "full", StartAt: 10, StateSync: true},
+			},
+		},
+		{
+			name: "pruning snapshot provider",
+			nodes: map[string]*ManifestNode{
+				"validator01": {SnapshotInterval: 5, RetainBlocks: 5},
+				"full01":      {Mode: "full", StartAt: 14, StateSync: true},
+			},
+		},
+		{
+			name: "no snapshot provider",
+			nodes: map[string]*ManifestNode{
+				"validator01": {},
+				"full01":      {Mode: "full", StartAt: 10, StateSync: true},
+			},
+			expectErr: "state syncing node \"full01\" has no snapshot to restore when it starts at height 10",
+		},
+		{
+			name: "snapshot provider pruning the snapshot",
+			nodes: map[string]*ManifestNode{
+				"validator01": {SnapshotInterval: 10, RetainBlocks: 5},
+				"full01":      {Mode: "full", StartAt: 15, StateSync: true},
+			},
+			expectErr: "has no snapshot to restore",
+		},
+		{
+			name: "syncing node starting before the first snapshot",
+			nodes: map[string]*ManifestNode{
+				"validator01": {SnapshotInterval: 10},
+				"full01":      {Mode: "full", StartAt: 5, StateSync: true},
+			},
+			expectErr: "has no snapshot to restore",
+		},
+		{
+			name: "snapshot provider starting after the snapshot",
+			nodes: map[string]*ManifestNode{
+				"validator01": {},
+				"full01":      {Mode: "full", StartAt: 12, SnapshotInterval: 10},
+				"full02":      {Mode: "full", StartAt: 15, StateSync: true},
+			},
+			expectErr: "state syncing node \"full02\" has no snapshot to restore",
+		},
+		{
+			name: "light client taking snapshots",
+			nodes: map[string]*ManifestNode{
+				"validator01": {},
+				"light01":     {Mode: "light", SnapshotInterval: 3},
+				"full01":      {Mode: "full", StartAt: 10, StateSync: true},
+			},
+			expectErr: "has no snapshot to restore",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Manifest{Nodes: tc.nodes}.Validate()
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestManifestValidateInitialQuorum(t *testing.T) {
+	testCases := []struct {
+		name      string
+		manifest  Manifest
+		expectErr string
+	}{
+		{
+			name: "default genesis validators",
+			manifest: Manifest{Nodes: map[string]*ManifestNode{
+				"validator01": {},
+				"validator02": {},
+				"validator03": {},
+				"validator04": {StartAt: 10},
+			}},
+		},
+		{
+			name: "genesis validators",
+			manifest: Manifest{
+				Validators: &map[string]int64{"validator01": 70, "validator02": 30},
+				Nodes: map[string]*ManifestNode{
+					"validator01": {},
+					"validator02": {StartAt: 10},
+				},
+			},
+		},
+		{
+			name: "genesis validators without quorum",
+			manifest: Manifest{
+				Validators: &map[string]int64{"validator01": 60, "validator02": 40},
+				Nodes: map[string]*ManifestNode{
+					"validator01": {},
+					"validator02": {StartAt: 10},
+				},
+			},
+			expectErr: "validators starting at the initial height 1 hold 60 of 100 voting power, " +
+				"must be more than 2/3 for the chain to start",
+		},
+		{
+			name: "initchain validators",
+			manifest: Manifest{
+				Validators:       &map[string]int64{},
+				ValidatorUpdates: map[string]map[string]int64{"0": {"validator01": 70, "validator02": 30}},
+				Nodes: map[string]*ManifestNode{
+					"validator01": {},
+					"validator02": {StartAt: 10},
+				},
+			},
+		},
+		{
+			name: "initchain validators without quorum",
+			manifest: Manifest{
+				InitialHeight:    1000,
+				Validators:       &map[string]int64{},
+				ValidatorUpdates: map[string]map[string]int64{"0": {"validator01": 30, "validator02": 70}},
+				Nodes: map[string]*ManifestNode{
+					"validator01": {StartAt: 1000},
+					"validator02": {StartAt: 1010},
+				},
+			},
+			expectErr: "validators starting at the initial height 1000 hold 30 of 100 voting power",
+		},
+		{
+			name: "initchain removes the genesis quorum",
+			manifest: Manifest{
+				Validators:       &map[string]int64{"validator01": 100, "validator02": 10},
+				ValidatorUpdates: map[string]map[string]int64{"0": {"validator01": 0}},
+				Nodes: map[string]*ManifestNode{
+					"validator01": {},
+					"validator02": {StartAt: 10},
+				},
+			},
+			expectErr: "validators starting at the initial height 1 hold 0 of 10 voting power",
+		},
+		{
+			name: "all validators delayed",
+			manifest: Manifest{
+				Validators: &map[string]int64{},
+				ValidatorUpdates: map[string]map[string]int64{
+					"0":  {"validator01": 100},
+					"15": {"validator02": 100},
+				},
+				Nodes: map[string]*ManifestNode{
+					"validator01": {StartAt: 10},
+					"validator02": {StartAt: 10},
+				},
+			},
+			expectErr: "validators starting at the initial height 1 hold 0 of 100 voting power",
+		},
+		{
+			name: "empty initial validator set",
+			manifest: Manifest{
+				Validators:       &map[string]int64{},
+				ValidatorUpdates: map[string]map[string]int64{"15": {"validator01": 100}},
+				Nodes: map[string]*ManifestNode{
+					"validator01": {StartAt: 10},
+				},
+			},
+			expectErr: "the validator set at the initial height 1 is empty, so the chain cannot start",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.manifest.Validate()
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestManifestExpectedHeightAt(t *testing.T) {
+	testCases := []struct {
+		name     string
+		manifest Manifest
+		elapsed  time.Duration
+		expected int64
+	}{
+		{
+			name:     "before the first block",
+			manifest: Manifest{Nodes: map[string]*ManifestNode{"validator01": {}}},
+			elapsed:  999 * time.Millisecond,
+			expected: 0,
+		},
+		{
+			name:     "default commit timeout",
+			manifest: Manifest{Nodes: map[string]*ManifestNode{"validator01": {}}},
+			elapsed:  time.Minute,
+			expected: 60,
+		},
+		{
+			name: "initial height",
+			manifest: Manifest{
+				InitialHeight: 1000,
+				Nodes:         map[string]*ManifestNode{"validator01": {}},
+			},
+			elapsed:  10 * time.Second,
+			expected: 1009,
+		},
+		{
+			// The slowest validator sets the pace, not the full node.
+			name: "commit timeouts",
+			manifest: Manifest{Nodes: map[string]*ManifestNode{
+				"validator01": {TimeoutCommit: 3 * time.Second},
+				"validator02": {Mode: string(ModeValidator), TimeoutCommit: 100 * time.Millisecond},
+				"full01":      {Mode: string(ModeFull), TimeoutCommit: 10 * time.Second},
+			}},
+			elapsed:  time.Minute,
+			expected: 20,
+		},
+		{
+			// 1s commit + 200ms + 300ms + 400ms + 50ms + 50ms = 2s per block.
+			name: "abci delays",
+			manifest: Manifest{
+				PrepareProposalDelay:  200 * time.Millisecond,
+				ProcessProposalDelay:  300 * time.Millisecond,
+				FinalizeBlockDelay:    400 * time.Millisecond,
+				PrepareProposalJitter: 50 * time.Millisecond,
+				ProcessProposalJitter: 50 * time.Millisecond,
+				Nodes:                 map[string]*ManifestNode{"validator01": {}},
+			},
+			elapsed:  time.Minute,
+			expected: 30,
+		},
+		{
+			name:     "negative",
+			manifest: Manifest{InitialHeight: 5, Nodes: map[string]*ManifestNode{"validator01": {}}},
+			elapsed:  -time.Minute,
+			expected: 4,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.manifest.ExpectedHeightAt(tc.elapsed))
+		})
+	}
+}
+
+func TestManifestGossipRates(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "testnet.toml")
+	manifest := Manifest{
+		ThrottledGossip: true,
+		Nodes: map[string]*ManifestNode{
+			"validator01": {SendRate: 4096, RecvRate: 8192},
+			"validator02": {},
+		},
+	}
+	require.NoError(t, manifest.Save(file))
+	bz, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Contains(t, string(bz), "throttled_gossip = true")
+	assert.Contains(t, string(bz), "send_rate = 4096")
+	assert.Contains(t, string(bz), "recv_rate = 8192")
+
+	loaded, err := LoadManifest(file)
+	require.NoError(t, err)
+	assert.True(t, loaded.ThrottledGossip)
+	assert.EqualValues(t, 4096, loaded.Nodes["validator01"].SendRate)
+	assert.EqualValues(t, 8192, loaded.Nodes["validator01"].RecvRate)
+
+	// Nodes without rates keep the CometBFT defaults, which the runner leaves
+	// untouched.
+	assert.Zero(t, loaded.Nodes["validator02"].SendRate)
+	assert.Zero(t, loaded.Nodes["validator02"].RecvRate)
+	require.NoError(t, os.WriteFile(file, []byte("[node.validator01]\n"), 0o600))
+	loaded, err = LoadManifest(file)
+	require.NoError(t, err)
+	assert.False(t, loaded.ThrottledGossip)
+	assert.Zero(t, loaded.Nodes["validator01"].SendRate)
+	assert.Zero(t, loaded.Nodes["validator01"].RecvRate)
+}
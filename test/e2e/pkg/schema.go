@@ -0,0 +1,204 @@
+package e2e
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// ManifestSchema returns a JSON Schema describing the TOML manifest format, as
+// derived from the Manifest and ManifestNode structs.
+func ManifestSchema() ([]byte, error) {
+	schema := typeSchema(reflect.TypeOf(Manifest{}))
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "CometBFT E2E testnet manifest"
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// typeSchema builds the JSON Schema of a Go type, using the TOML tags of
+// struct fields as property names.
+func typeSchema(t reflect.Type) map[string]interface{} {
+	if t == durationType {
+		// Durations may be given either as strings ("100ms") or nanoseconds.
+		return map[string]interface{}{"type": []string{"string", "integer"}}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("toml"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			properties[name] = typeSchema(field.Type)
+		}
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// ValidateManifestBytes checks a TOML manifest against the manifest schema,
+// reporting unknown keys and type mismatches along with their line number.
+func ValidateManifestBytes(bz []byte) error {
+	var doc map[string]interface{}
+	if _, err := toml.Decode(string(bz), &doc); err != nil {
+		return fmt.Errorf("invalid TOML: %w", err)
+	}
+	v := &schemaValidator{lines: strings.Split(string(bz), "\n")}
+	v.validate(typeSchema(reflect.TypeOf(Manifest{})), doc, nil)
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(v.problems, "\n"))
+}
+
+// schemaValidator walks a decoded TOML document and collects problems.
+type schemaValidator struct {
+	lines    []string
+	problems []string
+}
+
+func (v *schemaValidator) report(path []string, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if line := v.findLine(path); line > 0 {
+		msg = fmt.Sprintf("line %d: %s", line, msg)
+	}
+	v.problems = append(v.problems, msg)
+}
+
+func (v *schemaValidator) validate(schema map[string]interface{}, value interface{}, path []string) {
+	key := strings.Join(path, ".")
+	types, ok := schema["type"].([]string)
+	if !ok {
+		types = []string{schema["type"].(string)}
+	}
+	if !matchesSchemaType(types, value) {
+		v.report(path, "key %q has type %T, expected %s", key, value, strings.Join(types, " or "))
+		return
+	}
+
+	switch value := value.(type) {
+	case int64:
+		if minimum, ok := schema["minimum"].(int); ok && value < int64(minimum) {
+			v.report(path, "key %q must be at least %d", key, minimum)
+		}
+	case []interface{}:
+		for i, item := range value {
+			itemPath := append(append([]string{}, path...), fmt.Sprint(i))
+			v.validate(schema["items"].(map[string]interface{}), item, itemPath)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		properties, _ := schema["properties"].(map[string]interface{})
+		for _, k := range keys {
+			itemPath := append(append([]string{}, path...), k)
+			if propSchema, ok := properties[k]; ok {
+				v.validate(propSchema.(map[string]interface{}), value[k], itemPath)
+			} else if additional, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+				v.validate(additional, value[k], itemPath)
+			} else {
+				v.report(itemPath, "unknown key %q", strings.Join(itemPath, "."))
+			}
+		}
+	}
+}
+
+func matchesSchemaType(types []string, value interface{}) bool {
+	for _, t := range types {
+		switch value.(type) {
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case int64:
+			if t == "integer" || t == "number" {
+				return true
+			}
+		case float64:
+			if t == "number" {
+				return true
+			}
+		case []interface{}, []map[string]interface{}:
+			if t == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if t == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// findLine makes a best effort to find the line number of a key in the
+// manifest, by looking for the key after its enclosing table header. Returns 0
+// if the key cannot be found.
+func (v *schemaValidator) findLine(path []string) int {
+	if len(path) == 0 {
+		return 0
+	}
+	start := 0
+	for i := len(path) - 1; i > 0; i-- {
+		header := "[" + strings.Join(path[:i], ".") + "]"
+		for n, line := range v.lines {
+			if strings.TrimSpace(line) == header {
+				start = n
+				break
+			}
+		}
+		if start > 0 {
+			break
+		}
+	}
+	last := path[len(path)-1]
+	for n := start; n < len(v.lines); n++ {
+		line := strings.TrimSpace(v.lines[n])
+		if line == "["+strings.Join(path, ".")+"]" {
+			return n + 1
+		}
+		line = strings.Trim(strings.SplitN(line, "=", 2)[0], " \"")
+		if line == last {
+			return n + 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,118 @@
+package e2e
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/BurntSushi/toml"
+)
+
+// bareTOMLKey matches the keys that TOML allows unquoted.
+var bareTOMLKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Sort canonicalizes the order of the manifest's lists, so that saving it
+// gives the same output however they were generated. It sorts the bridge
+// nodes, and the seeds, persistent peers and witnesses of every node. A light
+// client's first persistent peer is its primary, so it stays first.
+// Perturbations and load profile bursts happen in order, and are left alone.
+//
+// Maps are written ordered by key regardless, see Save.
+func (m *Manifest) Sort() {
+	sort.Strings(m.BridgeNodes)
+	for _, node := range m.Nodes {
+		if node == nil {
+			continue
+		}
+		sort.Strings(node.Seeds)
+		sort.Strings(node.Witnesses)
+		if node.Mode == string(ModeLight) && len(node.PersistentPeers) > 0 {
+			sort.Strings(node.PersistentPeers[1:])
+		} else {
+			sort.Strings(node.PersistentPeers)
+		}
+	}
+}
+
+// encode encodes the manifest as TOML. The TOML encoder orders map keys
+// lexically, so the height-keyed validator updates and misbehaviors are
+// written separately at the end, ordered numerically.
+func (m Manifest) encode() ([]byte, error) {
+	updates, nodes := m.ValidatorUpdates, m.Nodes
+	m.ValidatorUpdates = nil
+	if nodes != nil {
+		m.Nodes = make(map[string]*ManifestNode, len(nodes))
+		for name, node := range nodes {
+			if node != nil {
+				node := *node
+				node.Misbehaviors = nil
+				m.Nodes[name] = &node
+			} else {
+				m.Nodes[name] = nil
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(m); err != nil {
+		return nil, err
+	}
+	heights := make([]string, 0, len(updates))
+	for height := range updates {
+		heights = append(heights, height)
+	}
+	for _, height := range sortHeights(heights) {
+		fmt.Fprintf(&buf, "\n[validator_update.%s]\n", tomlKey(height))
+		names := make([]string, 0, len(updates[height]))
+		for name := range updates[height] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(&buf, "  %s = %d\n", tomlKey(name), updates[height][name])
+		}
+	}
+	for _, name := range sortNodeNames(Manifest{Nodes: nodes}) {
+		if nodes[name] == nil || len(nodes[name].Misbehaviors) == 0 {
+			continue
+		}
+		misbehaviors := nodes[name].Misbehaviors
+		fmt.Fprintf(&buf, "\n[node.%s.misbehaviors]\n", tomlKey(name))
+		heights := make([]string, 0, len(misbehaviors))
+		for height := range misbehaviors {
+			heights = append(heights, height)
+		}
+		for _, height := range sortHeights(heights) {
+			fmt.Fprintf(&buf, "  %s = %q\n", tomlKey(height), misbehaviors[height])
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// sortHeights sorts the keys of a height-keyed map in numerical order, and
+// returns them. Keys that aren't heights come last, in lexical order.
+func sortHeights(keys []string) []string {
+	sort.Slice(keys, func(i, j int) bool {
+		a, errA := strconv.ParseInt(keys[i], 10, 64)
+		b, errB := strconv.ParseInt(keys[j], 10, 64)
+		switch {
+		case errA == nil && errB == nil && a != b:
+			return a < b
+		case (errA == nil) != (errB == nil):
+			return errA == nil
+		default:
+			return keys[i] < keys[j]
+		}
+	})
+	return keys
+}
+
+// tomlKey quotes a TOML key, unless it can be written bare.
+func tomlKey(key string) string {
+	if bareTOMLKey.MatchString(key) {
+		return key
+	}
+	return strconv.Quote(key)
+}
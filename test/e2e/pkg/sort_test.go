@@ -0,0 +1,88 @@
+package e2e
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSortManifest returns a manifest whose lists are in the given order of
+// node names, reversed or not.
+func newSortManifest(reversed bool) Manifest {
+	list := func(names ...string) []string {
+		if reversed {
+			for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+				names[i], names[j] = names[j], names[i]
+			}
+		}
+		return names
+	}
+	return Manifest{
+		BridgeNodes: list("full01", "full02"),
+		ValidatorUpdates: map[string]map[string]int64{
+			"9":  {"validator02": 10, "validator01": 20},
+			"10": {"validator03": 30},
+		},
+		Nodes: map[string]*ManifestNode{
+			"validator01": {
+				Seeds:           list("seed01", "seed02"),
+				PersistentPeers: list("validator02", "validator03"),
+				Perturb:         []string{"restart", "kill"},
+				Misbehaviors:    map[string]string{"9": "double-prevote", "10": "double-precommit"},
+			},
+			"light01": {
+				Mode:            "light",
+				PersistentPeers: append([]string{"validator03"}, list("validator01", "validator02")...),
+				Witnesses:       list("full01", "full02"),
+			},
+		},
+	}
+}
+
+func TestManifestSort(t *testing.T) {
+	canonical := newSortManifest(false)
+	canonical.Sort()
+	require.Equal(t, newSortManifest(false), canonical, "canonical manifest changed")
+
+	shuffled := newSortManifest(true)
+	require.NotEqual(t, canonical, shuffled)
+	shuffled.Sort()
+	assert.Equal(t, canonical, shuffled)
+
+	// Sorting is idempotent, keeps the light client's primary first, and
+	// leaves perturbations in order.
+	shuffled.Sort()
+	assert.Equal(t, canonical, shuffled)
+	assert.Equal(t, []string{"validator03", "validator01", "validator02"},
+		shuffled.Nodes["light01"].PersistentPeers)
+	assert.Equal(t, []string{"restart", "kill"}, shuffled.Nodes["validator01"].Perturb)
+}
+
+func TestManifestSave(t *testing.T) {
+	dir := t.TempDir()
+	canonicalFile, shuffledFile := filepath.Join(dir, "canonical.toml"), filepath.Join(dir, "shuffled.toml")
+	require.NoError(t, newSortManifest(false).Save(canonicalFile))
+	require.NoError(t, newSortManifest(true).Save(shuffledFile))
+
+	canonical, err := os.ReadFile(canonicalFile)
+	require.NoError(t, err)
+	shuffled, err := os.ReadFile(shuffledFile)
+	require.NoError(t, err)
+	assert.Equal(t, string(canonical), string(shuffled))
+
+	// Heights are ordered numerically, so 9 comes before 10.
+	output := string(canonical)
+	assert.Less(t, strings.Index(output, "[validator_update.9]"), strings.Index(output, "[validator_update.10]"))
+	assert.Less(t, strings.Index(output, `9 = "double-prevote"`), strings.Index(output, `10 = "double-precommit"`))
+
+	loaded, err := LoadManifest(canonicalFile)
+	require.NoError(t, err)
+	expect := newSortManifest(false)
+	assert.Equal(t, expect.ValidatorUpdates, loaded.ValidatorUpdates)
+	assert.Equal(t, expect.Nodes["validator01"].Misbehaviors, loaded.Nodes["validator01"].Misbehaviors)
+	assert.Equal(t, expect.Nodes["light01"].PersistentPeers, loaded.Nodes["light01"].PersistentPeers)
+}
@@ -2,22 +2,31 @@ package e2e
 
 import (
 	"bytes"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"math/rand"
 	"net"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"text/template"
 	"time"
 
+	"github.com/cometbft/cometbft/config"
 	"github.com/cometbft/cometbft/crypto"
 	"github.com/cometbft/cometbft/crypto/ed25519"
 	"github.com/cometbft/cometbft/crypto/secp256k1"
+	"github.com/cometbft/cometbft/crypto/tmhash"
 	rpchttp "github.com/cometbft/cometbft/rpc/client/http"
+	"github.com/cometbft/cometbft/test/e2e/app"
+	"github.com/cometbft/cometbft/types"
 
 	_ "embed"
 )
@@ -25,19 +34,23 @@ import (
 const (
 	randomSeed               int64  = 2308084734268
 	proxyPortFirst           uint32 = 5701
-	prometheusProxyPortFirst uint32 = 6701
+	PrometheusProxyPortFirst uint32 = 6701
+	PprofProxyPortFirst      uint32 = 7701
 
-	defaultBatchSize   = 2
 	defaultConnections = 1
 	defaultTxSizeBytes = 1024
 
 	localVersion = "cometbft/e2e-node:local-version"
+
+	defaultSnapshotFormat uint32 = 1
 )
 
 type (
 	Mode         string
 	Protocol     string
 	Perturbation string
+	Misbehavior  string
+	RecoveryMode string
 )
 
 const (
@@ -53,43 +66,146 @@ const (
 	ProtocolTCP             Protocol = "tcp"
 	ProtocolUNIX            Protocol = "unix"
 
-	PerturbationDisconnect Perturbation = "disconnect"
-	PerturbationKill       Perturbation = "kill"
-	PerturbationPause      Perturbation = "pause"
-	PerturbationRestart    Perturbation = "restart"
-	PerturbationUpgrade    Perturbation = "upgrade"
+	PerturbationDisconnect        Perturbation = "disconnect"
+	PerturbationKill              Perturbation = "kill"
+	PerturbationPause             Perturbation = "pause"
+	PerturbationRestart           Perturbation = "restart"
+	PerturbationUpgrade           Perturbation = "upgrade"
+	PerturbationSkew              Perturbation = "skew"
+	PerturbationThrottleDisk      Perturbation = "throttle_disk"
+	PerturbationCorruptDB         Perturbation = "corrupt_db"
+	PerturbationPrivvalDisconnect Perturbation = "privval_disconnect"
+	PerturbationFlap              Perturbation = "flap"
+	PerturbationWALTruncate       Perturbation = "wal_truncate"
+
+	RecoveryModeBlockSync RecoveryMode = "blocksync"
+	RecoveryModeStateSync RecoveryMode = "statesync"
+
+	MisbehaviorDoublePrevote   Misbehavior = "double-prevote"
+	MisbehaviorDoublePrecommit Misbehavior = "double-precommit"
+
+	// ABCIAppKVStore is the default ABCI application, see Manifest.ABCIApp.
+	ABCIAppKVStore = "kvstore"
 
 	EvidenceAgeHeight int64         = 7
 	EvidenceAgeTime   time.Duration = 500 * time.Millisecond
+
+	// MaxConsensusTimeout bounds the per-node consensus timeouts, so that the
+	// runner's waiting logic still sees the network make progress.
+	MaxConsensusTimeout time.Duration = 10 * time.Second
+
+	// MaxClockSkew bounds the clock offset of individual nodes.
+	MaxClockSkew time.Duration = time.Minute
+
+	// MaxSyncersPerServer bounds how many nodes starting at the same height
+	// may catch up from each node serving them, i.e. each archive node for
+	// block sync and each snapshot provider for state sync.
+	MaxSyncersPerServer = 3
+
+	// StartAtNever is the start_at of absent validators, which are part of
+	// the validator set but which the runner never starts, see Node.Absent.
+	StartAtNever int64 = -1
+
+	// DefaultLoadTxBatchSize is the number of transactions the runner sends
+	// every second without a load_tx_batch_size or load profile.
+	DefaultLoadTxBatchSize = 2
+
+	// DefaultArchiveBlackoutDuration is how long archive nodes stay offline
+	// during an archive blackout, see Manifest.ArchiveBlackoutHeight.
+	DefaultArchiveBlackoutDuration time.Duration = 30 * time.Second
+
+	// MinFlapInterval and MaxFlapInterval bound the number of blocks between
+	// the disconnections and reconnections of a flapping node.
+	MinFlapInterval int64 = 2
+	MaxFlapInterval int64 = 10
+)
+
+// AddressFamily is the IP address family a node uses to reach its peers.
+type AddressFamily string
+
+const (
+	AddressFamilyIPv4 AddressFamily = "ipv4"
+	AddressFamilyIPv6 AddressFamily = "ipv6"
+	AddressFamilyDual AddressFamily = "dual"
 )
 
+// Common returns the address family two nodes with the given families can
+// use to reach each other, preferring IPv4, or false if there is none.
+func (f AddressFamily) Common(other AddressFamily) (AddressFamily, bool) {
+	switch {
+	case f.supports(AddressFamilyIPv4) && other.supports(AddressFamilyIPv4):
+		return AddressFamilyIPv4, true
+	case f.supports(AddressFamilyIPv6) && other.supports(AddressFamilyIPv6):
+		return AddressFamilyIPv6, true
+	default:
+		return "", false
+	}
+}
+
+// supports returns whether a node with this address family has an address of
+// the given single family.
+func (f AddressFamily) supports(family AddressFamily) bool {
+	return f == family || f == AddressFamilyDual
+}
+
 // Testnet represents a single testnet.
 type Testnet struct {
 	Name                             string
+	ChainID                          string
 	File                             string
 	Dir                              string
 	IP                               *net.IPNet
+	IPv6Net                          *net.IPNet
 	InitialHeight                    int64
+	GenesisTime                      time.Time
+	GenesisTimeOffset                time.Duration
 	InitialState                     map[string]string
 	Validators                       map[*Node]int64
 	ValidatorUpdates                 map[int64]map[*Node]int64
 	Nodes                            []*Node
+	BridgeNodes                      []*Node
+	SeedOnlyDiscovery                bool
 	KeyType                          string
 	Evidence                         int
 	LoadTxSizeBytes                  int
 	LoadTxBatchSize                  int
 	LoadTxConnections                int
+	LoadProfile                      *LoadProfile
 	ABCIProtocol                     string
+	ABCIApp                          string
 	PrepareProposalDelay             time.Duration
 	ProcessProposalDelay             time.Duration
 	CheckTxDelay                     time.Duration
 	VoteExtensionDelay               time.Duration
 	FinalizeBlockDelay               time.Duration
+	PrepareProposalJitter            time.Duration
+	ProcessProposalJitter            time.Duration
 	UpgradeVersion                   string
+	UpgradeHeight                    int64
 	Prometheus                       bool
 	VoteExtensionsEnableHeight       int64
 	VoteExtensionSize                uint
 	PeerGossipIntraloopSleepDuration time.Duration
+	GeneratorSeed                    int64
+	GeneratorVersion                 string
+	ZoneLatencies                    map[string]map[string]time.Duration
+	LinkLatencies                    []LinkLatency
+	ExpectedInitialAppHash           []byte
+	ExpectedFirstBlockBy             time.Duration
+	ExpectedCatchUpBy                time.Duration
+	MaxBlockBytes                    int64
+	MaxGas                           int64
+	SnapshotHeight                   int64
+	SnapshotHash                     []byte
+	ArchiveBlackoutHeight            int64
+	ArchiveBlackoutDuration          time.Duration
+	GlobalRestartHeight              int64
+	EvidenceMaxAgeNumBlocks          int64
+	EvidenceMaxAgeDuration           time.Duration
+	MetricThresholds                 map[string]MetricThreshold
+	AssertProposerFairness           bool
+	ThrottledGossip                  bool
+	BlockInterval                    time.Duration
 }
 
 // Node represents a CometBFT node in a testnet.
@@ -101,7 +217,9 @@ type Node struct {
 	PrivvalKey          crypto.PrivKey
 	NodeKey             crypto.PrivKey
 	InternalIP          net.IP
+	InternalIPv6        net.IP
 	ExternalIP          net.IP
+	AddressFamily       AddressFamily
 	ProxyPort           uint32
 	StartAt             int64
 	BlockSyncVersion    string
@@ -110,14 +228,55 @@ type Node struct {
 	ABCIProtocol        Protocol
 	PrivvalProtocol     Protocol
 	PersistInterval     uint64
+	MempoolCacheSize    int
+	MempoolRecheck      bool
+	WALEnabled          bool
+	RPCUnsafe           bool
+	RPCMaxSubscriptions int
 	SnapshotInterval    uint64
+	SnapshotFormat      uint32
+	SnapshotChunkSize   uint64
 	RetainBlocks        uint64
+	ShortRetention      bool
 	Seeds               []*Node
 	PersistentPeers     []*Node
+	Witnesses           []*Node
+	SentryFor           *Node
+	TrustPeriod         time.Duration
+	TrustHeight         int64
 	Perturbations       []Perturbation
+	RecoveryMode        RecoveryMode
+	Misbehaviors        map[int64]Misbehavior
+	KeyRotations        map[int64]crypto.PrivKey
+	Zone                string
+	BehindNAT           bool
+	ExternalAddress     string
+	VoteExtensionDelay  time.Duration
+	TimeoutPropose      time.Duration
+	TimeoutCommit       time.Duration
+	MaxBlockBytes       int64
+	AppConfig           map[string]string
+	ClockSkew           time.Duration
+	StartupBackoff      time.Duration
+	MaxDialRetries      int
+	MaxInboundPeers     int
+	MaxOutboundPeers    int
+	DiskBandwidth       uint64
+	FlapInterval        int64
 	SendNoLoad          bool
+	LoadWeight          int
 	Prometheus          bool
 	PrometheusProxyPort uint32
+	Pprof               bool
+	PprofProxyPort      uint32
+
+	// AssertReplayConsistency, see ManifestNode.AssertReplayConsistency.
+	AssertReplayConsistency bool
+	// PromoteAt, see ManifestNode.PromoteAt.
+	PromoteAt int64
+	// SendRate and RecvRate, see ManifestNode.SendRate.
+	SendRate int64
+	RecvRate int64
 }
 
 // LoadTestnet loads a testnet from a manifest file, using the filename to
@@ -135,10 +294,14 @@ func LoadTestnet(file string, ifd InfrastructureData) (*Testnet, error) {
 
 // NewTestnetFromManifest creates and validates a testnet from a manifest
 func NewTestnetFromManifest(manifest Manifest, file string, ifd InfrastructureData) (*Testnet, error) {
+	if err := manifest.Validate(); err != nil {
+		return nil, err
+	}
 	dir := strings.TrimSuffix(file, filepath.Ext(file))
 
 	keyGen := newKeyGenerator(randomSeed)
-	prometheusProxyPortGen := newPortGenerator(prometheusProxyPortFirst)
+	prometheusProxyPortGen := newPortGenerator(PrometheusProxyPortFirst)
+	pprofProxyPortGen := newPortGenerator(PprofProxyPortFirst)
 	_, ipNet, err := net.ParseCIDR(ifd.Network)
 	if err != nil {
 		return nil, fmt.Errorf("invalid IP network address %q: %w", ifd.Network, err)
@@ -146,6 +309,7 @@ func NewTestnetFromManifest(manifest Manifest, file string, ifd InfrastructureDa
 
 	testnet := &Testnet{
 		Name:                             filepath.Base(dir),
+		ChainID:                          manifest.ChainID,
 		File:                             file,
 		Dir:                              dir,
 		IP:                               ipNet,
@@ -158,17 +322,47 @@ func NewTestnetFromManifest(manifest Manifest, file string, ifd InfrastructureDa
 		LoadTxSizeBytes:                  manifest.LoadTxSizeBytes,
 		LoadTxBatchSize:                  manifest.LoadTxBatchSize,
 		LoadTxConnections:                manifest.LoadTxConnections,
+		LoadProfile:                      manifest.LoadProfile,
 		ABCIProtocol:                     manifest.ABCIProtocol,
+		ABCIApp:                          manifest.ABCIApp,
 		PrepareProposalDelay:             manifest.PrepareProposalDelay,
 		ProcessProposalDelay:             manifest.ProcessProposalDelay,
 		CheckTxDelay:                     manifest.CheckTxDelay,
 		VoteExtensionDelay:               manifest.VoteExtensionDelay,
 		FinalizeBlockDelay:               manifest.FinalizeBlockDelay,
+		PrepareProposalJitter:            manifest.PrepareProposalJitter,
+		ProcessProposalJitter:            manifest.ProcessProposalJitter,
 		UpgradeVersion:                   manifest.UpgradeVersion,
+		UpgradeHeight:                    manifest.UpgradeHeight,
 		Prometheus:                       manifest.Prometheus,
 		VoteExtensionsEnableHeight:       manifest.VoteExtensionsEnableHeight,
 		VoteExtensionSize:                manifest.VoteExtensionSize,
 		PeerGossipIntraloopSleepDuration: manifest.PeerGossipIntraloopSleepDuration,
+		GeneratorSeed:                    manifest.GeneratorSeed,
+		GeneratorVersion:                 manifest.GeneratorVersion,
+		ZoneLatencies:                    manifest.ZoneLatencies,
+		LinkLatencies:                    manifest.LinkLatencies,
+		SeedOnlyDiscovery:                manifest.SeedOnlyDiscovery,
+		GenesisTime:                      manifest.GenesisTime,
+		GenesisTimeOffset:                manifest.GenesisTimeOffset,
+		ExpectedFirstBlockBy:             manifest.ExpectedFirstBlockBy,
+		ExpectedCatchUpBy:                manifest.ExpectedCatchUpBy,
+		MaxGas:                           manifest.MaxGas,
+		ArchiveBlackoutHeight:            manifest.ArchiveBlackoutHeight,
+		ArchiveBlackoutDuration:          manifest.ArchiveBlackoutDuration,
+		GlobalRestartHeight:              manifest.GlobalRestartHeight,
+		EvidenceMaxAgeNumBlocks:          manifest.ConsensusParams.EvidenceMaxAgeNumBlocks,
+		EvidenceMaxAgeDuration:           manifest.ConsensusParams.EvidenceMaxAgeDuration,
+		MetricThresholds:                 manifest.MetricThresholds,
+		AssertProposerFairness:           manifest.AssertProposerFairness,
+		ThrottledGossip:                  manifest.ThrottledGossip,
+		BlockInterval:                    manifest.BlockInterval(),
+	}
+	if ifd.IPv6Network != "" {
+		_, testnet.IPv6Net, err = net.ParseCIDR(ifd.IPv6Network)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IPv6 network address %q: %w", ifd.IPv6Network, err)
+		}
 	}
 	if len(manifest.KeyType) != 0 {
 		testnet.KeyType = manifest.KeyType
@@ -176,9 +370,37 @@ func NewTestnetFromManifest(manifest Manifest, file string, ifd InfrastructureDa
 	if manifest.InitialHeight > 0 {
 		testnet.InitialHeight = manifest.InitialHeight
 	}
+	if manifest.ExpectedInitialAppHash != "" {
+		testnet.ExpectedInitialAppHash, err = hex.DecodeString(manifest.ExpectedInitialAppHash)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expected initial app hash %q: %w", manifest.ExpectedInitialAppHash, err)
+		}
+	}
+	if manifest.Snapshot != nil {
+		testnet.SnapshotHeight = manifest.Snapshot.Height
+		testnet.SnapshotHash, err = hex.DecodeString(manifest.Snapshot.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("invalid snapshot hash %q: %w", manifest.Snapshot.Hash, err)
+		}
+	}
+	if testnet.EvidenceMaxAgeNumBlocks == 0 {
+		testnet.EvidenceMaxAgeNumBlocks = EvidenceAgeHeight
+	}
+	if testnet.EvidenceMaxAgeDuration == 0 {
+		testnet.EvidenceMaxAgeDuration = EvidenceAgeTime
+	}
+	if testnet.ArchiveBlackoutHeight > 0 && testnet.ArchiveBlackoutDuration == 0 {
+		testnet.ArchiveBlackoutDuration = DefaultArchiveBlackoutDuration
+	}
 	if testnet.ABCIProtocol == "" {
 		testnet.ABCIProtocol = string(ProtocolBuiltin)
 	}
+	if testnet.ChainID == "" {
+		testnet.ChainID = testnet.Name
+	}
+	if testnet.ABCIApp == "" {
+		testnet.ABCIApp = ABCIAppKVStore
+	}
 	if testnet.UpgradeVersion == "" {
 		testnet.UpgradeVersion = localVersion
 	}
@@ -186,7 +408,7 @@ func NewTestnetFromManifest(manifest Manifest, file string, ifd InfrastructureDa
 		testnet.LoadTxConnections = defaultConnections
 	}
 	if testnet.LoadTxBatchSize == 0 {
-		testnet.LoadTxBatchSize = defaultBatchSize
+		testnet.LoadTxBatchSize = DefaultLoadTxBatchSize
 	}
 	if testnet.LoadTxSizeBytes == 0 {
 		testnet.LoadTxSizeBytes = defaultTxSizeBytes
@@ -206,33 +428,65 @@ func NewTestnetFromManifest(manifest Manifest, file string, ifd InfrastructureDa
 		if v == "" {
 			v = localVersion
 		}
+		keyType := manifest.KeyType
+		if nodeManifest.KeyType != "" {
+			keyType = nodeManifest.KeyType
+		}
+		if !isSupportedKeyType(keyType) {
+			return nil, fmt.Errorf("unsupported key type %q for node %q", keyType, name)
+		}
+		if !isSupportedNodeKeyType(nodeManifest.NodeKeyType) {
+			return nil, fmt.Errorf("unsupported node key type %q for node %q", nodeManifest.NodeKeyType, name)
+		}
+
+		// Keys are always drawn from keyGen, so that a key seed doesn't change
+		// the keys it doesn't apply to.
+		privvalKey := keyGen.Generate(keyType)
+		nodeKey := keyGen.Generate(keyTypeOrDefault(nodeManifest.NodeKeyType))
+		if manifest.KeySeed != 0 {
+			privvalKey = namedKey(manifest.KeySeed, name, keyType)
+		}
+		if manifest.SharedNodeKeys {
+			nodeKey = namedKey(manifest.KeySeed, "node/"+name, keyTypeOrDefault(nodeManifest.NodeKeyType))
+		}
 
 		node := &Node{
-			Name:             name,
-			Version:          v,
-			Testnet:          testnet,
-			PrivvalKey:       keyGen.Generate(manifest.KeyType),
-			NodeKey:          keyGen.Generate("ed25519"),
-			InternalIP:       ind.IPAddress,
-			ExternalIP:       extIP,
-			ProxyPort:        ind.Port,
-			Mode:             ModeValidator,
-			Database:         "goleveldb",
-			ABCIProtocol:     Protocol(testnet.ABCIProtocol),
-			PrivvalProtocol:  ProtocolFile,
-			StartAt:          nodeManifest.StartAt,
-			BlockSyncVersion: nodeManifest.BlockSyncVersion,
-			StateSync:        nodeManifest.StateSync,
-			PersistInterval:  1,
-			SnapshotInterval: nodeManifest.SnapshotInterval,
-			RetainBlocks:     nodeManifest.RetainBlocks,
-			Perturbations:    []Perturbation{},
-			SendNoLoad:       nodeManifest.SendNoLoad,
-			Prometheus:       testnet.Prometheus,
+			Name:               name,
+			Version:            v,
+			Testnet:            testnet,
+			PrivvalKey:         privvalKey,
+			NodeKey:            nodeKey,
+			InternalIP:         ind.IPAddress,
+			InternalIPv6:       ind.IPv6Address,
+			ExternalIP:         extIP,
+			ProxyPort:          ind.Port,
+			Mode:               ModeValidator,
+			Database:           "goleveldb",
+			ABCIProtocol:       Protocol(testnet.ABCIProtocol),
+			PrivvalProtocol:    ProtocolFile,
+			StartAt:            nodeManifest.StartAt,
+			BlockSyncVersion:   nodeManifest.BlockSyncVersion,
+			StateSync:          nodeManifest.StateSync,
+			PersistInterval:    1,
+			SnapshotInterval:   nodeManifest.SnapshotInterval,
+			RetainBlocks:       nodeManifest.RetainBlocks,
+			ShortRetention:     nodeManifest.ShortRetention,
+			Perturbations:      []Perturbation{},
+			VoteExtensionDelay: testnet.VoteExtensionDelay,
+			SendNoLoad:         nodeManifest.SendNoLoad,
+			LoadWeight:         nodeManifest.LoadWeight,
+			Prometheus:         testnet.Prometheus,
 		}
 		if node.StartAt == testnet.InitialHeight {
 			node.StartAt = 0 // normalize to 0 for initial nodes, since code expects this
 		}
+		node.AddressFamily = AddressFamily(nodeManifest.AddressFamily)
+		if node.AddressFamily == "" {
+			node.AddressFamily = AddressFamilyIPv4
+			if node.InternalIP.To4() == nil {
+				node.AddressFamily = AddressFamilyIPv6
+			}
+		}
 		if node.BlockSyncVersion == "" {
 			node.BlockSyncVersion = "v0"
 		}
@@ -251,16 +505,121 @@ func NewTestnetFromManifest(manifest Manifest, file string, ifd InfrastructureDa
 		if nodeManifest.PersistInterval != nil {
 			node.PersistInterval = *nodeManifest.PersistInterval
 		}
-		if node.Prometheus {
+		node.MempoolCacheSize = config.DefaultMempoolConfig().CacheSize
+		if nodeManifest.MempoolCacheSize != nil {
+			node.MempoolCacheSize = *nodeManifest.MempoolCacheSize
+		}
+		node.MempoolRecheck = config.DefaultMempoolConfig().Recheck
+		if nodeManifest.MempoolRecheck != nil {
+			node.MempoolRecheck = *nodeManifest.MempoolRecheck
+		}
+		node.WALEnabled = true
+		if nodeManifest.WALEnabled != nil {
+			node.WALEnabled = *nodeManifest.WALEnabled
+		}
+		node.RPCUnsafe = nodeManifest.RPCConfig.Unsafe
+		node.RPCMaxSubscriptions = config.DefaultRPCConfig().MaxSubscriptionsPerClient
+		if nodeManifest.RPCConfig.MaxSubscriptionsPerClient != nil {
+			node.RPCMaxSubscriptions = *nodeManifest.RPCConfig.MaxSubscriptionsPerClient
+		}
+		if nodeManifest.VoteExtensionDelay != 0 {
+			node.VoteExtensionDelay = nodeManifest.VoteExtensionDelay
+		}
+		node.SnapshotFormat = defaultSnapshotFormat
+		if nodeManifest.SnapshotFormat != 0 {
+			node.SnapshotFormat = nodeManifest.SnapshotFormat
+		}
+		node.SnapshotChunkSize = nodeManifest.SnapshotChunkSize
+		node.TimeoutPropose = nodeManifest.TimeoutPropose
+		node.TimeoutCommit = nodeManifest.TimeoutCommit
+		node.MaxBlockBytes = nodeManifest.MaxBlockBytes
+		if node.MaxBlockBytes != 0 {
+			testnet.MaxBlockBytes = node.MaxBlockBytes
+		}
+		node.AppConfig = nodeManifest.AppConfig
+		node.ClockSkew = nodeManifest.ClockSkew
+		node.StartupBackoff = nodeManifest.StartupBackoff
+		node.MaxDialRetries = nodeManifest.MaxDialRetries
+		node.MaxInboundPeers = nodeManifest.MaxInboundPeers
+		node.MaxOutboundPeers = nodeManifest.MaxOutboundPeers
+		node.TrustPeriod = nodeManifest.TrustPeriod
+		node.TrustHeight = nodeManifest.TrustHeight
+		node.Zone = nodeManifest.Zone
+		node.BehindNAT = nodeManifest.BehindNAT
+		node.ExternalAddress = nodeManifest.ExternalAddress
+		node.DiskBandwidth = nodeManifest.DiskBandwidth
+		node.FlapInterval = nodeManifest.FlapInterval
+		node.RecoveryMode = RecoveryMode(nodeManifest.RecoveryMode)
+		node.AssertReplayConsistency = nodeManifest.AssertReplayConsistency
+		node.PromoteAt = nodeManifest.PromoteAt
+		node.SendRate = nodeManifest.SendRate
+		node.RecvRate = nodeManifest.RecvRate
+		node.Prometheus = node.Prometheus || nodeManifest.EnablePrometheus
+		switch {
+		case nodeManifest.PrometheusPort != 0 && !node.Prometheus:
+			return nil, fmt.Errorf("node %q has a Prometheus port but Prometheus is disabled", name)
+		case nodeManifest.PrometheusPort != 0:
+			node.PrometheusProxyPort = nodeManifest.PrometheusPort
+		case node.Prometheus:
 			node.PrometheusProxyPort = prometheusProxyPortGen.Next()
 		}
+		node.Pprof = nodeManifest.EnablePprof
+		switch {
+		case nodeManifest.PprofPort != 0 && !node.Pprof:
+			return nil, fmt.Errorf("node %q has a pprof port but pprof is disabled", name)
+		case nodeManifest.PprofPort != 0:
+			node.PprofProxyPort = nodeManifest.PprofPort
+		case node.Pprof:
+			node.PprofProxyPort = pprofProxyPortGen.Next()
+		}
 		for _, p := range nodeManifest.Perturb {
 			node.Perturbations = append(node.Perturbations, Perturbation(p))
 		}
+		for heightStr, misbehavior := range nodeManifest.Misbehaviors {
+			height, err := strconv.ParseInt(heightStr, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid misbehavior height %q for node %q: %w", heightStr, name, err)
+			}
+			if node.Misbehaviors == nil {
+				node.Misbehaviors = map[int64]Misbehavior{}
+			}
+			node.Misbehaviors[height] = Misbehavior(misbehavior)
+		}
+		// Rotated keys are derived rather than drawn from keyGen, so that
+		// rotations don't change any other key.
+		keySeed := manifest.KeySeed
+		if keySeed == 0 {
+			keySeed = randomSeed
+		}
+		for heightStr, keyID := range nodeManifest.KeyRotations {
+			height, err := strconv.ParseInt(heightStr, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid key rotation height %q for node %q: %w", heightStr, name, err)
+			}
+			if keyID == "" {
+				return nil, fmt.Errorf("key rotation of node %q at height %v has no key ID", name, height)
+			}
+			if node.KeyRotations == nil {
+				node.KeyRotations = map[int64]crypto.PrivKey{}
+			}
+			node.KeyRotations[height] = namedKey(keySeed, "rotation/"+name+"/"+keyID, keyType)
+		}
 		testnet.Nodes = append(testnet.Nodes, node)
 	}
 
 	// We do a second pass to set up seeds and persistent peers, which allows graph cycles.
+	// Sentries are resolved first, since they change the default peers.
+	for _, node := range testnet.Nodes {
+		sentryFor := manifest.Nodes[node.Name].SentryFor
+		if sentryFor == "" {
+			continue
+		}
+		node.SentryFor = testnet.LookupNode(sentryFor)
+		if node.SentryFor == nil {
+			return nil, fmt.Errorf("unknown validator %q for sentry %q", sentryFor, node.Name)
+		}
+	}
+
 	for _, node := range testnet.Nodes {
 		nodeManifest, ok := manifest.Nodes[node.Name]
 		if !ok {
@@ -280,19 +639,63 @@ func NewTestnetFromManifest(manifest Manifest, file string, ifd InfrastructureDa
 			}
 			node.PersistentPeers = append(node.PersistentPeers, peer)
 		}
+		for _, witnessName := range nodeManifest.Witnesses {
+			witness := testnet.LookupNode(witnessName)
+			if witness == nil {
+				return nil, fmt.Errorf("unknown witness %q for node %q", witnessName, node.Name)
+			}
+			node.Witnesses = append(node.Witnesses, witness)
+		}
 
 		// If there are no seeds or persistent peers specified, default to persistent
-		// connections to all other nodes.
-		if len(node.PersistentPeers) == 0 && len(node.Seeds) == 0 {
+		// connections to all other nodes it shares an address family with, unless
+		// nodes must discover their peers through seeds. Validators with sentries
+		// only connect to them, and are hidden from all other nodes.
+		if len(node.PersistentPeers) == 0 && len(node.Seeds) == 0 && !testnet.SeedOnlyDiscovery {
+			sentries := testnet.Sentries(node)
 			for _, peer := range testnet.Nodes {
 				if peer.Name == node.Name {
 					continue
 				}
+				if _, ok := node.AddressFamily.Common(peer.AddressFamily); !ok {
+					continue
+				}
+				if len(sentries) > 0 && peer.SentryFor != node {
+					continue
+				}
+				if node.SentryFor != peer && node.Mode != ModeLight && len(testnet.Sentries(peer)) > 0 {
+					continue
+				}
 				node.PersistentPeers = append(node.PersistentPeers, peer)
 			}
 		}
 	}
 
+	for _, name := range manifest.BridgeNodes {
+		node := testnet.LookupNode(name)
+		if node == nil {
+			return nil, fmt.Errorf("unknown bridge node %q", name)
+		}
+		if node.Stateless() {
+			return nil, fmt.Errorf("bridge node %q must be a validator or full node", name)
+		}
+		if node.BehindNAT {
+			return nil, fmt.Errorf("bridge node %q must not be behind NAT", name)
+		}
+		testnet.BridgeNodes = append(testnet.BridgeNodes, node)
+	}
+
+	for _, name := range manifest.ArchiveNodes {
+		node := testnet.LookupNode(name)
+		if node == nil {
+			return nil, fmt.Errorf("unknown archive node %q", name)
+		}
+		if !slices.Contains(testnet.ArchiveNodes(), node) {
+			return nil, fmt.Errorf("archive node %q must be a validator or full node starting at genesis, "+
+				"retaining all blocks and not recovering with state sync", name)
+		}
+	}
+
 	// Set up genesis validators. If not specified explicitly, use all validator nodes.
 	if manifest.Validators != nil {
 		for validatorName, power := range *manifest.Validators {
@@ -341,153 +744,1740 @@ func (t Testnet) Validate() error {
 	if len(t.Nodes) == 0 {
 		return errors.New("network has no nodes")
 	}
-	for _, node := range t.Nodes {
-		if err := node.Validate(t); err != nil {
-			return fmt.Errorf("invalid node %q: %w", node.Name, err)
+	if len(t.ValidatorKeyTypes()) > 1 {
+		// Older versions of the application only know a single validator key
+		// type, and would compute different validator updates.
+		for _, node := range t.Nodes {
+			if node.Version != localVersion {
+				return fmt.Errorf("mixed validator key types require all nodes to run the local version, "+
+					"but node %q runs %q", node.Name, node.Version)
+			}
 		}
 	}
-	return nil
-}
-
-// Validate validates a node.
-func (n Node) Validate(testnet Testnet) error {
-	if n.Name == "" {
-		return errors.New("node has no name")
+	if err := t.validateZoneLatencies(); err != nil {
+		return err
 	}
-	if n.InternalIP == nil {
-		return errors.New("node has no IP address")
+	if err := t.validateLinkLatencies(); err != nil {
+		return err
 	}
-	if !testnet.IP.Contains(n.InternalIP) {
-		return fmt.Errorf("node IP %v is not in testnet network %v", n.InternalIP, testnet.IP)
+	if err := t.validateKeys(); err != nil {
+		return err
 	}
-	if n.ProxyPort == n.PrometheusProxyPort {
-		return fmt.Errorf("node local port %v used also for Prometheus local port", n.ProxyPort)
+	if err := t.validateChainID(); err != nil {
+		return err
 	}
-	if n.ProxyPort > 0 && n.ProxyPort <= 1024 {
-		return fmt.Errorf("local port %v must be >1024", n.ProxyPort)
+	if err := t.validateABCIApp(); err != nil {
+		return err
 	}
-	if n.PrometheusProxyPort > 0 && n.PrometheusProxyPort <= 1024 {
-		return fmt.Errorf("local port %v must be >1024", n.PrometheusProxyPort)
+	if err := t.validateAppConfig(); err != nil {
+		return err
 	}
-	for _, peer := range testnet.Nodes {
-		if peer.Name != n.Name && peer.ProxyPort == n.ProxyPort && peer.ExternalIP.Equal(n.ExternalIP) {
-			return fmt.Errorf("peer %q also has local port %v", peer.Name, n.ProxyPort)
-		}
-		if n.PrometheusProxyPort > 0 {
-			if peer.Name != n.Name && peer.PrometheusProxyPort == n.PrometheusProxyPort {
-				return fmt.Errorf("peer %q also has local port %v", peer.Name, n.PrometheusProxyPort)
-			}
-		}
+	if err := t.validateRPCSurface(); err != nil {
+		return err
 	}
-	switch n.BlockSyncVersion {
-	case "v0":
-	default:
-		return fmt.Errorf("invalid block sync setting %q", n.BlockSyncVersion)
+	if t.EvidenceMaxAgeNumBlocks < 0 || t.EvidenceMaxAgeDuration < 0 {
+		return errors.New("evidence_max_age_num_blocks and evidence_max_age_duration must not be negative")
 	}
-	switch n.Database {
-	case "goleveldb", "cleveldb", "boltdb", "rocksdb", "badgerdb":
-	default:
-		return fmt.Errorf("invalid database setting %q", n.Database)
+	if t.PrepareProposalJitter < 0 || t.ProcessProposalJitter < 0 {
+		return errors.New("prepare_proposal_jitter and process_proposal_jitter must not be negative")
 	}
-	switch n.ABCIProtocol {
-	case ProtocolBuiltin, ProtocolBuiltinConnSync, ProtocolUNIX, ProtocolTCP, ProtocolGRPC:
-	default:
-		return fmt.Errorf("invalid ABCI protocol setting %q", n.ABCIProtocol)
+	if t.ExpectedFirstBlockBy < 0 || t.ExpectedCatchUpBy < 0 {
+		return errors.New("expected_first_block_by and expected_catch_up_by must not be negative")
 	}
-	if n.Mode == ModeLight && n.ABCIProtocol != ProtocolBuiltin && n.ABCIProtocol != ProtocolBuiltinConnSync {
-		return errors.New("light client must use builtin protocol")
+	if !t.GenesisTime.IsZero() && t.GenesisTimeOffset != 0 {
+		return errors.New("genesis_time and genesis_time_offset can't be combined")
 	}
-	switch n.PrivvalProtocol {
-	case ProtocolFile, ProtocolUNIX, ProtocolTCP:
-	default:
-		return fmt.Errorf("invalid privval protocol setting %q", n.PrivvalProtocol)
+	// Nodes mustn't wait for genesis longer than they may take to produce
+	// the first block.
+	if t.ExpectedFirstBlockBy > 0 && t.GenesisTimeOffset >= t.ExpectedFirstBlockBy {
+		return fmt.Errorf("genesis_time_offset (%v) must be less than expected_first_block_by (%v)",
+			t.GenesisTimeOffset, t.ExpectedFirstBlockBy)
 	}
-
-	if n.StartAt > 0 && n.StartAt < n.Testnet.InitialHeight {
-		return fmt.Errorf("cannot start at height %v lower than initial height %v",
-			n.StartAt, n.Testnet.InitialHeight)
+	if err := t.validateUpgradeHeight(); err != nil {
+		return err
 	}
-	if n.StateSync && n.StartAt == 0 {
-		return errors.New("state synced nodes cannot start at the initial height")
+	if err := t.validateBlockParams(); err != nil {
+		return err
 	}
-	if n.RetainBlocks != 0 && n.RetainBlocks < uint64(EvidenceAgeHeight) {
-		return fmt.Errorf("retain_blocks must be 0 or be greater or equal to max evidence age (%d)",
-			EvidenceAgeHeight)
+	if err := t.validateGossipRates(); err != nil {
+		return err
 	}
-	if n.PersistInterval == 0 && n.RetainBlocks > 0 {
-		return errors.New("persist_interval=0 requires retain_blocks=0")
+	if err := t.validateSyncCapacity(); err != nil {
+		return err
 	}
-	if n.PersistInterval > 1 && n.RetainBlocks > 0 && n.RetainBlocks < n.PersistInterval {
-		return errors.New("persist_interval must be less than or equal to retain_blocks")
+	if err := t.validateSnapshot(); err != nil {
+		return err
 	}
-	if n.SnapshotInterval > 0 && n.RetainBlocks > 0 && n.RetainBlocks < n.SnapshotInterval {
-		return errors.New("snapshot_interval must be less than er equal to retain_blocks")
+	if err := t.validateSeedOnlyDiscovery(); err != nil {
+		return err
+	}
+	if err := t.validatePeerLimits(); err != nil {
+		return err
+	}
+	if err := t.validateArchiveBlackout(); err != nil {
+		return err
+	}
+	if err := t.validateGlobalRestart(); err != nil {
+		return err
+	}
+	if err := t.validateSentries(); err != nil {
+		return err
+	}
+	if err := t.validateMetricThresholds(); err != nil {
+		return err
+	}
+	if err := t.validateKeyRotations(); err != nil {
+		return err
+	}
+	if t.LoadProfile != nil {
+		if err := t.LoadProfile.Validate(); err != nil {
+			return fmt.Errorf("invalid load profile: %w", err)
+		}
+	}
+	for _, node := range t.Nodes {
+		if err := node.Validate(t); err != nil {
+			return fmt.Errorf("invalid node %q: %w", node.Name, err)
+		}
+		if node.StateSync && len(t.SnapshotProviders(node)) == 0 {
+			return fmt.Errorf("state syncing node %q has no snapshot provider with format %d",
+				node.Name, node.SnapshotFormat)
+		}
+		if err := t.validateRecoverySource(node); err != nil {
+			return fmt.Errorf("invalid node %q: %w", node.Name, err)
+		}
+		if err := t.validateLightTrust(node); err != nil {
+			return err
+		}
+		for height := range node.Misbehaviors {
+			if err := t.validateHonestQuorum(height); err != nil {
+				return err
+			}
+		}
+	}
+	if err := t.validateShortRetention(); err != nil {
+		return err
+	}
+	if err := t.validateAbsentQuorum(); err != nil {
+		return err
+	}
+	if err := t.validateProposerFairness(); err != nil {
+		return err
+	}
+	if err := t.validatePromotions(); err != nil {
+		return err
+	}
+	// A quorum of validators never loses its signer, or flaps, at once.
+	for _, perturbation := range []Perturbation{PerturbationPrivvalDisconnect, PerturbationFlap, PerturbationWALTruncate} {
+		if err := t.validatePerturbedQuorum(perturbation); err != nil {
+			return err
+		}
 	}
+	return t.validateUnthrottledQuorum()
+}
 
-	var upgradeFound bool
-	for _, perturbation := range n.Perturbations {
-		switch perturbation {
-		case PerturbationUpgrade:
-			if upgradeFound {
-				return fmt.Errorf("'upgrade' perturbation can appear at most once per node")
+// validateKeys checks that no two nodes share a consensus or P2P key, which
+// could happen with a key_seed if their names' hashes collide.
+func (t Testnet) validateKeys() error {
+	owners := map[string]string{}
+	for _, node := range t.Nodes {
+		keys := []crypto.PrivKey{node.PrivvalKey, node.NodeKey}
+		for _, key := range node.KeyRotations {
+			keys = append(keys, key)
+		}
+		for _, key := range keys {
+			if key == nil {
+				continue
 			}
-			upgradeFound = true
-		case PerturbationDisconnect, PerturbationKill, PerturbationPause, PerturbationRestart:
-		default:
-			return fmt.Errorf("invalid perturbation %q", perturbation)
+			pubKey := string(key.PubKey().Bytes())
+			if owner, ok := owners[pubKey]; ok {
+				return fmt.Errorf("nodes %q and %q share a key", owner, node.Name)
+			}
+			owners[pubKey] = node.Name
 		}
 	}
+	return nil
+}
+
+// chainIDRegexp matches valid chain IDs. CometBFT only bounds their length,
+// see types.MaxChainIDLen, but they also end up in file names, log lines and
+// metric labels, so they are restricted to a portable charset.
+var chainIDRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
 
+// validateChainID checks that the chain ID of the testnet, whether set in the
+// manifest or defaulting to its name, is valid, see chainIDRegexp.
+func (t Testnet) validateChainID() error {
+	if len(t.ChainID) > types.MaxChainIDLen {
+		return fmt.Errorf("chain ID %q is %d characters long, must be at most %d",
+			t.ChainID, len(t.ChainID), types.MaxChainIDLen)
+	}
+	if !chainIDRegexp.MatchString(t.ChainID) {
+		return fmt.Errorf("invalid chain ID %q, which must only contain letters, digits, '.', '_' and '-'",
+			t.ChainID)
+	}
 	return nil
 }
 
-// LookupNode looks up a node by name. For now, simply do a linear search.
-func (t Testnet) LookupNode(name string) *Node {
+// abciAppRegexp matches the names of application binaries.
+var abciAppRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// validateABCIApp checks that an application other than the kvstore is named
+// by a binary, and that no kvstore-specific settings are used with it.
+func (t Testnet) validateABCIApp() error {
+	if t.ABCIApp == ABCIAppKVStore {
+		return nil
+	}
+	if !abciAppRegexp.MatchString(t.ABCIApp) {
+		return fmt.Errorf("invalid abci_app %q, which must be the name of a binary", t.ABCIApp)
+	}
+	if len(t.InitialState) > 0 || len(t.ExpectedInitialAppHash) > 0 {
+		return fmt.Errorf("initial_state and expected_initial_app_hash only apply to the %v app", ABCIAppKVStore)
+	}
 	for _, node := range t.Nodes {
-		if node.Name == name {
-			return node
+		if node.Mode != ModeLight && (node.ABCIProtocol == ProtocolBuiltin || node.ABCIProtocol == ProtocolBuiltinConnSync) {
+			return fmt.Errorf("node %q cannot run app %q with the %q protocol, which only runs the %v app",
+				node.Name, t.ABCIApp, node.ABCIProtocol, ABCIAppKVStore)
 		}
 	}
 	return nil
 }
 
-// ArchiveNodes returns a list of archive nodes that start at the initial height
-// and contain the entire blockchain history. They are used e.g. as light client
-// RPC servers.
-func (t Testnet) ArchiveNodes() []*Node {
-	nodes := []*Node{}
+// validateAppConfig checks that the app_config of the nodes lets the network
+// reach consensus: all nodes must agree on whether to accept empty vote
+// extensions, and unless they do, validators omitting vote extensions must
+// hold less than 1/3 of the voting power at every height.
+func (t Testnet) validateAppConfig() error {
+	var configured *Node
 	for _, node := range t.Nodes {
-		if !node.Stateless() && node.StartAt == 0 && node.RetainBlocks == 0 {
-			nodes = append(nodes, node)
+		if len(node.AppConfig) > 0 {
+			configured = node
+			break
 		}
 	}
-	return nodes
-}
+	if configured == nil {
+		return nil
+	}
+	if t.ABCIApp != ABCIAppKVStore {
+		return fmt.Errorf("node %q sets app_config, which only applies to the %v app", configured.Name, ABCIAppKVStore)
+	}
 
-// RandomNode returns a random non-seed node.
-func (t Testnet) RandomNode() *Node {
-	for {
-		node := t.Nodes[rand.Intn(len(t.Nodes))] //nolint:gosec
-		if node.Mode != ModeSeed {
-			return node
+	emptyExtensions := func(node *Node) string {
+		if value, ok := node.AppConfig[app.AppConfigEmptyVoteExtensions]; ok {
+			return value
+		}
+		return app.AppConfigToggles[app.AppConfigEmptyVoteExtensions][0]
+	}
+	accept := emptyExtensions(configured)
+	for _, node := range t.Nodes {
+		if node.Mode != ModeLight && emptyExtensions(node) != accept {
+			return fmt.Errorf("nodes %q and %q disagree on %v, which all nodes must agree on",
+				configured.Name, node.Name, app.AppConfigEmptyVoteExtensions)
+		}
+	}
+	if t.VoteExtensionsEnableHeight == 0 || accept == "accept" {
+		return nil
+	}
+
+	heights := []int64{t.InitialHeight}
+	for h := range t.ValidatorUpdates {
+		heights = append(heights, h)
+	}
+	for _, height := range heights {
+		var total, omitting int64
+		for node, power := range t.ValidatorPowersAt(height) {
+			total += power
+			if node.AppConfig[app.AppConfigVoteExtensions] == "omit" {
+				omitting += power
+			}
+		}
+		if 3*omitting >= total && omitting > 0 {
+			return fmt.Errorf("validators omitting vote extensions hold %v of %v voting power at height %v, "+
+				"which cannot reach consensus unless all nodes accept empty vote extensions", omitting, total, height)
 		}
 	}
+	return nil
 }
 
-// IPv6 returns true if the testnet is an IPv6 network.
-func (t Testnet) IPv6() bool {
-	return t.IP.IP.To4() == nil
+// MaxEvidenceBytes is the maximum size of the evidence in blocks of at most
+// maxBlockBytes, which the runner sets in the genesis along with the block
+// size.
+func MaxEvidenceBytes(maxBlockBytes int64) int64 {
+	return maxBlockBytes / 4
 }
 
-// HasPerturbations returns whether the network has any perturbations.
-func (t Testnet) HasPerturbations() bool {
+// validateBlockParams checks that the nodes agree on the network-wide block
+// size, and that blocks of that size have room for a commit of every
+// validator, evidence, and the largest load transaction.
+func (t Testnet) validateBlockParams() error {
+	if t.MaxGas < 0 {
+		return fmt.Errorf("max_gas must not be negative, got %v", t.MaxGas)
+	}
+	validators := 0
 	for _, node := range t.Nodes {
-		if len(node.Perturbations) > 0 {
-			return true
+		if node.Mode == ModeValidator || node.PromoteAt > 0 {
+			validators++
+		}
+		switch {
+		case node.MaxBlockBytes < 0 || node.MaxBlockBytes > types.MaxBlockSizeBytes:
+			return fmt.Errorf("node %q has max_block_bytes %v, must be between 0 and %v",
+				node.Name, node.MaxBlockBytes, types.MaxBlockSizeBytes)
+		case node.MaxBlockBytes == t.MaxBlockBytes:
+		case node.MaxBlockBytes != 0 || node.Mode == ModeValidator:
+			return fmt.Errorf("node %q has max_block_bytes %v, but other nodes have %v: "+
+				"it is a consensus parameter, which all validators must agree on",
+				node.Name, node.MaxBlockBytes, t.MaxBlockBytes)
 		}
 	}
-	return false
-}
+	if t.MaxBlockBytes == 0 {
+		return nil
+	}
+
+	txSize := t.maxLoadTxSize()
+	dataBytes := t.MaxBlockBytes - MaxEvidenceBytes(t.MaxBlockBytes) -
+		types.MaxOverheadForBlock - types.MaxHeaderBytes - types.MaxCommitBytes(validators)
+	if dataBytes < int64(txSize) {
+		return fmt.Errorf("max_block_bytes %v leaves room for %v bytes of transactions, "+
+			"too few for load transactions of %v bytes", t.MaxBlockBytes, dataBytes, txSize)
+	}
+	return nil
+}
+
+// maxLoadTxSize returns the size in bytes of the largest load transaction.
+func (t Testnet) maxLoadTxSize() int {
+	txSize := t.LoadTxSizeBytes
+	if t.LoadProfile != nil {
+		for _, size := range t.LoadProfile.TxSizes {
+			txSize = max(txSize, size)
+		}
+	}
+	return txSize
+}
+
+// ExpectedBlockBytes estimates the size of the testnet's blocks under load:
+// the largest transactions sent at the peak rate during a block interval,
+// bounded by max_block_bytes.
+func (t Testnet) ExpectedBlockBytes() int64 {
+	rate := t.LoadTxBatchSize
+	if t.LoadProfile != nil {
+		rate = t.LoadProfile.PeakRate()
+	}
+	return expectedBlockBytes(rate, t.maxLoadTxSize(), t.MaxBlockBytes, t.BlockInterval)
+}
+
+// MinGossipRate returns the lowest send_rate and recv_rate, in bytes per
+// second, that let a block of the expected size propagate within the block
+// interval, see ExpectedBlockBytes.
+func (t Testnet) MinGossipRate() int64 {
+	return minGossipRate(t.ExpectedBlockBytes(), t.BlockInterval)
+}
+
+// expectedBlockBytes estimates the size of blocks holding the transactions
+// of the given size sent at the given rate per second during a block
+// interval, bounded by maxBlockBytes if positive.
+func expectedBlockBytes(txRate, txSize int, maxBlockBytes int64, interval time.Duration) int64 {
+	expected := int64(txRate) * int64(txSize) * int64(interval) / int64(time.Second)
+	if maxBlockBytes > 0 {
+		expected = min(expected, maxBlockBytes)
+	}
+	return expected
+}
+
+// gossipRateHeadroom is the factor by which gossip rates must exceed the
+// expected block size per block interval, as transactions are sent to peers
+// twice: once by the mempool, and once in block parts.
+const gossipRateHeadroom = 2
+
+// minGossipRate returns the lowest gossip rate, in bytes per second, that lets
+// blocks of the given size propagate within the block interval.
+func minGossipRate(blockBytes int64, interval time.Duration) int64 {
+	if interval <= 0 {
+		return 0
+	}
+	return (gossipRateHeadroom*blockBytes*int64(time.Second) + int64(interval) - 1) / int64(interval)
+}
+
+// validateGossipRates checks that the nodes' send and receive rates are high
+// enough for blocks to propagate within the block interval, unless the
+// testnet is intentionally throttled. Rates of 0 are the CometBFT defaults.
+func (t Testnet) validateGossipRates() error {
+	minRate := t.MinGossipRate()
+	for _, node := range t.Nodes {
+		for _, rate := range []struct {
+			name  string
+			value int64
+		}{{"send_rate", node.SendRate}, {"recv_rate", node.RecvRate}} {
+			switch {
+			case rate.value < 0:
+				return fmt.Errorf("node %q has %v %v, must not be negative", node.Name, rate.name, rate.value)
+			case rate.value == 0 || t.ThrottledGossip:
+			case rate.value < minRate:
+				return fmt.Errorf("node %q has %v %v bytes/s, must be at least %v for blocks of %v bytes "+
+					"to propagate within the block interval of %v, or throttled_gossip must be set",
+					node.Name, rate.name, rate.value, minRate, t.ExpectedBlockBytes(), t.BlockInterval)
+			}
+		}
+	}
+	return nil
+}
+
+// validateUpgradeHeight checks that the nodes to be upgraded by a coordinated
+// upgrade are running when it happens, and aren't upgraded otherwise.
+func (t Testnet) validateUpgradeHeight() error {
+	if t.UpgradeHeight == 0 {
+		return nil
+	}
+	if t.UpgradeHeight <= t.InitialHeight {
+		return fmt.Errorf("upgrade_height %v must be above the initial height %v", t.UpgradeHeight, t.InitialHeight)
+	}
+	for _, node := range t.Nodes {
+		if node.Version == t.UpgradeVersion {
+			continue
+		}
+		if node.StartAt >= t.UpgradeHeight {
+			return fmt.Errorf("node %q must start below upgrade_height %v, or run the upgrade version",
+				node.Name, t.UpgradeHeight)
+		}
+		for _, perturbation := range node.Perturbations {
+			if perturbation == PerturbationUpgrade {
+				return fmt.Errorf("node %q cannot use the 'upgrade' perturbation with upgrade_height", node.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// validateArchiveBlackout checks that an archive blackout has archive nodes to
+// kill, leaves the network live, and ends before the catch-up SLA expires.
+func (t Testnet) validateArchiveBlackout() error {
+	if t.ArchiveBlackoutHeight == 0 {
+		return nil
+	}
+	if t.ArchiveBlackoutHeight <= t.InitialHeight {
+		return fmt.Errorf("archive_blackout_height %v must be above the initial height %v",
+			t.ArchiveBlackoutHeight, t.InitialHeight)
+	}
+	if t.ArchiveBlackoutDuration < 0 {
+		return errors.New("archive_blackout_duration must not be negative")
+	}
+	if t.ExpectedCatchUpBy > 0 && t.ArchiveBlackoutDuration >= t.ExpectedCatchUpBy {
+		return fmt.Errorf("archive_blackout_duration %v must be below expected_catch_up_by %v",
+			t.ArchiveBlackoutDuration, t.ExpectedCatchUpBy)
+	}
+	if t.UpgradeHeight > 0 {
+		return errors.New("archive_blackout_height cannot be combined with upgrade_height")
+	}
+	archiveNodes := t.ArchiveNodes()
+	if len(archiveNodes) == 0 {
+		return errors.New("archive_blackout_height requires at least one archive node")
+	}
+	var total, archived int64
+	for node, power := range t.ValidatorPowersAt(t.ArchiveBlackoutHeight) {
+		total += power
+		if slices.Contains(archiveNodes, node) {
+			archived += power
+		}
+	}
+	if 3*archived >= total {
+		return fmt.Errorf("archive validators hold %v of %v voting power at archive_blackout_height %v, "+
+			"must be less than 1/3", archived, total, t.ArchiveBlackoutHeight)
+	}
+	return nil
+}
+
+// validateGlobalRestart checks that a global restart happens once every node
+// has started, and that the restarted nodes recover their state without
+// losing data.
+func (t Testnet) validateGlobalRestart() error {
+	if t.GlobalRestartHeight == 0 {
+		return nil
+	}
+	if t.GlobalRestartHeight <= t.InitialHeight {
+		return fmt.Errorf("global_restart_height %v must be above the initial height %v",
+			t.GlobalRestartHeight, t.InitialHeight)
+	}
+	if t.UpgradeHeight > 0 {
+		return errors.New("global_restart_height cannot be combined with upgrade_height")
+	}
+	if t.ArchiveBlackoutHeight > 0 {
+		return errors.New("global_restart_height cannot be combined with archive_blackout_height")
+	}
+	for _, node := range t.Nodes {
+		if node.StartAt >= t.GlobalRestartHeight {
+			return fmt.Errorf("node %q starts at height %v, but all nodes must have started by global_restart_height %v",
+				node.Name, node.StartAt, t.GlobalRestartHeight)
+		}
+		// Nodes not persisting their state would lose it. The others retain
+		// the blocks of at least one persist interval, see Node.Validate, and
+		// replay them.
+		if node.Mode != ModeLight && node.PersistInterval == 0 {
+			return fmt.Errorf("node %q has persist_interval=0, but global_restart_height requires "+
+				"every node but light clients to persist its state", node.Name)
+		}
+	}
+	return nil
+}
+
+// validateRPCSurface checks that at least one validator or full node accepts
+// websocket subscriptions, so that clients of the testnet can follow its
+// events over RPC.
+func (t Testnet) validateRPCSurface() error {
+	for _, node := range t.Nodes {
+		if (node.Mode == ModeValidator || node.Mode == ModeFull) && node.RPCMaxSubscriptions > 0 {
+			return nil
+		}
+	}
+	return errors.New("no validator or full node accepts RPC subscriptions, see max_subscriptions_per_client")
+}
+
+// validateSentries checks that sentries are full nodes protecting a
+// validator they share an address family with, and that validators with
+// sentries only peer with them, so that they are hidden from the rest of the
+// network. Light clients only reach their providers over RPC, and can use
+// such validators.
+func (t Testnet) validateSentries() error {
+	for _, node := range t.Nodes {
+		if node.SentryFor == nil {
+			continue
+		}
+		if node.Mode != ModeFull {
+			return fmt.Errorf("sentry %q must be a full node, not a %s node", node.Name, node.Mode)
+		}
+		if node.SentryFor.Mode != ModeValidator {
+			return fmt.Errorf("sentry %q must protect a validator, not %s node %q",
+				node.Name, node.SentryFor.Mode, node.SentryFor.Name)
+		}
+		if _, ok := node.AddressFamily.Common(node.SentryFor.AddressFamily); !ok {
+			return fmt.Errorf("sentry %q shares no address family with validator %q", node.Name, node.SentryFor.Name)
+		}
+	}
+	for _, validator := range t.Nodes {
+		if len(t.Sentries(validator)) == 0 {
+			continue
+		}
+		if len(validator.Seeds) > 0 {
+			return fmt.Errorf("validator %q has sentries, so it must not have seeds", validator.Name)
+		}
+		for _, peer := range validator.PersistentPeers {
+			if peer.SentryFor != validator {
+				return fmt.Errorf("validator %q has sentries, but peers with %q directly", validator.Name, peer.Name)
+			}
+		}
+		for _, node := range t.Nodes {
+			if node.Mode == ModeLight || node.SentryFor == validator {
+				continue
+			}
+			if slices.Contains(node.Seeds, validator) || slices.Contains(node.PersistentPeers, validator) {
+				return fmt.Errorf("node %q peers with validator %q directly, bypassing its sentries",
+					node.Name, validator.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// Sentries returns the sentries of a validator, if any.
+func (t Testnet) Sentries(validator *Node) []*Node {
+	var sentries []*Node
+	for _, node := range t.Nodes {
+		if node.SentryFor == validator {
+			sentries = append(sentries, node)
+		}
+	}
+	return sentries
+}
+
+// validateSyncCapacity checks that nodes starting at the same height, which
+// catch up with the network simultaneously, have enough nodes to serve them,
+// see MaxSyncersPerServer. Block syncing nodes are served by the archive
+// nodes, and state syncing nodes by the snapshot providers running by then.
+func (t Testnet) validateSyncCapacity() error {
+	syncers := map[int64][]*Node{}
+	for _, node := range t.Nodes {
+		if node.StartAt > 0 && !node.Stateless() {
+			syncers[node.StartAt] = append(syncers[node.StartAt], node)
+		}
+	}
+	for height, nodes := range syncers {
+		if len(nodes) < 2 {
+			continue
+		}
+		blockSyncers, stateSyncers := 0, 0
+		providers := map[string]bool{}
+		for _, node := range nodes {
+			if !node.StateSync {
+				blockSyncers++
+				continue
+			}
+			stateSyncers++
+			for _, provider := range t.SnapshotProviders(node) {
+				if provider.StartAt < height {
+					providers[provider.Name] = true
+				}
+			}
+		}
+		if servers := len(t.ArchiveNodes()); blockSyncers > MaxSyncersPerServer*servers {
+			return fmt.Errorf("%d nodes block sync from height %d, but %d archive nodes only serve %d",
+				blockSyncers, height, servers, MaxSyncersPerServer*servers)
+		}
+		if stateSyncers > MaxSyncersPerServer*len(providers) {
+			return fmt.Errorf("%d nodes state sync from height %d, but %d snapshot providers only serve %d",
+				stateSyncers, height, len(providers), MaxSyncersPerServer*len(providers))
+		}
+	}
+	return nil
+}
+
+// validateSnapshot checks that the block trusted by state syncing nodes, if
+// set, exists by the time every one of them starts, so that the genesis nodes
+// can take a snapshot from which they bootstrap.
+func (t Testnet) validateSnapshot() error {
+	if t.SnapshotHeight == 0 && len(t.SnapshotHash) == 0 {
+		return nil
+	}
+	if t.SnapshotHeight < t.InitialHeight {
+		return fmt.Errorf("snapshot height %v must not be below the initial height %v", t.SnapshotHeight, t.InitialHeight)
+	}
+	if len(t.SnapshotHash) != 0 && len(t.SnapshotHash) != tmhash.Size {
+		return fmt.Errorf("snapshot hash must be %v bytes, got %v", tmhash.Size, len(t.SnapshotHash))
+	}
+	syncers := 0
+	for _, node := range t.Nodes {
+		if !node.StateSync {
+			continue
+		}
+		syncers++
+		if node.StartAt <= t.SnapshotHeight {
+			return fmt.Errorf("state syncing node %q starts at height %v, but the snapshot height %v "+
+				"must be below it", node.Name, node.StartAt, t.SnapshotHeight)
+		}
+	}
+	if syncers == 0 {
+		return errors.New("snapshot is set, but no node state syncs")
+	}
+	return nil
+}
+
+// validatePeerLimits checks that the nodes limiting their P2P connections can
+// still connect to all of their seeds and persistent peers, and accept the
+// nodes listing them as persistent peers. Light clients have no P2P
+// connections of their own.
+func (t Testnet) validatePeerLimits() error {
+	inbound := map[*Node]int{}
+	for _, node := range t.Nodes {
+		if node.Mode == ModeLight {
+			continue
+		}
+		for _, peer := range node.PersistentPeers {
+			inbound[peer]++
+		}
+	}
+	for _, node := range t.Nodes {
+		if node.MaxInboundPeers < 0 || node.MaxOutboundPeers < 0 {
+			return fmt.Errorf("node %q: max_inbound_peers and max_outbound_peers must not be negative", node.Name)
+		}
+		if node.MaxInboundPeers == 0 && node.MaxOutboundPeers == 0 {
+			continue
+		}
+		if node.Mode == ModeLight {
+			return fmt.Errorf("light client %q takes no max_inbound_peers nor max_outbound_peers", node.Name)
+		}
+		if outbound := len(node.Seeds) + len(node.PersistentPeers); node.MaxOutboundPeers > 0 &&
+			node.MaxOutboundPeers < outbound {
+			return fmt.Errorf("node %q has max_outbound_peers %v, below its %v seeds and persistent peers",
+				node.Name, node.MaxOutboundPeers, outbound)
+		}
+		if node.MaxInboundPeers > 0 && node.MaxInboundPeers < inbound[node] {
+			return fmt.Errorf("node %q has max_inbound_peers %v, below the %v nodes listing it as a persistent peer",
+				node.Name, node.MaxInboundPeers, inbound[node])
+		}
+	}
+	return nil
+}
+
+// validateSeedOnlyDiscovery checks that, with seed-only discovery, nodes find
+// their peers through the testnet's seeds only.
+func (t Testnet) validateSeedOnlyDiscovery() error {
+	if !t.SeedOnlyDiscovery {
+		return nil
+	}
+	seeds := 0
+	for _, node := range t.Nodes {
+		if node.Mode == ModeSeed {
+			seeds++
+		}
+	}
+	if seeds == 0 {
+		return errors.New("seed_only_discovery requires at least one seed node")
+	}
+	for _, node := range t.Nodes {
+		switch {
+		case node.Mode == ModeLight:
+		case len(node.PersistentPeers) > 0:
+			return fmt.Errorf("node %q has persistent peers, but seed_only_discovery is set", node.Name)
+		case node.Mode != ModeSeed && len(node.Seeds) == 0:
+			return fmt.Errorf("node %q has no seeds, but seed_only_discovery is set", node.Name)
+		}
+	}
+	return nil
+}
+
+// validateRecoverySource checks that a node whose database gets corrupted has
+// other nodes to recover from. It must not be the last archive node, since the
+// rest of the network relies on one holding the entire blockchain history.
+func (t Testnet) validateRecoverySource(node *Node) error {
+	var archiveNodes int
+	for _, peer := range t.ArchiveNodes() {
+		if peer.Name != node.Name {
+			archiveNodes++
+		}
+	}
+	switch node.RecoveryMode {
+	case RecoveryModeBlockSync:
+		if archiveNodes == 0 {
+			return errors.New("cannot corrupt the database of the last archive node")
+		}
+	case RecoveryModeStateSync:
+		if archiveNodes < 2 {
+			return errors.New("recovering with state sync requires 2 other archive nodes as RPC servers")
+		}
+		if len(t.SnapshotProviders(node)) == 0 {
+			return fmt.Errorf("recovering with state sync requires a snapshot provider with format %d",
+				node.SnapshotFormat)
+		}
+	}
+	return nil
+}
+
+// validateLightTrust checks that the block a light client initially trusts is
+// still retained by at least one of its providers when it starts. The runner
+// starts it once the network reaches its start height, and light clients
+// without a trust_height trust the initial height.
+func (t Testnet) validateLightTrust(node *Node) error {
+	if node.Mode != ModeLight {
+		return nil
+	}
+	trustHeight := node.TrustHeight
+	if trustHeight == 0 {
+		trustHeight = t.InitialHeight
+	}
+	head := max(node.StartAt, t.InitialHeight)
+	var closest *Node
+	var shortfall int64
+	for _, provider := range append(append([]*Node{}, node.PersistentPeers...), node.Witnesses...) {
+		missing := provider.lowestRetainedHeight(head) - trustHeight
+		if missing <= 0 {
+			return nil
+		}
+		if closest == nil || missing < shortfall {
+			closest, shortfall = provider, missing
+		}
+	}
+	if closest == nil {
+		return nil
+	}
+	return fmt.Errorf("light client %q trusts height %v, but all of its providers have pruned it by its start "+
+		"height %v; the closest, %q, is %v blocks short of retaining it", node.Name, trustHeight, head,
+		closest.Name, shortfall)
+}
+
+// lowestRetainedHeight returns the lowest height the node still has a block
+// of once it reaches the given height, after pruning all but its last
+// RetainBlocks blocks.
+func (n Node) lowestRetainedHeight(head int64) int64 {
+	if n.RetainBlocks == 0 || head-int64(n.RetainBlocks) < n.Testnet.InitialHeight {
+		return n.Testnet.InitialHeight
+	}
+	return head - int64(n.RetainBlocks) + 1
+}
+
+// validateZoneLatencies checks that the latency matrix has symmetric entries
+// for every pair of zones used by nodes, and that latencies within a zone are
+// lower than latencies to other zones.
+func (t Testnet) validateZoneLatencies() error {
+	zones := t.Zones()
+	for _, a := range zones {
+		for _, b := range zones {
+			ab, ok := t.ZoneLatencies[a][b]
+			if !ok {
+				return fmt.Errorf("missing latency from zone %q to zone %q", a, b)
+			}
+			if ab < 0 {
+				return fmt.Errorf("latency from zone %q to zone %q must not be negative", a, b)
+			}
+			if ba := t.ZoneLatencies[b][a]; ab != ba {
+				return fmt.Errorf("latency from zone %q to zone %q (%v) differs from the reverse latency (%v)",
+					a, b, ab, ba)
+			}
+			if a != b && t.ZoneLatencies[a][a] >= ab {
+				return fmt.Errorf("latency within zone %q must be lower than the latency to zone %q", a, b)
+			}
+		}
+	}
+	return nil
+}
+
+// validateLinkLatencies checks that every link latency degrades the link
+// between two peers in one direction, once, and that the sending node runs the
+// local version, whose entrypoint emulates latency.
+func (t Testnet) validateLinkLatencies() error {
+	seen := map[[2]string]bool{}
+	for _, link := range t.LinkLatencies {
+		from, to := t.LookupNode(link.From), t.LookupNode(link.To)
+		switch {
+		case from == nil || to == nil:
+			return fmt.Errorf("link latency from %q to %q: unknown node", link.From, link.To)
+		case from == to:
+			return fmt.Errorf("link latency from %q to itself", link.From)
+		case seen[[2]string{link.From, link.To}]:
+			return fmt.Errorf("duplicate link latency from %q to %q", link.From, link.To)
+		case from.Mode == ModeLight || to.Mode == ModeLight:
+			return fmt.Errorf("link latency from %q to %q: light clients have no peers", link.From, link.To)
+		case !from.IsPeer(to):
+			return fmt.Errorf("link latency from %q to %q: the nodes are not peers", link.From, link.To)
+		case from.Version != localVersion:
+			return fmt.Errorf("link latency from %q requires the local version, but node runs %q",
+				link.From, from.Version)
+		case link.Delay < 0 || link.Jitter < 0:
+			return fmt.Errorf("link latency from %q to %q: delay and jitter must not be negative", link.From, link.To)
+		case link.Jitter > link.Delay:
+			return fmt.Errorf("link latency from %q to %q: jitter %v exceeds delay %v",
+				link.From, link.To, link.Jitter, link.Delay)
+		case link.Loss < 0 || link.Loss > 100:
+			return fmt.Errorf("link latency from %q to %q: loss must be between 0 and 100", link.From, link.To)
+		case link.Delay == 0 && link.Loss == 0:
+			return fmt.Errorf("link latency from %q to %q has neither delay nor loss", link.From, link.To)
+		}
+		seen[[2]string{link.From, link.To}] = true
+	}
+	return nil
+}
+
+// Zones returns the sorted zones of the testnet's nodes.
+func (t Testnet) Zones() []string {
+	zones := []string{}
+	seen := map[string]bool{}
+	for _, node := range t.Nodes {
+		if node.Zone != "" && !seen[node.Zone] {
+			seen[node.Zone] = true
+			zones = append(zones, node.Zone)
+		}
+	}
+	sort.Strings(zones)
+	return zones
+}
+
+// validateHonestQuorum checks that validators with misbehaviors hold less than
+// 1/3 of the voting power at the given height, together with the absent
+// validators, so that honest validators can still commit blocks. Validators are counted as misbehaving regardless of the
+// heights of their misbehaviors.
+func (t Testnet) validateHonestQuorum(height int64) error {
+	var total, byzantine, absent int64
+	for node, power := range t.ValidatorPowersAt(height) {
+		total += power
+		switch {
+		case len(node.Misbehaviors) > 0:
+			byzantine += power
+		case node.Absent():
+			absent += power
+		}
+	}
+	if 3*(byzantine+absent) >= total {
+		return fmt.Errorf("misbehaving validators hold %v of %v voting power at height %v, "+
+			"must be less than 1/3 together with the %v of absent validators", byzantine, total, height, absent)
+	}
+	return nil
+}
+
+// validateShortRetention checks that validators with short_retention hold
+// less than 1/3 of the voting power at the initial height and after every
+// validator update, so that they are never the only validators verifying
+// evidence about the blocks they pruned.
+func (t Testnet) validateShortRetention() error {
+	heights := []int64{t.InitialHeight}
+	for height := range t.ValidatorUpdates {
+		heights = append(heights, height)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	for _, height := range heights {
+		var total, short int64
+		for node, power := range t.ValidatorPowersAt(height) {
+			total += power
+			if node.ShortRetention {
+				short += power
+			}
+		}
+		if 3*short >= total && short > 0 {
+			return fmt.Errorf("validators with short_retention hold %v of %v voting power at height %v, "+
+				"must be less than 1/3", short, total, height)
+		}
+	}
+	return nil
+}
+
+// validateUnthrottledQuorum checks that genesis validators whose disk may be
+// throttled hold less than 1/3 of the initial voting power, so that the
+// network stays live while they fall behind.
+func (t Testnet) validateUnthrottledQuorum() error {
+	var total, throttled int64
+	for node, power := range t.ValidatorPowersAt(t.InitialHeight) {
+		total += power
+		for _, perturbation := range node.Perturbations {
+			if perturbation == PerturbationThrottleDisk {
+				throttled += power
+				break
+			}
+		}
+	}
+	if 3*throttled >= total && throttled > 0 {
+		return fmt.Errorf("genesis validators with throttled disks hold %v of %v voting power, "+
+			"must be less than 1/3", throttled, total)
+	}
+	return nil
+}
+
+// validatePerturbedQuorum checks that validators with the given perturbation
+// hold less than 1/3 of the voting power at the initial height and after
+// every validator update, together with the absent validators, which are
+// offline all along.
+func (t Testnet) validatePerturbedQuorum(perturbation Perturbation) error {
+	heights := []int64{t.InitialHeight}
+	for height := range t.ValidatorUpdates {
+		heights = append(heights, height)
+	}
+	for _, height := range heights {
+		var total, perturbed, absent int64
+		for node, power := range t.ValidatorPowersAt(height) {
+			total += power
+			switch {
+			case slices.Contains(node.Perturbations, perturbation):
+				perturbed += power
+			case node.Absent():
+				absent += power
+			}
+		}
+		if 3*(perturbed+absent) >= total && perturbed > 0 {
+			return fmt.Errorf("validators with the '%v' perturbation hold %v of %v voting power "+
+				"at height %v, must be less than 1/3 together with the %v of absent validators",
+				perturbation, perturbed, total, height, absent)
+		}
+	}
+	return nil
+}
+
+// validateAbsentQuorum checks that absent validators hold less than 1/3 of
+// the voting power at the initial height and after every validator update,
+// so that the validators the runner starts can always commit blocks.
+func (t Testnet) validateAbsentQuorum() error {
+	heights := []int64{t.InitialHeight}
+	for height := range t.ValidatorUpdates {
+		heights = append(heights, height)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	for _, height := range heights {
+		var total, absent int64
+		for node, power := range t.ValidatorPowersAt(height) {
+			total += power
+			if node.Absent() {
+				absent += power
+			}
+		}
+		if 3*absent >= total && absent > 0 {
+			return fmt.Errorf("absent validators hold %v of %v voting power at height %v, "+
+				"must be less than 1/3", absent, total, height)
+		}
+	}
+	return nil
+}
+
+// validatePromotions checks that full nodes only join the validator set
+// through a validator update at their promote_at height, which they weren't
+// part of before, and that the validators promoted at a height hold less than
+// 1/3 of the voting power, together with the absent validators, so that the
+// others stay live while they start voting.
+func (t Testnet) validatePromotions() error {
+	promotions := map[int64]bool{}
+	for height, update := range t.ValidatorUpdates {
+		for node, power := range update {
+			if node.Mode != ModeFull {
+				continue
+			}
+			if node.PromoteAt != height || power <= 0 {
+				return fmt.Errorf("full node %q can only join the validator set at its promote_at height, "+
+					"not at height %v", node.Name, height)
+			}
+			promotions[height] = true
+		}
+	}
+	for _, node := range t.Nodes {
+		if node.PromoteAt == 0 {
+			continue
+		}
+		if !promotions[node.PromoteAt] || t.ValidatorUpdates[node.PromoteAt][node] <= 0 {
+			return fmt.Errorf("promotion of node %q at height %v has no matching validator update",
+				node.Name, node.PromoteAt)
+		}
+		if _, ok := t.Validators[node]; ok {
+			return fmt.Errorf("node %q is promoted at height %v, so it cannot be a genesis validator",
+				node.Name, node.PromoteAt)
+		}
+	}
+	for height := range promotions {
+		var total, promoted, absent int64
+		for validator, power := range t.ValidatorPowersAt(height) {
+			total += power
+			switch {
+			case validator.PromoteAt == height:
+				promoted += power
+			case validator.Absent():
+				absent += power
+			}
+		}
+		if 3*(promoted+absent) >= total {
+			return fmt.Errorf("validators promoted at height %v hold %v of %v voting power, "+
+				"must be less than 1/3 together with the %v of absent validators", height, promoted, total, absent)
+		}
+	}
+	return nil
+}
+
+// validateProposerFairness checks that the validators of a testnet asserting
+// proposer fairness hold the same voting power at the initial height and after
+// every validator update, so that proposers rotate round-robin, and that none
+// of them is absent, since the next one would propose in its stead.
+func (t Testnet) validateProposerFairness() error {
+	if !t.AssertProposerFairness {
+		return nil
+	}
+	heights := []int64{t.InitialHeight}
+	for height := range t.ValidatorUpdates {
+		heights = append(heights, height)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	for _, height := range heights {
+		var minPower, maxPower int64
+		for node, power := range t.ValidatorPowersAt(height) {
+			if node.Absent() {
+				return fmt.Errorf("assert_proposer_fairness requires every validator to start, but %q is absent",
+					node.Name)
+			}
+			if minPower == 0 || power < minPower {
+				minPower = power
+			}
+			maxPower = max(maxPower, power)
+		}
+		if minPower != maxPower {
+			return fmt.Errorf("assert_proposer_fairness requires validators of equal voting power, "+
+				"found powers from %v to %v at height %v", minPower, maxPower, height)
+		}
+	}
+	return nil
+}
+
+// ValidatorPowersAt returns the voting power of each validator after applying
+// the genesis validators and all validator updates up to the given height.
+func (t Testnet) ValidatorPowersAt(height int64) map[*Node]int64 {
+	heights := []int64{}
+	for h := range t.ValidatorUpdates {
+		if h <= height {
+			heights = append(heights, h)
+		}
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+
+	powers := map[*Node]int64{}
+	for node, power := range t.Validators {
+		powers[node] = power
+	}
+	for _, h := range heights {
+		for node, power := range t.ValidatorUpdates[h] {
+			if power == 0 {
+				delete(powers, node)
+			} else {
+				powers[node] = power
+			}
+		}
+	}
+	return powers
+}
+
+// validateKeyRotations checks that every key rotation is matched by a
+// validator update of its node at the same height, and that the rotating
+// validators hold less than 1/3 of the voting power, so that the others stay
+// live while they restart with their new keys.
+func (t Testnet) validateKeyRotations() error {
+	if !t.HasKeyRotations() {
+		return nil
+	}
+	if t.UpgradeHeight > 0 || t.ArchiveBlackoutHeight > 0 || t.GlobalRestartHeight > 0 {
+		return errors.New("key_rotations cannot be combined with upgrade_height, archive_blackout_height " +
+			"or global_restart_height")
+	}
+	for _, node := range t.Nodes {
+		for height := range node.KeyRotations {
+			if power := t.ValidatorUpdates[height][node]; power <= 0 {
+				return fmt.Errorf("key rotation of node %q at height %v has no matching validator update", node.Name, height)
+			}
+			if _, ok := t.ValidatorPowersAt(height - 1)[node]; !ok {
+				return fmt.Errorf("node %q cannot rotate its key at height %v, since it isn't a validator then",
+					node.Name, height)
+			}
+			var total, rotating, absent int64
+			for validator, power := range t.ValidatorPowersAt(height) {
+				total += power
+				switch {
+				case len(validator.KeyRotations) > 0:
+					rotating += power
+				case validator.Absent():
+					absent += power
+				}
+			}
+			if 3*(rotating+absent) >= total {
+				return fmt.Errorf("validators rotating their keys hold %v of %v voting power at height %v, "+
+					"must be less than 1/3 together with the %v of absent validators", rotating, total, height, absent)
+			}
+		}
+	}
+	return nil
+}
+
+// LoadShares returns the share of the transaction load each node receives, by
+// its load weight, see ManifestNode.LoadWeight. The shares add up to 1, and
+// nodes with send_no_load and absent validators are left out.
+func (t Testnet) LoadShares() map[*Node]float64 {
+	shares := map[*Node]float64{}
+	total := 0
+	for _, node := range t.Nodes {
+		if node.SendNoLoad || node.Absent() {
+			continue
+		}
+		weight := node.LoadWeight
+		if weight == 0 {
+			weight = 1
+		}
+		shares[node] = float64(weight)
+		total += weight
+	}
+	for node := range shares {
+		shares[node] /= float64(total)
+	}
+	return shares
+}
+
+// HasKeyRotations returns whether any validator of the network rotates its
+// key.
+func (t Testnet) HasKeyRotations() bool {
+	for _, node := range t.Nodes {
+		if len(node.KeyRotations) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// HasMisbehaviors returns whether any validator of the network misbehaves.
+func (t Testnet) HasMisbehaviors() bool {
+	for _, node := range t.Nodes {
+		if len(node.Misbehaviors) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// validateMetricThresholds checks that the metric thresholds are consistent,
+// and that some node exposes metrics to check them against.
+func (t Testnet) validateMetricThresholds() error {
+	if len(t.MetricThresholds) == 0 {
+		return nil
+	}
+	if !t.HasPrometheus() {
+		return errors.New("metric_thresholds require a node exposing Prometheus metrics")
+	}
+	for name, threshold := range t.MetricThresholds {
+		if name == "" {
+			return errors.New("metric_thresholds has a threshold without a metric name")
+		}
+		if threshold.Min == nil && threshold.Max == nil {
+			return fmt.Errorf("metric threshold %q has neither min nor max", name)
+		}
+		if threshold.Min != nil && threshold.Max != nil && *threshold.Min > *threshold.Max {
+			return fmt.Errorf("metric threshold %q has min %v above max %v", name, *threshold.Min, *threshold.Max)
+		}
+	}
+	return nil
+}
+
+// HasPrometheus returns whether any node of the network exposes Prometheus
+// metrics.
+func (t Testnet) HasPrometheus() bool {
+	for _, node := range t.Nodes {
+		if node.Prometheus {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate validates a node.
+func (n Node) Validate(testnet Testnet) error {
+	if n.Name == "" {
+		return errors.New("node has no name")
+	}
+	if n.InternalIP == nil {
+		return errors.New("node has no IP address")
+	}
+	if !testnet.IP.Contains(n.InternalIP) {
+		return fmt.Errorf("node IP %v is not in testnet network %v", n.InternalIP, testnet.IP)
+	}
+	if n.InternalIPv6 != nil && (testnet.IPv6Net == nil || !testnet.IPv6Net.Contains(n.InternalIPv6)) {
+		return fmt.Errorf("node IPv6 address %v is not in testnet IPv6 network %v", n.InternalIPv6, testnet.IPv6Net)
+	}
+	switch n.AddressFamily {
+	case AddressFamilyIPv4, AddressFamilyIPv6, AddressFamilyDual:
+	default:
+		return fmt.Errorf("invalid address family %q", n.AddressFamily)
+	}
+	if n.AddressFamily.supports(AddressFamilyIPv4) && n.InternalIP.To4() == nil {
+		return fmt.Errorf("node has address family %q but no IPv4 address", n.AddressFamily)
+	}
+	if n.AddressFamily.supports(AddressFamilyIPv6) && n.IP(AddressFamilyIPv6).To4() != nil {
+		return fmt.Errorf("node has address family %q but no IPv6 address", n.AddressFamily)
+	}
+	// With seed-only discovery, a lone seed learns of its peers as they dial it.
+	if len(n.Seeds) == 0 && len(n.PersistentPeers) == 0 && len(testnet.Nodes) > 1 &&
+		!(testnet.SeedOnlyDiscovery && n.Mode == ModeSeed) {
+		return fmt.Errorf("node with address family %q cannot reach any other node", n.AddressFamily)
+	}
+	for _, peer := range append(append(append([]*Node{}, n.Seeds...), n.PersistentPeers...), n.Witnesses...) {
+		if _, ok := n.AddressFamily.Common(peer.AddressFamily); !ok {
+			return fmt.Errorf("node with address family %q cannot reach peer %q with address family %q",
+				n.AddressFamily, peer.Name, peer.AddressFamily)
+		}
+	}
+	if n.ProxyPort == n.PrometheusProxyPort {
+		return fmt.Errorf("node local port %v used also for Prometheus local port", n.ProxyPort)
+	}
+	if n.ProxyPort > 0 && n.ProxyPort <= 1024 {
+		return fmt.Errorf("local port %v must be >1024", n.ProxyPort)
+	}
+	if n.PrometheusProxyPort > 0 && n.PrometheusProxyPort <= 1024 {
+		return fmt.Errorf("local port %v must be >1024", n.PrometheusProxyPort)
+	}
+	if n.PprofProxyPort > 0 && (n.PprofProxyPort == n.ProxyPort || n.PprofProxyPort == n.PrometheusProxyPort) {
+		return fmt.Errorf("node local port %v used also for pprof local port", n.PprofProxyPort)
+	}
+	if n.PprofProxyPort > 0 && n.PprofProxyPort <= 1024 {
+		return fmt.Errorf("local port %v must be >1024", n.PprofProxyPort)
+	}
+	for _, peer := range testnet.Nodes {
+		if peer.Name != n.Name && peer.ProxyPort == n.ProxyPort && peer.ExternalIP.Equal(n.ExternalIP) {
+			return fmt.Errorf("peer %q also has local port %v", peer.Name, n.ProxyPort)
+		}
+		if n.PrometheusProxyPort > 0 {
+			if peer.Name != n.Name && (peer.PrometheusProxyPort == n.PrometheusProxyPort || peer.ProxyPort == n.PrometheusProxyPort) {
+				return fmt.Errorf("peer %q also has local port %v", peer.Name, n.PrometheusProxyPort)
+			}
+		}
+		if n.PprofProxyPort > 0 && peer.Name != n.Name {
+			switch n.PprofProxyPort {
+			case peer.ProxyPort, peer.PrometheusProxyPort, peer.PprofProxyPort:
+				return fmt.Errorf("peer %q also has local port %v", peer.Name, n.PprofProxyPort)
+			}
+		}
+	}
+	switch n.BlockSyncVersion {
+	case "v0":
+	default:
+		return fmt.Errorf("invalid block sync setting %q", n.BlockSyncVersion)
+	}
+	switch n.Database {
+	case "goleveldb", "cleveldb", "boltdb", "rocksdb", "badgerdb":
+	default:
+		return fmt.Errorf("invalid database setting %q", n.Database)
+	}
+	switch n.ABCIProtocol {
+	case ProtocolBuiltin, ProtocolBuiltinConnSync, ProtocolUNIX, ProtocolTCP, ProtocolGRPC:
+	default:
+		return fmt.Errorf("invalid ABCI protocol setting %q", n.ABCIProtocol)
+	}
+	if n.Mode == ModeLight && n.ABCIProtocol != ProtocolBuiltin && n.ABCIProtocol != ProtocolBuiltinConnSync {
+		return errors.New("light client must use builtin protocol")
+	}
+	switch n.PrivvalProtocol {
+	case ProtocolFile, ProtocolUNIX, ProtocolTCP:
+	default:
+		return fmt.Errorf("invalid privval protocol setting %q", n.PrivvalProtocol)
+	}
+
+	// Older images lack the entrypoint hook emulating latency.
+	if n.Zone != "" && n.Version != localVersion {
+		return fmt.Errorf("zone requires the local version, but node runs %q", n.Version)
+	}
+
+	if n.BehindNAT {
+		if n.Mode == ModeSeed || n.Mode == ModeLight {
+			return fmt.Errorf("%v nodes must be directly reachable, and cannot be behind NAT", n.Mode)
+		}
+		// Like latency, NAT is emulated by an entrypoint hook.
+		if n.Version != localVersion {
+			return fmt.Errorf("behind_nat requires the local version, but node runs %q", n.Version)
+		}
+		if n.ExternalAddress != "" {
+			return errors.New("external_address cannot be set on a node behind NAT")
+		}
+		peers := append(append([]*Node{}, n.Seeds...), n.PersistentPeers...)
+		reachable := len(peers) == 0
+		for _, peer := range peers {
+			reachable = reachable || !peer.BehindNAT
+		}
+		if !reachable {
+			return errors.New("node is behind NAT, and so are all of its peers, so it cannot connect to any")
+		}
+	}
+	if n.ExternalAddress != "" {
+		if _, _, err := net.SplitHostPort(n.ExternalAddress); err != nil {
+			return fmt.Errorf("invalid external_address %q: %w", n.ExternalAddress, err)
+		}
+	}
+
+	// Older versions of the application ignore these settings, and only take
+	// snapshots of the default format.
+	if n.Version != localVersion && (n.SnapshotFormat != defaultSnapshotFormat || n.SnapshotChunkSize != 0) {
+		return fmt.Errorf("snapshot_format and snapshot_chunk_size require the local version, but node runs %q", n.Version)
+	}
+
+	if len(n.AppConfig) > 0 {
+		if n.Mode == ModeLight {
+			return errors.New("light clients run no application, and take no app_config")
+		}
+		if n.Version != localVersion {
+			return fmt.Errorf("app_config requires the local version, but node runs %q", n.Version)
+		}
+		if err := app.ValidateAppConfig(n.AppConfig); err != nil {
+			return err
+		}
+	}
+
+	if n.TimeoutPropose < 0 || n.TimeoutPropose > MaxConsensusTimeout {
+		return fmt.Errorf("timeout_propose must be between 0 and %v", MaxConsensusTimeout)
+	}
+	if n.TimeoutCommit < 0 || n.TimeoutCommit > MaxConsensusTimeout {
+		return fmt.Errorf("timeout_commit must be between 0 and %v", MaxConsensusTimeout)
+	}
+
+	if n.ClockSkew < -MaxClockSkew || n.ClockSkew > MaxClockSkew {
+		return fmt.Errorf("clock_skew must be between -%v and %v", MaxClockSkew, MaxClockSkew)
+	}
+	// The clock skew is applied to the votes signed inside the node process,
+	// which only runs CometBFT with the builtin protocols.
+	if n.UsesClockSkew() && n.ABCIProtocol != ProtocolBuiltin && n.ABCIProtocol != ProtocolBuiltinConnSync {
+		return fmt.Errorf("clock_skew and the 'skew' perturbation require a builtin ABCI protocol, not %q", n.ABCIProtocol)
+	}
+	if n.UsesClockSkew() && n.Mode != ModeValidator && n.PromoteAt == 0 {
+		return errors.New("clock_skew and the 'skew' perturbation require a node signing votes, i.e. a validator")
+	}
+
+	if n.Mode != ModeLight && (len(n.Witnesses) > 0 || n.TrustPeriod != 0 || n.TrustHeight != 0) {
+		return errors.New("witnesses, trust_period and trust_height only apply to light clients")
+	}
+	if n.TrustPeriod < 0 {
+		return errors.New("trust_period must not be negative")
+	}
+	if n.TrustHeight != 0 && (n.TrustHeight < n.Testnet.InitialHeight || n.TrustHeight > n.StartAt) {
+		return fmt.Errorf("trust_height must be between the initial height %v and start height %v",
+			n.Testnet.InitialHeight, n.StartAt)
+	}
+	if n.Mode == ModeLight {
+		providers := map[string]bool{}
+		for _, provider := range append(append([]*Node{}, n.PersistentPeers...), n.Witnesses...) {
+			providers[provider.Name] = true
+		}
+		if len(providers) < 2 {
+			return fmt.Errorf("light client needs at least 2 distinct providers, a primary and a witness, but has %d",
+				len(providers))
+		}
+	}
+	for _, witness := range n.Witnesses {
+		if len(n.PersistentPeers) > 0 && witness == n.PersistentPeers[0] {
+			return fmt.Errorf("primary %q cannot also be a witness", witness.Name)
+		}
+		if witness.Stateless() {
+			return fmt.Errorf("witness %q must be a validator or full node", witness.Name)
+		}
+		if witness.Absent() {
+			return fmt.Errorf("witness %q never starts", witness.Name)
+		}
+	}
+	if n.Mode == ModeLight && len(n.PersistentPeers) > 0 && n.PersistentPeers[0].Absent() {
+		return fmt.Errorf("primary %q never starts", n.PersistentPeers[0].Name)
+	}
+
+	if n.StartAt > 0 && n.StartAt < n.Testnet.InitialHeight {
+		return fmt.Errorf("cannot start at height %v lower than initial height %v",
+			n.StartAt, n.Testnet.InitialHeight)
+	}
+	if n.StartAt < 0 && !n.Absent() {
+		return fmt.Errorf("start_at %v must not be negative, except %v for absent validators", n.StartAt, StartAtNever)
+	}
+	if n.Absent() {
+		switch {
+		case n.Mode != ModeValidator:
+			return errors.New("only validators can be absent")
+		case n.StateSync:
+			return errors.New("absent validators never start, so they cannot state sync")
+		case len(n.Perturbations) > 0 || len(n.Misbehaviors) > 0 || len(n.KeyRotations) > 0:
+			return errors.New("absent validators never start, so they take no perturbations, misbehaviors " +
+				"or key rotations")
+		}
+	}
+	if n.StateSync && n.StartAt == 0 {
+		return errors.New("state synced nodes cannot start at the initial height")
+	}
+	if n.PromoteAt != 0 {
+		switch {
+		case n.Mode != ModeFull:
+			return errors.New("only full nodes can be promoted to validators")
+		case n.PromoteAt <= max(n.StartAt, n.Testnet.InitialHeight):
+			return fmt.Errorf("promote_at %v must be after the node starts at height %v, so that it syncs "+
+				"the state before its promotion", n.PromoteAt, max(n.StartAt, n.Testnet.InitialHeight))
+		case n.PrivvalProtocol != ProtocolFile:
+			return fmt.Errorf("promoted full nodes sign with the file privval protocol, not %q", n.PrivvalProtocol)
+		}
+	}
+	if n.ShortRetention && (n.RetainBlocks == 0 || (n.Mode != ModeValidator && n.Mode != ModeFull)) {
+		return errors.New("short_retention only applies to validators and full nodes with retain_blocks")
+	}
+	if n.RetainBlocks != 0 && n.RetainBlocks < uint64(n.Testnet.EvidenceMaxAgeNumBlocks) && !n.ShortRetention {
+		return fmt.Errorf("retain_blocks must be 0 or be greater or equal to max evidence age (%d)",
+			n.Testnet.EvidenceMaxAgeNumBlocks)
+	}
+	if n.MempoolCacheSize < 0 {
+		return errors.New("mempool_cache_size must not be negative")
+	}
+	if n.Mode == ModeLight && (n.MempoolCacheSize != config.DefaultMempoolConfig().CacheSize ||
+		n.MempoolRecheck != config.DefaultMempoolConfig().Recheck) {
+		return errors.New("light clients have no mempool, and take no mempool_cache_size or mempool_recheck")
+	}
+	if n.Mode == ModeLight && !n.WALEnabled {
+		return errors.New("light clients have no consensus WAL, and take no wal_enabled")
+	}
+	if n.AssertReplayConsistency {
+		switch {
+		case n.Mode != ModeFull || n.PromoteAt != 0:
+			return errors.New("assert_replay_consistency only applies to full nodes that are never promoted, " +
+				"which are never part of the quorum")
+		case n.ABCIProtocol != ProtocolBuiltinConnSync:
+			return fmt.Errorf("assert_replay_consistency requires the %q ABCI protocol, not %q",
+				ProtocolBuiltinConnSync, n.ABCIProtocol)
+		case !slices.Contains(n.Perturbations, PerturbationKill) || !slices.Contains(n.Perturbations, PerturbationRestart):
+			return errors.New("assert_replay_consistency requires both the 'kill' and 'restart' perturbations")
+		}
+	}
+	if n.RPCMaxSubscriptions < 0 {
+		return errors.New("max_subscriptions_per_client must not be negative")
+	}
+	if err := n.validateStartupBackoff(); err != nil {
+		return err
+	}
+	if n.LoadWeight < 0 {
+		return errors.New("load_weight must not be negative")
+	}
+	if n.SendNoLoad && n.LoadWeight > 0 {
+		return errors.New("nodes with send_no_load take no load_weight")
+	}
+	if n.Mode == ModeLight && (n.RPCUnsafe ||
+		n.RPCMaxSubscriptions != config.DefaultRPCConfig().MaxSubscriptionsPerClient) {
+		return errors.New("light clients take no rpc_config")
+	}
+	if n.PersistInterval == 0 && n.RetainBlocks > 0 {
+		return errors.New("persist_interval=0 requires retain_blocks=0")
+	}
+	if n.PersistInterval > 1 && n.RetainBlocks > 0 && n.RetainBlocks < n.PersistInterval {
+		return errors.New("persist_interval must be less than or equal to retain_blocks")
+	}
+	if n.SnapshotInterval > 0 && n.RetainBlocks > 0 && n.RetainBlocks < n.SnapshotInterval {
+		return errors.New("snapshot_interval must be less than er equal to retain_blocks")
+	}
+
+	if len(n.Misbehaviors) > 0 && n.Mode != ModeValidator {
+		return errors.New("only validators can misbehave")
+	}
+	if len(n.KeyRotations) > 0 {
+		switch {
+		case n.Mode != ModeValidator:
+			return errors.New("only validators can rotate their keys")
+		case n.PrivvalProtocol != ProtocolFile:
+			return fmt.Errorf("key rotations require privval protocol %q, not %q", ProtocolFile, n.PrivvalProtocol)
+		case len(n.Misbehaviors) > 0:
+			return errors.New("misbehaving validators cannot rotate their keys")
+		}
+	}
+	for height := range n.KeyRotations {
+		if height <= max(n.Testnet.InitialHeight, n.StartAt) {
+			return fmt.Errorf("key rotation height %v must be above the initial and start heights", height)
+		}
+	}
+	for height, misbehavior := range n.Misbehaviors {
+		if height < n.Testnet.InitialHeight {
+			return fmt.Errorf("misbehavior height %v is below the initial height %v", height, n.Testnet.InitialHeight)
+		}
+		switch misbehavior {
+		case MisbehaviorDoublePrevote, MisbehaviorDoublePrecommit:
+		default:
+			return fmt.Errorf("invalid misbehavior %q at height %v", misbehavior, height)
+		}
+	}
+
+	var upgradeFound, corruptDBFound, flapFound bool
+	for _, perturbation := range n.Perturbations {
+		switch perturbation {
+		case PerturbationUpgrade:
+			if upgradeFound {
+				return fmt.Errorf("'upgrade' perturbation can appear at most once per node")
+			}
+			upgradeFound = true
+		case PerturbationThrottleDisk:
+			if n.DiskBandwidth == 0 {
+				return errors.New("'throttle_disk' perturbation requires disk_bandwidth")
+			}
+		case PerturbationCorruptDB:
+			if n.Stateless() {
+				return errors.New("'corrupt_db' perturbation only applies to validators and full nodes")
+			}
+			corruptDBFound = true
+		case PerturbationPrivvalDisconnect:
+			if n.Mode != ModeValidator || (n.PrivvalProtocol != ProtocolTCP && n.PrivvalProtocol != ProtocolUNIX) {
+				return fmt.Errorf("'privval_disconnect' perturbation requires a validator with a socket signer, "+
+					"not %q", n.PrivvalProtocol)
+			}
+			// The signer is disconnected by the node process.
+			if n.Version != localVersion {
+				return fmt.Errorf("'privval_disconnect' perturbation requires the local version, but node runs %q", n.Version)
+			}
+		case PerturbationFlap:
+			if n.FlapInterval < MinFlapInterval || n.FlapInterval > MaxFlapInterval {
+				return fmt.Errorf("'flap' perturbation requires flap_interval between %v and %v, got %v",
+					MinFlapInterval, MaxFlapInterval, n.FlapInterval)
+			}
+			flapFound = true
+		case PerturbationWALTruncate:
+			if n.Mode != ModeValidator {
+				return errors.New("'wal_truncate' perturbation only applies to validators")
+			}
+			if !n.WALEnabled {
+				return errors.New("'wal_truncate' perturbation requires wal_enabled")
+			}
+		case PerturbationDisconnect, PerturbationKill, PerturbationPause, PerturbationRestart, PerturbationSkew:
+		default:
+			return fmt.Errorf("invalid perturbation %q", perturbation)
+		}
+	}
+	if !flapFound && n.FlapInterval != 0 {
+		return errors.New("flap_interval only applies to nodes with the 'flap' perturbation")
+	}
+	switch {
+	case corruptDBFound && n.RecoveryMode == "":
+		return errors.New("'corrupt_db' perturbation requires recovery_mode")
+	case !corruptDBFound && n.RecoveryMode != "":
+		return errors.New("recovery_mode only applies to nodes with the 'corrupt_db' perturbation")
+	}
+	switch n.RecoveryMode {
+	case "", RecoveryModeBlockSync, RecoveryModeStateSync:
+	default:
+		return fmt.Errorf("invalid recovery_mode %q", n.RecoveryMode)
+	}
+
+	return nil
+}
+
+// validateStartupBackoff checks that a node dialing its peers with a startup
+// backoff can connect to one within its testnet's catch-up SLA.
+func (n Node) validateStartupBackoff() error {
+	if n.StartupBackoff < 0 || n.MaxDialRetries < 0 {
+		return errors.New("startup_backoff and max_dial_retries must not be negative")
+	}
+	if n.StartupBackoff == 0 && n.MaxDialRetries == 0 {
+		return nil
+	}
+	if n.Mode == ModeLight {
+		return errors.New("light clients take no startup_backoff nor max_dial_retries")
+	}
+	if n.MaxDialRetries == 0 {
+		return nil
+	}
+	if n.StartupBackoff == 0 {
+		return errors.New("max_dial_retries requires a startup_backoff")
+	}
+	if len(n.Seeds)+len(n.PersistentPeers) == 0 {
+		return errors.New("max_dial_retries requires seeds or persistent peers to dial")
+	}
+	if budget := time.Duration(n.MaxDialRetries) * n.StartupBackoff; n.Testnet.ExpectedCatchUpBy > 0 &&
+		budget >= n.Testnet.ExpectedCatchUpBy {
+		return fmt.Errorf("max_dial_retries times startup_backoff (%v) must be less than expected_catch_up_by (%v)",
+			budget, n.Testnet.ExpectedCatchUpBy)
+	}
+	return nil
+}
+
+// OutgoingLinkLatencies returns the link latencies of the links from the node,
+// see Manifest.LinkLatencies.
+func (n Node) OutgoingLinkLatencies() []LinkLatency {
+	links := []LinkLatency{}
+	for _, link := range n.Testnet.LinkLatencies {
+		if link.From == n.Name {
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// EmulatesLatency returns whether the node emulates the latency to other
+// nodes, i.e. whether it is in a zone or has degraded links to peers.
+func (n Node) EmulatesLatency() bool {
+	return n.Zone != "" || len(n.OutgoingLinkLatencies()) > 0
+}
+
+// IsPeer returns whether the node and the given one connect to each other,
+// i.e. one of them lists the other as a seed or persistent peer, including the
+// persistent peers nodes get by default.
+func (n Node) IsPeer(peer *Node) bool {
+	dials := func(a, b Node) bool {
+		for _, p := range append(append([]*Node{}, a.Seeds...), a.PersistentPeers...) {
+			if p.Name == b.Name {
+				return true
+			}
+		}
+		return false
+	}
+	return dials(n, *peer) || dials(*peer, n)
+}
+
+// UsesClockSkew returns whether the node's clock must be controllable, i.e.
+// whether it has a clock skew or a skew perturbation.
+func (n Node) UsesClockSkew() bool {
+	if n.ClockSkew != 0 {
+		return true
+	}
+	for _, perturbation := range n.Perturbations {
+		if perturbation == PerturbationSkew {
+			return true
+		}
+	}
+	return false
+}
+
+// PrivvalKeyAt returns the consensus key of the node as of the validator
+// updates at the given height, i.e. its key after every key rotation up to
+// that height. Like validator updates, it applies to the validator set two
+// blocks later.
+func (n Node) PrivvalKeyAt(height int64) crypto.PrivKey {
+	key, rotatedAt := n.PrivvalKey, int64(0)
+	for h, rotated := range n.KeyRotations {
+		if h <= height && h > rotatedAt {
+			key, rotatedAt = rotated, h
+		}
+	}
+	return key
+}
+
+// LookupNode looks up a node by name. For now, simply do a linear search.
+func (t Testnet) LookupNode(name string) *Node {
+	for _, node := range t.Nodes {
+		if node.Name == name {
+			return node
+		}
+	}
+	return nil
+}
+
+// ValidatorKeyTypes returns the sorted key types used by all validators, either
+// in genesis or in validator updates.
+func (t Testnet) ValidatorKeyTypes() []string {
+	keyTypes := map[string]bool{}
+	for validator := range t.Validators {
+		keyTypes[validator.PrivvalKey.Type()] = true
+	}
+	for _, validators := range t.ValidatorUpdates {
+		for validator := range validators {
+			keyTypes[validator.PrivvalKey.Type()] = true
+		}
+	}
+	if len(keyTypes) == 0 {
+		return []string{keyTypeOrDefault(t.KeyType)}
+	}
+	types := make([]string, 0, len(keyTypes))
+	for keyType := range keyTypes {
+		types = append(types, keyType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// SnapshotProviders returns the nodes taking state sync snapshots that the
+// given node is able to restore, i.e. snapshots of the same format. Only nodes
+// running the local version provide snapshots of non-default formats.
+func (t Testnet) SnapshotProviders(node *Node) []*Node {
+	nodes := []*Node{}
+	for _, peer := range t.Nodes {
+		if peer.Name != node.Name && !peer.Stateless() && !peer.Absent() && peer.SnapshotInterval > 0 &&
+			peer.SnapshotFormat == node.SnapshotFormat &&
+			(peer.SnapshotFormat == defaultSnapshotFormat || peer.Version == localVersion) {
+			nodes = append(nodes, peer)
+		}
+	}
+	return nodes
+}
+
+// ArchiveNodes returns a list of archive nodes that start at the initial height
+// and contain the entire blockchain history. They are used e.g. as light client
+// RPC servers. Nodes recovering from a corrupt_db perturbation with state sync
+// lose their history, so they aren't archive nodes.
+func (t Testnet) ArchiveNodes() []*Node {
+	nodes := []*Node{}
+	for _, node := range t.Nodes {
+		if !node.Stateless() && node.StartAt == 0 && node.RetainBlocks == 0 &&
+			node.RecoveryMode != RecoveryModeStateSync {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// Warnings returns the caveats of a valid testnet that the runner reports
+// before running it, such as expected stalls.
+func (t Testnet) Warnings() []string {
+	warnings := []string{}
+	if t.ArchiveBlackoutHeight > 0 {
+		warnings = append(warnings, fmt.Sprintf("catch-up is expected to stall at height %v, "+
+			"while all %v archive nodes are offline for %v",
+			t.ArchiveBlackoutHeight, len(t.ArchiveNodes()), t.ArchiveBlackoutDuration))
+	}
+	return warnings
+}
+
+// RandomNode returns a random non-seed node.
+func (t Testnet) RandomNode() *Node {
+	for {
+		node := t.Nodes[rand.Intn(len(t.Nodes))] //nolint:gosec
+		if node.Mode != ModeSeed {
+			return node
+		}
+	}
+}
+
+// IPv6 returns true if the testnet is an IPv6 network.
+func (t Testnet) IPv6() bool {
+	return t.IP.IP.To4() == nil
+}
+
+// HasPerturbations returns whether the network has any perturbations.
+func (t Testnet) HasPerturbations() bool {
+	for _, node := range t.Nodes {
+		if len(node.Perturbations) > 0 {
+			return true
+		}
+	}
+	return false
+}
 
 //go:embed templates/prometheus-yaml.tmpl
 var prometheusYamlTemplate string
@@ -517,10 +2507,51 @@ func (t Testnet) WritePrometheusConfig() error {
 	return nil
 }
 
+// IP returns the node's internal IP address of the given family. In
+// single-stack testnets, this is always InternalIP.
+func (n Node) IP(family AddressFamily) net.IP {
+	if family == AddressFamilyIPv6 && n.InternalIPv6 != nil {
+		return n.InternalIPv6
+	}
+	return n.InternalIP
+}
+
+// IPs returns all internal IP addresses of the node.
+func (n Node) IPs() []net.IP {
+	if n.InternalIPv6 != nil {
+		return []net.IP{n.InternalIP, n.InternalIPv6}
+	}
+	return []net.IP{n.InternalIP}
+}
+
+// ipFrom returns the IP address the given node uses to reach this node. It
+// is the node's own IPv6 address for IPv6-only nodes, and its IPv4 address
+// if no common address family exists.
+func (n Node) ipFrom(from *Node) net.IP {
+	family := n.AddressFamily
+	if from != nil {
+		family, _ = from.AddressFamily.Common(n.AddressFamily)
+	}
+	if family == AddressFamilyIPv6 {
+		return n.IP(AddressFamilyIPv6)
+	}
+	return n.InternalIP
+}
+
 // Address returns a P2P endpoint address for the node.
 func (n Node) AddressP2P(withID bool) string {
-	ip := n.InternalIP.String()
-	if n.InternalIP.To4() == nil {
+	return n.addressP2P(n.ipFrom(nil), withID)
+}
+
+// AddressP2PFrom returns the P2P endpoint address the given node uses to
+// connect to this node, in an address family supported by both nodes.
+func (n Node) AddressP2PFrom(from *Node, withID bool) string {
+	return n.addressP2P(n.ipFrom(from), withID)
+}
+
+func (n Node) addressP2P(internalIP net.IP, withID bool) string {
+	ip := internalIP.String()
+	if internalIP.To4() == nil {
 		// IPv6 addresses must be wrapped in [] to avoid conflict with : port separator
 		ip = fmt.Sprintf("[%v]", ip)
 	}
@@ -533,8 +2564,18 @@ func (n Node) AddressP2P(withID bool) string {
 
 // Address returns an RPC endpoint address for the node.
 func (n Node) AddressRPC() string {
-	ip := n.InternalIP.String()
-	if n.InternalIP.To4() == nil {
+	return n.addressRPC(n.ipFrom(nil))
+}
+
+// AddressRPCFrom returns the RPC endpoint address the given node uses to
+// connect to this node, in an address family supported by both nodes.
+func (n Node) AddressRPCFrom(from *Node) string {
+	return n.addressRPC(n.ipFrom(from))
+}
+
+func (n Node) addressRPC(internalIP net.IP) string {
+	ip := internalIP.String()
+	if internalIP.To4() == nil {
 		// IPv6 addresses must be wrapped in [] to avoid conflict with : port separator
 		ip = fmt.Sprintf("[%v]", ip)
 	}
@@ -546,11 +2587,44 @@ func (n Node) Client() (*rpchttp.HTTP, error) {
 	return rpchttp.New(fmt.Sprintf("http://%s:%v", n.ExternalIP, n.ProxyPort), "/websocket")
 }
 
+// Absent returns true if the node is a validator the runner never starts, see
+// StartAtNever.
+func (n Node) Absent() bool {
+	return n.StartAt == StartAtNever
+}
+
 // Stateless returns true if the node is either a seed node or a light node
 func (n Node) Stateless() bool {
 	return n.Mode == ModeLight || n.Mode == ModeSeed
 }
 
+func isSupportedKeyType(keyType string) bool {
+	switch keyType {
+	case "", ed25519.KeyType, secp256k1.KeyType:
+		return true
+	default:
+		return false
+	}
+}
+
+// isSupportedNodeKeyType returns whether a key type can be used for node (P2P)
+// keys. P2P secret connections only accept Ed25519 keys.
+func isSupportedNodeKeyType(keyType string) bool {
+	switch keyType {
+	case "", ed25519.KeyType:
+		return true
+	default:
+		return false
+	}
+}
+
+func keyTypeOrDefault(keyType string) string {
+	if keyType == "" {
+		return ed25519.KeyType
+	}
+	return keyType
+}
+
 // keyGenerator generates pseudorandom Ed25519 keys based on a seed.
 type keyGenerator struct {
 	random *rand.Rand
@@ -579,6 +2653,13 @@ func (g *keyGenerator) Generate(keyType string) crypto.PrivKey {
 	}
 }
 
+// namedKey derives a key from a seed and a name alone, see Manifest.KeySeed.
+func namedKey(seed int64, name string, keyType string) crypto.PrivKey {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	return newKeyGenerator(seed ^ int64(h.Sum64())).Generate(keyType)
+}
+
 // portGenerator generates local Docker proxy ports for each node.
 type portGenerator struct {
 	nextPort uint32
@@ -0,0 +1,3115 @@
+package e2e
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cometbft/cometbft/config"
+)
+
+// loadTestnetTOML loads a testnet from the given TOML manifest, using the
+// Docker infrastructure.
+func loadTestnetTOML(t *testing.T, manifest string) (*Testnet, error) {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "testnet.toml")
+	require.NoError(t, os.WriteFile(file, []byte(manifest), 0o600))
+	m, err := LoadManifest(file)
+	require.NoError(t, err)
+	ifd, err := NewDockerInfrastructureData(m)
+	require.NoError(t, err)
+	return LoadTestnet(file, ifd)
+}
+
+func TestTestnetAddressFamilies(t *testing.T) {
+	testCases := []struct {
+		name      string
+		manifest  string
+		expectErr string
+		check     func(t *testing.T, testnet *Testnet)
+	}{
+		{
+			name: "single stack",
+			manifest: `
+[node.validator01]
+[node.validator02]
+persistent_peers = ["validator01"]
+`,
+			check: func(t *testing.T, testnet *Testnet) {
+				assert.Nil(t, testnet.IPv6Net)
+				for _, node := range testnet.Nodes {
+					assert.Equal(t, AddressFamilyIPv4, node.AddressFamily)
+					assert.Nil(t, node.InternalIPv6)
+				}
+			},
+		},
+		{
+			name: "dual-homed peer",
+			manifest: `
+[node.validator01]
+address_family = "ipv4"
+persistent_peers = ["validator02"]
+[node.validator02]
+address_family = "dual"
+[node.validator03]
+address_family = "ipv6"
+persistent_peers = ["validator02"]
+`,
+			check: func(t *testing.T, testnet *Testnet) {
+				require.NotNil(t, testnet.IPv6Net)
+				validator01 := testnet.LookupNode("validator01")
+				validator02 := testnet.LookupNode("validator02")
+				validator03 := testnet.LookupNode("validator03")
+				assert.Equal(t, validator02.InternalIP, validator02.ipFrom(validator01))
+				assert.Equal(t, validator02.InternalIPv6, validator02.ipFrom(validator03))
+				assert.Len(t, validator02.IPs(), 2)
+			},
+		},
+		{
+			name: "default peers share an address family",
+			manifest: `
+[node.validator01]
+address_family = "ipv4"
+[node.validator02]
+address_family = "dual"
+[node.validator03]
+address_family = "ipv6"
+persistent_peers = ["validator02"]
+`,
+			check: func(t *testing.T, testnet *Testnet) {
+				peers := []string{}
+				for _, peer := range testnet.LookupNode("validator01").PersistentPeers {
+					peers = append(peers, peer.Name)
+				}
+				assert.Equal(t, []string{"validator02"}, peers)
+			},
+		},
+		{
+			name: "peer without a common address family",
+			manifest: `
+[node.validator01]
+address_family = "ipv4"
+persistent_peers = ["validator02"]
+[node.validator02]
+address_family = "ipv6"
+persistent_peers = ["validator01"]
+`,
+			expectErr: `cannot reach peer "validator02" with address family "ipv6"`,
+		},
+		{
+			name: "no node with a common address family",
+			manifest: `
+[node.validator01]
+address_family = "ipv4"
+[node.validator02]
+address_family = "ipv6"
+`,
+			expectErr: `node with address family "ipv4" cannot reach any other node`,
+		},
+		{
+			name: "invalid address family",
+			manifest: `
+[node.validator01]
+address_family = "ipv5"
+`,
+			expectErr: `invalid address family "ipv5"`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testnet, err := loadTestnetTOML(t, tc.manifest)
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			if tc.check != nil {
+				tc.check(t, testnet)
+			}
+		})
+	}
+}
+
+func TestLoadTestnetPeerStartHeights(t *testing.T) {
+	_, err := loadTestnetTOML(t, `
+[node.validator01]
+persistent_peers = ["validator02"]
+[node.validator02]
+start_at = 10
+persistent_peers = ["validator01"]
+`)
+	require.ErrorContains(t, err, `all seeds and persistent peers of node "validator01" start after it`)
+}
+
+func TestTestnetNodeKeyTypes(t *testing.T) {
+	testCases := []struct {
+		name        string
+		nodeKeyType string
+		keyType     string
+		expectErr   string
+	}{
+		{name: "defaults"},
+		{name: "ed25519 node key with secp256k1 validator key", nodeKeyType: "ed25519", keyType: "secp256k1"},
+		{name: "secp256k1 node key", nodeKeyType: "secp256k1", expectErr: `unsupported node key type "secp256k1"`},
+		{name: "unknown node key", nodeKeyType: "rsa", expectErr: `unsupported node key type "rsa"`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testnet, err := loadTestnetTOML(t, fmt.Sprintf(`
+[node.validator01]
+node_key_type = %q
+key_type = %q
+`, tc.nodeKeyType, tc.keyType))
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "ed25519", testnet.Nodes[0].NodeKey.Type())
+		})
+	}
+}
+
+func TestTestnetConsensusTimeouts(t *testing.T) {
+	testCases := []struct {
+		name      string
+		timeouts  string
+		expectErr string
+	}{
+		{name: "defaults"},
+		{name: "aggressive", timeouts: `timeout_propose = "500ms"` + "\n" + `timeout_commit = "100ms"`},
+		{name: "at the bound", timeouts: fmt.Sprintf("timeout_propose = %q", MaxConsensusTimeout)},
+		{
+			name:      "negative propose",
+			timeouts:  `timeout_propose = "-1s"`,
+			expectErr: "timeout_propose must be between 0 and",
+		},
+		{
+			name:      "commit beyond the bound",
+			timeouts:  fmt.Sprintf("timeout_commit = %q", MaxConsensusTimeout+time.Second),
+			expectErr: "timeout_commit must be between 0 and",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadTestnetTOML(t, "[node.validator01]\n"+tc.timeouts+"\n[node.validator02]\n")
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestTestnetABCIJitter(t *testing.T) {
+	testnet, err := loadTestnetTOML(t, `
+prepare_proposal_jitter = "100ms"
+process_proposal_jitter = "200ms"
+[node.validator01]
+`)
+	require.NoError(t, err)
+	assert.Equal(t, 100*time.Millisecond, testnet.PrepareProposalJitter)
+	assert.Equal(t, 200*time.Millisecond, testnet.ProcessProposalJitter)
+
+	_, err = loadTestnetTOML(t, `
+process_proposal_jitter = "-1ms"
+[node.validator01]
+`)
+	require.ErrorContains(t, err, "must not be negative")
+}
+
+func TestTestnetStartupSLAs(t *testing.T) {
+	testnet, err := loadTestnetTOML(t, `
+expected_first_block_by = "1m"
+expected_catch_up_by = "5m"
+[node.validator01]
+`)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, testnet.ExpectedFirstBlockBy)
+	assert.Equal(t, 5*time.Minute, testnet.ExpectedCatchUpBy)
+
+	_, err = loadTestnetTOML(t, `
+expected_catch_up_by = "-1s"
+[node.validator01]
+`)
+	require.ErrorContains(t, err, "must not be negative")
+}
+
+func TestTestnetBlockParams(t *testing.T) {
+	testCases := []struct {
+		name      string
+		manifest  string
+		expectErr string
+	}{
+		{
+			name: "validators agree",
+			manifest: `
+max_gas = 100
+[node.validator01]
+max_block_bytes = 65536
+[node.validator02]
+max_block_bytes = 65536
+[node.full01]
+mode = "full"
+`,
+		},
+		{
+			name: "validators disagree",
+			manifest: `
+[node.validator01]
+max_block_bytes = 65536
+[node.validator02]
+max_block_bytes = 131072
+`,
+			expectErr: "all validators must agree",
+		},
+		{
+			name: "validator unset",
+			manifest: `
+[node.validator01]
+max_block_bytes = 65536
+[node.validator02]
+`,
+			expectErr: "all validators must agree",
+		},
+		{
+			name: "full node disagrees",
+			manifest: `
+[node.validator01]
+max_block_bytes = 65536
+[node.full01]
+mode = "full"
+max_block_bytes = 131072
+`,
+			expectErr: "all validators must agree",
+		},
+		{
+			name: "too large",
+			manifest: `
+[node.validator01]
+max_block_bytes = 1000000000
+`,
+			expectErr: "must be between 0 and",
+		},
+		{
+			name: "no room for load transactions",
+			manifest: `
+[load_profile]
+tx_rate = 10
+tx_sizes = [16384]
+[node.validator01]
+max_block_bytes = 16384
+`,
+			expectErr: "too few for load transactions of 16384 bytes",
+		},
+		{
+			name: "negative max gas",
+			manifest: `
+max_gas = -1
+[node.validator01]
+`,
+			expectErr: "max_gas must not be negative",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testnet, err := loadTestnetTOML(t, tc.manifest)
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.EqualValues(t, 65536, testnet.MaxBlockBytes)
+			assert.EqualValues(t, 100, testnet.MaxGas)
+		})
+	}
+}
+
+func TestTestnetAppConfig(t *testing.T) {
+	testCases := []struct {
+		name      string
+		manifest  string
+		expectErr string
+	}{
+		{
+			name: "mixed vote extensions",
+			manifest: `
+vote_extensions_enable_height = 1
+[node.validator01]
+app_config = { empty_vote_extensions = "accept" }
+[node.validator02]
+app_config = { vote_extensions = "omit", empty_vote_extensions = "accept" }
+[node.full01]
+mode = "full"
+app_config = { empty_vote_extensions = "accept" }
+[node.light01]
+mode = "light"
+persistent_peers = ["validator01", "validator02"]
+`,
+		},
+		{
+			name: "minority omits vote extensions",
+			manifest: `
+vote_extensions_enable_height = 1
+[node.validator01]
+[node.validator02]
+[node.validator03]
+[node.validator04]
+app_config = { vote_extensions = "omit" }
+`,
+		},
+		{
+			name: "third omits vote extensions",
+			manifest: `
+vote_extensions_enable_height = 1
+[node.validator01]
+[node.validator02]
+[node.validator03]
+app_config = { vote_extensions = "omit" }
+`,
+			expectErr: "cannot reach consensus unless all nodes accept empty vote extensions",
+		},
+		{
+			name: "third omits vote extensions after update",
+			manifest: `
+vote_extensions_enable_height = 1
+[validators]
+validator01 = 100
+validator02 = 100
+validator03 = 100
+[validator_update.10]
+validator04 = 150
+[node.validator01]
+[node.validator02]
+[node.validator03]
+[node.validator04]
+app_config = { vote_extensions = "omit" }
+`,
+			expectErr: "hold 150 of 450 voting power at height 10",
+		},
+		{
+			name: "vote extensions disabled",
+			manifest: `
+[node.validator01]
+app_config = { vote_extensions = "omit" }
+`,
+		},
+		{
+			name: "disagree on empty vote extensions",
+			manifest: `
+[node.validator01]
+app_config = { empty_vote_extensions = "accept" }
+[node.full01]
+mode = "full"
+`,
+			expectErr: "disagree on empty_vote_extensions",
+		},
+		{
+			name: "unknown toggle",
+			manifest: `
+[node.validator01]
+app_config = { turbo = "on" }
+`,
+			expectErr: `unknown app_config toggle "turbo"`,
+		},
+		{
+			name: "invalid value",
+			manifest: `
+[node.validator01]
+app_config = { vote_extensions = "sometimes" }
+`,
+			expectErr: `invalid value "sometimes"`,
+		},
+		{
+			name: "light client",
+			manifest: `
+[node.validator01]
+[node.validator02]
+[node.light01]
+mode = "light"
+persistent_peers = ["validator01", "validator02"]
+app_config = { vote_extensions = "omit" }
+`,
+			expectErr: "take no app_config",
+		},
+		{
+			name: "older version",
+			manifest: `
+[node.validator01]
+version = "cometbft/e2e-node:v0.38.0"
+app_config = { vote_extensions = "omit" }
+`,
+			expectErr: "app_config requires the local version",
+		},
+		{
+			name: "other app",
+			manifest: `
+abci_app = "my-app"
+abci_protocol = "tcp"
+[node.validator01]
+app_config = { vote_extensions = "omit" }
+`,
+			expectErr: "only applies to the kvstore app",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadTestnetTOML(t, tc.manifest)
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+
+	// The toggles pass through saving and loading the manifest unchanged.
+	testnet, err := loadTestnetTOML(t, testCases[0].manifest)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"vote_extensions": "omit", "empty_vote_extensions": "accept"},
+		testnet.LookupNode("validator02").AppConfig)
+	assert.Empty(t, testnet.LookupNode("light01").AppConfig)
+
+	m := Manifest{Nodes: map[string]*ManifestNode{"validator01": {AppConfig: testnet.LookupNode("validator02").AppConfig}}}
+	file := filepath.Join(t.TempDir(), "saved.toml")
+	require.NoError(t, m.Save(file))
+	saved, err := LoadManifest(file)
+	require.NoError(t, err)
+	assert.Equal(t, m.Nodes["validator01"].AppConfig, saved.Nodes["validator01"].AppConfig)
+}
+
+func TestTestnetSnapshot(t *testing.T) {
+	const nodes = `
+[node.validator01]
+snapshot_interval = 3
+[node.validator02]
+[node.full01]
+mode = "full"
+start_at = 20
+state_sync = true
+`
+	hash := strings.Repeat("AB", 32)
+	testCases := []struct {
+		name      string
+		manifest  string
+		expectErr string
+	}{
+		{
+			name: "fetched hash",
+			manifest: `
+[snapshot]
+height = 10
+` + nodes,
+		},
+		{
+			name: "given hash",
+			manifest: `
+[snapshot]
+height = 10
+hash = "` + hash + `"
+` + nodes,
+		},
+		{
+			name: "below initial height",
+			manifest: `
+initial_height = 5
+[snapshot]
+height = 4
+` + nodes,
+			expectErr: "snapshot height 4 must not be below the initial height 5",
+		},
+		{
+			name: "at start height",
+			manifest: `
+[snapshot]
+height = 20
+` + nodes,
+			expectErr: `state syncing node "full01" starts at height 20, but the snapshot height 20 must be below it`,
+		},
+		{
+			name: "short hash",
+			manifest: `
+[snapshot]
+height = 10
+hash = "ABAB"
+` + nodes,
+			expectErr: "snapshot hash must be 32 bytes, got 2",
+		},
+		{
+			name: "invalid hash",
+			manifest: `
+[snapshot]
+height = 10
+hash = "xyz"
+` + nodes,
+			expectErr: "invalid snapshot hash",
+		},
+		{
+			name: "no state syncing node",
+			manifest: `
+[snapshot]
+height = 10
+[node.validator01]
+`,
+			expectErr: "snapshot is set, but no node state syncs",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testnet, err := loadTestnetTOML(t, tc.manifest)
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.EqualValues(t, 10, testnet.SnapshotHeight)
+		})
+	}
+}
+
+func TestTestnetSeedOnlyDiscovery(t *testing.T) {
+	testCases := []struct {
+		name      string
+		manifest  string
+		expectErr string
+	}{
+		{
+			name: "seeds only",
+			manifest: `
+seed_only_discovery = true
+[node.seed01]
+mode = "seed"
+[node.validator01]
+seeds = ["seed01"]
+[node.validator02]
+seeds = ["seed01"]
+[node.light01]
+mode = "light"
+persistent_peers = ["validator01", "validator02"]
+`,
+		},
+		{
+			name: "no seed nodes",
+			manifest: `
+seed_only_discovery = true
+[node.validator01]
+[node.validator02]
+`,
+			expectErr: "seed_only_discovery requires at least one seed node",
+		},
+		{
+			name: "persistent peers",
+			manifest: `
+seed_only_discovery = true
+[node.seed01]
+mode = "seed"
+[node.validator01]
+seeds = ["seed01"]
+[node.validator02]
+seeds = ["seed01"]
+persistent_peers = ["validator01"]
+`,
+			expectErr: `node "validator02" has persistent peers`,
+		},
+		{
+			name: "no seeds",
+			manifest: `
+seed_only_discovery = true
+[node.seed01]
+mode = "seed"
+[node.validator01]
+seeds = ["seed01"]
+[node.validator02]
+`,
+			expectErr: `node "validator02" has no seeds`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testnet, err := loadTestnetTOML(t, tc.manifest)
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, testnet.SeedOnlyDiscovery)
+		})
+	}
+}
+
+func TestTestnetMempool(t *testing.T) {
+	testnet, err := loadTestnetTOML(t, `
+[node.validator01]
+[node.validator02]
+mempool_cache_size = 0
+mempool_recheck = false
+[node.full01]
+mode = "full"
+mempool_cache_size = 100
+`)
+	require.NoError(t, err)
+	validator01 := testnet.LookupNode("validator01")
+	assert.Equal(t, 10000, validator01.MempoolCacheSize)
+	assert.True(t, validator01.MempoolRecheck)
+	validator02 := testnet.LookupNode("validator02")
+	assert.Zero(t, validator02.MempoolCacheSize)
+	assert.False(t, validator02.MempoolRecheck)
+	full01 := testnet.LookupNode("full01")
+	assert.Equal(t, 100, full01.MempoolCacheSize)
+	assert.True(t, full01.MempoolRecheck)
+
+	_, err = loadTestnetTOML(t, `
+[node.validator01]
+mempool_cache_size = -1
+`)
+	require.ErrorContains(t, err, "mempool_cache_size must not be negative")
+
+	_, err = loadTestnetTOML(t, `
+[node.validator01]
+[node.validator02]
+[node.light01]
+mode = "light"
+persistent_peers = ["validator01", "validator02"]
+mempool_recheck = false
+`)
+	require.ErrorContains(t, err, "light clients have no mempool")
+
+	// Unset settings stay unset when saving the manifest.
+	cacheSize, recheck := 0, false
+	m := Manifest{Nodes: map[string]*ManifestNode{
+		"validator01": {MempoolCacheSize: &cacheSize, MempoolRecheck: &recheck},
+		"validator02": {},
+	}}
+	file := filepath.Join(t.TempDir(), "saved.toml")
+	require.NoError(t, m.Save(file))
+	saved, err := LoadManifest(file)
+	require.NoError(t, err)
+	assert.Equal(t, m.Nodes, saved.Nodes)
+}
+
+func TestTestnetRPCConfig(t *testing.T) {
+	testnet, err := loadTestnetTOML(t, `
+[node.validator01]
+[node.validator02]
+rpc_config = { unsafe = true, max_subscriptions_per_client = 0 }
+[node.full01]
+mode = "full"
+[node.full01.rpc_config]
+max_subscriptions_per_client = 20
+`)
+	require.NoError(t, err)
+	validator01 := testnet.LookupNode("validator01")
+	assert.False(t, validator01.RPCUnsafe)
+	assert.Equal(t, 5, validator01.RPCMaxSubscriptions)
+	validator02 := testnet.LookupNode("validator02")
+	assert.True(t, validator02.RPCUnsafe)
+	assert.Zero(t, validator02.RPCMaxSubscriptions)
+	full01 := testnet.LookupNode("full01")
+	assert.False(t, full01.RPCUnsafe)
+	assert.Equal(t, 20, full01.RPCMaxSubscriptions)
+
+	_, err = loadTestnetTOML(t, `
+[node.validator01]
+rpc_config = { max_subscriptions_per_client = -1 }
+[node.validator02]
+`)
+	require.ErrorContains(t, err, "max_subscriptions_per_client must not be negative")
+
+	_, err = loadTestnetTOML(t, `
+[node.validator01]
+[node.validator02]
+[node.light01]
+mode = "light"
+persistent_peers = ["validator01", "validator02"]
+rpc_config = { unsafe = true }
+`)
+	require.ErrorContains(t, err, "light clients take no rpc_config")
+
+	_, err = loadTestnetTOML(t, `
+[node.validator01]
+rpc_config = { max_subscriptions_per_client = 0 }
+[node.seed01]
+mode = "seed"
+`)
+	require.ErrorContains(t, err, "no validator or full node accepts RPC subscriptions")
+
+	// Unset settings stay unset when saving the manifest.
+	subscriptions := 0
+	m := Manifest{Nodes: map[string]*ManifestNode{
+		"validator01": {RPCConfig: ManifestRPCConfig{Unsafe: true, MaxSubscriptionsPerClient: &subscriptions}},
+		"validator02": {},
+	}}
+	file := filepath.Join(t.TempDir(), "saved.toml")
+	require.NoError(t, m.Save(file))
+	saved, err := LoadManifest(file)
+	require.NoError(t, err)
+	assert.Equal(t, m.Nodes, saved.Nodes)
+}
+
+func TestTestnetMetricThresholds(t *testing.T) {
+	testnet, err := loadTestnetTOML(t, `
+[metric_thresholds]
+cometbft_consensus_block_interval_seconds = { max = 3.5 }
+cometbft_mempool_size = { min = 0, max = 100 }
+[node.validator01]
+enable_prometheus = true
+[node.validator02]
+`)
+	require.NoError(t, err)
+	interval := testnet.MetricThresholds["cometbft_consensus_block_interval_seconds"]
+	assert.Nil(t, interval.Min)
+	require.NoError(t, interval.Check(3.5))
+	require.ErrorContains(t, interval.Check(4), "above the maximum of 3.5")
+	mempool := testnet.MetricThresholds["cometbft_mempool_size"]
+	require.ErrorContains(t, mempool.Check(-1), "below the minimum of 0")
+
+	testCases := []struct {
+		manifest  string
+		expectErr string
+	}{
+		{`
+[metric_thresholds]
+cometbft_mempool_size = { max = 100 }
+[node.validator01]
+`, "metric_thresholds require a node exposing Prometheus metrics"},
+		{`
+prometheus = true
+[metric_thresholds]
+cometbft_mempool_size = {}
+[node.validator01]
+`, "has neither min nor max"},
+		{`
+prometheus = true
+[metric_thresholds]
+cometbft_mempool_size = { min = 10, max = 1 }
+[node.validator01]
+`, "has min 10 above max 1"},
+	}
+	for _, tc := range testCases {
+		_, err := loadTestnetTOML(t, tc.manifest)
+		require.ErrorContains(t, err, tc.expectErr)
+	}
+}
+
+func TestTestnetKeyRotations(t *testing.T) {
+	testnet, err := loadTestnetTOML(t, `
+[validators]
+validator01 = 100
+validator02 = 100
+validator03 = 100
+validator04 = 50
+[validator_update.20]
+validator04 = 60
+[node.validator01]
+[node.validator02]
+[node.validator03]
+[node.validator04]
+key_rotations = { 20 = "second" }
+`)
+	require.NoError(t, err)
+	validator04 := testnet.LookupNode("validator04")
+	rotated := validator04.KeyRotations[20]
+	require.NotNil(t, rotated)
+	assert.NotEqual(t, validator04.PrivvalKey, rotated)
+	assert.Equal(t, validator04.PrivvalKey, validator04.PrivvalKeyAt(19))
+	assert.Equal(t, rotated, validator04.PrivvalKeyAt(20))
+
+	testCases := []struct {
+		name      string
+		manifest  string
+		expectErr string
+	}{
+		{"unmatched rotation", `
+[node.validator01]
+[node.validator02]
+[node.validator03]
+[node.validator04]
+key_rotations = { 20 = "second" }
+`, "key rotation of node \"validator04\" at height 20 has no matching validator update"},
+		{"removing update", `
+[validator_update.20]
+validator04 = 0
+[node.validator01]
+[node.validator02]
+[node.validator03]
+[node.validator04]
+key_rotations = { 20 = "second" }
+`, "has no matching validator update"},
+		{"not yet a validator", `
+[validators]
+validator01 = 100
+validator02 = 100
+validator03 = 100
+[validator_update.20]
+validator04 = 10
+[node.validator01]
+[node.validator02]
+[node.validator03]
+[node.validator04]
+key_rotations = { 20 = "second" }
+`, "isn't a validator then"},
+		{"too much power", `
+[validators]
+validator01 = 100
+validator02 = 100
+[validator_update.20]
+validator02 = 100
+[node.validator01]
+[node.validator02]
+key_rotations = { 20 = "second" }
+`, "validators rotating their keys hold 100 of 200 voting power at height 20"},
+		{"remote signer", `
+[validator_update.20]
+validator04 = 100
+[node.validator01]
+[node.validator02]
+[node.validator03]
+[node.validator04]
+privval_protocol = "tcp"
+key_rotations = { 20 = "second" }
+`, "key rotations require privval protocol \"file\""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadTestnetTOML(t, tc.manifest)
+			require.ErrorContains(t, err, tc.expectErr)
+		})
+	}
+}
+
+func TestTestnetShortRetention(t *testing.T) {
+	testCases := []struct {
+		name      string
+		manifest  string
+		expectErr string
+	}{
+		{
+			name: "minority",
+			manifest: `
+[node.validator01]
+[node.validator02]
+[node.validator03]
+[node.validator04]
+retain_blocks = 3
+short_retention = true
+[node.full01]
+mode = "full"
+retain_blocks = 3
+short_retention = true
+`,
+		},
+		{
+			name: "without short_retention",
+			manifest: `
+[node.validator01]
+[node.full01]
+mode = "full"
+retain_blocks = 3
+`,
+			expectErr: "retain_blocks must be 0 or be greater or equal to max evidence age",
+		},
+		{
+			name: "without retain_blocks",
+			manifest: `
+[node.validator01]
+[node.full01]
+mode = "full"
+short_retention = true
+`,
+			expectErr: "short_retention only applies to validators and full nodes with retain_blocks",
+		},
+		{
+			name: "third of the power",
+			manifest: `
+[node.validator01]
+[node.validator02]
+[node.validator03]
+retain_blocks = 3
+short_retention = true
+`,
+			expectErr: "validators with short_retention hold 100 of 300 voting power at height 1",
+		},
+		{
+			name: "third of the power after an update",
+			manifest: `
+[validator_update.5]
+validator04 = 200
+[node.validator01]
+[node.validator02]
+[node.validator03]
+[node.validator04]
+retain_blocks = 3
+short_retention = true
+start_at = 5
+`,
+			expectErr: "validators with short_retention hold 200 of 500 voting power at height 5",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testnet, err := loadTestnetTOML(t, tc.manifest)
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, testnet.LookupNode("full01").ShortRetention)
+			assert.False(t, testnet.LookupNode("validator01").ShortRetention)
+		})
+	}
+}
+
+func TestTestnetLightProviders(t *testing.T) {
+	testCases := []struct {
+		name      string
+		light     string
+		expectErr string
+	}{
+		{name: "primary and witness", light: `persistent_peers = ["validator01"]
+witnesses = ["validator02"]`},
+		{name: "two persistent peers", light: `persistent_peers = ["validator01", "validator02"]`},
+		{name: "default peers", light: ``},
+		{
+			name:      "single provider",
+			light:     `persistent_peers = ["validator01"]`,
+			expectErr: "light client needs at least 2 distinct providers, a primary and a witness, but has 1",
+		},
+		{
+			name:      "repeated provider",
+			light:     `persistent_peers = ["validator01", "validator01"]`,
+			expectErr: "but has 1",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadTestnetTOML(t, `
+[node.validator01]
+[node.validator02]
+[node.light01]
+mode = "light"
+start_at = 5
+`+tc.light+"\n")
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestTestnetLightTrust(t *testing.T) {
+	testCases := []struct {
+		name      string
+		manifest  string
+		expectErr string
+	}{
+		{
+			name: "archive provider",
+			manifest: `
+[node.validator01]
+retain_blocks = 10
+[node.validator02]
+[node.light01]
+mode = "light"
+start_at = 30
+persistent_peers = ["validator01"]
+witnesses = ["validator02"]
+`,
+		},
+		{
+			name: "pruning provider retaining the trust height",
+			manifest: `
+[node.validator01]
+retain_blocks = 10
+[node.validator02]
+retain_blocks = 10
+[node.light01]
+mode = "light"
+start_at = 30
+trust_height = 25
+persistent_peers = ["validator01"]
+witnesses = ["validator02"]
+`,
+		},
+		{
+			name: "pruning providers retaining the trust height at the start height",
+			manifest: `
+[node.validator01]
+retain_blocks = 30
+[node.validator02]
+retain_blocks = 10
+[node.light01]
+mode = "light"
+start_at = 30
+persistent_peers = ["validator01"]
+witnesses = ["validator02"]
+`,
+		},
+		{
+			name: "pruning providers",
+			manifest: `
+[node.validator01]
+retain_blocks = 20
+[node.validator02]
+retain_blocks = 10
+[node.light01]
+mode = "light"
+start_at = 30
+persistent_peers = ["validator01"]
+witnesses = ["validator02"]
+`,
+			expectErr: "light client \"light01\" trusts height 1, but all of its providers have pruned it by its " +
+				"start height 30; the closest, \"validator01\", is 10 blocks short of retaining it",
+		},
+		{
+			name: "pruning providers and a later trust height",
+			manifest: `
+[node.validator01]
+retain_blocks = 10
+[node.validator02]
+retain_blocks = 10
+[node.light01]
+mode = "light"
+start_at = 30
+trust_height = 15
+persistent_peers = ["validator01"]
+witnesses = ["validator02"]
+`,
+			expectErr: "is 6 blocks short of retaining it",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadTestnetTOML(t, tc.manifest)
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestTestnetUpgradeHeight(t *testing.T) {
+	testCases := []struct {
+		name      string
+		manifest  string
+		expectErr string
+	}{
+		{
+			name: "nodes start before the upgrade",
+			manifest: `
+upgrade_height = 20
+[node.validator01]
+version = "cometbft/e2e-node:v0.38.0"
+[node.full02]
+mode = "full"
+version = "cometbft/e2e-node:v0.38.0"
+start_at = 10
+[node.full01]
+mode = "full"
+start_at = 30
+`,
+		},
+		{
+			name: "upgrade at the initial height",
+			manifest: `
+initial_height = 20
+upgrade_height = 20
+[node.validator01]
+version = "cometbft/e2e-node:v0.38.0"
+`,
+			expectErr: "upgrade_height 20 must be above the initial height 20",
+		},
+		{
+			name: "old node starts after the upgrade",
+			manifest: `
+upgrade_height = 20
+[node.validator01]
+[node.full01]
+mode = "full"
+version = "cometbft/e2e-node:v0.38.0"
+start_at = 30
+`,
+			expectErr: `node "full01" must start below upgrade_height 20`,
+		},
+		{
+			name: "upgrade perturbation",
+			manifest: `
+upgrade_height = 20
+[node.validator01]
+version = "cometbft/e2e-node:v0.38.0"
+perturb = ["upgrade"]
+`,
+			expectErr: `node "validator01" cannot use the 'upgrade' perturbation with upgrade_height`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadTestnetTOML(t, tc.manifest)
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestTestnetRecoveryMode(t *testing.T) {
+	testCases := []struct {
+		name      string
+		manifest  string
+		expectErr string
+	}{
+		{
+			name: "blocksync from another archive node",
+			manifest: `
+[node.validator01]
+[node.validator02]
+perturb = ["corrupt_db"]
+recovery_mode = "blocksync"
+`,
+		},
+		{
+			name: "state sync from archive nodes and a snapshot provider",
+			manifest: `
+[node.validator01]
+snapshot_interval = 3
+[node.validator02]
+[node.full01]
+mode = "full"
+perturb = ["corrupt_db"]
+recovery_mode = "statesync"
+`,
+		},
+		{
+			name: "last archive node",
+			manifest: `
+[node.validator01]
+perturb = ["corrupt_db"]
+recovery_mode = "blocksync"
+[node.full01]
+mode = "full"
+retain_blocks = 14
+`,
+			expectErr: `invalid node "validator01": cannot corrupt the database of the last archive node`,
+		},
+		{
+			name: "state sync with a single other archive node",
+			manifest: `
+[node.validator01]
+snapshot_interval = 3
+[node.full01]
+mode = "full"
+perturb = ["corrupt_db"]
+recovery_mode = "statesync"
+`,
+			expectErr: "recovering with state sync requires 2 other archive nodes as RPC servers",
+		},
+		{
+			name: "state sync without snapshot providers",
+			manifest: `
+[node.validator01]
+[node.validator02]
+[node.full01]
+mode = "full"
+perturb = ["corrupt_db"]
+recovery_mode = "statesync"
+`,
+			expectErr: "recovering with state sync requires a snapshot provider with format 1",
+		},
+		{
+			name: "missing recovery mode",
+			manifest: `
+[node.validator01]
+[node.validator02]
+perturb = ["corrupt_db"]
+`,
+			expectErr: "'corrupt_db' perturbation requires recovery_mode",
+		},
+		{
+			name: "recovery mode without corrupt_db",
+			manifest: `
+[node.validator01]
+[node.validator02]
+recovery_mode = "blocksync"
+`,
+			expectErr: "recovery_mode only applies to nodes with the 'corrupt_db' perturbation",
+		},
+		{
+			name: "invalid recovery mode",
+			manifest: `
+[node.validator01]
+[node.validator02]
+perturb = ["corrupt_db"]
+recovery_mode = "restore"
+`,
+			expectErr: `invalid recovery_mode "restore"`,
+		},
+		{
+			name: "seed node",
+			manifest: `
+[node.validator01]
+[node.seed01]
+mode = "seed"
+perturb = ["corrupt_db"]
+recovery_mode = "blocksync"
+`,
+			expectErr: "'corrupt_db' perturbation only applies to validators and full nodes",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadTestnetTOML(t, tc.manifest)
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestTestnetSyncCapacity(t *testing.T) {
+	testCases := []struct {
+		name      string
+		manifest  string
+		expectErr string
+	}{
+		{
+			name: "staggered nodes",
+			manifest: `
+[node.validator01]
+[node.full01]
+mode = "full"
+start_at = 10
+[node.full02]
+mode = "full"
+start_at = 15
+[node.full03]
+mode = "full"
+start_at = 20
+[node.full04]
+mode = "full"
+start_at = 25
+`,
+		},
+		{
+			name: "block syncing nodes within capacity",
+			manifest: `
+[node.validator01]
+[node.full01]
+mode = "full"
+start_at = 20
+[node.full02]
+mode = "full"
+start_at = 20
+[node.full03]
+mode = "full"
+start_at = 20
+`,
+		},
+		{
+			name: "too many block syncing nodes",
+			manifest: `
+[node.validator01]
+[node.full01]
+mode = "full"
+start_at = 20
+[node.full02]
+mode = "full"
+start_at = 20
+[node.full03]
+mode = "full"
+start_at = 20
+[node.full04]
+mode = "full"
+start_at = 20
+`,
+			expectErr: "4 nodes block sync from height 20, but 1 archive nodes only serve 3",
+		},
+		{
+			name: "too many state syncing nodes",
+			manifest: `
+[node.validator01]
+snapshot_interval = 3
+[node.validator02]
+[node.validator03]
+[node.full01]
+mode = "full"
+start_at = 20
+state_sync = true
+[node.full02]
+mode = "full"
+start_at = 20
+state_sync = true
+[node.full03]
+mode = "full"
+start_at = 20
+state_sync = true
+[node.full04]
+mode = "full"
+start_at = 20
+state_sync = true
+`,
+			expectErr: "4 nodes state sync from height 20, but 1 snapshot providers only serve 3",
+		},
+		{
+			name: "snapshot providers starting at the same height",
+			manifest: `
+[node.validator01]
+snapshot_interval = 3
+[node.validator02]
+[node.validator03]
+[node.full01]
+mode = "full"
+start_at = 20
+state_sync = true
+snapshot_interval = 3
+[node.full02]
+mode = "full"
+start_at = 20
+state_sync = true
+[node.full03]
+mode = "full"
+start_at = 20
+state_sync = true
+[node.full04]
+mode = "full"
+start_at = 20
+state_sync = true
+`,
+			expectErr: "4 nodes state sync from height 20, but 1 snapshot providers only serve 3",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadTestnetTOML(t, tc.manifest)
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestTestnetABCIApp(t *testing.T) {
+	testCases := []struct {
+		name      string
+		manifest  string
+		expectErr string
+	}{
+		{
+			name: "default kvstore app",
+			manifest: `
+initial_state = { items = "1" }
+[node.validator01]
+`,
+		},
+		{
+			name: "other app over a socket",
+			manifest: `
+abci_app = "stress-app"
+abci_protocol = "tcp"
+[node.validator01]
+[node.validator02]
+[node.light01]
+mode = "light"
+start_at = 5
+persistent_peers = ["validator01", "validator02"]
+`,
+		},
+		{
+			name: "other app with a builtin protocol",
+			manifest: `
+abci_app = "stress-app"
+abci_protocol = "builtin_connsync"
+[node.validator01]
+`,
+			expectErr: `node "validator01" cannot run app "stress-app" with the "builtin_connsync" protocol`,
+		},
+		{
+			name: "other app with kvstore state",
+			manifest: `
+abci_app = "stress-app"
+abci_protocol = "unix"
+initial_state = { items = "1" }
+[node.validator01]
+`,
+			expectErr: "initial_state and expected_initial_app_hash only apply to the kvstore app",
+		},
+		{
+			name: "app path",
+			manifest: `
+abci_app = "/bin/sh"
+abci_protocol = "unix"
+[node.validator01]
+`,
+			expectErr: `invalid abci_app "/bin/sh"`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testnet, err := loadTestnetTOML(t, tc.manifest)
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			require.NotEmpty(t, testnet.ABCIApp)
+		})
+	}
+}
+
+func TestTestnetArchiveBlackout(t *testing.T) {
+	const nodes = `
+[validators]
+validator01 = 30
+validator02 = 35
+validator03 = 35
+[node.validator01]
+[node.validator02]
+retain_blocks = 14
+[node.validator03]
+retain_blocks = 14
+[node.full01]
+mode = "full"
+start_at = 20
+`
+	testCases := []struct {
+		name      string
+		manifest  string
+		expectErr string
+	}{
+		{
+			name: "live quorum",
+			manifest: `
+archive_nodes = ["validator01"]
+archive_blackout_height = 15
+` + nodes,
+		},
+		{
+			name: "not an archive node",
+			manifest: `
+archive_nodes = ["validator02"]
+` + nodes,
+			expectErr: `archive node "validator02" must be a validator or full node starting at genesis`,
+		},
+		{
+			name: "unknown archive node",
+			manifest: `
+archive_nodes = ["validator09"]
+` + nodes,
+			expectErr: `unknown archive node "validator09"`,
+		},
+		{
+			name: "at initial height",
+			manifest: `
+archive_blackout_height = 1
+` + nodes,
+			expectErr: "archive_blackout_height 1 must be above the initial height 1",
+		},
+		{
+			name: "past catch-up SLA",
+			manifest: `
+archive_blackout_height = 15
+archive_blackout_duration = "1m"
+expected_catch_up_by = "1m"
+` + nodes,
+			expectErr: "archive_blackout_duration 1m0s must be below expected_catch_up_by 1m0s",
+		},
+		{
+			name: "no live quorum",
+			manifest: `
+archive_blackout_height = 15
+[validators]
+validator01 = 40
+validator02 = 30
+validator03 = 30
+[node.validator01]
+[node.validator02]
+retain_blocks = 14
+[node.validator03]
+retain_blocks = 14
+`,
+			expectErr: "archive validators hold 40 of 100 voting power at archive_blackout_height 15, must be less than 1/3",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testnet, err := loadTestnetTOML(t, tc.manifest)
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, DefaultArchiveBlackoutDuration, testnet.ArchiveBlackoutDuration)
+			assert.Len(t, testnet.Warnings(), 1)
+		})
+	}
+}
+
+func TestTestnetPrivvalDisconnect(t *testing.T) {
+	testCases := []struct {
+		name      string
+		manifest  string
+		expectErr string
+	}{
+		{
+			name: "socket signer",
+			manifest: `
+[validators]
+validator01 = 20
+validator02 = 40
+validator03 = 40
+[node.validator01]
+privval_protocol = "tcp"
+perturb = ["privval_disconnect"]
+[node.validator02]
+[node.validator03]
+`,
+		},
+		{
+			name: "file signer",
+			manifest: `
+[node.validator01]
+perturb = ["privval_disconnect"]
+[node.validator02]
+[node.validator03]
+[node.validator04]
+`,
+			expectErr: `'privval_disconnect' perturbation requires a validator with a socket signer, not "file"`,
+		},
+		{
+			name: "full node",
+			manifest: `
+[node.validator01]
+[node.full01]
+mode = "full"
+privval_protocol = "unix"
+perturb = ["privval_disconnect"]
+`,
+			expectErr: `'privval_disconnect' perturbation requires a validator with a socket signer`,
+		},
+		{
+			name: "no quorum",
+			manifest: `
+[validators]
+validator01 = 20
+validator02 = 40
+validator03 = 40
+[validator_update.10]
+validator01 = 60
+[node.validator01]
+privval_protocol = "unix"
+perturb = ["privval_disconnect"]
+[node.validator02]
+[node.validator03]
+`,
+			expectErr: "validators with the 'privval_disconnect' perturbation hold 60 of 140 voting power at height 10, " +
+				"must be less than 1/3",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadTestnetTOML(t, tc.manifest)
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestTestnetWALTruncate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		manifest  string
+		expectErr string
+	}{
+		{
+			name: "minority validator",
+			manifest: `
+[validators]
+validator01 = 20
+validator02 = 40
+validator03 = 40
+[node.validator01]
+perturb = ["wal_truncate"]
+[node.validator02]
+wal_enabled = false
+[node.validator03]
+`,
+		},
+		{
+			name: "wal disabled",
+			manifest: `
+[node.validator01]
+wal_enabled = false
+perturb = ["wal_truncate"]
+[node.validator02]
+[node.validator03]
+[node.validator04]
+`,
+			expectErr: "'wal_truncate' perturbation requires wal_enabled",
+		},
+		{
+			name: "full node",
+			manifest: `
+[node.validator01]
+[node.full01]
+mode = "full"
+perturb = ["wal_truncate"]
+`,
+			expectErr: "'wal_truncate' perturbation only applies to validators",
+		},
+		{
+			name: "light client",
+			manifest: `
+[node.validator01]
+[node.validator02]
+[node.light01]
+mode = "light"
+persistent_peers = ["validator01", "validator02"]
+wal_enabled = false
+`,
+			expectErr: "light clients have no consensus WAL, and take no wal_enabled",
+		},
+		{
+			name: "no quorum",
+			manifest: `
+[validators]
+validator01 = 20
+validator02 = 40
+validator03 = 40
+[node.validator01]
+perturb = ["wal_truncate"]
+[node.validator02]
+perturb = ["wal_truncate"]
+[node.validator03]
+`,
+			expectErr: "validators with the 'wal_truncate' perturbation hold 60 of 100 voting power at height 1, " +
+				"must be less than 1/3",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadTestnetTOML(t, tc.manifest)
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+// TestManifestWALRoundTrip tests that wal_enabled and the wal_truncate
+// perturbation survive a save/load round trip.
+func TestManifestWALRoundTrip(t *testing.T) {
+	m := Manifest{Nodes: map[string]*ManifestNode{
+		"validator01": {Perturb: []string{string(PerturbationWALTruncate)}},
+		"validator02": {WALEnabled: new(bool)},
+		"validator03": {},
+		"validator04": {},
+	}}
+	file := filepath.Join(t.TempDir(), "manifest.toml")
+	require.NoError(t, m.Save(file))
+	loaded, err := LoadManifest(file)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"wal_truncate"}, loaded.Nodes["validator01"].Perturb)
+	require.NotNil(t, loaded.Nodes["validator02"].WALEnabled)
+	assert.False(t, *loaded.Nodes["validator02"].WALEnabled)
+	assert.Nil(t, loaded.Nodes["validator03"].WALEnabled)
+
+	ifd, err := NewDockerInfrastructureData(loaded)
+	require.NoError(t, err)
+	testnet, err := LoadTestnet(file, ifd)
+	require.NoError(t, err)
+	assert.True(t, testnet.LookupNode("validator01").WALEnabled)
+	assert.False(t, testnet.LookupNode("validator02").WALEnabled)
+	assert.True(t, testnet.LookupNode("validator03").WALEnabled)
+}
+
+func TestTestnetConsensusParams(t *testing.T) {
+	testnet, err := loadTestnetTOML(t, `
+[node.validator01]
+retain_blocks = 7
+`)
+	require.NoError(t, err)
+	assert.Equal(t, EvidenceAgeHeight, testnet.EvidenceMaxAgeNumBlocks)
+	assert.Equal(t, EvidenceAgeTime, testnet.EvidenceMaxAgeDuration)
+
+	testnet, err = loadTestnetTOML(t, `
+[consensus_params]
+evidence_max_age_num_blocks = 14
+evidence_max_age_duration = "1s"
+[node.validator01]
+retain_blocks = 14
+`)
+	require.NoError(t, err)
+	assert.EqualValues(t, 14, testnet.EvidenceMaxAgeNumBlocks)
+	assert.Equal(t, time.Second, testnet.EvidenceMaxAgeDuration)
+
+	_, err = loadTestnetTOML(t, `
+[consensus_params]
+evidence_max_age_num_blocks = 14
+[node.validator01]
+retain_blocks = 7
+`)
+	require.ErrorContains(t, err, "retain_blocks must be 0 or be greater or equal to max evidence age (14)")
+}
+
+func TestTestnetFlap(t *testing.T) {
+	testCases := []struct {
+		name      string
+		manifest  string
+		expectErr string
+	}{
+		{
+			name: "flapping full node",
+			manifest: `
+[node.validator01]
+[node.full01]
+mode = "full"
+perturb = ["flap"]
+flap_interval = 5
+`,
+		},
+		{
+			name: "no interval",
+			manifest: `
+[node.validator01]
+[node.full01]
+mode = "full"
+perturb = ["flap"]
+`,
+			expectErr: "'flap' perturbation requires flap_interval between 2 and 10, got 0",
+		},
+		{
+			name: "interval without flap",
+			manifest: `
+[node.validator01]
+[node.full01]
+mode = "full"
+flap_interval = 5
+`,
+			expectErr: "flap_interval only applies to nodes with the 'flap' perturbation",
+		},
+		{
+			name: "flapping quorum",
+			manifest: `
+[node.validator01]
+perturb = ["flap"]
+flap_interval = 5
+[node.validator02]
+`,
+			expectErr: "validators with the 'flap' perturbation hold 100 of 200 voting power at height 1",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadTestnetTOML(t, tc.manifest)
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestTestnetBehindNAT(t *testing.T) {
+	testCases := []struct {
+		name      string
+		manifest  string
+		expectErr string
+	}{
+		{
+			name: "full node behind NAT dialing a validator",
+			manifest: `
+[node.validator01]
+[node.full01]
+mode = "full"
+behind_nat = true
+persistent_peers = ["validator01"]
+`,
+		},
+		{
+			name: "external address",
+			manifest: `
+[node.validator01]
+external_address = "203.0.113.1:26656"
+`,
+		},
+		{
+			name: "invalid external address",
+			manifest: `
+[node.validator01]
+external_address = "203.0.113.1"
+`,
+			expectErr: "invalid external_address",
+		},
+		{
+			name: "external address behind NAT",
+			manifest: `
+[node.validator01]
+[node.full01]
+mode = "full"
+behind_nat = true
+external_address = "203.0.113.1:26656"
+`,
+			expectErr: "external_address cannot be set on a node behind NAT",
+		},
+		{
+			name: "seed behind NAT",
+			manifest: `
+[node.seed01]
+mode = "seed"
+behind_nat = true
+[node.validator01]
+seeds = ["seed01"]
+`,
+			expectErr: "seed nodes must be directly reachable",
+		},
+		{
+			name: "bridge node behind NAT",
+			manifest: `
+bridge_nodes = ["full01"]
+[node.validator01]
+[node.full01]
+mode = "full"
+behind_nat = true
+`,
+			expectErr: "bridge node \"full01\" must not be behind NAT",
+		},
+		{
+			name: "all peers behind NAT",
+			manifest: `
+[node.validator01]
+[node.full01]
+mode = "full"
+behind_nat = true
+persistent_peers = ["full02"]
+[node.full02]
+mode = "full"
+behind_nat = true
+`,
+			expectErr: "node is behind NAT, and so are all of its peers",
+		},
+		{
+			name: "other version behind NAT",
+			manifest: `
+[node.validator01]
+[node.full01]
+mode = "full"
+version = "cometbft/e2e-node:v0.38.0"
+behind_nat = true
+`,
+			expectErr: "behind_nat requires the local version",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadTestnetTOML(t, tc.manifest)
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestTestnetSentries(t *testing.T) {
+	testCases := []struct {
+		name      string
+		manifest  string
+		expectErr string
+	}{
+		{
+			name: "default peers",
+			manifest: `
+[node.validator01]
+[node.validator02]
+[node.full01]
+mode = "full"
+sentry_for = "validator01"
+[node.full02]
+mode = "full"
+sentry_for = "validator01"
+[node.full03]
+mode = "full"
+`,
+		},
+		{
+			name: "explicit peers",
+			manifest: `
+[node.validator01]
+persistent_peers = ["full01"]
+[node.validator02]
+persistent_peers = ["full01", "full02"]
+[node.full01]
+mode = "full"
+sentry_for = "validator01"
+persistent_peers = ["validator01", "validator02"]
+[node.full02]
+mode = "full"
+persistent_peers = ["full01"]
+`,
+		},
+		{
+			name: "validator peering with the public network",
+			manifest: `
+[node.validator01]
+persistent_peers = ["full01", "validator02"]
+[node.validator02]
+[node.full01]
+mode = "full"
+sentry_for = "validator01"
+`,
+			expectErr: "validator \"validator01\" has sentries, but peers with \"validator02\" directly",
+		},
+		{
+			name: "public network peering with a validator",
+			manifest: `
+[node.validator01]
+persistent_peers = ["full01"]
+[node.validator02]
+persistent_peers = ["validator01"]
+[node.full01]
+mode = "full"
+sentry_for = "validator01"
+`,
+			expectErr: "node \"validator02\" peers with validator \"validator01\" directly, bypassing its sentries",
+		},
+		{
+			name: "validator with seeds",
+			manifest: `
+[node.seed01]
+mode = "seed"
+[node.validator01]
+seeds = ["seed01"]
+[node.full01]
+mode = "full"
+sentry_for = "validator01"
+`,
+			expectErr: "validator \"validator01\" has sentries, so it must not have seeds",
+		},
+		{
+			name: "sentry validator",
+			manifest: `
+[node.validator01]
+[node.validator02]
+sentry_for = "validator01"
+`,
+			expectErr: "sentry \"validator02\" must be a full node, not a validator node",
+		},
+		{
+			name: "sentry of a full node",
+			manifest: `
+[node.validator01]
+[node.full01]
+mode = "full"
+[node.full02]
+mode = "full"
+sentry_for = "full01"
+`,
+			expectErr: "sentry \"full02\" must protect a validator, not full node \"full01\"",
+		},
+		{
+			name: "sentry of an unknown node",
+			manifest: `
+[node.validator01]
+[node.full01]
+mode = "full"
+sentry_for = "validator02"
+`,
+			expectErr: "unknown validator \"validator02\" for sentry \"full01\"",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testnet, err := loadTestnetTOML(t, tc.manifest)
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			for _, validator := range testnet.Nodes {
+				sentries := testnet.Sentries(validator)
+				if len(sentries) == 0 {
+					continue
+				}
+				require.ElementsMatch(t, sentries, validator.PersistentPeers)
+				for _, node := range testnet.Nodes {
+					if node.SentryFor != validator {
+						require.NotContains(t, node.PersistentPeers, validator, node.Name)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestTestnetKeySeed(t *testing.T) {
+	small := `
+[node.validator01]
+[node.validator02]
+`
+	large := `
+[node.seed01]
+mode = "seed"
+[node.validator01]
+[node.validator02]
+[node.full01]
+mode = "full"
+`
+	load := func(settings, nodes string) *Testnet {
+		testnet, err := loadTestnetTOML(t, settings+nodes)
+		require.NoError(t, err)
+		return testnet
+	}
+
+	// Without a key seed, keys depend on the other nodes.
+	a, b := load("", small), load("", large)
+	require.NotEqual(t, a.LookupNode("validator01").PrivvalKey, b.LookupNode("validator01").PrivvalKey)
+
+	a, b = load("key_seed = 42\n", small), load("key_seed = 42\n", large)
+	for _, name := range []string{"validator01", "validator02"} {
+		require.Equal(t, a.LookupNode(name).PrivvalKey, b.LookupNode(name).PrivvalKey, name)
+		require.NotEqual(t, a.LookupNode(name).NodeKey, b.LookupNode(name).NodeKey, name)
+	}
+	require.NotEqual(t, a.LookupNode("validator01").PrivvalKey, a.LookupNode("validator02").PrivvalKey)
+	// The key seed doesn't change the keys it doesn't apply to.
+	require.Equal(t, load("", large).LookupNode("full01").NodeKey, b.LookupNode("full01").NodeKey)
+
+	a = load("key_seed = 42\nshared_node_keys = true\n", small)
+	b = load("key_seed = 42\nshared_node_keys = true\n", large)
+	for _, name := range []string{"validator01", "validator02"} {
+		require.Equal(t, a.LookupNode(name).PrivvalKey, b.LookupNode(name).PrivvalKey, name)
+		require.Equal(t, a.LookupNode(name).NodeKey, b.LookupNode(name).NodeKey, name)
+	}
+
+	_, err := loadTestnetTOML(t, "shared_node_keys = true\n"+small)
+	require.ErrorContains(t, err, "shared_node_keys requires a key_seed")
+}
+
+func TestTestnetGlobalRestart(t *testing.T) {
+	testCases := []struct {
+		name      string
+		manifest  string
+		expectErr string
+	}{
+		{
+			name: "restart once all nodes started",
+			manifest: `
+global_restart_height = 20
+[node.validator01]
+[node.full01]
+mode = "full"
+start_at = 10
+persist_interval = 5
+retain_blocks = 10
+`,
+		},
+		{
+			name: "restart at the initial height",
+			manifest: `
+global_restart_height = 1
+[node.validator01]
+`,
+			expectErr: "global_restart_height 1 must be above the initial height 1",
+		},
+		{
+			name: "node starting at the restart height",
+			manifest: `
+global_restart_height = 20
+[node.validator01]
+[node.full01]
+mode = "full"
+start_at = 20
+`,
+			expectErr: "all nodes must have started by global_restart_height 20",
+		},
+		{
+			name: "node not persisting its state",
+			manifest: `
+global_restart_height = 20
+[node.validator01]
+[node.full01]
+mode = "full"
+persist_interval = 0
+`,
+			expectErr: "node \"full01\" has persist_interval=0",
+		},
+		{
+			name: "restart during an upgrade",
+			manifest: `
+global_restart_height = 20
+upgrade_height = 10
+upgrade_version = "cometbft/e2e-node:local-version"
+[node.validator01]
+`,
+			expectErr: "global_restart_height cannot be combined with upgrade_height",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadTestnetTOML(t, tc.manifest)
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestTestnetStartupBackoff(t *testing.T) {
+	testnet, err := loadTestnetTOML(t, `
+expected_catch_up_by = "1m"
+[node.validator01]
+[node.validator02]
+[node.full01]
+mode = "full"
+persistent_peers = ["validator01"]
+startup_backoff = "500ms"
+max_dial_retries = 40
+`)
+	require.NoError(t, err)
+	full01 := testnet.LookupNode("full01")
+	assert.Equal(t, 500*time.Millisecond, full01.StartupBackoff)
+	assert.Equal(t, 40, full01.MaxDialRetries)
+	validator01 := testnet.LookupNode("validator01")
+	assert.Zero(t, validator01.StartupBackoff)
+	assert.Zero(t, validator01.MaxDialRetries)
+
+	testCases := []struct {
+		name      string
+		manifest  string
+		expectErr string
+	}{
+		{"negative", `
+[node.validator01]
+startup_backoff = "-1s"
+`, "startup_backoff and max_dial_retries must not be negative"},
+		{"light client", `
+[node.validator01]
+[node.validator02]
+[node.light01]
+mode = "light"
+persistent_peers = ["validator01", "validator02"]
+startup_backoff = "1s"
+`, "light clients take no startup_backoff nor max_dial_retries"},
+		{"retries without backoff", `
+[node.validator01]
+[node.validator02]
+persistent_peers = ["validator01"]
+max_dial_retries = 5
+`, "max_dial_retries requires a startup_backoff"},
+		{"retries without peers", `
+[node.validator01]
+startup_backoff = "1s"
+max_dial_retries = 5
+`, "max_dial_retries requires seeds or persistent peers to dial"},
+		{"beyond catch-up SLA", `
+expected_catch_up_by = "1m"
+[node.validator01]
+[node.validator02]
+persistent_peers = ["validator01"]
+startup_backoff = "10s"
+max_dial_retries = 6
+`, "max_dial_retries times startup_backoff (1m0s) must be less than expected_catch_up_by (1m0s)"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadTestnetTOML(t, tc.manifest)
+			require.ErrorContains(t, err, tc.expectErr)
+		})
+	}
+
+	// The settings survive saving the manifest, and stay unset by default.
+	m := Manifest{Nodes: map[string]*ManifestNode{
+		"validator01": {StartupBackoff: 2 * time.Second, MaxDialRetries: 10},
+		"validator02": {},
+	}}
+	file := filepath.Join(t.TempDir(), "saved.toml")
+	require.NoError(t, m.Save(file))
+	saved, err := LoadManifest(file)
+	require.NoError(t, err)
+	assert.Equal(t, m.Nodes, saved.Nodes)
+}
+
+func TestTestnetPeerLimits(t *testing.T) {
+	testCases := []struct {
+		name      string
+		manifest  string
+		expectErr string
+	}{
+		{
+			name: "limits cover the peers",
+			manifest: `
+[node.seed01]
+mode = "seed"
+max_inbound_peers = 1
+max_outbound_peers = 3
+[node.validator01]
+max_inbound_peers = 2
+max_outbound_peers = 3
+[node.validator02]
+seeds = ["seed01"]
+[node.validator03]
+persistent_peers = ["validator01"]
+`,
+		},
+		{
+			name: "seeds and persistent peers",
+			manifest: `
+[node.seed01]
+mode = "seed"
+[node.validator01]
+seeds = ["seed01"]
+persistent_peers = ["validator02", "validator03"]
+max_outbound_peers = 2
+[node.validator02]
+[node.validator03]
+`,
+			expectErr: `node "validator01" has max_outbound_peers 2, below its 3 seeds and persistent peers`,
+		},
+		{
+			name: "implicit persistent peers",
+			manifest: `
+[node.validator01]
+max_inbound_peers = 2
+[node.validator02]
+[node.validator03]
+[node.validator04]
+`,
+			expectErr: `node "validator01" has max_inbound_peers 2, below the 3 nodes listing it as a persistent peer`,
+		},
+		{
+			name: "negative",
+			manifest: `
+[node.validator01]
+max_inbound_peers = -1
+`,
+			expectErr: "max_inbound_peers and max_outbound_peers must not be negative",
+		},
+		{
+			name: "light client",
+			manifest: `
+[node.validator01]
+[node.validator02]
+[node.light01]
+mode = "light"
+persistent_peers = ["validator01", "validator02"]
+max_outbound_peers = 2
+`,
+			expectErr: `light client "light01" takes no max_inbound_peers nor max_outbound_peers`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadTestnetTOML(t, tc.manifest)
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestTestnetGenesisTime(t *testing.T) {
+	past := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	testnet, err := loadTestnetTOML(t, fmt.Sprintf(`
+genesis_time = %v
+expected_first_block_by = "1m"
+[node.validator01]
+`, past.Format(time.RFC3339)))
+	require.NoError(t, err)
+	assert.True(t, past.Equal(testnet.GenesisTime))
+
+	testnet, err = loadTestnetTOML(t, `
+genesis_time_offset = "30s"
+expected_first_block_by = "1m"
+[node.validator01]
+`)
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, testnet.GenesisTimeOffset)
+
+	_, err = loadTestnetTOML(t, `
+genesis_time_offset = "1h"
+expected_first_block_by = "1m"
+[node.validator01]
+`)
+	require.ErrorContains(t, err, "genesis_time_offset (1h0m0s) must be less than expected_first_block_by (1m0s)")
+
+	// Without a first block SLA, nodes may wait for genesis as long as needed.
+	_, err = loadTestnetTOML(t, `
+genesis_time_offset = "1h"
+[node.validator01]
+`)
+	require.NoError(t, err)
+
+	_, err = loadTestnetTOML(t, fmt.Sprintf(`
+genesis_time = %v
+genesis_time_offset = "-1h"
+[node.validator01]
+`, past.Format(time.RFC3339)))
+	require.ErrorContains(t, err, "genesis_time and genesis_time_offset can't be combined")
+
+	// An unset genesis time stays unset when saving the manifest.
+	m := Manifest{Nodes: map[string]*ManifestNode{"validator01": {}}}
+	file := filepath.Join(t.TempDir(), "saved.toml")
+	require.NoError(t, m.Save(file))
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "genesis_time =")
+	m.GenesisTime = past
+	require.NoError(t, m.Save(file))
+	saved, err := LoadManifest(file)
+	require.NoError(t, err)
+	assert.True(t, past.Equal(saved.GenesisTime))
+}
+
+func TestTestnetLoadShares(t *testing.T) {
+	testnet, err := loadTestnetTOML(t, `
+[node.validator01]
+[node.validator02]
+load_weight = 3
+[node.full01]
+mode = "full"
+load_weight = 4
+[node.full02]
+mode = "full"
+send_no_load = true
+`)
+	require.NoError(t, err)
+	shares := testnet.LoadShares()
+	require.Len(t, shares, 3)
+	assert.InDelta(t, 0.125, shares[testnet.LookupNode("validator01")], 1e-9)
+	assert.InDelta(t, 0.375, shares[testnet.LookupNode("validator02")], 1e-9)
+	assert.InDelta(t, 0.5, shares[testnet.LookupNode("full01")], 1e-9)
+	assert.NotContains(t, shares, testnet.LookupNode("full02"))
+
+	// Without weights, the load is spread evenly.
+	testnet, err = loadTestnetTOML(t, `
+[node.validator01]
+[node.validator02]
+[node.validator03]
+[node.validator04]
+`)
+	require.NoError(t, err)
+	total := 0.0
+	for _, share := range testnet.LoadShares() {
+		assert.InDelta(t, 0.25, share, 1e-9)
+		total += share
+	}
+	assert.InDelta(t, 1, total, 1e-9)
+
+	_, err = loadTestnetTOML(t, `
+[node.validator01]
+load_weight = -1
+`)
+	require.ErrorContains(t, err, "load_weight must not be negative")
+
+	_, err = loadTestnetTOML(t, `
+[node.validator01]
+[node.validator02]
+send_no_load = true
+load_weight = 2
+`)
+	require.ErrorContains(t, err, "nodes with send_no_load take no load_weight")
+
+	m := Manifest{Nodes: map[string]*ManifestNode{
+		"validator01": {LoadWeight: 5},
+		"validator02": {},
+	}}
+	file := filepath.Join(t.TempDir(), "saved.toml")
+	require.NoError(t, m.Save(file))
+	saved, err := LoadManifest(file)
+	require.NoError(t, err)
+	assert.Equal(t, m.Nodes, saved.Nodes)
+}
+
+func TestTestnetLinkLatencies(t *testing.T) {
+	testnet, err := loadTestnetTOML(t, `
+[[link_latencies]]
+from = "validator01"
+to = "validator02"
+delay = "200ms"
+jitter = "20ms"
+loss = 5.0
+[node.validator01]
+persistent_peers = ["validator02"]
+[node.validator02]
+[node.full01]
+mode = "full"
+persistent_peers = ["validator02"]
+`)
+	require.NoError(t, err)
+	validator01, validator02 := testnet.LookupNode("validator01"), testnet.LookupNode("validator02")
+	assert.True(t, validator01.IsPeer(validator02))
+	assert.True(t, validator02.IsPeer(validator01))
+	assert.False(t, validator01.IsPeer(testnet.LookupNode("full01")))
+	assert.Equal(t, []LinkLatency{{
+		From: "validator01", To: "validator02", Delay: 200 * time.Millisecond, Jitter: 20 * time.Millisecond, Loss: 5,
+	}}, validator01.OutgoingLinkLatencies())
+	assert.True(t, validator01.EmulatesLatency())
+	assert.False(t, validator02.EmulatesLatency())
+
+	nodes := `
+[node.validator01]
+persistent_peers = ["validator02"]
+[node.validator02]
+[node.full01]
+mode = "full"
+persistent_peers = ["validator02"]
+[node.light01]
+mode = "light"
+persistent_peers = ["validator01", "validator02"]
+`
+	testCases := []struct {
+		name      string
+		links     string
+		expectErr string
+	}{
+		{"unknown node", `
+[[link_latencies]]
+from = "validator01"
+to = "validator03"
+delay = "1s"
+`, `link latency from "validator01" to "validator03": unknown node`},
+		{"itself", `
+[[link_latencies]]
+from = "validator01"
+to = "validator01"
+delay = "1s"
+`, `link latency from "validator01" to itself`},
+		{"not peers", `
+[[link_latencies]]
+from = "full01"
+to = "validator01"
+delay = "1s"
+`, `link latency from "full01" to "validator01": the nodes are not peers`},
+		{"light client", `
+[[link_latencies]]
+from = "validator01"
+to = "light01"
+delay = "1s"
+`, `light clients have no peers`},
+		{"duplicate", `
+[[link_latencies]]
+from = "validator02"
+to = "validator01"
+delay = "1s"
+[[link_latencies]]
+from = "validator02"
+to = "validator01"
+delay = "2s"
+`, `duplicate link latency from "validator02" to "validator01"`},
+		{"jitter above delay", `
+[[link_latencies]]
+from = "validator01"
+to = "validator02"
+delay = "10ms"
+jitter = "20ms"
+`, "jitter 20ms exceeds delay 10ms"},
+		{"loss above 100", `
+[[link_latencies]]
+from = "validator01"
+to = "validator02"
+loss = 101.0
+`, "loss must be between 0 and 100"},
+		{"nothing degraded", `
+[[link_latencies]]
+from = "validator01"
+to = "validator02"
+`, "has neither delay nor loss"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadTestnetTOML(t, tc.links+nodes)
+			require.ErrorContains(t, err, tc.expectErr)
+		})
+	}
+}
+
+func TestTestnetAbsentValidators(t *testing.T) {
+	testCases := []struct {
+		name      string
+		manifest  string
+		expectErr string
+	}{
+		{
+			name: "minority validator",
+			manifest: `
+[validators]
+validator01 = 20
+validator02 = 40
+validator03 = 40
+[node.validator01]
+start_at = -1
+[node.validator02]
+[node.validator03]
+`,
+		},
+		{
+			name: "initial quorum",
+			manifest: `
+[node.validator01]
+start_at = -1
+[node.validator02]
+[node.validator03]
+`,
+			expectErr: "validators starting at the initial height 1 hold 200 of 300 voting power",
+		},
+		{
+			name: "quorum after validator update",
+			manifest: `
+[validators]
+validator01 = 20
+validator02 = 40
+validator03 = 40
+[validator_update.10]
+validator01 = 40
+[node.validator01]
+start_at = -1
+[node.validator02]
+[node.validator03]
+`,
+			expectErr: "absent validators hold 40 of 120 voting power at height 10, must be less than 1/3",
+		},
+		{
+			name: "quorum with perturbed validators",
+			manifest: `
+[validators]
+validator01 = 20
+validator02 = 20
+validator03 = 60
+[node.validator01]
+start_at = -1
+[node.validator02]
+perturb = ["wal_truncate"]
+[node.validator03]
+`,
+			expectErr: "validators with the 'wal_truncate' perturbation hold 20 of 100 voting power at height 1, " +
+				"must be less than 1/3 together with the 20 of absent validators",
+		},
+		{
+			name: "quorum with misbehaving validators",
+			manifest: `
+[validators]
+validator01 = 20
+validator02 = 20
+validator03 = 60
+[node.validator01]
+start_at = -1
+[node.validator02]
+misbehaviors = { 5 = "double-prevote" }
+[node.validator03]
+`,
+			expectErr: "misbehaving validators hold 20 of 100 voting power at height 5, " +
+				"must be less than 1/3 together with the 20 of absent validators",
+		},
+		{
+			name: "full node",
+			manifest: `
+[node.validator01]
+[node.full01]
+mode = "full"
+start_at = -1
+`,
+			expectErr: "only validators can be absent",
+		},
+		{
+			name: "perturbed",
+			manifest: `
+[validators]
+validator01 = 20
+validator02 = 40
+validator03 = 40
+[node.validator01]
+start_at = -1
+perturb = ["kill"]
+[node.validator02]
+[node.validator03]
+`,
+			expectErr: "absent validators never start, so they take no perturbations",
+		},
+		{
+			name: "negative start height",
+			manifest: `
+[node.validator01]
+start_at = -2
+[node.validator02]
+[node.validator03]
+[node.validator04]
+`,
+			expectErr: "start_at -2 must not be negative, except -1 for absent validators",
+		},
+		{
+			name: "only absent peers",
+			manifest: `
+[validators]
+validator01 = 20
+validator02 = 40
+validator03 = 40
+[node.validator01]
+start_at = -1
+[node.validator02]
+[node.validator03]
+[node.full01]
+mode = "full"
+persistent_peers = ["validator01"]
+`,
+			expectErr: `all seeds and persistent peers of node "full01" start after it at height 0, or never start`,
+		},
+		{
+			name: "absent light client primary",
+			manifest: `
+[validators]
+validator01 = 20
+validator02 = 40
+validator03 = 40
+[node.validator01]
+start_at = -1
+[node.validator02]
+[node.validator03]
+[node.light01]
+mode = "light"
+persistent_peers = ["validator01", "validator02"]
+`,
+			expectErr: `primary "validator01" never starts`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testnet, err := loadTestnetTOML(t, tc.manifest)
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			absent := testnet.LookupNode("validator01")
+			require.True(t, absent.Absent())
+			assert.Equal(t, int64(20), testnet.Validators[absent])
+			assert.NotContains(t, testnet.ArchiveNodes(), absent)
+			assert.NotContains(t, testnet.LoadShares(), absent)
+		})
+	}
+}
+
+func TestTestnetChainID(t *testing.T) {
+	testCases := []struct {
+		name      string
+		chainID   string
+		expect    string
+		expectErr string
+	}{
+		{name: "default", expect: "testnet"},
+		{name: "explicit", chainID: "e2e-large-ab12cd", expect: "e2e-large-ab12cd"},
+		{name: "too long", chainID: strings.Repeat("a", 51), expectErr: "must be at most 50"},
+		{name: "charset", chainID: "e2e large", expectErr: `invalid chain ID "e2e large"`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			manifest := "[node.validator01]\n"
+			if tc.chainID != "" {
+				manifest = fmt.Sprintf("chain_id = %q\n", tc.chainID) + manifest
+			}
+			testnet, err := loadTestnetTOML(t, manifest)
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expect, testnet.ChainID)
+		})
+	}
+}
+
+func TestTestnetReplayConsistency(t *testing.T) {
+	testCases := []struct {
+		name      string
+		manifest  string
+		expectErr string
+	}{
+		{
+			name: "full node",
+			manifest: `
+abci_protocol = "builtin_connsync"
+[node.validator01]
+[node.full01]
+mode = "full"
+perturb = ["kill", "restart"]
+assert_replay_consistency = true
+`,
+		},
+		{
+			name: "validator",
+			manifest: `
+abci_protocol = "builtin_connsync"
+[node.validator01]
+perturb = ["kill", "restart"]
+assert_replay_consistency = true
+`,
+			expectErr: "assert_replay_consistency only applies to full nodes",
+		},
+		{
+			name: "protocol",
+			manifest: `
+abci_protocol = "builtin"
+[node.validator01]
+[node.full01]
+mode = "full"
+perturb = ["kill", "restart"]
+assert_replay_consistency = true
+`,
+			expectErr: `assert_replay_consistency requires the "builtin_connsync" ABCI protocol, not "builtin"`,
+		},
+		{
+			name: "missing restart",
+			manifest: `
+abci_protocol = "builtin_connsync"
+[node.validator01]
+[node.full01]
+mode = "full"
+perturb = ["kill"]
+assert_replay_consistency = true
+`,
+			expectErr: "assert_replay_consistency requires both the 'kill' and 'restart' perturbations",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testnet, err := loadTestnetTOML(t, tc.manifest)
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, testnet.LookupNode("full01").AssertReplayConsistency)
+		})
+	}
+}
+
+func TestTestnetProposerFairness(t *testing.T) {
+	testCases := []struct {
+		name      string
+		manifest  string
+		expectErr string
+	}{
+		{
+			name: "equal powers",
+			manifest: `
+assert_proposer_fairness = true
+[validators]
+validator01 = 100
+validator02 = 100
+validator03 = 100
+[validator_update.10]
+validator04 = 100
+[node.validator01]
+[node.validator02]
+[node.validator03]
+[node.validator04]
+start_at = 5
+`,
+		},
+		{
+			name: "unequal powers",
+			manifest: `
+assert_proposer_fairness = true
+[validators]
+validator01 = 100
+validator02 = 100
+validator03 = 100
+[validator_update.10]
+validator03 = 50
+[node.validator01]
+[node.validator02]
+[node.validator03]
+`,
+			expectErr: "found powers from 50 to 100 at height 10",
+		},
+		{
+			name: "absent validator",
+			manifest: `
+assert_proposer_fairness = true
+[validators]
+validator01 = 100
+validator02 = 100
+validator03 = 100
+validator04 = 100
+[node.validator01]
+[node.validator02]
+[node.validator03]
+[node.validator04]
+start_at = -1
+`,
+			expectErr: `assert_proposer_fairness requires every validator to start, but "validator04" is absent`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testnet, err := loadTestnetTOML(t, tc.manifest)
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, testnet.AssertProposerFairness)
+		})
+	}
+}
+
+func TestTestnetPromotions(t *testing.T) {
+	testCases := []struct {
+		name      string
+		manifest  string
+		expectErr string
+	}{
+		{
+			name: "promoted full node",
+			manifest: `
+[validators]
+validator01 = 100
+validator02 = 100
+[validator_update.10]
+full01 = 50
+[node.validator01]
+[node.validator02]
+[node.full01]
+mode = "full"
+start_at = 5
+promote_at = 10
+`,
+		},
+		{
+			name: "validator",
+			manifest: `
+[validators]
+validator01 = 100
+[node.validator01]
+promote_at = 10
+`,
+			expectErr: "only full nodes can be promoted to validators",
+		},
+		{
+			name: "promoted before starting",
+			manifest: `
+[validators]
+validator01 = 100
+validator02 = 100
+[validator_update.5]
+full01 = 50
+[node.validator01]
+[node.validator02]
+[node.full01]
+mode = "full"
+start_at = 5
+promote_at = 5
+`,
+			expectErr: "promote_at 5 must be after the node starts at height 5",
+		},
+		{
+			name: "remote signer",
+			manifest: `
+[validators]
+validator01 = 100
+validator02 = 100
+[validator_update.10]
+full01 = 50
+[node.validator01]
+[node.validator02]
+[node.full01]
+mode = "full"
+promote_at = 10
+privval_protocol = "tcp"
+`,
+			expectErr: `promoted full nodes sign with the file privval protocol, not "tcp"`,
+		},
+		{
+			name: "missing validator update",
+			manifest: `
+[validators]
+validator01 = 100
+validator02 = 100
+[node.validator01]
+[node.validator02]
+[node.full01]
+mode = "full"
+promote_at = 10
+`,
+			expectErr: `promotion of node "full01" at height 10 has no matching validator update`,
+		},
+		{
+			name: "unscheduled promotion",
+			manifest: `
+[validators]
+validator01 = 100
+validator02 = 100
+[validator_update.10]
+full01 = 50
+[node.validator01]
+[node.validator02]
+[node.full01]
+mode = "full"
+`,
+			expectErr: `full node "full01" can only join the validator set at its promote_at height, not at height 10`,
+		},
+		{
+			name: "quorum",
+			manifest: `
+[validators]
+validator01 = 100
+validator02 = 100
+[validator_update.10]
+full01 = 100
+[node.validator01]
+[node.validator02]
+[node.full01]
+mode = "full"
+promote_at = 10
+`,
+			expectErr: "validators promoted at height 10 hold 100 of 300 voting power, must be less than 1/3",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testnet, err := loadTestnetTOML(t, tc.manifest)
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			full := testnet.LookupNode("full01")
+			assert.Equal(t, int64(10), full.PromoteAt)
+			assert.NotContains(t, testnet.ValidatorPowersAt(9), full)
+			assert.Equal(t, int64(50), testnet.ValidatorPowersAt(10)[full])
+		})
+	}
+}
+
+func TestTestnetGossipRates(t *testing.T) {
+	testCases := []struct {
+		name      string
+		manifest  string
+		expectErr string
+		check     func(t *testing.T, testnet *Testnet)
+	}{
+		{
+			// 2 transactions of 1024 bytes per second, and a block per second.
+			name: "default rates",
+			manifest: `
+[node.validator01]
+`,
+			check: func(t *testing.T, testnet *Testnet) {
+				assert.False(t, testnet.ThrottledGossip)
+				assert.EqualValues(t, 2048, testnet.ExpectedBlockBytes())
+				assert.EqualValues(t, 4096, testnet.MinGossipRate())
+				assert.Zero(t, testnet.Nodes[0].SendRate)
+				assert.Zero(t, testnet.Nodes[0].RecvRate)
+				// The CometBFT defaults, which nodes without rates keep, don't
+				// limit the load.
+				assert.GreaterOrEqual(t, config.DefaultP2PConfig().SendRate, testnet.MinGossipRate())
+				assert.GreaterOrEqual(t, config.DefaultP2PConfig().RecvRate, testnet.MinGossipRate())
+			},
+		},
+		{
+			name: "rates",
+			manifest: `
+[node.validator01]
+send_rate = 4096
+recv_rate = 1048576
+`,
+			check: func(t *testing.T, testnet *Testnet) {
+				assert.EqualValues(t, 4096, testnet.Nodes[0].SendRate)
+				assert.EqualValues(t, 1048576, testnet.Nodes[0].RecvRate)
+			},
+		},
+		{
+			name: "too low",
+			manifest: `
+[node.validator01]
+send_rate = 4095
+`,
+			expectErr: `node "validator01" has send_rate 4095 bytes/s, must be at least 4096 for blocks of 2048 bytes ` +
+				"to propagate within the block interval of 1s, or throttled_gossip must be set",
+		},
+		{
+			// Blocks are no larger than max_block_bytes, however high the load.
+			name: "max block bytes",
+			manifest: `
+load_tx_batch_size = 1000
+load_tx_size_bytes = 10000
+[node.validator01]
+max_block_bytes = 1048576
+recv_rate = 2097152
+`,
+			check: func(t *testing.T, testnet *Testnet) {
+				assert.EqualValues(t, 1048576, testnet.ExpectedBlockBytes())
+				assert.EqualValues(t, 2097152, testnet.MinGossipRate())
+			},
+		},
+		{
+			// A longer block interval leaves more time for the same load.
+			name: "commit timeout",
+			manifest: `
+[node.validator01]
+timeout_commit = "4s"
+send_rate = 4096
+`,
+			check: func(t *testing.T, testnet *Testnet) {
+				assert.EqualValues(t, 8192, testnet.ExpectedBlockBytes())
+				assert.EqualValues(t, 4096, testnet.MinGossipRate())
+			},
+		},
+		{
+			name: "throttled",
+			manifest: `
+throttled_gossip = true
+[node.validator01]
+send_rate = 512
+recv_rate = 512
+`,
+			check: func(t *testing.T, testnet *Testnet) {
+				assert.True(t, testnet.ThrottledGossip)
+			},
+		},
+		{
+			name: "negative",
+			manifest: `
+throttled_gossip = true
+[node.validator01]
+recv_rate = -1
+`,
+			expectErr: `node "validator01" has recv_rate -1, must not be negative`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testnet, err := loadTestnetTOML(t, tc.manifest)
+			if tc.expectErr != "" {
+				require.ErrorContains(t, err, tc.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			tc.check(t, testnet)
+		})
+	}
+}
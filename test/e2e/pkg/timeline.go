@@ -0,0 +1,182 @@
+package e2e
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// TimelineEventKind is the kind of a TimelineEvent.
+type TimelineEventKind string
+
+const (
+	TimelineNodeStart            TimelineEventKind = "node_start"
+	TimelineValidatorUpdate      TimelineEventKind = "validator_update"
+	TimelineVoteExtensionsEnable TimelineEventKind = "vote_extensions_enable"
+	TimelineMisbehavior          TimelineEventKind = "misbehavior"
+	TimelineKeyRotation          TimelineEventKind = "key_rotation"
+	TimelineUpgrade              TimelineEventKind = "upgrade"
+	TimelineArchiveBlackout      TimelineEventKind = "archive_blackout"
+	TimelineGlobalRestart        TimelineEventKind = "global_restart"
+	TimelinePerturbation         TimelineEventKind = "perturbation"
+)
+
+// timelinePerturbationDelay is how many blocks the runner waits for after
+// starting every node before applying perturbations.
+const timelinePerturbationDelay = 5
+
+// timelineKindOrder orders the events of a timeline scheduled at the same
+// height: nodes start before anything happens to them, and perturbations come
+// last, as the runner applies them once everything else is in place.
+var timelineKindOrder = map[TimelineEventKind]int{
+	TimelineNodeStart:            0,
+	TimelineValidatorUpdate:      1,
+	TimelineVoteExtensionsEnable: 2,
+	TimelineMisbehavior:          3,
+	TimelineKeyRotation:          4,
+	TimelineUpgrade:              5,
+	TimelineArchiveBlackout:      6,
+	TimelineGlobalRestart:        7,
+	TimelinePerturbation:         8,
+}
+
+// TimelineEvent is an event scheduled by a manifest, see Manifest.Timeline.
+type TimelineEvent struct {
+	// Height is the height the event is scheduled at.
+	Height int64
+	Kind   TimelineEventKind
+	// Node is the name of the node the event applies to, if any.
+	Node        string
+	Description string
+}
+
+// String returns a human-readable form of the event.
+func (e TimelineEvent) String() string {
+	return fmt.Sprintf("%d: %s", e.Height, e.Description)
+}
+
+// Timeline returns the events scheduled by the manifest, sorted by height:
+// node starts, validator updates, the enabling of vote extensions,
+// misbehaviors, key rotations, the coordinated upgrade, the archive blackout,
+// the global restart, and perturbations. Nodes starting at genesis start at
+// the initial height, and absent nodes, which never start, are left out.
+// Events at the same height are sorted by kind, then by node name, and a
+// node's perturbations keep their order. The runner applies perturbations one
+// at a time once every node has started and a few more blocks were committed,
+// so their height is the earliest one the first of them may be applied at.
+func (m Manifest) Timeline() []TimelineEvent {
+	initialHeight := max(m.InitialHeight, 1)
+	events := []TimelineEvent{}
+	add := func(height int64, kind TimelineEventKind, node string, format string, args ...any) {
+		events = append(events, TimelineEvent{
+			Height:      height,
+			Kind:        kind,
+			Node:        node,
+			Description: fmt.Sprintf(format, args...),
+		})
+	}
+
+	lastStart := initialHeight
+	for _, name := range sortNodeNames(m) {
+		node := m.Nodes[name]
+		if node == nil {
+			node = &ManifestNode{}
+		}
+		if node.StartAt == StartAtNever {
+			continue
+		}
+		startAt := max(node.StartAt, initialHeight)
+		lastStart = max(lastStart, startAt)
+		add(startAt, TimelineNodeStart, name, "node %s starts", name)
+		for _, h := range sortedHeights(node.Misbehaviors) {
+			add(h.height, TimelineMisbehavior, name, "node %s misbehaves with %s", name, node.Misbehaviors[h.key])
+		}
+		for _, h := range sortedHeights(node.KeyRotations) {
+			add(h.height, TimelineKeyRotation, name, "node %s rotates its consensus key", name)
+		}
+	}
+
+	updateHeights := make(map[string]string, len(m.ValidatorUpdates))
+	for key := range m.ValidatorUpdates {
+		updateHeights[key] = ""
+	}
+	for _, h := range sortedHeights(updateHeights) {
+		update := m.ValidatorUpdates[h.key]
+		names := make([]string, 0, len(update))
+		for name := range update {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			height := h.height
+			if height == 0 {
+				// Validator updates at height 0 are returned by InitChain.
+				height = initialHeight
+			}
+			if update[name] == 0 {
+				add(height, TimelineValidatorUpdate, name, "validator %s is removed", name)
+				continue
+			}
+			add(height, TimelineValidatorUpdate, name, "validator %s gets voting power %d", name, update[name])
+		}
+	}
+
+	if m.VoteExtensionsEnableHeight > 0 {
+		add(m.VoteExtensionsEnableHeight, TimelineVoteExtensionsEnable, "", "vote extensions are enabled")
+	}
+	if m.UpgradeHeight > 0 {
+		add(m.UpgradeHeight, TimelineUpgrade, "", "the network upgrades to %s", m.UpgradeVersion)
+	}
+	if m.ArchiveBlackoutHeight > 0 {
+		add(m.ArchiveBlackoutHeight, TimelineArchiveBlackout, "", "every archive node is killed")
+	}
+	if m.GlobalRestartHeight > 0 {
+		add(m.GlobalRestartHeight, TimelineGlobalRestart, "", "every node restarts")
+	}
+
+	perturbAt := lastStart + timelinePerturbationDelay
+	for _, name := range sortNodeNames(m) {
+		node := m.Nodes[name]
+		if node == nil {
+			continue
+		}
+		for _, p := range node.Perturb {
+			add(perturbAt, TimelinePerturbation, name, "node %s gets the %q perturbation", name, p)
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Height != events[j].Height {
+			return events[i].Height < events[j].Height
+		}
+		if events[i].Kind != events[j].Kind {
+			return timelineKindOrder[events[i].Kind] < timelineKindOrder[events[j].Kind]
+		}
+		if events[i].Kind == TimelinePerturbation {
+			return false
+		}
+		return events[i].Node < events[j].Node
+	})
+	return events
+}
+
+// heightKey is a height keying a map of a manifest, along with its key.
+type heightKey struct {
+	height int64
+	key    string
+}
+
+// sortedHeights returns the heights keying a map in ascending order, skipping
+// keys that aren't heights.
+func sortedHeights(heights map[string]string) []heightKey {
+	sorted := make([]heightKey, 0, len(heights))
+	for key := range heights {
+		height, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			continue
+		}
+		sorted = append(sorted, heightKey{height: height, key: key})
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].height < sorted[j].height })
+	return sorted
+}
@@ -0,0 +1,69 @@
+package e2e
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifestTimeline(t *testing.T) {
+	manifest := Manifest{
+		InitialHeight:              10,
+		VoteExtensionsEnableHeight: 12,
+		UpgradeHeight:              15,
+		UpgradeVersion:             "v1.0.0",
+		ValidatorUpdates: map[string]map[string]int64{
+			"0":  {"validator01": 100, "validator02": 100},
+			"20": {"validator03": 50},
+			"30": {"validator02": 0},
+		},
+		Nodes: map[string]*ManifestNode{
+			"validator01": {Perturb: []string{"pause", "kill"}, Misbehaviors: map[string]string{"14": "double-prevote"}},
+			"validator02": {KeyRotations: map[string]string{"25": "rotated"}},
+			"validator03": {StartAt: 18, Perturb: []string{"restart"}},
+			"validator04": {StartAt: StartAtNever},
+			"full01":      {Mode: "full", StartAt: 22},
+		},
+	}
+
+	expect := []TimelineEvent{
+		{Height: 10, Kind: TimelineNodeStart, Node: "validator01"},
+		{Height: 10, Kind: TimelineNodeStart, Node: "validator02"},
+		{Height: 10, Kind: TimelineValidatorUpdate, Node: "validator01"},
+		{Height: 10, Kind: TimelineValidatorUpdate, Node: "validator02"},
+		{Height: 12, Kind: TimelineVoteExtensionsEnable},
+		{Height: 14, Kind: TimelineMisbehavior, Node: "validator01"},
+		{Height: 15, Kind: TimelineUpgrade},
+		{Height: 18, Kind: TimelineNodeStart, Node: "validator03"},
+		{Height: 20, Kind: TimelineValidatorUpdate, Node: "validator03"},
+		{Height: 22, Kind: TimelineNodeStart, Node: "full01"},
+		{Height: 25, Kind: TimelineKeyRotation, Node: "validator02"},
+		{Height: 27, Kind: TimelinePerturbation, Node: "validator01"},
+		{Height: 27, Kind: TimelinePerturbation, Node: "validator01"},
+		{Height: 27, Kind: TimelinePerturbation, Node: "validator03"},
+		{Height: 30, Kind: TimelineValidatorUpdate, Node: "validator02"},
+	}
+	timeline := manifest.Timeline()
+	require.Len(t, timeline, len(expect))
+	for i, event := range timeline {
+		assert.Equal(t, expect[i].Height, event.Height, "event %d: %v", i, event)
+		assert.Equal(t, expect[i].Kind, event.Kind, "event %d: %v", i, event)
+		assert.Equal(t, expect[i].Node, event.Node, "event %d: %v", i, event)
+		assert.NotEmpty(t, event.Description)
+	}
+	assert.True(t, sort.SliceIsSorted(timeline, func(i, j int) bool { return timeline[i].Height < timeline[j].Height }))
+
+	// A node's perturbations keep the order the runner applies them in.
+	assert.Contains(t, timeline[11].Description, `"pause"`)
+	assert.Contains(t, timeline[12].Description, `"kill"`)
+	assert.Equal(t, "30: validator validator02 is removed", timeline[14].String())
+
+	manifest.ArchiveBlackoutHeight = 40
+	manifest.GlobalRestartHeight = 40
+	timeline = manifest.Timeline()
+	require.Len(t, timeline, len(expect)+2)
+	assert.Equal(t, TimelineArchiveBlackout, timeline[len(timeline)-2].Kind)
+	assert.Equal(t, TimelineGlobalRestart, timeline[len(timeline)-1].Kind)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/cometbft/cometbft/libs/log"
+	e2e "github.com/cometbft/cometbft/test/e2e/pkg"
+	"github.com/cometbft/cometbft/test/e2e/pkg/infra/docker"
+)
+
+// ArchiveBlackout performs the archive blackout of a testnet once it reaches
+// its blackout height: every archive node is killed at once, and started
+// again after the blackout duration. It returns once they have caught up.
+func ArchiveBlackout(ctx context.Context, testnet *e2e.Testnet) error {
+	if _, _, err := waitForHeight(ctx, testnet, testnet.ArchiveBlackoutHeight); err != nil {
+		return err
+	}
+	archiveNodes := testnet.ArchiveNodes()
+	names := make([]string, 0, len(archiveNodes))
+	for _, node := range archiveNodes {
+		names = append(names, node.Name)
+	}
+	logger.Info("archive blackout", "msg", log.NewLazySprintf("Killing %v archive nodes at height %v for %v...",
+		len(names), testnet.ArchiveBlackoutHeight, testnet.ArchiveBlackoutDuration))
+	if err := docker.ExecCompose(ctx, testnet.Dir, append([]string{"kill", "-s", "SIGKILL"}, names...)...); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(testnet.ArchiveBlackoutDuration):
+	}
+	if err := docker.ExecCompose(ctx, testnet.Dir, append([]string{"start"}, names...)...); err != nil {
+		return err
+	}
+	for _, node := range archiveNodes {
+		if _, err := waitForNode(ctx, node, testnet.ArchiveBlackoutHeight, time.Minute); err != nil {
+			return err
+		}
+	}
+	logger.Info("archive blackout", "msg", log.NewLazySprintf("Archive nodes back online after %v", testnet.ArchiveBlackoutDuration))
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"sort"
 	"time"
 
 	"github.com/cometbft/cometbft/crypto"
@@ -36,7 +37,10 @@ func InjectEvidence(ctx context.Context, r *rand.Rand, testnet *e2e.Testnet, amo
 	for _, idx := range r.Perm(len(testnet.Nodes)) {
 		targetNode = testnet.Nodes[idx]
 
-		if targetNode.Mode == e2e.ModeSeed || targetNode.Mode == e2e.ModeLight {
+		// Evidence is only injected through nodes retaining the whole
+		// evidence age, see e2e.ManifestNode.ShortRetention.
+		if targetNode.Mode == e2e.ModeSeed || targetNode.Mode == e2e.ModeLight || targetNode.ShortRetention ||
+			targetNode.Absent() {
 			targetNode = nil
 			continue
 		}
@@ -91,12 +95,12 @@ func InjectEvidence(ctx context.Context, r *rand.Rand, testnet *e2e.Testnet, amo
 	for i := 1; i <= amount; i++ {
 		if i%lightClientEvidenceRatio == 0 {
 			ev, err = generateLightClientAttackEvidence(
-				ctx, privVals, evidenceHeight, valSet, testnet.Name, blockRes.Block.Time,
+				ctx, privVals, evidenceHeight, valSet, testnet.ChainID, blockRes.Block.Time,
 			)
 		} else {
 			var dve *types.DuplicateVoteEvidence
 			dve, err = generateDuplicateVoteEvidence(
-				privVals, evidenceHeight, valSet, testnet.Name, blockRes.Block.Time,
+				privVals, evidenceHeight, valSet, testnet.ChainID, blockRes.Block.Time,
 			)
 			if dve.VoteA.Height < testnet.VoteExtensionsEnableHeight {
 				dve.VoteA.Extension = nil
@@ -128,6 +132,98 @@ func InjectEvidence(ctx context.Context, r *rand.Rand, testnet *e2e.Testnet, amo
 	return nil
 }
 
+// InjectMisbehaviors makes validators misbehave at the heights given in the
+// manifest. Once a misbehavior height has been committed, it signs conflicting
+// votes at that height with the validator's key and broadcasts the resulting
+// evidence through an archive node.
+func InjectMisbehaviors(ctx context.Context, testnet *e2e.Testnet) error {
+	type misbehavior struct {
+		node     *e2e.Node
+		height   int64
+		behavior e2e.Misbehavior
+	}
+	misbehaviors := []misbehavior{}
+	for _, node := range testnet.Nodes {
+		for height, behavior := range node.Misbehaviors {
+			misbehaviors = append(misbehaviors, misbehavior{node: node, height: height, behavior: behavior})
+		}
+	}
+	sort.Slice(misbehaviors, func(i, j int) bool {
+		if misbehaviors[i].height != misbehaviors[j].height {
+			return misbehaviors[i].height < misbehaviors[j].height
+		}
+		return misbehaviors[i].node.Name < misbehaviors[j].node.Name
+	})
+
+	archiveNodes := testnet.ArchiveNodes()
+	if len(archiveNodes) == 0 {
+		return errors.New("could not find archive node to inject misbehaviors through")
+	}
+	targetNode := archiveNodes[0]
+	client, err := targetNode.Client()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range misbehaviors {
+		var voteType cmtproto.SignedMsgType
+		switch m.behavior {
+		case e2e.MisbehaviorDoublePrevote:
+			voteType = cmtproto.PrevoteType
+		case e2e.MisbehaviorDoublePrecommit:
+			voteType = cmtproto.PrecommitType
+		default:
+			return fmt.Errorf("unexpected misbehavior %q", m.behavior)
+		}
+
+		// The block at the misbehavior height must be committed, so that
+		// the target node can validate the evidence.
+		if _, err := waitForNode(ctx, targetNode, m.height+1, 2*time.Minute); err != nil {
+			return err
+		}
+		height := m.height
+		blockRes, err := client.Block(ctx, &height)
+		if err != nil {
+			return err
+		}
+		nValidators := 100
+		valRes, err := client.Validators(ctx, &height, nil, &nValidators)
+		if err != nil {
+			return err
+		}
+		valSet, err := types.ValidatorSetFromExistingValidators(valRes.Validators)
+		if err != nil {
+			return err
+		}
+
+		privKey, err := readPrivKey(filepath.Join(testnet.Dir, m.node.Name, PrivvalKeyFile))
+		if err != nil {
+			return err
+		}
+		privVal := types.NewMockPVWithParams(privKey, false, false)
+		valIdx, _ := valSet.GetByAddress(privKey.PubKey().Address())
+		if valIdx < 0 {
+			return fmt.Errorf("misbehaving node %v is not a validator at height %v", m.node.Name, height)
+		}
+
+		logger.Info(fmt.Sprintf("Injecting %v misbehavior of %v at height %v...", m.behavior, m.node.Name, height))
+		ev, err := makeDuplicateVoteEvidence(privVal, valIdx, voteType, height, valSet, testnet.ChainID, blockRes.Block.Time)
+		if err != nil {
+			return err
+		}
+		if height < testnet.VoteExtensionsEnableHeight {
+			ev.VoteA.Extension = nil
+			ev.VoteA.ExtensionSignature = nil
+			ev.VoteB.Extension = nil
+			ev.VoteB.ExtensionSignature = nil
+		}
+		if _, err := client.BroadcastEvidence(ctx, ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func getPrivateValidatorKeys(testnet *e2e.Testnet) ([]types.MockPV, error) {
 	privVals := []types.MockPV{}
 
@@ -211,11 +307,25 @@ func generateDuplicateVoteEvidence(
 	if err != nil {
 		return nil, err
 	}
-	voteA, err := types.MakeVote(privVal, chainID, valIdx, height, 0, 2, makeRandomBlockID(), time)
+	return makeDuplicateVoteEvidence(privVal, valIdx, cmtproto.PrecommitType, height, vals, chainID, time)
+}
+
+// makeDuplicateVoteEvidence returns evidence of the given validator signing two
+// votes of the given type for different blocks at the same height and round.
+func makeDuplicateVoteEvidence(
+	privVal types.MockPV,
+	valIdx int32,
+	voteType cmtproto.SignedMsgType,
+	height int64,
+	vals *types.ValidatorSet,
+	chainID string,
+	time time.Time,
+) (*types.DuplicateVoteEvidence, error) {
+	voteA, err := types.MakeVote(privVal, chainID, valIdx, height, 0, voteType, makeRandomBlockID(), time)
 	if err != nil {
 		return nil, err
 	}
-	voteB, err := types.MakeVote(privVal, chainID, valIdx, height, 0, 2, makeRandomBlockID(), time)
+	voteB, err := types.MakeVote(privVal, chainID, valIdx, height, 0, voteType, makeRandomBlockID(), time)
 	if err != nil {
 		return nil, err
 	}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
+	"math/rand"
 	"sync"
 	"time"
 
@@ -28,18 +30,26 @@ func Load(ctx context.Context, testnet *e2e.Testnet) error {
 	defer cancel()
 
 	logger.Info("load", "msg", log.NewLazySprintf("Starting transaction load (%v workers)...", workerPoolSize))
+	if testnet.LoadProfile != nil && testnet.LoadProfile.Overloaded {
+		logger.Info("load", "msg", log.NewLazySprintf("Load profile %q is expected to overload the network (peak %v tx/s)",
+			testnet.LoadProfile.Name, testnet.LoadProfile.PeakRate()))
+	}
 	started := time.Now()
 	u := [16]byte(uuid.New()) // generate run ID on startup
 
 	txCh := make(chan types.Tx)
 	go loadGenerate(ctx, txCh, testnet, u[:])
 
-	for _, n := range testnet.Nodes {
-		if n.SendNoLoad {
-			continue
+	// Nodes pull transactions at the same pace, so they receive load in
+	// proportion to their number of connections, which is scaled by their
+	// share of the load, see e2e.ManifestNode.LoadWeight.
+	shares := testnet.LoadShares()
+	for n, share := range shares {
+		connections := int(math.Round(float64(testnet.LoadTxConnections) * share * float64(len(shares))))
+		if connections == 0 && testnet.LoadTxConnections > 0 {
+			connections = 1
 		}
-
-		for w := 0; w < testnet.LoadTxConnections; w++ {
+		for w := 0; w < connections; w++ {
 			go loadProcess(ctx, txCh, chSuccess, n)
 		}
 	}
@@ -65,10 +75,13 @@ func Load(ctx context.Context, testnet *e2e.Testnet) error {
 	}
 }
 
-// loadGenerate generates jobs until the context is canceled
+// loadGenerate generates jobs until the context is canceled. Every second, it
+// generates a batch of the size given by the testnet's load profile, if any,
+// or of LoadTxBatchSize otherwise.
 func loadGenerate(ctx context.Context, txCh chan<- types.Tx, testnet *e2e.Testnet, id []byte) {
 	t := time.NewTimer(0)
 	defer t.Stop()
+	started := time.Now()
 	for {
 		select {
 		case <-t.C:
@@ -82,8 +95,12 @@ func loadGenerate(ctx context.Context, txCh chan<- types.Tx, testnet *e2e.Testne
 		// function out. If createTxBatch has not completed its work by the time
 		// the next batch is set to be sent out, then the context is canceled so that
 		// the current batch is halted, allowing the next batch to begin.
+		batchSize := testnet.LoadTxBatchSize
+		if testnet.LoadProfile != nil {
+			batchSize = testnet.LoadProfile.RateAt(time.Since(started))
+		}
 		tctx, cf := context.WithTimeout(ctx, time.Second)
-		createTxBatch(tctx, txCh, testnet, id)
+		createTxBatch(tctx, txCh, testnet, id, batchSize)
 		cf()
 	}
 }
@@ -91,7 +108,11 @@ func loadGenerate(ctx context.Context, txCh chan<- types.Tx, testnet *e2e.Testne
 // createTxBatch creates new transactions and sends them into the txCh. createTxBatch
 // returns when either a full batch has been sent to the txCh or the context
 // is canceled.
-func createTxBatch(ctx context.Context, txCh chan<- types.Tx, testnet *e2e.Testnet, id []byte) {
+func createTxBatch(ctx context.Context, txCh chan<- types.Tx, testnet *e2e.Testnet, id []byte, batchSize int) {
+	txSizes := []int{testnet.LoadTxSizeBytes}
+	if testnet.LoadProfile != nil && len(testnet.LoadProfile.TxSizes) > 0 {
+		txSizes = testnet.LoadProfile.TxSizes
+	}
 	wg := &sync.WaitGroup{}
 	genCh := make(chan struct{})
 	for i := 0; i < workerPoolSize; i++ {
@@ -101,8 +122,8 @@ func createTxBatch(ctx context.Context, txCh chan<- types.Tx, testnet *e2e.Testn
 			for range genCh {
 				tx, err := payload.NewBytes(&payload.Payload{
 					Id:          id,
-					Size:        uint64(testnet.LoadTxSizeBytes),
-					Rate:        uint64(testnet.LoadTxBatchSize),
+					Size:        uint64(txSizes[rand.Intn(len(txSizes))]), //nolint:gosec
+					Rate:        uint64(batchSize),
 					Connections: uint64(testnet.LoadTxConnections),
 				})
 				if err != nil {
@@ -117,7 +138,7 @@ func createTxBatch(ctx context.Context, txCh chan<- types.Tx, testnet *e2e.Testn
 			}
 		}()
 	}
-	for i := 0; i < testnet.LoadTxBatchSize; i++ {
+	for i := 0; i < batchSize; i++ {
 		select {
 		case genCh <- struct{}{}:
 		case <-ctx.Done():
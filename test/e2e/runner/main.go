@@ -86,6 +86,9 @@ func NewCLI() *CLI {
 			}
 
 			cli.testnet = testnet
+			for _, warning := range testnet.Warnings() {
+				logger.Info("load", "msg", "Warning: "+warning)
+			}
 			switch inft {
 			case "docker":
 				cli.infp = &docker.Provider{
@@ -127,6 +130,59 @@ func NewCLI() *CLI {
 				chLoadResult <- err
 			}()
 
+			// Misbehaviors are injected concurrently with starting the
+			// testnet, since they must happen at specific heights.
+			chMisbehaviorResult := make(chan error, 1)
+			if cli.testnet.HasMisbehaviors() {
+				go func() {
+					chMisbehaviorResult <- InjectMisbehaviors(ctx, cli.testnet)
+				}()
+			} else {
+				chMisbehaviorResult <- nil
+			}
+
+			// The coordinated upgrade, if any, also happens concurrently with
+			// starting the testnet, but must be done before perturbing it.
+			chUpgradeResult := make(chan error, 1)
+			if cli.testnet.UpgradeHeight > 0 {
+				go func() {
+					chUpgradeResult <- UpgradeNetwork(ctx, cli.testnet)
+				}()
+			} else {
+				chUpgradeResult <- nil
+			}
+
+			// So does the archive blackout, if any, which must be over
+			// before perturbing the testnet, since it kills archive nodes.
+			chBlackoutResult := make(chan error, 1)
+			if cli.testnet.ArchiveBlackoutHeight > 0 {
+				go func() {
+					chBlackoutResult <- ArchiveBlackout(ctx, cli.testnet)
+				}()
+			} else {
+				chBlackoutResult <- nil
+			}
+
+			// And so does the global restart, if any.
+			chRestartResult := make(chan error, 1)
+			if cli.testnet.GlobalRestartHeight > 0 {
+				go func() {
+					chRestartResult <- RestartNetwork(ctx, cli.testnet)
+				}()
+			} else {
+				chRestartResult <- nil
+			}
+
+			// And so do key rotations, if any.
+			chRotateResult := make(chan error, 1)
+			if cli.testnet.HasKeyRotations() {
+				go func() {
+					chRotateResult <- RotateKeys(ctx, cli.testnet)
+				}()
+			} else {
+				chRotateResult <- nil
+			}
+
 			if err := Start(cmd.Context(), cli.testnet, cli.infp); err != nil {
 				return err
 			}
@@ -135,6 +191,19 @@ func NewCLI() *CLI {
 				return err
 			}
 
+			if err := <-chUpgradeResult; err != nil {
+				return err
+			}
+			if err := <-chBlackoutResult; err != nil {
+				return err
+			}
+			if err := <-chRestartResult; err != nil {
+				return err
+			}
+			if err := <-chRotateResult; err != nil {
+				return err
+			}
+
 			if cli.testnet.HasPerturbations() {
 				if err := Perturb(cmd.Context(), cli.testnet, cli.infp); err != nil {
 					return err
@@ -153,6 +222,17 @@ func NewCLI() *CLI {
 				}
 			}
 
+			if err := <-chMisbehaviorResult; err != nil {
+				return err
+			}
+
+			// Metrics are checked while the testnet is still under load.
+			if len(cli.testnet.MetricThresholds) > 0 {
+				if err := CheckMetrics(cmd.Context(), cli.testnet); err != nil {
+					return err
+				}
+			}
+
 			loadCancel()
 			if err := <-chLoadResult; err != nil {
 				return err
@@ -261,6 +341,14 @@ func NewCLI() *CLI {
 		},
 	})
 
+	cli.root.AddCommand(&cobra.Command{
+		Use:   "check-metrics",
+		Short: "Checks the metrics of a running testnet against the thresholds of its manifest",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return CheckMetrics(cmd.Context(), cli.testnet)
+		},
+	})
+
 	cli.root.AddCommand(&cobra.Command{
 		Use:   "test",
 		Short: "Runs test cases against a running testnet",
@@ -353,6 +441,10 @@ Does not run any perturbations.
 func (cli *CLI) Run() {
 	if err := cli.root.Execute(); err != nil {
 		logger.Error(err.Error())
+		if cli.testnet != nil && cli.testnet.GeneratorVersion != "" {
+			logger.Error("Testnet was generated; rerun the generator with this seed to reproduce it",
+				"seed", cli.testnet.GeneratorSeed, "generator_version", cli.testnet.GeneratorVersion)
+		}
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+
+	"github.com/cometbft/cometbft/libs/log"
+	e2e "github.com/cometbft/cometbft/test/e2e/pkg"
+)
+
+// CheckMetrics scrapes the Prometheus metrics of every node exposing them, and
+// checks them against the testnet's metric thresholds, see
+// e2e.Manifest.MetricThresholds.
+func CheckMetrics(ctx context.Context, testnet *e2e.Testnet) error {
+	names := make([]string, 0, len(testnet.MetricThresholds))
+	for name := range testnet.MetricThresholds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	logger.Info("check metrics", "msg", log.NewLazySprintf("Checking %v metrics...", len(names)))
+
+	exported := map[string]bool{}
+	for _, node := range testnet.Nodes {
+		if !node.Prometheus || node.PrometheusProxyPort == 0 || node.Mode == e2e.ModeLight || node.Absent() {
+			continue
+		}
+		families, err := scrapeMetrics(ctx, node)
+		if err != nil {
+			return fmt.Errorf("scraping the metrics of node %q: %w", node.Name, err)
+		}
+		for _, name := range names {
+			family, ok := families[name]
+			if !ok {
+				continue
+			}
+			exported[name] = true
+			for _, metric := range family.GetMetric() {
+				value, ok := metricValue(family.GetType(), metric)
+				if !ok {
+					continue
+				}
+				if err := testnet.MetricThresholds[name].Check(value); err != nil {
+					return fmt.Errorf("metric %v of node %q: %w", name, node.Name, err)
+				}
+			}
+		}
+	}
+	for _, name := range names {
+		if !exported[name] {
+			return fmt.Errorf("no node exports metric %v", name)
+		}
+	}
+	logger.Info("check metrics", "msg", "All metrics within their thresholds")
+	return nil
+}
+
+// scrapeMetrics fetches the Prometheus metrics of a node, by metric name.
+func scrapeMetrics(ctx context.Context, node *e2e.Node) (map[string]*dto.MetricFamily, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	url := fmt.Sprintf("http://%s:%v/metrics", node.ExternalIP, node.PrometheusProxyPort)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+	var parser expfmt.TextParser
+	return parser.TextToMetricFamilies(resp.Body)
+}
+
+// metricValue returns the value of a metric to check against its threshold:
+// the value of gauges and counters, and the mean of histograms and summaries,
+// which have none until they have observed a value.
+func metricValue(kind dto.MetricType, metric *dto.Metric) (float64, bool) {
+	switch kind {
+	case dto.MetricType_GAUGE:
+		return metric.GetGauge().GetValue(), true
+	case dto.MetricType_COUNTER:
+		return metric.GetCounter().GetValue(), true
+	case dto.MetricType_UNTYPED:
+		return metric.GetUntyped().GetValue(), true
+	case dto.MetricType_HISTOGRAM:
+		h := metric.GetHistogram()
+		if h.GetSampleCount() == 0 {
+			return 0, false
+		}
+		return h.GetSampleSum() / float64(h.GetSampleCount()), true
+	case dto.MetricType_SUMMARY:
+		s := metric.GetSummary()
+		if s.GetSampleCount() == 0 {
+			return 0, false
+		}
+		return s.GetSampleSum() / float64(s.GetSampleCount()), true
+	default:
+		return 0, false
+	}
+}
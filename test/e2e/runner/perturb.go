@@ -1,8 +1,10 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"path/filepath"
 	"time"
 
 	"github.com/cometbft/cometbft/libs/log"
@@ -12,6 +14,27 @@ import (
 	"github.com/cometbft/cometbft/test/e2e/pkg/infra/docker"
 )
 
+// perturbationClockSkew is added to a node's clock skew during a skew
+// perturbation.
+const perturbationClockSkew = 3 * time.Second
+
+// corruptDBRecoveryTimeout is how long a node has to catch up with the network
+// again after a corrupt_db perturbation.
+const corruptDBRecoveryTimeout = 3 * time.Minute
+
+// walTruncateBytes is how many bytes a wal_truncate perturbation cuts off the
+// end of a node's consensus WAL, leaving a partially written last record.
+const walTruncateBytes = 64
+
+// replayCheckTimeout is how long a reference node has to reach the height
+// whose header commits the app hash a node checks after replaying its blocks,
+// see assertReplayConsistency.
+const replayCheckTimeout = time.Minute
+
+// flapCycles is how many times a flap perturbation disconnects and reconnects
+// a node.
+const flapCycles = 3
+
 // Perturbs a running testnet.
 func Perturb(ctx context.Context, testnet *e2e.Testnet, ifp infra.Provider) error {
 	for _, node := range testnet.Nodes {
@@ -61,6 +84,13 @@ func PerturbNode(ctx context.Context, node *e2e.Node, perturbation e2e.Perturbat
 			return nil, err
 		}
 
+	case e2e.PerturbationFlap:
+		logger.Info("perturb node", "msg", log.NewLazySprintf("Flapping node %v every %v blocks...",
+			node.Name, node.FlapInterval))
+		if err := flap(ctx, node, name, ifp); err != nil {
+			return nil, err
+		}
+
 	case e2e.PerturbationPause:
 		logger.Info("perturb node", "msg", log.NewLazySprintf("Pausing node %v...", node.Name))
 		if err := docker.ExecCompose(context.Background(), testnet.Dir, "pause", name); err != nil {
@@ -77,6 +107,51 @@ func PerturbNode(ctx context.Context, node *e2e.Node, perturbation e2e.Perturbat
 			return nil, err
 		}
 
+	case e2e.PerturbationSkew:
+		skew := node.ClockSkew + perturbationClockSkew
+		logger.Info("perturb node", "msg", log.NewLazySprintf("Skewing clock of node %v by %v...", node.Name, skew))
+		if err := WriteClockSkew(node, skew); err != nil {
+			return nil, err
+		}
+		time.Sleep(10 * time.Second)
+		if err := WriteClockSkew(node, node.ClockSkew); err != nil {
+			return nil, err
+		}
+
+	case e2e.PerturbationThrottleDisk:
+		logger.Info("perturb node", "msg",
+			log.NewLazySprintf("Throttling disk of node %v to %v bytes/s...", node.Name, node.DiskBandwidth))
+		if err := ifp.ThrottleDisk(context.Background(), name, node.ExternalIP.String(), node.DiskBandwidth); err != nil {
+			return nil, err
+		}
+		time.Sleep(10 * time.Second)
+		if err := ifp.ThrottleDisk(context.Background(), name, node.ExternalIP.String(), 0); err != nil {
+			return nil, err
+		}
+
+	case e2e.PerturbationPrivvalDisconnect:
+		logger.Info("perturb node", "msg", log.NewLazySprintf("Disconnecting remote signer of node %v...", node.Name))
+		if err := WritePrivvalDisconnect(node, true); err != nil {
+			return nil, err
+		}
+		time.Sleep(10 * time.Second)
+		if err := WritePrivvalDisconnect(node, false); err != nil {
+			return nil, err
+		}
+
+	case e2e.PerturbationCorruptDB:
+		logger.Info("perturb node", "msg",
+			log.NewLazySprintf("Corrupting database of node %v, recovering with %v...", node.Name, node.RecoveryMode))
+		if err := corruptDB(ctx, node, name); err != nil {
+			return nil, err
+		}
+
+	case e2e.PerturbationWALTruncate:
+		logger.Info("perturb node", "msg", log.NewLazySprintf("Truncating consensus WAL of node %v...", node.Name))
+		if err := truncateWAL(node, name); err != nil {
+			return nil, err
+		}
+
 	case e2e.PerturbationUpgrade:
 		oldV := node.Version
 		newV := node.Testnet.UpgradeVersion
@@ -113,5 +188,157 @@ func PerturbNode(ctx context.Context, node *e2e.Node, perturbation e2e.Perturbat
 	logger.Info("perturb node",
 		"msg",
 		log.NewLazySprintf("Node %v recovered at height %v", node.Name, status.SyncInfo.LatestBlockHeight))
+	if node.AssertReplayConsistency &&
+		(perturbation == e2e.PerturbationKill || perturbation == e2e.PerturbationRestart) {
+		if err := assertReplayConsistency(ctx, node); err != nil {
+			return nil, err
+		}
+	}
 	return status, nil
 }
+
+// assertReplayConsistency checks that the application of a node which just
+// recovered from a kill or restart replayed its blocks consistently, i.e. that
+// the app hash it reports for its last block is the one the network committed
+// in the header of the next block, as fetched from another archive node.
+func assertReplayConsistency(ctx context.Context, node *e2e.Node) error {
+	client, err := node.Client()
+	if err != nil {
+		return err
+	}
+	info, err := client.ABCIInfo(ctx)
+	if err != nil {
+		return err
+	}
+	height := info.Response.LastBlockHeight
+	if height == 0 {
+		return nil
+	}
+	var reference *e2e.Node
+	for _, archive := range node.Testnet.ArchiveNodes() {
+		if archive.Name != node.Name {
+			reference = archive
+			break
+		}
+	}
+	if reference == nil {
+		return fmt.Errorf("no archive node to check the replay of node %v against", node.Name)
+	}
+	if _, err := waitForNode(ctx, reference, height+1, replayCheckTimeout); err != nil {
+		return err
+	}
+	referenceClient, err := reference.Client()
+	if err != nil {
+		return err
+	}
+	next := height + 1
+	block, err := referenceClient.Block(ctx, &next)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(block.Block.AppHash, info.Response.LastBlockAppHash) {
+		return fmt.Errorf("node %v replayed to app hash %X at height %v, but node %v committed %X",
+			node.Name, info.Response.LastBlockAppHash, height, reference.Name, block.Block.AppHash)
+	}
+	logger.Info("perturb node", "msg",
+		log.NewLazySprintf("Node %v replayed consistently up to height %v", node.Name, height))
+	return nil
+}
+
+// corruptDB destroys the databases of a node, keeping its privval state so that
+// validators don't double-sign, and restarts it to recover with its recovery
+// mode. It returns once the node has caught up with the height it had before.
+func corruptDB(ctx context.Context, node *e2e.Node, name string) error {
+	testnet := node.Testnet
+	client, err := node.Client()
+	if err != nil {
+		return err
+	}
+	status, err := client.Status(ctx)
+	if err != nil {
+		return err
+	}
+	height := status.SyncInfo.LatestBlockHeight
+
+	if node.RecoveryMode == e2e.RecoveryModeStateSync {
+		block, err := client.Block(ctx, &height)
+		if err != nil {
+			return err
+		}
+		if err := UpdateConfigStateSync(node, height, block.BlockID.Hash.Bytes()); err != nil {
+			return err
+		}
+		if err := EnableConfigStateSync(node); err != nil {
+			return err
+		}
+	}
+
+	if err := docker.ExecCompose(context.Background(), testnet.Dir, "stop", name); err != nil {
+		return err
+	}
+	// The data files are owned by root, so they're removed from within a
+	// container running as root, as in cleanupDir.
+	dataDir, err := filepath.Abs(filepath.Join(testnet.Dir, node.Name, "data"))
+	if err != nil {
+		return err
+	}
+	err = docker.Exec(context.Background(), "run", "--rm", "--entrypoint", "", "-v", fmt.Sprintf("%v:/data", dataDir),
+		"cometbft/e2e-node", "sh", "-c",
+		"find /data -mindepth 1 -maxdepth 1 ! -name '*_validator_state.json' -exec rm -rf {} +")
+	if err != nil {
+		return err
+	}
+	if err := docker.ExecCompose(context.Background(), testnet.Dir, "start", name); err != nil {
+		return err
+	}
+	_, err = waitForNode(ctx, node, height, corruptDBRecoveryTimeout)
+	return err
+}
+
+// truncateWAL kills a node, cuts off the end of its consensus WAL as if it had
+// crashed while writing to it, and restarts it, so that it repairs the WAL.
+func truncateWAL(node *e2e.Node, name string) error {
+	testnet := node.Testnet
+	if err := docker.ExecCompose(context.Background(), testnet.Dir, "kill", "-s", "SIGKILL", name); err != nil {
+		return err
+	}
+	// The data files are owned by root, so the WAL is truncated from within a
+	// container running as root, as in corruptDB.
+	dataDir, err := filepath.Abs(filepath.Join(testnet.Dir, node.Name, "data"))
+	if err != nil {
+		return err
+	}
+	err = docker.Exec(context.Background(), "run", "--rm", "--entrypoint", "", "-v", fmt.Sprintf("%v:/data", dataDir),
+		"cometbft/e2e-node", "sh", "-c",
+		fmt.Sprintf(`f=/data/cs.wal/wal; [ -f $f ] || exit 0; s=$(stat -c %%s $f); `+
+			`truncate -s $((s > %[1]d ? s - %[1]d : 0)) $f`, walTruncateBytes))
+	if err != nil {
+		return err
+	}
+	return docker.ExecCompose(context.Background(), testnet.Dir, "start", name)
+}
+
+// flap repeatedly disconnects a node from the network and reconnects it, each
+// time once the network has produced the node's flap interval of blocks.
+func flap(ctx context.Context, node *e2e.Node, name string, ifp infra.Provider) error {
+	for i := 0; i < flapCycles; i++ {
+		for _, connected := range []bool{true, false} {
+			block, _, err := waitForHeight(ctx, node.Testnet, 0)
+			if err != nil {
+				return err
+			}
+			if _, _, err := waitForHeight(ctx, node.Testnet, block.Height+node.FlapInterval); err != nil {
+				return err
+			}
+			if connected {
+				err = ifp.Disconnect(context.Background(), name, node.ExternalIP.String())
+			} else {
+				err = ifp.Reconnect(context.Background(), name, node.ExternalIP.String())
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
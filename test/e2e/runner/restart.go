@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/cometbft/cometbft/libs/log"
+	e2e "github.com/cometbft/cometbft/test/e2e/pkg"
+	"github.com/cometbft/cometbft/test/e2e/pkg/infra/docker"
+)
+
+// RestartNetwork performs the global restart of a testnet once it reaches its
+// restart height: every node is stopped at once, and then started again. It
+// returns once they have caught up.
+func RestartNetwork(ctx context.Context, testnet *e2e.Testnet) error {
+	if _, _, err := waitForHeight(ctx, testnet, testnet.GlobalRestartHeight); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(testnet.Nodes))
+	for _, node := range testnet.Nodes {
+		if !node.Absent() {
+			names = append(names, node.Name)
+		}
+	}
+	logger.Info("global restart", "msg", log.NewLazySprintf("Restarting all %v nodes at height %v...",
+		len(names), testnet.GlobalRestartHeight))
+	if err := docker.ExecCompose(ctx, testnet.Dir, append([]string{"stop"}, names...)...); err != nil {
+		return err
+	}
+	if err := docker.ExecCompose(ctx, testnet.Dir, append([]string{"start"}, names...)...); err != nil {
+		return err
+	}
+	for _, node := range testnet.Nodes {
+		if node.Mode == e2e.ModeLight || node.Absent() {
+			continue
+		}
+		if _, err := waitForNode(ctx, node, testnet.GlobalRestartHeight, time.Minute); err != nil {
+			return err
+		}
+	}
+	logger.Info("global restart", "msg", "All nodes back online")
+	return nil
+}
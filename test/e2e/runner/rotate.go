@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/cometbft/cometbft/libs/log"
+	e2e "github.com/cometbft/cometbft/test/e2e/pkg"
+	"github.com/cometbft/cometbft/test/e2e/pkg/infra/docker"
+)
+
+// RotateKeys performs the key rotations of a testnet, in height order: once
+// the validator update of a rotation is committed, the node is stopped, its
+// consensus key replaced by the rotated one, and the node started again. It
+// returns once the last rotating node has caught up.
+func RotateKeys(ctx context.Context, testnet *e2e.Testnet) error {
+	type rotation struct {
+		node   *e2e.Node
+		height int64
+	}
+	rotations := []rotation{}
+	for _, node := range testnet.Nodes {
+		for height := range node.KeyRotations {
+			rotations = append(rotations, rotation{node: node, height: height})
+		}
+	}
+	sort.Slice(rotations, func(i, j int) bool {
+		if rotations[i].height != rotations[j].height {
+			return rotations[i].height < rotations[j].height
+		}
+		return rotations[i].node.Name < rotations[j].node.Name
+	})
+
+	for _, r := range rotations {
+		// The new key joins the validator set two blocks after the update,
+		// so the node swaps keys in between.
+		if _, _, err := waitForHeight(ctx, testnet, r.height+1); err != nil {
+			return err
+		}
+		logger.Info("rotate keys", "msg", log.NewLazySprintf("Rotating the key of %v at height %v...",
+			r.node.Name, r.height))
+		if err := docker.ExecCompose(ctx, testnet.Dir, "stop", r.node.Name); err != nil {
+			return err
+		}
+		nodeDir := filepath.Join(testnet.Dir, r.node.Name)
+		key, err := os.ReadFile(filepath.Join(nodeDir, fmt.Sprintf(PrivvalRotatedKeyFile, r.height)))
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(nodeDir, PrivvalKeyFile), key, 0o600); err != nil {
+			return err
+		}
+		if err := docker.ExecCompose(ctx, testnet.Dir, "start", r.node.Name); err != nil {
+			return err
+		}
+		if _, err := waitForNode(ctx, r.node, r.height+1, time.Minute); err != nil {
+			return err
+		}
+	}
+	logger.Info("rotate keys", "msg", "All keys rotated")
+	return nil
+}
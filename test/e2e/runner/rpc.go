@@ -31,7 +31,7 @@ func waitForHeight(ctx context.Context, testnet *e2e.Testnet, height int64) (*ty
 			return nil, nil, ctx.Err()
 		case <-timer.C:
 			for _, node := range testnet.Nodes {
-				if node.Stateless() {
+				if node.Stateless() || node.Absent() {
 					continue
 				}
 				client, ok := clients[node.Name]
@@ -64,7 +64,7 @@ func waitForHeight(ctx context.Context, testnet *e2e.Testnet, height int64) (*ty
 			if len(clients) == 0 {
 				return nil, nil, errors.New("unable to connect to any network nodes")
 			}
-			if time.Since(lastIncrease) >= 20*time.Second {
+			if time.Since(lastIncrease) >= stallTimeout(testnet) {
 				if maxResult == nil {
 					return nil, nil, errors.New("chain stalled at unknown height")
 				}
@@ -116,7 +116,7 @@ func waitForAllNodes(ctx context.Context, testnet *e2e.Testnet, height int64, ti
 	deadline := time.Now().Add(timeout)
 
 	for _, node := range testnet.Nodes {
-		if node.Mode == e2e.ModeSeed {
+		if node.Mode == e2e.ModeSeed || node.Absent() {
 			continue
 		}
 
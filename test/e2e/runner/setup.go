@@ -6,9 +6,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -35,6 +37,32 @@ const (
 	PrivvalStateFile      = "data/priv_validator_state.json"
 	PrivvalDummyKeyFile   = "config/dummy_validator_key.json"
 	PrivvalDummyStateFile = "data/dummy_validator_state.json"
+
+	// PrivvalRotatedKeyFile holds the key a node rotates to at the given
+	// height, see e2e.Manifest.KeyRotations. The runner moves it to
+	// PrivvalKeyFile on rotation.
+	PrivvalRotatedKeyFile = "config/priv_validator_key.%v.json"
+
+	// ClockSkewFile holds the clock offset of a node, relative to the node
+	// directory. It is polled by the node while running.
+	ClockSkewFile = "clock_skew"
+
+	// PrivvalDisconnectFile tells whether the remote signer of a node is
+	// disconnected, relative to the node directory. It is polled by the node
+	// while running.
+	PrivvalDisconnectFile = "privval_disconnect"
+
+	// LatencyScriptFile sets up the emulated latency of a node to other nodes,
+	// relative to the node directory. It is run by the node's entrypoint.
+	LatencyScriptFile = "latency.sh"
+
+	// NATScriptFile makes a node drop inbound P2P connections, emulating a
+	// NAT, relative to the node directory. It is run by the node's entrypoint.
+	NATScriptFile = "nat.sh"
+
+	// NoWALFile marks a node running without a consensus WAL, relative to the
+	// node directory. The node's entrypoint discards the WAL when it exists.
+	NoWALFile = "no_wal"
 )
 
 // Setup sets up the testnet configuration.
@@ -88,6 +116,40 @@ func Setup(testnet *e2e.Testnet, infp infra.Provider) error {
 			return err
 		}
 
+		if node.EmulatesLatency() {
+			//nolint:gosec // G306: the script must be executable
+			err = os.WriteFile(filepath.Join(nodeDir, LatencyScriptFile), MakeLatencyScript(node), 0o755)
+			if err != nil {
+				return err
+			}
+		}
+
+		if node.BehindNAT {
+			//nolint:gosec // G306: the script must be executable
+			err = os.WriteFile(filepath.Join(nodeDir, NATScriptFile), MakeNATScript(), 0o755)
+			if err != nil {
+				return err
+			}
+		}
+
+		if !node.WALEnabled {
+			if err := os.WriteFile(filepath.Join(nodeDir, NoWALFile), nil, 0o644); err != nil { //nolint:gosec
+				return err
+			}
+		}
+
+		if node.UsesClockSkew() {
+			if err := WriteClockSkew(node, node.ClockSkew); err != nil {
+				return err
+			}
+		}
+
+		if slices.Contains(node.Perturbations, e2e.PerturbationPrivvalDisconnect) {
+			if err := WritePrivvalDisconnect(node, false); err != nil {
+				return err
+			}
+		}
+
 		if node.Mode == e2e.ModeLight {
 			// stop early if a light client
 			continue
@@ -107,6 +169,12 @@ func Setup(testnet *e2e.Testnet, infp infra.Provider) error {
 			filepath.Join(nodeDir, PrivvalKeyFile),
 			filepath.Join(nodeDir, PrivvalStateFile),
 		)).Save()
+		for height, key := range node.KeyRotations {
+			privval.NewFilePV(key,
+				filepath.Join(nodeDir, fmt.Sprintf(PrivvalRotatedKeyFile, height)),
+				filepath.Join(nodeDir, PrivvalStateFile),
+			).Key.Save()
+		}
 
 		// Set up a dummy validator. CometBFT requires a file PV even when not used, so we
 		// give it a dummy such that it will fail if it actually tries to use it.
@@ -116,7 +184,7 @@ func Setup(testnet *e2e.Testnet, infp infra.Provider) error {
 		)).Save()
 	}
 
-	if testnet.Prometheus {
+	if testnet.HasPrometheus() {
 		if err := testnet.WritePrometheusConfig(); err != nil {
 			return err
 		}
@@ -128,16 +196,27 @@ func Setup(testnet *e2e.Testnet, infp infra.Provider) error {
 // MakeGenesis generates a genesis document.
 func MakeGenesis(testnet *e2e.Testnet) (types.GenesisDoc, error) {
 	genesis := types.GenesisDoc{
-		GenesisTime:     time.Now(),
-		ChainID:         testnet.Name,
+		GenesisTime:     time.Now().Add(testnet.GenesisTimeOffset),
+		ChainID:         testnet.ChainID,
 		ConsensusParams: types.DefaultConsensusParams(),
 		InitialHeight:   testnet.InitialHeight,
 	}
+	if !testnet.GenesisTime.IsZero() {
+		genesis.GenesisTime = testnet.GenesisTime
+	}
 	// set the app version to 1
 	genesis.ConsensusParams.Version.App = 1
-	genesis.ConsensusParams.Evidence.MaxAgeNumBlocks = e2e.EvidenceAgeHeight
-	genesis.ConsensusParams.Evidence.MaxAgeDuration = e2e.EvidenceAgeTime
+	genesis.ConsensusParams.Evidence.MaxAgeNumBlocks = testnet.EvidenceMaxAgeNumBlocks
+	genesis.ConsensusParams.Evidence.MaxAgeDuration = testnet.EvidenceMaxAgeDuration
 	genesis.ConsensusParams.ABCI.VoteExtensionsEnableHeight = testnet.VoteExtensionsEnableHeight
+	genesis.ConsensusParams.Validator.PubKeyTypes = testnet.ValidatorKeyTypes()
+	if testnet.MaxBlockBytes > 0 {
+		genesis.ConsensusParams.Block.MaxBytes = testnet.MaxBlockBytes
+		genesis.ConsensusParams.Evidence.MaxBytes = e2e.MaxEvidenceBytes(testnet.MaxBlockBytes)
+	}
+	if testnet.MaxGas > 0 {
+		genesis.ConsensusParams.Block.MaxGas = testnet.MaxGas
+	}
 	for validator, power := range testnet.Validators {
 		genesis.Validators = append(genesis.Validators, types.GenesisValidator{
 			Name:    validator.Name,
@@ -169,11 +248,43 @@ func MakeConfig(node *e2e.Node) (*config.Config, error) {
 	cfg.RPC.ListenAddress = "tcp://0.0.0.0:26657"
 	cfg.RPC.PprofListenAddress = ":6060"
 	cfg.P2P.ExternalAddress = fmt.Sprintf("tcp://%v", node.AddressP2P(false))
+	switch {
+	case node.ExternalAddress != "":
+		cfg.P2P.ExternalAddress = fmt.Sprintf("tcp://%v", node.ExternalAddress)
+	case node.BehindNAT:
+		// A node behind NAT doesn't know a reachable address of its own.
+		cfg.P2P.ExternalAddress = ""
+	}
 	cfg.P2P.AddrBookStrict = false
+	if node.StartupBackoff > 0 {
+		cfg.P2P.PersistentPeersMaxDialPeriod = node.StartupBackoff
+	}
+	if node.MaxInboundPeers > 0 {
+		cfg.P2P.MaxNumInboundPeers = node.MaxInboundPeers
+	}
+	if node.MaxOutboundPeers > 0 {
+		cfg.P2P.MaxNumOutboundPeers = node.MaxOutboundPeers
+	}
+	if node.SendRate > 0 {
+		cfg.P2P.SendRate = node.SendRate
+	}
+	if node.RecvRate > 0 {
+		cfg.P2P.RecvRate = node.RecvRate
+	}
 	cfg.DBBackend = node.Database
 	cfg.StateSync.DiscoveryTime = 5 * time.Second
 	cfg.BlockSync.Version = node.BlockSyncVersion
 	cfg.Consensus.PeerGossipIntraloopSleepDuration = node.Testnet.PeerGossipIntraloopSleepDuration
+	if node.TimeoutPropose > 0 {
+		cfg.Consensus.TimeoutPropose = node.TimeoutPropose
+	}
+	if node.TimeoutCommit > 0 {
+		cfg.Consensus.TimeoutCommit = node.TimeoutCommit
+	}
+	cfg.Mempool.CacheSize = node.MempoolCacheSize
+	cfg.Mempool.Recheck = node.MempoolRecheck
+	cfg.RPC.Unsafe = node.RPCUnsafe
+	cfg.RPC.MaxSubscriptionsPerClient = node.RPCMaxSubscriptions
 
 	switch node.ABCIProtocol {
 	case e2e.ProtocolUNIX:
@@ -215,19 +326,26 @@ func MakeConfig(node *e2e.Node) (*config.Config, error) {
 		cfg.P2P.SeedMode = true
 		cfg.P2P.PexReactor = true
 	case e2e.ModeFull, e2e.ModeLight:
-		// Don't need to do anything, since we're using a dummy privval key by default.
+		// Don't need to do anything, since we're using a dummy privval key by default,
+		// except for full nodes to be promoted, which sign once they are validators.
+		if node.PromoteAt > 0 {
+			cfg.PrivValidatorKey = PrivvalKeyFile
+			cfg.PrivValidatorState = PrivvalStateFile
+		}
 	default:
 		return nil, fmt.Errorf("unexpected mode %q", node.Mode)
 	}
 
-	if node.StateSync {
-		cfg.StateSync.Enable = true
+	// Nodes recovering from a corrupt_db perturbation with state sync get
+	// their RPC servers now, and state sync is enabled when they recover.
+	if node.StateSync || node.RecoveryMode == e2e.RecoveryModeStateSync {
+		cfg.StateSync.Enable = node.StateSync
 		cfg.StateSync.RPCServers = []string{}
 		for _, peer := range node.Testnet.ArchiveNodes() {
 			if peer.Name == node.Name {
 				continue
 			}
-			cfg.StateSync.RPCServers = append(cfg.StateSync.RPCServers, peer.AddressRPC())
+			cfg.StateSync.RPCServers = append(cfg.StateSync.RPCServers, peer.AddressRPCFrom(node))
 		}
 		if len(cfg.StateSync.RPCServers) < 2 {
 			return nil, errors.New("unable to find 2 suitable state sync RPC servers")
@@ -239,14 +357,29 @@ func MakeConfig(node *e2e.Node) (*config.Config, error) {
 		if len(cfg.P2P.Seeds) > 0 {
 			cfg.P2P.Seeds += ","
 		}
-		cfg.P2P.Seeds += seed.AddressP2P(true)
+		cfg.P2P.Seeds += seed.AddressP2PFrom(node, true)
 	}
+	if node.TrustPeriod > 0 {
+		cfg.StateSync.TrustPeriod = node.TrustPeriod
+	}
+
+	// Light clients use their first persistent peer as the primary and the
+	// remaining ones, followed by any witnesses, as witnesses.
 	cfg.P2P.PersistentPeers = ""
-	for _, peer := range node.PersistentPeers {
+	for _, peer := range append(append([]*e2e.Node{}, node.PersistentPeers...), node.Witnesses...) {
 		if len(cfg.P2P.PersistentPeers) > 0 {
 			cfg.P2P.PersistentPeers += ","
 		}
-		cfg.P2P.PersistentPeers += peer.AddressP2P(true)
+		cfg.P2P.PersistentPeers += peer.AddressP2PFrom(node, true)
+	}
+
+	// Validators with sentries only connect to them, and their sentries don't
+	// gossip their address to the rest of the network.
+	if node.SentryFor != nil {
+		cfg.P2P.PrivatePeerIDs = string(p2p.PubKeyToID(node.SentryFor.NodeKey.PubKey()))
+	}
+	if len(node.Testnet.Sentries(node)) > 0 {
+		cfg.P2P.PexReactor = false
 	}
 
 	if node.Prometheus {
@@ -259,21 +392,26 @@ func MakeConfig(node *e2e.Node) (*config.Config, error) {
 // MakeAppConfig generates an ABCI application config for a node.
 func MakeAppConfig(node *e2e.Node) ([]byte, error) {
 	cfg := map[string]interface{}{
-		"chain_id":               node.Testnet.Name,
-		"dir":                    "data/app",
-		"listen":                 AppAddressUNIX,
-		"mode":                   node.Mode,
-		"protocol":               "socket",
-		"persist_interval":       node.PersistInterval,
-		"snapshot_interval":      node.SnapshotInterval,
-		"retain_blocks":          node.RetainBlocks,
-		"key_type":               node.PrivvalKey.Type(),
-		"prepare_proposal_delay": node.Testnet.PrepareProposalDelay,
-		"process_proposal_delay": node.Testnet.ProcessProposalDelay,
-		"check_tx_delay":         node.Testnet.CheckTxDelay,
-		"vote_extension_delay":   node.Testnet.VoteExtensionDelay,
-		"finalize_block_delay":   node.Testnet.FinalizeBlockDelay,
-		"vote_extension_size":    node.Testnet.VoteExtensionSize,
+		"chain_id":                node.Testnet.ChainID,
+		"dir":                     "data/app",
+		"listen":                  AppAddressUNIX,
+		"mode":                    node.Mode,
+		"protocol":                "socket",
+		"persist_interval":        node.PersistInterval,
+		"snapshot_interval":       node.SnapshotInterval,
+		"snapshot_format":         node.SnapshotFormat,
+		"snapshot_chunk_size":     node.SnapshotChunkSize,
+		"retain_blocks":           node.RetainBlocks,
+		"key_type":                node.PrivvalKey.Type(),
+		"prepare_proposal_delay":  node.Testnet.PrepareProposalDelay,
+		"process_proposal_delay":  node.Testnet.ProcessProposalDelay,
+		"check_tx_delay":          node.Testnet.CheckTxDelay,
+		"vote_extension_delay":    node.VoteExtensionDelay,
+		"finalize_block_delay":    node.Testnet.FinalizeBlockDelay,
+		"prepare_proposal_jitter": node.Testnet.PrepareProposalJitter,
+		"process_proposal_jitter": node.Testnet.ProcessProposalJitter,
+		"jitter_seed":             jitterSeed(node.Name),
+		"vote_extension_size":     node.Testnet.VoteExtensionSize,
 	}
 	switch node.ABCIProtocol {
 	case e2e.ProtocolUNIX:
@@ -305,16 +443,37 @@ func MakeAppConfig(node *e2e.Node) ([]byte, error) {
 		}
 	}
 
+	if node.UsesClockSkew() {
+		cfg["clock_skew_file"] = ClockSkewFile
+	}
+	if slices.Contains(node.Perturbations, e2e.PerturbationPrivvalDisconnect) {
+		cfg["privval_disconnect_file"] = PrivvalDisconnectFile
+	}
+
+	if len(node.AppConfig) > 0 {
+		cfg["app_config"] = node.AppConfig
+	}
+
 	if len(node.Testnet.ValidatorUpdates) > 0 {
 		validatorUpdates := map[string]map[string]int64{}
+		validatorKeyTypes := map[string]string{}
 		for height, validators := range node.Testnet.ValidatorUpdates {
 			updateVals := map[string]int64{}
 			for node, power := range validators {
-				updateVals[base64.StdEncoding.EncodeToString(node.PrivvalKey.PubKey().Bytes())] = power
+				// A key rotation replaces the previous key of the validator.
+				if _, ok := node.KeyRotations[height]; ok {
+					previous := node.PrivvalKeyAt(height - 1)
+					updateVals[base64.StdEncoding.EncodeToString(previous.PubKey().Bytes())] = 0
+				}
+				key := node.PrivvalKeyAt(height)
+				pubKey := base64.StdEncoding.EncodeToString(key.PubKey().Bytes())
+				updateVals[pubKey] = power
+				validatorKeyTypes[pubKey] = key.Type()
 			}
 			validatorUpdates[fmt.Sprintf("%v", height)] = updateVals
 		}
 		cfg["validator_update"] = validatorUpdates
+		cfg["validator_key_types"] = validatorKeyTypes
 	}
 
 	var buf bytes.Buffer
@@ -339,3 +498,111 @@ func UpdateConfigStateSync(node *e2e.Node, height int64, hash []byte) error {
 	bz = regexp.MustCompile(`(?m)^trust_hash =.*`).ReplaceAll(bz, []byte(fmt.Sprintf(`trust_hash = "%X"`, hash)))
 	return os.WriteFile(cfgPath, bz, 0o644) //nolint:gosec
 }
+
+// EnableConfigStateSync enables state sync in the config of a node, so that it
+// restores a snapshot the next time it starts with an empty state.
+func EnableConfigStateSync(node *e2e.Node) error {
+	cfgPath := filepath.Join(node.Testnet.Dir, node.Name, "config", "config.toml")
+	bz, err := os.ReadFile(cfgPath)
+	if err != nil {
+		return err
+	}
+	bz = regexp.MustCompile(`(?ms)^(\[statesync\]\n.*?)^enable = false`).ReplaceAll(bz, []byte(`${1}enable = true`))
+	return os.WriteFile(cfgPath, bz, 0o644) //nolint:gosec
+}
+
+// jitterSeed derives the seed of a node's ABCI delay jitter from its name, so
+// that the delays are the same in every run of the testnet.
+func jitterSeed(name string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// WriteClockSkew sets the clock offset of a node, which takes effect within a
+// second if the node is running.
+func WriteClockSkew(node *e2e.Node, skew time.Duration) error {
+	path := filepath.Join(node.Testnet.Dir, node.Name, ClockSkewFile)
+	return os.WriteFile(path, []byte(skew.String()+"\n"), 0o644) //nolint:gosec
+}
+
+// WritePrivvalDisconnect disconnects the remote signer of a node, or lets it
+// reconnect, which takes effect within a second if the node is running.
+func WritePrivvalDisconnect(node *e2e.Node, disconnected bool) error {
+	state := "connected"
+	if disconnected {
+		state = "disconnected"
+	}
+	path := filepath.Join(node.Testnet.Dir, node.Name, PrivvalDisconnectFile)
+	return os.WriteFile(path, []byte(state+"\n"), 0o644) //nolint:gosec
+}
+
+// MakeNATScript generates a shell script that drops new inbound connections to
+// the P2P port, while letting the node dial out to its peers.
+func MakeNATScript() []byte {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\nset -e\n")
+	for _, cmd := range []string{"iptables", "ip6tables"} {
+		fmt.Fprintf(&b, "%s -A INPUT -p tcp --dport 26656 -m conntrack --ctstate NEW -j DROP\n", cmd)
+	}
+	return []byte(b.String())
+}
+
+// MakeLatencyScript generates a shell script that emulates the latency from a
+// node to the nodes in each zone, using one netem qdisc per zone, and to the
+// peers its degraded links lead to, using one netem qdisc per link, see
+// e2e.Manifest.LinkLatencies. The filters of links take precedence over the
+// ones of zones.
+func MakeLatencyScript(node *e2e.Node) []byte {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\nset -e\n")
+	b.WriteString("tc qdisc add dev eth0 root handle 1: htb default 1\n")
+	b.WriteString("tc class add dev eth0 parent 1: classid 1:1 htb rate 10gbit\n")
+	class := 1
+	for _, link := range node.OutgoingLinkLatencies() {
+		class++
+		peer := node.Testnet.LookupNode(link.To)
+		netem := fmt.Sprintf("delay %dms", (node.Testnet.ZoneLatencies[node.Zone][peer.Zone] + link.Delay).Milliseconds())
+		if link.Jitter > 0 {
+			netem += fmt.Sprintf(" %dms", link.Jitter.Milliseconds())
+		}
+		if link.Loss > 0 {
+			netem += fmt.Sprintf(" loss %v%%", link.Loss)
+		}
+		writeLatencyClass(&b, class, netem, []*e2e.Node{peer}, 1)
+	}
+	if node.Zone == "" {
+		return []byte(b.String())
+	}
+	for _, zone := range node.Testnet.Zones() {
+		class++
+		latency := node.Testnet.ZoneLatencies[node.Zone][zone]
+		peers := []*e2e.Node{}
+		for _, peer := range node.Testnet.Nodes {
+			if peer.Zone == zone && peer.Name != node.Name {
+				peers = append(peers, peer)
+			}
+		}
+		writeLatencyClass(&b, class, fmt.Sprintf("delay %dms", latency.Milliseconds()), peers, 2)
+	}
+	return []byte(b.String())
+}
+
+// writeLatencyClass writes the tc commands setting up a netem qdisc with the
+// given parameters, and the filters routing the packets to the given peers
+// through it with the given priority, where lower numbers go first.
+func writeLatencyClass(b *strings.Builder, class int, netem string, peers []*e2e.Node, prio int) {
+	fmt.Fprintf(b, "tc class add dev eth0 parent 1: classid 1:%d htb rate 10gbit\n", class)
+	fmt.Fprintf(b, "tc qdisc add dev eth0 parent 1:%d handle %d: netem %v\n", class, class*10, netem)
+	for _, peer := range peers {
+		for _, ip := range peer.IPs() {
+			if ip.To4() != nil {
+				fmt.Fprintf(b, "tc filter add dev eth0 parent 1: protocol ip prio %d u32 match ip dst %v/32 flowid 1:%d\n",
+					prio, ip, class)
+			} else {
+				fmt.Fprintf(b, "tc filter add dev eth0 parent 1: protocol ipv6 prio %d u32 match ip6 dst %v/128 flowid 1:%d\n",
+					prio, ip, class)
+			}
+		}
+	}
+}
@@ -2,13 +2,16 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"path/filepath"
 	"sort"
 	"time"
 
 	"github.com/cometbft/cometbft/libs/log"
 	e2e "github.com/cometbft/cometbft/test/e2e/pkg"
 	"github.com/cometbft/cometbft/test/e2e/pkg/infra"
+	"github.com/cometbft/cometbft/types"
 )
 
 func Start(ctx context.Context, testnet *e2e.Testnet, p infra.Provider) error {
@@ -36,10 +39,32 @@ func Start(ctx context.Context, testnet *e2e.Testnet, p infra.Provider) error {
 		return nodeQueue[i].StartAt < nodeQueue[j].StartAt
 	})
 
-	if nodeQueue[0].StartAt > 0 {
+	// Absent validators sort first, and are never started.
+	for len(nodeQueue) > 0 && nodeQueue[0].Absent() {
+		nodeQueue = nodeQueue[1:]
+	}
+	if len(nodeQueue) == 0 || nodeQueue[0].StartAt > 0 {
 		return fmt.Errorf("no initial nodes in testnet")
 	}
 
+	// The first block SLA is measured from the start of the initial nodes,
+	// or from the genesis time if it is later, so that waiting for genesis
+	// doesn't count towards it.
+	genesis, err := genesisTime(testnet)
+	if err != nil {
+		return err
+	}
+	firstBlockCtx := ctx
+	if testnet.ExpectedFirstBlockBy > 0 {
+		start := time.Now()
+		if genesis.After(start) {
+			start = genesis
+		}
+		var cancel context.CancelFunc
+		firstBlockCtx, cancel = context.WithDeadline(ctx, start.Add(testnet.ExpectedFirstBlockBy))
+		defer cancel()
+	}
+
 	// Start initial nodes (StartAt: 0)
 	logger.Info("Starting initial network nodes...")
 	nodesAtZero := make([]*e2e.Node, 0)
@@ -47,12 +72,21 @@ func Start(ctx context.Context, testnet *e2e.Testnet, p infra.Provider) error {
 		nodesAtZero = append(nodesAtZero, nodeQueue[0])
 		nodeQueue = nodeQueue[1:]
 	}
-	err := p.StartNodes(context.Background(), nodesAtZero...)
+	err = p.StartNodes(context.Background(), nodesAtZero...)
 	if err != nil {
 		return err
 	}
+	// Nodes only serve RPC once the genesis time is due.
+	startupTimeout := 15 * time.Second
+	if wait := time.Until(genesis); wait > 0 {
+		logger.Info("start", "msg", log.NewLazySprintf("Waiting %v for the genesis time", wait.Round(time.Second)))
+		startupTimeout += wait
+	}
 	for _, node := range nodesAtZero {
-		if _, err := waitForNode(ctx, node, 0, 15*time.Second); err != nil {
+		if _, err := waitForNode(firstBlockCtx, node, 0, startupTimeout); err != nil {
+			return missedSLA(firstBlockCtx, err, "expected_first_block_by", testnet.ExpectedFirstBlockBy)
+		}
+		if err := waitForPeers(firstBlockCtx, node); err != nil {
 			return err
 		}
 		if node.PrometheusProxyPort > 0 {
@@ -79,17 +113,27 @@ func Start(ctx context.Context, testnet *e2e.Testnet, p infra.Provider) error {
 	// Wait for initial height
 	logger.Info("Waiting for initial height",
 		"height", networkHeight,
-		"nodes", len(testnet.Nodes)-len(nodeQueue),
+		"nodes", len(nodesAtZero),
 		"pending", len(nodeQueue))
 
-	block, blockID, err := waitForHeight(ctx, testnet, networkHeight)
+	block, blockID, err := waitForHeight(firstBlockCtx, testnet, networkHeight)
 	if err != nil {
-		return err
+		return missedSLA(firstBlockCtx, err, "expected_first_block_by", testnet.ExpectedFirstBlockBy)
+	}
+
+	// The catch-up SLA is measured from the first block.
+	if testnet.ExpectedCatchUpBy > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, testnet.ExpectedCatchUpBy)
+		defer cancel()
 	}
 
-	// Update any state sync nodes with a trusted height and hash
+	// Update any state sync nodes with a trusted height and hash. Light
+	// clients with a specific trust height, and state sync nodes bootstrapping
+	// from the testnet's snapshot, are updated right before starting, since
+	// their trusted block may not exist yet.
 	for _, node := range nodeQueue {
-		if node.StateSync || node.Mode == e2e.ModeLight {
+		if (node.StateSync && testnet.SnapshotHeight == 0) || (node.Mode == e2e.ModeLight && node.TrustHeight == 0) {
 			err = UpdateConfigStateSync(node, block.Height, blockID.Hash.Bytes())
 			if err != nil {
 				return err
@@ -113,6 +157,22 @@ func Start(ctx context.Context, testnet *e2e.Testnet, p infra.Provider) error {
 				"height", networkHeight)
 
 			if _, _, err := waitForHeight(ctx, testnet, networkHeight); err != nil {
+				return missedSLA(ctx, err, "expected_catch_up_by", testnet.ExpectedCatchUpBy)
+			}
+		}
+
+		if node.Mode == e2e.ModeLight && node.TrustHeight != 0 {
+			if err := updateTrustedBlock(ctx, testnet, node, node.TrustHeight); err != nil {
+				return err
+			}
+		}
+		if node.StateSync && testnet.SnapshotHeight != 0 {
+			if len(testnet.SnapshotHash) > 0 {
+				err = UpdateConfigStateSync(node, testnet.SnapshotHeight, testnet.SnapshotHash)
+			} else {
+				err = updateTrustedBlock(ctx, testnet, node, testnet.SnapshotHeight)
+			}
+			if err != nil {
 				return err
 			}
 		}
@@ -123,8 +183,12 @@ func Start(ctx context.Context, testnet *e2e.Testnet, p infra.Provider) error {
 		if err != nil {
 			return err
 		}
-		status, err := waitForNode(ctx, node, node.StartAt, 3*time.Minute)
+		// Catching up stalls while the archive nodes are offline.
+		status, err := waitForNode(ctx, node, node.StartAt, 3*time.Minute+testnet.ArchiveBlackoutDuration)
 		if err != nil {
+			return missedSLA(ctx, err, "expected_catch_up_by", testnet.ExpectedCatchUpBy)
+		}
+		if err := waitForPeers(ctx, node); err != nil {
 			return err
 		}
 		logger.Info("start", "msg", log.NewLazySprintf("Node %v up on http://%s:%v at height %v",
@@ -133,3 +197,74 @@ func Start(ctx context.Context, testnet *e2e.Testnet, p infra.Provider) error {
 
 	return nil
 }
+
+// waitForPeers waits for a node with max_dial_retries to connect to a peer,
+// checking once every startup_backoff, see e2e.ManifestNode.MaxDialRetries.
+// Other nodes aren't checked.
+func waitForPeers(ctx context.Context, node *e2e.Node) error {
+	if node.MaxDialRetries == 0 {
+		return nil
+	}
+	client, err := node.Client()
+	if err != nil {
+		return err
+	}
+	for retries := 0; ; retries++ {
+		netInfo, err := client.NetInfo(ctx)
+		if err == nil && netInfo.NPeers > 0 {
+			return nil
+		}
+		if retries == node.MaxDialRetries {
+			return fmt.Errorf("node %v connected to no peer after %v dial retries", node.Name, retries)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(node.StartupBackoff):
+		}
+	}
+}
+
+// missedSLA names the startup SLA in the error of a wait cut short by its
+// deadline, and returns other errors as they are.
+func missedSLA(ctx context.Context, err error, sla string, d time.Duration) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("testnet missed its %v SLA of %v: %w", sla, d, err)
+	}
+	return err
+}
+
+// updateTrustedBlock sets the trusted block of a light client or state
+// syncing node to the block at the given height, as reported by an archive
+// node.
+func updateTrustedBlock(ctx context.Context, testnet *e2e.Testnet, node *e2e.Node, height int64) error {
+	archiveNodes := testnet.ArchiveNodes()
+	if len(archiveNodes) == 0 {
+		return fmt.Errorf("no archive node to fetch the trusted block of %v from", node.Name)
+	}
+	client, err := archiveNodes[0].Client()
+	if err != nil {
+		return err
+	}
+	result, err := client.Block(ctx, &height)
+	if err != nil {
+		return fmt.Errorf("failed to fetch trusted block %v for %v: %w", height, node.Name, err)
+	}
+	return UpdateConfigStateSync(node, height, result.BlockID.Hash.Bytes())
+}
+
+// genesisTime returns the genesis time the testnet was set up with, which may
+// be relative to the time of the setup, see e2e.Manifest.GenesisTimeOffset.
+func genesisTime(testnet *e2e.Testnet) (time.Time, error) {
+	for _, node := range testnet.Nodes {
+		if node.Mode == e2e.ModeLight {
+			continue
+		}
+		genesis, err := types.GenesisDocFromFile(filepath.Join(testnet.Dir, node.Name, "config", "genesis.json"))
+		if err != nil {
+			return time.Time{}, err
+		}
+		return genesis.GenesisTime, nil
+	}
+	return time.Time{}, errors.New("no validators nor full nodes in testnet")
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/cometbft/cometbft/libs/log"
+	e2e "github.com/cometbft/cometbft/test/e2e/pkg"
+	"github.com/cometbft/cometbft/test/e2e/pkg/infra/docker"
+)
+
+// UpgradeNetwork performs the coordinated upgrade of a testnet once it reaches
+// its upgrade height: every node not running the upgrade version is stopped,
+// and then started again with the upgrade version.
+func UpgradeNetwork(ctx context.Context, testnet *e2e.Testnet) error {
+	if _, _, err := waitForHeight(ctx, testnet, testnet.UpgradeHeight); err != nil {
+		return err
+	}
+	names := []string{}
+	for _, node := range testnet.Nodes {
+		if node.Version != testnet.UpgradeVersion && !node.Absent() {
+			names = append(names, node.Name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	logger.Info("upgrade", "msg", log.NewLazySprintf("Upgrading %v nodes to version '%v' at height %v...",
+		len(names), testnet.UpgradeVersion, testnet.UpgradeHeight))
+	if err := docker.ExecCompose(ctx, testnet.Dir, append([]string{"stop"}, names...)...); err != nil {
+		return err
+	}
+	upgraded := make([]string, 0, len(names))
+	for _, name := range names {
+		upgraded = append(upgraded, name+"_u")
+	}
+	if err := docker.ExecCompose(ctx, testnet.Dir, append([]string{"up", "-d"}, upgraded...)...); err != nil {
+		return err
+	}
+	for _, node := range testnet.Nodes {
+		if node.Version == testnet.UpgradeVersion || node.Mode == e2e.ModeLight || node.Absent() {
+			continue
+		}
+		if _, err := waitForNode(ctx, node, testnet.UpgradeHeight, time.Minute); err != nil {
+			return err
+		}
+	}
+	return nil
+}
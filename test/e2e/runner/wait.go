@@ -21,15 +21,32 @@ func Wait(ctx context.Context, testnet *e2e.Testnet, blocks int64) error {
 // WaitUntil waits until a given height has been reached.
 func WaitUntil(ctx context.Context, testnet *e2e.Testnet, height int64) error {
 	logger.Info("wait until", "msg", log.NewLazySprintf("Waiting for all nodes to reach height %v...", height))
-	_, err := waitForAllNodes(ctx, testnet, height, waitingTime(len(testnet.Nodes), height))
+	_, err := waitForAllNodes(ctx, testnet, height, waitingTime(testnet, height))
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// throttledGossipSlowdown is how many times longer the runner waits for
+// testnets with throttled gossip, see e2e.Manifest.ThrottledGossip.
+const throttledGossipSlowdown = 4
+
 // waitingTime estimates how long it should take for a node to reach the height.
 // More nodes in a network implies we may expect a slower network and may have to wait longer.
-func waitingTime(nodes int, height int64) time.Duration {
-	return time.Duration(20+(int64(nodes)*height)) * time.Second
+func waitingTime(testnet *e2e.Testnet, height int64) time.Duration {
+	waiting := time.Duration(20+(int64(len(testnet.Nodes))*height)) * time.Second
+	if testnet.ThrottledGossip {
+		waiting *= throttledGossipSlowdown
+	}
+	return waiting
+}
+
+// stallTimeout returns how long the network may go without committing a block
+// before it is considered stalled.
+func stallTimeout(testnet *e2e.Testnet) time.Duration {
+	if testnet.ThrottledGossip {
+		return throttledGossipSlowdown * 20 * time.Second
+	}
+	return 20 * time.Second
 }
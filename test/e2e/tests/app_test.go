@@ -33,6 +33,31 @@ func TestApp_InitialState(t *testing.T) {
 	})
 }
 
+// Tests that the block at the initial height has the app hash the manifest
+// expects the app to return from InitChain.
+func TestApp_InitialAppHash(t *testing.T) {
+	testNode(t, func(t *testing.T, node e2e.Node) {
+		if len(node.Testnet.ExpectedInitialAppHash) == 0 {
+			return
+		}
+		// Only nodes that have the block at the initial height can be checked.
+		if node.Mode == e2e.ModeLight || node.StateSync || node.RetainBlocks > 0 ||
+			node.RecoveryMode == e2e.RecoveryModeStateSync {
+			return
+		}
+
+		client, err := node.Client()
+		require.NoError(t, err)
+		height := node.Testnet.InitialHeight
+		block, err := client.Block(ctx, &height)
+		require.NoError(t, err)
+		assert.Equal(t,
+			fmt.Sprintf("%X", node.Testnet.ExpectedInitialAppHash),
+			block.Block.AppHash.String(),
+			"initial app hash does not match the expected hash")
+	})
+}
+
 // Tests that the app hash (as reported by the app) matches the last
 // block and the node sync status.
 func TestApp_Hash(t *testing.T) {
@@ -66,6 +91,7 @@ func TestApp_Hash(t *testing.T) {
 // Tests that we can set a value and retrieve it.
 func TestApp_Tx(t *testing.T) {
 	testNode(t, func(t *testing.T, node e2e.Node) {
+		skipUnlessKVStore(t, node)
 		client, err := node.Client()
 		require.NoError(t, err)
 
@@ -107,6 +133,7 @@ func TestApp_Tx(t *testing.T) {
 
 func TestApp_VoteExtensions(t *testing.T) {
 	testNode(t, func(t *testing.T, node e2e.Node) {
+		skipUnlessKVStore(t, node)
 		client, err := node.Client()
 		require.NoError(t, err)
 		info, err := client.ABCIInfo(ctx)
@@ -129,3 +156,12 @@ func TestApp_VoteExtensions(t *testing.T) {
 		}
 	})
 }
+
+// skipUnlessKVStore skips tests relying on the state of the kvstore app, which
+// other applications don't share.
+func skipUnlessKVStore(t *testing.T, node e2e.Node) {
+	t.Helper()
+	if node.Testnet.ABCIApp != e2e.ABCIAppKVStore {
+		t.Skipf("testnet runs the %q app", node.Testnet.ABCIApp)
+	}
+}
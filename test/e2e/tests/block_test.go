@@ -1,12 +1,16 @@
 package e2e_test
 
 import (
+	"bytes"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	e2e "github.com/cometbft/cometbft/test/e2e/pkg"
+	"github.com/cometbft/cometbft/types"
 )
 
 // Tests that block headers are identical across nodes where present.
@@ -63,7 +67,7 @@ func TestBlock_Range(t *testing.T) {
 		last := status.SyncInfo.LatestBlockHeight
 
 		switch {
-		case node.StateSync:
+		case node.StateSync || node.RecoveryMode == e2e.RecoveryModeStateSync:
 			assert.Greater(t, first, node.Testnet.InitialHeight,
 				"state synced nodes should not contain network's initial height")
 
@@ -93,3 +97,37 @@ func TestBlock_Range(t *testing.T) {
 		}
 	})
 }
+
+// Tests that validators with a skewed clock sign their votes with skewed
+// timestamps, as seen in the commits of later blocks. Only clocks running
+// ahead are checked, since vote timestamps never precede the voted block.
+func TestBlock_ClockSkew(t *testing.T) {
+	blocks := fetchBlockChain(t)
+	testNode(t, func(t *testing.T, node e2e.Node) {
+		if node.Mode != e2e.ModeValidator || node.ClockSkew < time.Second {
+			return
+		}
+		offsets := []time.Duration{}
+		for _, block := range blocks {
+			if block.LastCommit == nil {
+				continue
+			}
+			// Validator sets reflect validator updates, and key rotations,
+			// from two blocks earlier.
+			address := node.PrivvalKeyAt(block.LastCommit.Height - 2).PubKey().Address()
+			// The block time is the median of the commit's vote timestamps.
+			for _, sig := range block.LastCommit.Signatures {
+				if sig.BlockIDFlag == types.BlockIDFlagCommit && bytes.Equal(sig.ValidatorAddress, address) {
+					offsets = append(offsets, sig.Timestamp.Sub(block.Time))
+				}
+			}
+		}
+		if len(offsets) == 0 {
+			t.Skip("validator did not sign any commits")
+		}
+		sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+		median := offsets[len(offsets)/2]
+		require.Greater(t, median, node.ClockSkew/2,
+			"median vote timestamp offset %v does not reflect clock skew %v", median, node.ClockSkew)
+	})
+}
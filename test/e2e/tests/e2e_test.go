@@ -50,7 +50,7 @@ func testNode(t *testing.T, testFunc func(*testing.T, e2e.Node)) {
 	}
 
 	for _, node := range nodes {
-		if node.Stateless() {
+		if node.Stateless() || node.Absent() {
 			continue
 		}
 
@@ -1,9 +1,14 @@
 package e2e_test
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+
+	cmtproto "github.com/cometbft/cometbft/proto/tendermint/types"
+	e2e "github.com/cometbft/cometbft/test/e2e/pkg"
+	"github.com/cometbft/cometbft/types"
 )
 
 // assert that all nodes that have blocks at the height of a misbehavior has evidence
@@ -17,6 +22,39 @@ func TestEvidence_Misbehavior(t *testing.T) {
 			seenEvidence += len(block.Evidence.Evidence)
 		}
 	}
-	require.Equal(t, testnet.Evidence, seenEvidence,
+	// Every misbehavior of a validator results in one piece of evidence, on
+	// top of the evidence injected by the runner.
+	expectedEvidence := testnet.Evidence
+	for _, node := range testnet.Nodes {
+		expectedEvidence += len(node.Misbehaviors)
+	}
+	require.Equal(t, expectedEvidence, seenEvidence,
 		"difference between the amount of evidence produced and committed")
 }
+
+// Tests that every misbehavior set in the manifest is committed as duplicate
+// vote evidence of the corresponding vote type.
+func TestEvidence_Misbehaviors(t *testing.T) {
+	blocks := fetchBlockChain(t)
+	testnet := loadTestnet(t)
+	for _, node := range testnet.Nodes {
+		for height, misbehavior := range node.Misbehaviors {
+			voteType := cmtproto.PrevoteType
+			if misbehavior == e2e.MisbehaviorDoublePrecommit {
+				voteType = cmtproto.PrecommitType
+			}
+			address := node.PrivvalKey.PubKey().Address()
+			found := false
+			for _, block := range blocks {
+				for _, ev := range block.Evidence.Evidence {
+					dve, ok := ev.(*types.DuplicateVoteEvidence)
+					if ok && dve.VoteA.Height == height && dve.VoteA.Type == voteType &&
+						bytes.Equal(dve.VoteA.ValidatorAddress, address) {
+						found = true
+					}
+				}
+			}
+			require.True(t, found, "no %v evidence committed for %v at height %v", misbehavior, node.Name, height)
+		}
+	}
+}
@@ -52,20 +52,21 @@ func TestValidator_Sets(t *testing.T) {
 	})
 }
 
-// Tests that a validator proposes blocks when it's supposed to. It tolerates some
-// missed blocks, e.g. due to testnet perturbations.
+// Tests that a validator proposes blocks when it's supposed to, including full
+// nodes once they are promoted to validators. It tolerates some missed blocks,
+// e.g. due to testnet perturbations.
 func TestValidator_Propose(t *testing.T) {
 	blocks := fetchBlockChain(t)
 	testNode(t, func(t *testing.T, node e2e.Node) {
-		if node.Mode != e2e.ModeValidator {
+		if node.Mode != e2e.ModeValidator && node.PromoteAt == 0 {
 			return
 		}
-		address := node.PrivvalKey.PubKey().Address()
 		valSchedule := newValidatorSchedule(*node.Testnet)
 
 		expectCount := 0
 		proposeCount := 0
 		for _, block := range blocks {
+			address := valSchedule.Address(node)
 			if bytes.Equal(valSchedule.Set.Proposer.Address, address) {
 				expectCount++
 				if bytes.Equal(block.ProposerAddress, address) {
@@ -83,20 +84,22 @@ func TestValidator_Propose(t *testing.T) {
 	})
 }
 
-// Tests that a validator signs blocks when it's supposed to. It tolerates some
-// missed blocks, e.g. due to testnet perturbations.
+// Tests that a validator signs blocks when it's supposed to, and only then,
+// including full nodes, which begin signing once they are promoted to
+// validators. It tolerates some missed blocks, e.g. due to testnet
+// perturbations.
 func TestValidator_Sign(t *testing.T) {
 	blocks := fetchBlockChain(t)
 	testNode(t, func(t *testing.T, node e2e.Node) {
-		if node.Mode != e2e.ModeValidator {
+		if node.Mode != e2e.ModeValidator && node.PromoteAt == 0 {
 			return
 		}
-		address := node.PrivvalKey.PubKey().Address()
 		valSchedule := newValidatorSchedule(*node.Testnet)
 
 		expectCount := 0
 		signCount := 0
 		for _, block := range blocks[1:] { // Skip first block, since it has no signatures
+			address := valSchedule.Address(node)
 			signed := false
 			for _, sig := range block.LastCommit.Signatures {
 				if bytes.Equal(sig.ValidatorAddress, address) {
@@ -123,6 +126,70 @@ func TestValidator_Sign(t *testing.T) {
 	})
 }
 
+// Tests that absent validators, which the runner never starts, never sign a
+// block.
+func TestValidator_Absent(t *testing.T) {
+	blocks := fetchBlockChain(t)
+	testnet := loadTestnet(t)
+	for _, node := range testnet.Nodes {
+		if !node.Absent() {
+			continue
+		}
+		address := node.PrivvalKey.PubKey().Address()
+		for _, block := range blocks[1:] {
+			for _, sig := range block.LastCommit.Signatures {
+				require.False(t, bytes.Equal(sig.ValidatorAddress, address),
+					"absent validator %v signed block %v", node.Name, block.LastCommit.Height)
+			}
+		}
+	}
+}
+
+// Tests that validators of equal voting power take turns proposing blocks, in
+// testnets asserting proposer fairness. Only the blocks committed once the
+// last validator update took effect count, and every validator must propose
+// between half and twice its share of them, which tolerates the rounds lost to
+// perturbations.
+func TestValidator_ProposerFairness(t *testing.T) {
+	testnet := loadTestnet(t)
+	if !testnet.AssertProposerFairness {
+		return
+	}
+	blocks := fetchBlockChain(t)
+	valSchedule := newValidatorSchedule(testnet)
+
+	// Validator updates only take effect two blocks after they're returned.
+	from := testnet.InitialHeight
+	for height := range testnet.ValidatorUpdates {
+		from = max(from, height+2)
+	}
+	validators := testnet.ValidatorPowersAt(from)
+	proposed := map[*e2e.Node]int{}
+	counted := 0
+	for _, block := range blocks {
+		if block.Height >= from {
+			counted++
+			for node := range validators {
+				if bytes.Equal(block.ProposerAddress, valSchedule.Address(*node)) {
+					proposed[node]++
+				}
+			}
+		}
+		valSchedule.Increment(1)
+	}
+	if counted < 4*len(validators) {
+		t.Skipf("only %v blocks after the last validator update, too few for %v validators", counted, len(validators))
+	}
+
+	share := float64(counted) / float64(len(validators))
+	for node := range validators {
+		require.GreaterOrEqual(t, float64(proposed[node]), share/2,
+			"validator %v proposed %v of %v blocks", node.Name, proposed[node], counted)
+		require.LessOrEqual(t, float64(proposed[node]), 2*share,
+			"validator %v proposed %v of %v blocks", node.Name, proposed[node], counted)
+	}
+}
+
 // validatorSchedule is a validator set iterator, which takes into account
 // validator set updates.
 type validatorSchedule struct {
@@ -150,7 +217,7 @@ func (s *validatorSchedule) Increment(heights int64) {
 			// validator set updates are offset by 2, since they only take effect
 			// two blocks after they're returned.
 			if update, ok := s.updates[s.height-2]; ok {
-				if err := s.Set.UpdateWithChangeSet(makeVals(update)); err != nil {
+				if err := s.Set.UpdateWithChangeSet(makeUpdate(update, s.height-2)); err != nil {
 					panic(err)
 				}
 			}
@@ -159,6 +226,25 @@ func (s *validatorSchedule) Increment(heights int64) {
 	}
 }
 
+// Address returns the address of a validator in the current validator set,
+// which changes with its key rotations.
+func (s *validatorSchedule) Address(node e2e.Node) []byte {
+	return node.PrivvalKeyAt(s.height - 2).PubKey().Address()
+}
+
+// makeUpdate returns the changes of a validator update at the given height,
+// where a key rotation removes the previous key of its validator.
+func makeUpdate(valMap map[*e2e.Node]int64, height int64) []*types.Validator {
+	vals := make([]*types.Validator, 0, len(valMap))
+	for node, power := range valMap {
+		if _, ok := node.KeyRotations[height]; ok {
+			vals = append(vals, types.NewValidator(node.PrivvalKeyAt(height-1).PubKey(), 0))
+		}
+		vals = append(vals, types.NewValidator(node.PrivvalKeyAt(height).PubKey(), power))
+	}
+	return vals
+}
+
 func makeVals(valMap map[*e2e.Node]int64) []*types.Validator {
 	vals := make([]*types.Validator, 0, len(valMap))
 	for node, power := range valMap {